@@ -159,6 +159,9 @@ PrivateTmp=true
 ProtectSystem=strict
 ProtectHome=true
 ReadWritePaths=/var/lib/sreootb /var/log/sreootb
+CapabilityBoundingSet=CAP_NET_RAW
+# Raw ICMP sockets for ping monitors when unprivileged ones are disabled
+AmbientCapabilities=CAP_NET_RAW
 
 # Resource limits
 LimitNOFILE=65536
@@ -202,6 +202,77 @@ server:
   
   # Authentication
   admin_api_key: "%s"               # Admin API key for web GUI access (generated)
+
+  # User accounts and sessions
+  auth:
+    session_duration: "24h"         # Lifetime of a regular login session
+    remember_me_duration: "720h"    # Lifetime of a "remember me" session
+    session_cleanup_interval: "1h"  # How often expired sessions are purged
+    allow_registration: false       # Allow self-service sign-up after the first account exists
+    setup_token: ""                 # Required to register the first account, which becomes admin (the admin API key
+                                    # also works; generated and logged at startup if empty)
+    encryption_key: ""              # 64 hex chars; encrypts TOTP secrets at rest (generated into encryption.key if empty;
+                                    # must be identical on every server sharing a CockroachDB cluster)
+    oidc:                           # OpenID Connect single sign-on (authorization code flow with PKCE)
+      enabled: false
+      name: "Single sign-on"        # Login button label
+      issuer_url: ""                # e.g. https://idp.example.com/realms/main
+      client_id: ""
+      client_secret: ""             # Leave empty for a public client
+      redirect_url: ""              # Defaults to <email.base_url>/api/auth/oidc/callback; one of them is required
+      scopes: ["openid", "email", "profile"]
+      groups_claim: "groups"        # ID token / userinfo claim listing the user's groups
+      role_mappings:                # IdP group -> viewer, editor or admin; the most privileged match wins
+        # - group: "sre-admins"
+        #   role: "admin"
+      default_role: "viewer"        # Role when no group matches; empty denies access
+      auto_provision: true          # Create accounts on first SSO login
+      sync_roles: true              # Re-apply group mappings on every SSO login (never demotes the last admin)
+
+  # Outgoing email (password resets, verification)
+  email:
+    enabled: false                  # When false, emails are only logged
+    provider: "console"             # console (print to stdout) or smtp
+    from: "SREootb <noreply@example.com>"
+    base_url: ""                    # Public web GUI URL used for links in emails (e.g. https://monitor.example.com);
+                                    # required for password reset
+    template_dir: ""                # Optional overrides: verification|password_reset|welcome .txt/.html
+    smtp:
+      host: ""
+      port: 587
+      username: ""
+      password: ""
+      tls_mode: "starttls"          # starttls, tls (implicit, usually port 465) or none
+      auth_method: ""               # plain, login, or empty to pick automatically
+      timeout: "30s"
+  
+  # Audit log of mutating actions and logins
+  audit:
+    retention: "2160h"              # How long audit events are kept (90 days; "0" keeps them forever)
+    cleanup_interval: "1h"          # How often expired audit events are purged
+  
+  # Rate limiting and login brute-force protection (limits are per client IP; 0 disables a limit)
+  rate_limit:
+    enabled: true
+    window: "1m"                    # Sliding window for the request limits below
+    web_requests: 600               # Requests per IP per window on the web GUI port
+    agent_requests: 1200            # Requests per IP per window on the agent port
+    auth_window: "1m"               # Sliding window for login/registration/password reset limits
+    auth_ip_requests: 20            # Auth requests per IP per auth window
+    auth_account_requests: 10       # Login attempts per account per auth window
+    max_failures: 5                 # Failed logins (or invalid agent keys) before a temporary lockout
+    failure_window: "15m"           # Window in which failures are counted
+    lockout_duration: "1m"          # First lockout; doubles for each repeated lockout
+    max_lockout_duration: "1h"      # Upper bound for lockout backoff
+  
+  # Reverse proxies allowed to report the client IP in X-Forwarded-For / X-Real-IP (IPs or CIDRs,
+  # e.g. ["127.0.0.1", "10.0.0.0/8"]); these headers are ignored from every other client
+  trusted_proxies: []
+
+  # SQLite files that sqlite:// sites may open, as absolute paths. Probe queries
+  # can read any table, so list only files editors may see; the server's own
+  # database is always refused. Empty disables sqlite:// monitoring.
+  sqlite_monitors: []
   
   # General server settings
   min_scan_interval: "10s"          # Minimum allowed scan interval
@@ -273,7 +344,9 @@ PrivateTmp=true
 ProtectSystem=strict
 ProtectHome=true
 ReadWritePaths=/var/lib/sreootb /var/log/sreootb
-CapabilityBoundingSet=CAP_NET_BIND_SERVICE
+CapabilityBoundingSet=CAP_NET_BIND_SERVICE CAP_NET_RAW
+# Raw ICMP sockets for ping monitors when unprivileged ones are disabled
+AmbientCapabilities=CAP_NET_RAW
 
 # Resource limits
 LimitNOFILE=65536
@@ -320,6 +320,28 @@ func createStandaloneConfig(cmd *cobra.Command) (*config.Config, error) {
 			MaxScanInterval: maxScanInterval,
 			DevMode:         devMode,
 			AccentColor:     accentColor,
+			Auth: config.AuthConfig{
+				SessionDuration:        24 * time.Hour, // Default values
+				RememberMeDuration:     30 * 24 * time.Hour,
+				SessionCleanupInterval: time.Hour,
+			},
+			Audit: config.AuditConfig{
+				Retention:       90 * 24 * time.Hour,
+				CleanupInterval: time.Hour,
+			},
+			RateLimit: config.RateLimitConfig{
+				Enabled:             true,
+				Window:              time.Minute,
+				WebRequests:         600,
+				AgentRequests:       1200,
+				AuthWindow:          time.Minute,
+				AuthIPRequests:      20,
+				AuthAccountRequests: 10,
+				MaxFailures:         5,
+				FailureWindow:       15 * time.Minute,
+				LockoutDuration:     time.Minute,
+				MaxLockoutDuration:  time.Hour,
+			},
 		},
 		Agent: config.AgentConfig{
 			ServerURL:     agentServerURL, // Connect to agent API server, not web GUI
@@ -526,7 +548,9 @@ PrivateTmp=true
 ProtectSystem=strict
 ProtectHome=true
 ReadWritePaths=/var/lib/sreootb /var/log/sreootb
-CapabilityBoundingSet=CAP_NET_BIND_SERVICE
+CapabilityBoundingSet=CAP_NET_BIND_SERVICE CAP_NET_RAW
+# Raw ICMP sockets for ping monitors when unprivileged ones are disabled
+AmbientCapabilities=CAP_NET_RAW
 
 # Resource limits
 LimitNOFILE=65536
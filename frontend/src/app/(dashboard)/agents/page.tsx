@@ -1,7 +1,7 @@
 'use client';
 
 import { useState, useEffect } from 'react';
-import { getSitesStatus } from '@/lib/api';
+import { getSitesStatus, apiRequest } from '@/lib/api';
 import { type SiteStatus } from '@/lib/api';
 import { Card, CardContent, CardDescription, CardHeader, CardTitle } from '@/components/ui/card';
 import { Button } from '@/components/ui/button';
@@ -49,7 +49,7 @@ export default function AgentsPage() {
     try {
       setLoading(true);
       setError(null);
-      const response = await fetch('/api/agents');
+      const response = await apiRequest('/api/agents');
       if (!response.ok) {
         throw new Error('Failed to fetch agents');
       }
@@ -66,7 +66,7 @@ export default function AgentsPage() {
 
   const fetchServerAPIKey = async () => {
     try {
-      const response = await fetch('/api/agents/api-key');
+      const response = await apiRequest('/api/agents/api-key');
       if (response.ok) {
         const data = await response.json();
         setServerAPIKey(data.api_key);
@@ -85,7 +85,7 @@ export default function AgentsPage() {
 
     try {
       setDeletingAgent(agentId);
-      const response = await fetch(`/api/agents/${agentId}`, {
+      const response = await apiRequest(`/api/agents/${agentId}`, {
         method: 'DELETE',
       });
 
@@ -15,6 +15,7 @@ import { Input } from "@/components/ui/input"
 import { Label } from "@/components/ui/label"
 import { Plus, AlertCircle, CheckCircle, Copy, Eye, EyeOff, Info, RefreshCw, Users, UserPlus } from "lucide-react"
 import { useAuth } from "@/context/AuthContext"
+import { apiRequest } from "@/lib/api"
 
 interface AddAgentDialogProps {
   onAgentAdded?: () => void
@@ -58,7 +59,7 @@ export function AddAgentDialog({ onAgentAdded }: AddAgentDialogProps) {
 
   const fetchServerInfo = async () => {
     try {
-      const response = await fetch("/api/agents/api-key")
+      const response = await apiRequest("/api/agents/api-key")
       if (response.ok) {
         const data = await response.json()
         setBootstrapAPIKey(data.api_key)
@@ -105,7 +106,7 @@ export function AddAgentDialog({ onAgentAdded }: AddAgentDialogProps) {
     setError(null)
 
     try {
-      const response = await fetch("/api/agents", {
+      const response = await apiRequest("/api/agents", {
         method: "POST",
         headers: {
           "Content-Type": "application/json",
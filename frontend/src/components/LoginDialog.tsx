@@ -1,6 +1,6 @@
 'use client';
 
-import { useState } from 'react';
+import { useEffect, useState } from 'react';
 import { useAuth } from '@/context/AuthContext';
 import { Button } from '@/components/ui/button';
 import { Input } from '@/components/ui/input';
@@ -21,9 +21,44 @@ interface LoginDialogProps {
 
 export function LoginDialog({ open, onOpenChange }: LoginDialogProps) {
   const [apiKey, setApiKey] = useState('');
+  const [code, setCode] = useState('');
   const [error, setError] = useState('');
   const [isLoading, setIsLoading] = useState(false);
-  const { login } = useAuth();
+  const [sso, setSso] = useState<{ name?: string; login_url?: string } | null>(null);
+  const { login, ssoChallenge, completeSsoLogin } = useAuth();
+
+  useEffect(() => {
+    if (!open) return;
+    fetch('/api/auth/oidc')
+      .then((res) => (res.ok ? res.json() : null))
+      .then((info) => setSso(info?.enabled ? info : null))
+      .catch(() => setSso(null));
+  }, [open]);
+
+  const handleSso = () => {
+    if (!sso?.login_url) return;
+    const redirect = window.location.pathname + window.location.search;
+    window.location.href = `${sso.login_url}?redirect=${encodeURIComponent(redirect)}`;
+  };
+
+  const handleSsoCode = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError('');
+    setIsLoading(true);
+
+    try {
+      if (await completeSsoLogin(code.trim())) {
+        setCode('');
+        onOpenChange(false);
+      } else {
+        setError('Invalid code, or the sign-in has expired. Please try again.');
+      }
+    } catch (err) {
+      setError('An unexpected error occurred. Please try again.');
+    } finally {
+      setIsLoading(false);
+    }
+  };
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -44,6 +79,59 @@ export function LoginDialog({ open, onOpenChange }: LoginDialogProps) {
     }
   };
 
+  if (ssoChallenge) {
+    return (
+      <Dialog open={open} onOpenChange={onOpenChange}>
+        <DialogContent className="sm:max-w-[425px]">
+          <DialogHeader>
+            <DialogTitle className="flex items-center">
+              <span className="mr-2">
+                <Key size={20} />
+              </span>
+              Two-Factor Authentication
+            </DialogTitle>
+            <DialogDescription>
+              Enter the code from your authenticator app, or one of your backup codes.
+            </DialogDescription>
+          </DialogHeader>
+          <form onSubmit={handleSsoCode} className="space-y-4">
+            <div className="space-y-2">
+              <label htmlFor="totp-code" className="text-sm font-medium">
+                Code
+              </label>
+              <Input
+                id="totp-code"
+                autoComplete="one-time-code"
+                placeholder="123456"
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+                disabled={isLoading}
+              />
+            </div>
+            {error && (
+              <div className="text-sm text-red-600 bg-red-50 p-2 rounded">
+                {error}
+              </div>
+            )}
+            <DialogFooter>
+              <Button
+                type="button"
+                variant="outline"
+                onClick={() => onOpenChange(false)}
+                disabled={isLoading}
+              >
+                Cancel
+              </Button>
+              <Button type="submit" disabled={isLoading}>
+                {isLoading ? 'Verifying...' : 'Verify'}
+              </Button>
+            </DialogFooter>
+          </form>
+        </DialogContent>
+      </Dialog>
+    );
+  }
+
   return (
     <Dialog open={open} onOpenChange={onOpenChange}>
       <DialogContent className="sm:max-w-[425px]">
@@ -78,6 +166,11 @@ export function LoginDialog({ open, onOpenChange }: LoginDialogProps) {
             </div>
           )}
           <DialogFooter>
+            {sso && (
+              <Button type="button" variant="outline" onClick={handleSso} disabled={isLoading}>
+                Sign in with {sso.name || 'SSO'}
+              </Button>
+            )}
             <Button
               type="button"
               variant="outline"
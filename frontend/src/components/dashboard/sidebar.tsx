@@ -2,7 +2,7 @@
 
 import Link from "next/link";
 import { usePathname } from "next/navigation";
-import { useState } from "react";
+import { useEffect, useState } from "react";
 import { cn } from "@/lib/utils";
 import { 
   Activity, 
@@ -93,9 +93,14 @@ interface SidebarProps {}
 export function Sidebar({}: SidebarProps) {
   const pathname = usePathname();
   const [expandedItems, setExpandedItems] = useState<Set<string>>(new Set());
-  const { isAuthenticated, logout } = useAuth();
+  const { isAuthenticated, logout, ssoChallenge } = useAuth();
   const [showLoginDialog, setShowLoginDialog] = useState(false);
 
+  // Single sign-on for an account with 2FA returns here to ask for the code
+  useEffect(() => {
+    if (ssoChallenge) setShowLoginDialog(true);
+  }, [ssoChallenge]);
+
   const toggleExpanded = (itemName: string) => {
     const newExpanded = new Set(expandedItems);
     if (newExpanded.has(itemName)) {
@@ -5,8 +5,11 @@ import React, { createContext, useContext, useState, useEffect, ReactNode } from
 interface AuthContextType {
   isAuthenticated: boolean;
   apiKey: string | null;
+  sessionToken: string | null;
   isLoading: boolean;
+  ssoChallenge: string | null;
   login: (key: string) => Promise<boolean>;
+  completeSsoLogin: (code: string) => Promise<boolean>;
   logout: () => void;
 }
 
@@ -14,9 +17,31 @@ const AuthContext = createContext<AuthContextType | undefined>(undefined);
 
 export function AuthProvider({ children }: { children: ReactNode }) {
   const [apiKey, setApiKey] = useState<string | null>(null);
+  const [sessionToken, setSessionToken] = useState<string | null>(null);
   const [isLoading, setIsLoading] = useState(true);
+  const [ssoChallenge, setSsoChallenge] = useState<string | null>(null);
 
   useEffect(() => {
+    // Single sign-on redirects back with the session token in the URL fragment;
+    // store it and strip it from the address bar and history
+    const fragment = new URLSearchParams(window.location.hash.slice(1));
+    // Accounts with 2FA enabled get a challenge to answer with a code instead
+    const ssoToken = fragment.get('session_token');
+    const challenge = fragment.get('sso_challenge');
+    if (ssoToken) {
+      localStorage.setItem('sessionToken', ssoToken);
+    }
+    if (challenge) {
+      setSsoChallenge(challenge);
+    }
+    if (ssoToken || challenge) {
+      window.history.replaceState(null, '', window.location.pathname + window.location.search);
+    }
+    const storedSession = localStorage.getItem('sessionToken');
+    if (storedSession) {
+      setSessionToken(storedSession);
+    }
+
     // Check for API key in local storage on initial load
     const storedKey = localStorage.getItem('apiKey');
     if (storedKey) {
@@ -44,7 +69,34 @@ export function AuthProvider({ children }: { children: ReactNode }) {
     return false;
   };
 
+  const completeSsoLogin = async (code: string): Promise<boolean> => {
+    const response = await fetch('/api/auth/oidc/2fa', {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify({ challenge: ssoChallenge, totp_code: code }),
+    });
+    if (!response.ok) {
+      // An expired challenge cannot be answered; the user has to sign in again
+      if (response.status === 400) setSsoChallenge(null);
+      return false;
+    }
+    const { session_token: token } = await response.json();
+    localStorage.setItem('sessionToken', token);
+    setSessionToken(token);
+    setSsoChallenge(null);
+    return true;
+  };
+
   const logout = () => {
+    if (sessionToken) {
+      // End the server-side session; the local state is cleared regardless
+      fetch('/api/auth/logout', {
+        method: 'POST',
+        headers: { Authorization: `Bearer ${sessionToken}` },
+      }).catch(() => {});
+    }
+    setSessionToken(null);
+    localStorage.removeItem('sessionToken');
     setApiKey(null);
     localStorage.removeItem('apiKey');
     // Clear the cookie
@@ -52,10 +104,13 @@ export function AuthProvider({ children }: { children: ReactNode }) {
   };
 
   const value = {
-    isAuthenticated: !!apiKey,
+    isAuthenticated: !!apiKey || !!sessionToken,
     apiKey,
+    sessionToken,
     isLoading,
+    ssoChallenge,
     login,
+    completeSsoLogin,
     logout,
   };
 
@@ -16,10 +16,24 @@ function createFetchError(originalError: string, context?: string): Error {
   return new Error(message);
 }
 
+// Attach the stored admin API key, or the session token from single sign-on,
+// so authenticated API routes accept the request
+function withAuth(options?: RequestInit): RequestInit {
+  const headers = new Headers(options?.headers);
+  const apiKey = typeof window !== 'undefined' ? localStorage.getItem('apiKey') : null;
+  const sessionToken = typeof window !== 'undefined' ? localStorage.getItem('sessionToken') : null;
+  if (apiKey && !headers.has('X-API-Key')) {
+    headers.set('X-API-Key', apiKey);
+  } else if (sessionToken && !headers.has('X-API-Key') && !headers.has('Authorization')) {
+    headers.set('Authorization', `Bearer ${sessionToken}`);
+  }
+  return { ...options, headers };
+}
+
 // Helper function for making API requests with better error handling
-async function apiRequest(url: string, options?: RequestInit): Promise<Response> {
+export async function apiRequest(url: string, options?: RequestInit): Promise<Response> {
   try {
-    const response = await fetch(url, options);
+    const response = await fetch(url, withAuth(options));
     return response;
   } catch (error) {
     // Network error (server not running, connection refused, etc.)
@@ -50,6 +64,8 @@ export interface SiteStatus {
   total_up: number;
   total_down: number;
   scan_interval?: string;
+  paused?: boolean;
+  paused_at?: string;
   // Security and agent information
   connection_type?: 'agent' | 'resource' | 'controller';
   agent_port?: string;
@@ -161,6 +177,17 @@ export async function deleteSite(siteId: number): Promise<{ message: string }> {
   return response.json();
 }
 
+export async function setSitePaused(siteId: number, paused: boolean): Promise<{ message: string }> {
+  const response = await apiRequest(`${API_BASE}/sites/${siteId}/${paused ? 'pause' : 'resume'}`, {
+    method: 'POST',
+  });
+  if (!response.ok) {
+    const errorText = await response.text();
+    throw new Error(errorText || 'Failed to update site');
+  }
+  return response.json();
+}
+
 export async function getSiteHistory(siteId: number, limit = 100): Promise<SiteCheck[]> {
   const response = await apiRequest(`${API_BASE}/sites/${siteId}/history?limit=${limit}`);
   if (!response.ok) throw new Error('Failed to fetch site history');
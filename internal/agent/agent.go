@@ -11,7 +11,6 @@ import (
 	"net/http"
 	"net/url"
 	"os"
-	"os/exec"
 	"os/signal"
 	"regexp"
 	"runtime"
@@ -26,6 +25,7 @@ import (
 
 	"github.com/x86txt/sreootb/internal/config"
 	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
 )
 
 // Agent represents the monitoring agent instance
@@ -819,6 +819,15 @@ func (a *Agent) updateTaskSchedulers(tasks []models.MonitorTask) {
 		}
 	}
 
+	// Restart schedulers whose task definition changed, e.g. after a site was edited
+	for taskID, scheduler := range a.taskSchedulers {
+		if task := currentTasks[taskID]; !sameTask(scheduler.task, task) {
+			log.Debug().Int("task_id", taskID).Str("monitor_type", task.MonitorType).Str("url", task.URL).Msg("Restarting scheduler for updated task")
+			scheduler.Stop()
+			delete(a.taskSchedulers, taskID)
+		}
+	}
+
 	// Start schedulers for new tasks
 	for taskID, task := range currentTasks {
 		if _, exists := a.taskSchedulers[taskID]; !exists {
@@ -830,6 +839,13 @@ func (a *Agent) updateTaskSchedulers(tasks []models.MonitorTask) {
 	}
 }
 
+// sameTask reports whether two task definitions are identical
+func sameTask(a, b models.MonitorTask) bool {
+	aJSON, errA := json.Marshal(a)
+	bJSON, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(aJSON, bJSON)
+}
+
 // stopAllTaskSchedulers stops all running task schedulers
 func (a *Agent) stopAllTaskSchedulers() {
 	a.schedulersMutex.Lock()
@@ -940,6 +956,20 @@ func (ts *TaskScheduler) executeTask() {
 		result = ts.executePingCheck(timeout)
 	case "log":
 		result = ts.executeLogCheck(timeout)
+	case "tcp":
+		result = ts.executeTCPCheck(timeout)
+	case "dns":
+		result = ts.executeDNSCheck(timeout)
+	case "transaction":
+		result = ts.executeTransactionCheck(timeout)
+	case "grpc":
+		result = ts.executeGRPCCheck(timeout)
+	case "smtp", "imap":
+		result = ts.executeMailCheck(timeout)
+	case "websocket":
+		result = ts.executeWebSocketCheck(timeout)
+	case "postgres", "sqlite":
+		result = ts.executeDatabaseCheck(timeout)
 	default:
 		log.Error().Int("task_id", ts.task.ID).Str("monitor_type", ts.task.MonitorType).Msg("Unknown monitor type")
 		result.Status = "error"
@@ -963,15 +993,13 @@ func (ts *TaskScheduler) executeHTTPCheck(timeout time.Duration) models.MonitorR
 		CheckedAt: time.Now(),
 	}
 
-	start := time.Now()
+	httpConfig := ts.task.HTTPConfig()
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout:   timeout,
-		Transport: ts.agent.httpClient.Transport, // Use same TLS config as agent
-	}
+	// Create HTTP client with the task's redirect and IP settings. It does not
+	// share the agent's transport so insecure_tls never skips site certificate checks.
+	client := utils.NewHTTPCheckClient(httpConfig, nil, timeout)
 
-	req, err := http.NewRequest("GET", ts.task.URL, nil)
+	req, err := utils.NewHTTPCheckRequest(context.Background(), httpConfig, ts.task.URL, ts.agent.config.Agent.UserAgent)
 	if err != nil {
 		result.Status = "error"
 		errorMsg := fmt.Sprintf("Failed to create request: %v", err)
@@ -979,8 +1007,7 @@ func (ts *TaskScheduler) executeHTTPCheck(timeout time.Duration) models.MonitorR
 		return result
 	}
 
-	req.Header.Set("User-Agent", ts.agent.config.Agent.UserAgent)
-
+	start := time.Now()
 	resp, err := client.Do(req)
 	duration := time.Since(start)
 	responseTime := float64(duration.Nanoseconds()) / 1e6 // Convert to milliseconds
@@ -990,14 +1017,18 @@ func (ts *TaskScheduler) executeHTTPCheck(timeout time.Duration) models.MonitorR
 		result.Status = "down"
 		errorMsg := fmt.Sprintf("HTTP request failed: %v", err)
 		result.ErrorMessage = &errorMsg
+		if inspection := utils.InspectTLSError(err); inspection != nil {
+			result.Metadata = map[string]interface{}{"tls": inspection}
+			errorMsg = "TLS: " + strings.Join(inspection.Problems, "; ")
+		}
 		return result
 	}
 	defer resp.Body.Close()
 
 	result.StatusCode = &resp.StatusCode
 
-	// Check if response indicates success
-	if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+	// Check if response status is one the site accepts
+	if httpConfig.AcceptsStatus(resp.StatusCode) {
 		result.Status = "up"
 	} else {
 		result.Status = "down"
@@ -1011,47 +1042,356 @@ func (ts *TaskScheduler) executeHTTPCheck(timeout time.Duration) models.MonitorR
 		"headers":        resp.Header,
 	}
 
+	hasAssertions := httpConfig != nil && len(httpConfig.Assertions) > 0
+	contentConfig := ts.task.ContentChangeConfig()
+	if hasAssertions || contentConfig != nil {
+		body, size, err := utils.ReadAssertionBody(resp.Body)
+		if err != nil {
+			if result.Status == "up" {
+				result.Status = "down"
+				errorMsg := fmt.Sprintf("Failed to read response body: %v", err)
+				result.ErrorMessage = &errorMsg
+			}
+		} else {
+			if hasAssertions {
+				ts.applyHTTPAssertions(&result, httpConfig.Assertions, resp.Header, body, size, duration)
+			}
+			// Only pages served with an accepted status are compared; the server
+			// records a change as an event without touching the status
+			if contentConfig != nil && httpConfig.AcceptsStatus(resp.StatusCode) {
+				snapshot, err := utils.NormalizeContent(body, resp.Header.Get("Content-Type"), contentConfig)
+				if err != nil {
+					log.Warn().Err(err).Int("task_id", ts.task.ID).Msg("Failed to normalize content")
+				} else {
+					result.Metadata["content"] = snapshot
+				}
+			}
+		}
+	}
+
+	if resp.TLS != nil {
+		inspection := utils.InspectTLSState(resp.TLS, ts.task.TLSConfig(), time.Now())
+		result.Metadata["tls"] = inspection
+		// Certificate problems only make the result worse
+		worse := (inspection.Status == "degraded" && result.Status == "up") ||
+			(inspection.Status == "down" && (result.Status == "up" || result.Status == "degraded"))
+		if worse {
+			result.Status = inspection.Status
+			errorMsg := "TLS: " + strings.Join(inspection.Problems, "; ")
+			result.ErrorMessage = &errorMsg
+		}
+	}
+
 	return result
 }
 
-// executePingCheck performs a ping check
-func (ts *TaskScheduler) executePingCheck(timeout time.Duration) models.MonitorResultRequest {
+// applyHTTPAssertions evaluates response assertions and records every result in
+// the metadata. Failing assertions take an up check down, or degraded when only
+// latency thresholds fail.
+func (ts *TaskScheduler) applyHTTPAssertions(result *models.MonitorResultRequest, assertions []models.HTTPAssertion, header http.Header, body []byte, size int64, responseTime time.Duration) {
+	results := utils.EvaluateHTTPAssertions(assertions, header, body, size, responseTime)
+
+	var failed []utils.HTTPAssertionResult
+	var messages []string
+	degradedOnly := true
+	for _, r := range results {
+		if r.Passed {
+			continue
+		}
+		failed = append(failed, r)
+		messages = append(messages, r.Message)
+		if !r.Degraded {
+			degradedOnly = false
+		}
+	}
+
+	result.Metadata["body_size"] = size
+	result.Metadata["assertions"] = results
+	if len(failed) == 0 {
+		return
+	}
+	result.Metadata["failed_assertions"] = failed
+
+	if result.Status != "up" {
+		return
+	}
+	if degradedOnly {
+		result.Status = "degraded"
+	} else {
+		result.Status = "down"
+	}
+	errorMsg := "Assertion failed: " + strings.Join(messages, "; ")
+	result.ErrorMessage = &errorMsg
+}
+
+// executeTCPCheck performs a TCP connect check with optional TLS and banner matching
+func (ts *TaskScheduler) executeTCPCheck(timeout time.Duration) models.MonitorResultRequest {
 	result := models.MonitorResultRequest{
 		TaskID:    ts.task.ID,
 		CheckedAt: time.Now(),
 	}
 
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
 	start := time.Now()
+	check, err := utils.CheckTCP(ctx, ts.task.URL, ts.task.TCPConfig(), ts.task.TLSConfig())
+	responseTime := float64(time.Since(start).Nanoseconds()) / 1e6
+	result.ResponseTime = &responseTime
+	result.Metadata = map[string]interface{}{"tcp": check}
 
-	// Use system ping command
-	var cmd *exec.Cmd
-	timeoutSeconds := int(timeout.Seconds())
-	if timeoutSeconds == 0 {
-		timeoutSeconds = 5
+	switch {
+	case err != nil:
+		result.Status = "down"
+		errorMsg := err.Error()
+		result.ErrorMessage = &errorMsg
+	case check.TLS != nil && check.TLS.Status != "up":
+		result.Status = check.TLS.Status
+		errorMsg := "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		result.ErrorMessage = &errorMsg
+	default:
+		result.Status = "up"
 	}
 
-	switch runtime.GOOS {
-	case "windows":
-		cmd = exec.Command("ping", "-n", "1", "-w", strconv.Itoa(timeoutSeconds*1000), ts.task.URL)
-	default: // Linux, macOS, etc.
-		cmd = exec.Command("ping", "-c", "1", "-W", strconv.Itoa(timeoutSeconds), ts.task.URL)
+	return result
+}
+
+// executeDNSCheck performs a DNS query and checks the answer
+func (ts *TaskScheduler) executeDNSCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
 	}
 
-	output, err := cmd.Output()
-	duration := time.Since(start)
-	responseTime := float64(duration.Nanoseconds()) / 1e6 // Convert to milliseconds
+	var dnsConfig *models.DNSCheckConfig
+	if ts.task.Config != nil {
+		dnsConfig = ts.task.Config.DNS
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	check, err := utils.CheckDNS(ctx, ts.task.URL, dnsConfig)
+	if check != nil {
+		result.ResponseTime = &check.QueryMs
+		result.Metadata = map[string]interface{}{"dns": check}
+	}
+
+	switch {
+	case err != nil:
+		result.Status = "down"
+		errorMsg := err.Error()
+		result.ErrorMessage = &errorMsg
+	case len(check.Problems) > 0:
+		result.Status = "down"
+		errorMsg := "DNS: " + strings.Join(check.Problems, "; ")
+		result.ErrorMessage = &errorMsg
+	default:
+		result.Status = "up"
+	}
+
+	return result
+}
+
+// executeGRPCCheck calls the standard gRPC health check RPC
+func (ts *TaskScheduler) executeGRPCCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	check, err := utils.CheckGRPC(ctx, ts.task.URL, ts.task.GRPCConfig(), ts.task.TLSConfig())
+	if check != nil {
+		result.ResponseTime = &check.RPCMs
+		result.Metadata = map[string]interface{}{"grpc": check}
+	}
+
+	switch {
+	case err != nil:
+		result.Status = "down"
+		errorMsg := err.Error()
+		if check != nil && check.TLS != nil && check.TLS.Status == "down" {
+			errorMsg = "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		}
+		result.ErrorMessage = &errorMsg
+	case check.TLS != nil && check.TLS.Status == "down":
+		result.Status = "down"
+		errorMsg := "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		result.ErrorMessage = &errorMsg
+	default:
+		result.Status = check.Status
+		if check.Status != "up" {
+			errorMsg := "Health status " + check.ServingStatus
+			result.ErrorMessage = &errorMsg
+		} else if check.TLS != nil && check.TLS.Status == "degraded" {
+			result.Status = "degraded"
+			errorMsg := "TLS: " + strings.Join(check.TLS.Problems, "; ")
+			result.ErrorMessage = &errorMsg
+		}
+	}
+
+	return result
+}
+
+// executeMailCheck runs the phases of an SMTP or IMAP check
+func (ts *TaskScheduler) executeMailCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	check, err := utils.CheckMail(ctx, ts.task.URL, ts.task.MailConfig(), ts.task.TLSConfig())
+	if check != nil {
+		result.ResponseTime = &check.TotalMs
+		result.Metadata = map[string]interface{}{"mail": check}
+	}
+
+	switch {
+	case err != nil:
+		result.Status = "down"
+		errorMsg := err.Error()
+		if check != nil && check.TLS != nil && check.TLS.Status == "down" {
+			errorMsg = "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		}
+		result.ErrorMessage = &errorMsg
+	case check.TLS != nil && check.TLS.Status != "up":
+		result.Status = check.TLS.Status
+		errorMsg := "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		result.ErrorMessage = &errorMsg
+	default:
+		result.Status = "up"
+	}
+
+	return result
+}
+
+// executeWebSocketCheck upgrades to a WebSocket and waits for the expected message
+func (ts *TaskScheduler) executeWebSocketCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	check, err := utils.CheckWebSocket(ctx, ts.task.URL, ts.task.WebSocketConfig(), ts.task.TLSConfig(), ts.agent.config.Agent.UserAgent)
+	responseTime := check.HandshakeMs
+	if check.RoundTripMs != nil {
+		responseTime += *check.RoundTripMs
+	}
 	result.ResponseTime = &responseTime
+	result.StatusCode = check.StatusCode
+	result.Metadata = map[string]interface{}{"websocket": check}
+
+	switch {
+	case err != nil:
+		result.Status = "down"
+		errorMsg := err.Error()
+		if check.TLS != nil && check.TLS.Status == "down" {
+			errorMsg = "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		}
+		result.ErrorMessage = &errorMsg
+	case check.TLS != nil && check.TLS.Status != "up":
+		result.Status = check.TLS.Status
+		errorMsg := "TLS: " + strings.Join(check.TLS.Problems, "; ")
+		result.ErrorMessage = &errorMsg
+	default:
+		result.Status = "up"
+	}
+
+	return result
+}
 
+// executeDatabaseCheck connects to a database and runs its probe query
+func (ts *TaskScheduler) executeDatabaseCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	check, err := utils.CheckDatabase(ctx, ts.task.URL, ts.task.DatabaseConfig())
+	responseTime := float64(time.Since(start).Nanoseconds()) / 1e6
+	result.ResponseTime = &responseTime
+	result.Metadata = map[string]interface{}{"database": check}
+
+	switch {
+	case err != nil:
+		result.Status = "down"
+		errorMsg := err.Error()
+		result.ErrorMessage = &errorMsg
+	case len(check.Problems) > 0:
+		result.Status = "down"
+		errorMsg := "Database: " + strings.Join(check.Problems, "; ")
+		result.ErrorMessage = &errorMsg
+	default:
+		result.Status = "up"
+	}
+
+	return result
+}
+
+// executeTransactionCheck runs the HTTP steps of a transaction in order
+func (ts *TaskScheduler) executeTransactionCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	check := utils.RunTransaction(ctx, ts.task.TransactionConfig(), ts.agent.config.Agent.UserAgent)
+	result.ResponseTime = &check.TotalMs
+	result.Status = check.Status
+	result.Metadata = map[string]interface{}{"transaction": check}
+	// The status code of the failing step, if it got a response; a config
+	// without steps fails before any
+	if step := check.FailedStep; step != nil && *step <= len(check.Steps) {
+		result.StatusCode = check.Steps[*step-1].StatusCode
+	}
+	if check.Message != "" {
+		result.ErrorMessage = &check.Message
+	}
+
+	return result
+}
+
+// executePingCheck sends ICMP echo probes and judges loss and latency
+func (ts *TaskScheduler) executePingCheck(timeout time.Duration) models.MonitorResultRequest {
+	result := models.MonitorResultRequest{
+		TaskID:    ts.task.ID,
+		CheckedAt: time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	ping, err := utils.Ping(ctx, ts.task.URL, ts.task.PingConfig())
 	if err != nil {
 		result.Status = "down"
 		errorMsg := fmt.Sprintf("Ping failed: %v", err)
 		result.ErrorMessage = &errorMsg
-	} else {
-		result.Status = "up"
-		// Add ping output as metadata
-		result.Metadata = map[string]interface{}{
-			"ping_output": string(output),
-		}
+		return result
+	}
+
+	result.ResponseTime = ping.AvgMs
+	result.Metadata = map[string]interface{}{"ping": ping}
+
+	status, problem := utils.PingStatus(ping, ts.task.PingConfig())
+	result.Status = status
+	if problem != "" {
+		result.ErrorMessage = &problem
 	}
 
 	return result
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"github.com/spf13/viper"
@@ -23,20 +24,122 @@ type LogConfig struct {
 
 // ServerConfig holds server-specific configuration
 type ServerConfig struct {
-	Bind            string         `mapstructure:"bind"`       // Web GUI bind address
-	AgentBind       string         `mapstructure:"agent_bind"` // Agent API bind address (WebSocket/HTTP)
-	TLSCert         string         `mapstructure:"tls_cert"`
-	TLSKey          string         `mapstructure:"tls_key"`
-	AgentTLSCert    string         `mapstructure:"agent_tls_cert"` // Separate TLS cert for agent port
-	AgentTLSKey     string         `mapstructure:"agent_tls_key"`  // Separate TLS key for agent port
-	Database        DatabaseConfig `mapstructure:"database"`
-	AutoTLS         bool           `mapstructure:"auto_tls"`
-	AdminAPIKey     string         `mapstructure:"admin_api_key"` // Admin API key for web GUI authentication
-	AgentAPIKey     string         `mapstructure:"agent_api_key"` // Agent API key for agent authentication
-	AccentColor     string         `mapstructure:"accent_color"`  // Custom accent color (hex code)
-	MinScanInterval time.Duration  `mapstructure:"min_scan_interval"`
-	MaxScanInterval time.Duration  `mapstructure:"max_scan_interval"`
-	DevMode         bool           `mapstructure:"dev_mode"`
+	Bind            string          `mapstructure:"bind"`       // Web GUI bind address
+	AgentBind       string          `mapstructure:"agent_bind"` // Agent API bind address (WebSocket/HTTP)
+	TLSCert         string          `mapstructure:"tls_cert"`
+	TLSKey          string          `mapstructure:"tls_key"`
+	AgentTLSCert    string          `mapstructure:"agent_tls_cert"` // Separate TLS cert for agent port
+	AgentTLSKey     string          `mapstructure:"agent_tls_key"`  // Separate TLS key for agent port
+	Database        DatabaseConfig  `mapstructure:"database"`
+	AutoTLS         bool            `mapstructure:"auto_tls"`
+	AdminAPIKey     string          `mapstructure:"admin_api_key"` // Admin API key for web GUI authentication
+	AgentAPIKey     string          `mapstructure:"agent_api_key"` // Agent API key for agent authentication
+	AccentColor     string          `mapstructure:"accent_color"`  // Custom accent color (hex code)
+	MinScanInterval time.Duration   `mapstructure:"min_scan_interval"`
+	MaxScanInterval time.Duration   `mapstructure:"max_scan_interval"`
+	DevMode         bool            `mapstructure:"dev_mode"`
+	Auth            AuthConfig      `mapstructure:"auth"`            // User account and session settings
+	Email           EmailConfig     `mapstructure:"email"`           // Outgoing email settings
+	Audit           AuditConfig     `mapstructure:"audit"`           // Audit log settings
+	RateLimit       RateLimitConfig `mapstructure:"rate_limit"`      // Request rate limits and login lockouts
+	TrustedProxies  []string        `mapstructure:"trusted_proxies"` // IPs or CIDRs of reverse proxies whose X-Forwarded-For/X-Real-IP are believed
+	SQLiteMonitors  []string        `mapstructure:"sqlite_monitors"` // Absolute paths of SQLite files sqlite:// sites may open; empty disables them
+}
+
+// SQLiteMonitorAllowed reports whether sqlite:// sites may open the file at
+// path. Only files an admin listed in sqlite_monitors qualify, and never the
+// server's own database.
+func (s *ServerConfig) SQLiteMonitorAllowed(path string) bool {
+	path = filepath.Clean(path)
+	if s.Database.SQLitePath != "" {
+		if own, err := filepath.Abs(s.Database.SQLitePath); err != nil || path == own {
+			return false
+		}
+	}
+	for _, allowed := range s.SQLiteMonitors {
+		if path == filepath.Clean(allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimitConfig holds request rate limiting and brute-force protection settings.
+// Request limits are per client IP; a limit of 0 disables that check.
+type RateLimitConfig struct {
+	Enabled             bool          `mapstructure:"enabled"`
+	Window              time.Duration `mapstructure:"window"`                // Sliding window for web_requests and agent_requests
+	WebRequests         int           `mapstructure:"web_requests"`          // Requests per IP per window on the web GUI port
+	AgentRequests       int           `mapstructure:"agent_requests"`        // Requests per IP per window on the agent port
+	AuthWindow          time.Duration `mapstructure:"auth_window"`           // Sliding window for auth endpoint limits
+	AuthIPRequests      int           `mapstructure:"auth_ip_requests"`      // Auth requests per IP per auth window
+	AuthAccountRequests int           `mapstructure:"auth_account_requests"` // Auth requests per account per auth window
+	MaxFailures         int           `mapstructure:"max_failures"`          // Failed attempts within failure_window before a lockout
+	FailureWindow       time.Duration `mapstructure:"failure_window"`        // Window in which failed attempts are counted
+	LockoutDuration     time.Duration `mapstructure:"lockout_duration"`      // First lockout; doubles with each repeated lockout
+	MaxLockoutDuration  time.Duration `mapstructure:"max_lockout_duration"`  // Upper bound for the exponential backoff
+}
+
+// AuditConfig holds audit log configuration
+type AuditConfig struct {
+	Retention       time.Duration `mapstructure:"retention"`        // How long audit events are kept (0 keeps them forever)
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval"` // How often expired audit events are purged
+}
+
+// AuthConfig holds user authentication configuration
+type AuthConfig struct {
+	SessionDuration        time.Duration `mapstructure:"session_duration"`         // Lifetime of a regular login session
+	RememberMeDuration     time.Duration `mapstructure:"remember_me_duration"`     // Lifetime of a "remember me" session
+	SessionCleanupInterval time.Duration `mapstructure:"session_cleanup_interval"` // How often expired sessions are purged
+	AllowRegistration      bool          `mapstructure:"allow_registration"`       // Allow self-service sign-up after the first account exists
+	SetupToken             string        `mapstructure:"setup_token"`              // Required to register the first (admin) account; generated and logged at startup if empty
+	EncryptionKey          string        `mapstructure:"encryption_key"`           // Hex-encoded AES-256 key for secrets at rest (generated if empty)
+	OIDC                   OIDCConfig    `mapstructure:"oidc"`                     // OpenID Connect single sign-on
+}
+
+// OIDCConfig holds OpenID Connect single sign-on configuration
+type OIDCConfig struct {
+	Enabled       bool              `mapstructure:"enabled"`
+	Name          string            `mapstructure:"name"`       // Label shown on the web GUI login button
+	IssuerURL     string            `mapstructure:"issuer_url"` // Provider issuer; discovery is read from <issuer>/.well-known/openid-configuration
+	ClientID      string            `mapstructure:"client_id"`
+	ClientSecret  string            `mapstructure:"client_secret"` // Empty for public clients (PKCE only)
+	RedirectURL   string            `mapstructure:"redirect_url"`  // Defaults to <base URL>/api/auth/oidc/callback
+	Scopes        []string          `mapstructure:"scopes"`
+	GroupsClaim   string            `mapstructure:"groups_claim"`   // Claim listing the user's IdP groups
+	RoleMappings  []OIDCRoleMapping `mapstructure:"role_mappings"`  // IdP group to SREootb role; the most privileged match wins
+	DefaultRole   string            `mapstructure:"default_role"`   // Role when no group matches; empty denies access
+	AutoProvision bool              `mapstructure:"auto_provision"` // Create accounts on first login
+	SyncRoles     bool              `mapstructure:"sync_roles"`     // Update the role from group membership on every login
+}
+
+// OIDCRoleMapping maps an identity provider group to a user role
+type OIDCRoleMapping struct {
+	Group string `mapstructure:"group"`
+	Role  string `mapstructure:"role"`
+}
+
+// EmailConfig holds outgoing email configuration
+type EmailConfig struct {
+	Enabled     bool       `mapstructure:"enabled"`      // Send emails (when false they are only logged)
+	Provider    string     `mapstructure:"provider"`     // "console" (print to stdout) or "smtp"
+	From        string     `mapstructure:"from"`         // Sender address, e.g. "SREootb <noreply@example.com>"
+	BaseURL     string     `mapstructure:"base_url"`     // Public web GUI URL used to build links in emails
+	TemplateDir string     `mapstructure:"template_dir"` // Directory with <name>.txt / <name>.html overrides
+	SMTP        SMTPConfig `mapstructure:"smtp"`
+}
+
+// SMTPConfig holds SMTP relay configuration
+type SMTPConfig struct {
+	Host               string        `mapstructure:"host"`
+	Port               int           `mapstructure:"port"`
+	Username           string        `mapstructure:"username"`
+	Password           string        `mapstructure:"password"`
+	TLSMode            string        `mapstructure:"tls_mode"`             // "starttls", "tls" (implicit) or "none"
+	AuthMethod         string        `mapstructure:"auth_method"`          // "plain", "login" or "" to pick automatically
+	HeloName           string        `mapstructure:"helo_name"`            // Name sent in EHLO (defaults to "localhost")
+	InsecureSkipVerify bool          `mapstructure:"insecure_skip_verify"` // Skip relay certificate verification
+	Timeout            time.Duration `mapstructure:"timeout"`              // Connection and delivery timeout
 }
 
 // DatabaseConfig holds database configuration
@@ -105,6 +208,44 @@ func setDefaults() {
 	viper.SetDefault("server.max_scan_interval", 24*time.Hour)
 	viper.SetDefault("server.dev_mode", false)
 
+	// Authentication defaults
+	viper.SetDefault("server.auth.session_duration", 24*time.Hour)
+	viper.SetDefault("server.auth.remember_me_duration", 30*24*time.Hour)
+	viper.SetDefault("server.auth.session_cleanup_interval", time.Hour)
+	viper.SetDefault("server.auth.allow_registration", false)
+	viper.SetDefault("server.auth.oidc.enabled", false)
+	viper.SetDefault("server.auth.oidc.name", "Single sign-on")
+	viper.SetDefault("server.auth.oidc.scopes", []string{"openid", "email", "profile"})
+	viper.SetDefault("server.auth.oidc.groups_claim", "groups")
+	viper.SetDefault("server.auth.oidc.default_role", "viewer")
+	viper.SetDefault("server.auth.oidc.auto_provision", true)
+	viper.SetDefault("server.auth.oidc.sync_roles", true)
+
+	// Email defaults
+	viper.SetDefault("server.email.enabled", false)
+	viper.SetDefault("server.email.provider", "console")
+	viper.SetDefault("server.email.from", "SREootb <noreply@localhost>")
+	viper.SetDefault("server.email.smtp.port", 587)
+	viper.SetDefault("server.email.smtp.tls_mode", "starttls")
+	viper.SetDefault("server.email.smtp.timeout", 30*time.Second)
+
+	// Audit log defaults
+	viper.SetDefault("server.audit.retention", 90*24*time.Hour)
+	viper.SetDefault("server.audit.cleanup_interval", time.Hour)
+
+	// Rate limit defaults
+	viper.SetDefault("server.rate_limit.enabled", true)
+	viper.SetDefault("server.rate_limit.window", time.Minute)
+	viper.SetDefault("server.rate_limit.web_requests", 600)
+	viper.SetDefault("server.rate_limit.agent_requests", 1200)
+	viper.SetDefault("server.rate_limit.auth_window", time.Minute)
+	viper.SetDefault("server.rate_limit.auth_ip_requests", 20)
+	viper.SetDefault("server.rate_limit.auth_account_requests", 10)
+	viper.SetDefault("server.rate_limit.max_failures", 5)
+	viper.SetDefault("server.rate_limit.failure_window", 15*time.Minute)
+	viper.SetDefault("server.rate_limit.lockout_duration", time.Minute)
+	viper.SetDefault("server.rate_limit.max_lockout_duration", time.Hour)
+
 	// Database defaults
 	viper.SetDefault("server.database.type", "sqlite")
 	viper.SetDefault("server.database.sqlite_path", "./db/sreootb.db")
@@ -140,6 +281,16 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("database configuration invalid: %w", err)
 	}
 
+	// Email validation
+	if err := c.validateEmail(); err != nil {
+		return fmt.Errorf("email configuration invalid: %w", err)
+	}
+
+	// OIDC validation
+	if err := c.validateOIDC(); err != nil {
+		return fmt.Errorf("oidc configuration invalid: %w", err)
+	}
+
 	// Agent validation
 	if c.Agent.ServerURL != "" {
 		if c.Agent.APIKey == "" {
@@ -182,3 +333,68 @@ func (c *Config) validateDatabase() error {
 
 	return nil
 }
+
+// validateEmail validates outgoing email configuration
+func (c *Config) validateEmail() error {
+	email := c.Server.Email
+	if !email.Enabled {
+		return nil
+	}
+
+	switch email.Provider {
+	case "", "console":
+	case "smtp":
+		if email.SMTP.Host == "" {
+			return fmt.Errorf("smtp.host is required when using the smtp provider")
+		}
+		if email.SMTP.Port <= 0 || email.SMTP.Port > 65535 {
+			return fmt.Errorf("smtp.port must be between 1 and 65535")
+		}
+		switch email.SMTP.TLSMode {
+		case "", "starttls", "tls", "none":
+		default:
+			return fmt.Errorf("smtp.tls_mode must be 'starttls', 'tls' or 'none', got '%s'", email.SMTP.TLSMode)
+		}
+		switch email.SMTP.AuthMethod {
+		case "", "plain", "login":
+		default:
+			return fmt.Errorf("smtp.auth_method must be 'plain' or 'login', got '%s'", email.SMTP.AuthMethod)
+		}
+	default:
+		return fmt.Errorf("email provider must be either 'console' or 'smtp', got '%s'", email.Provider)
+	}
+
+	return nil
+}
+
+// validateOIDC validates single sign-on configuration
+func (c *Config) validateOIDC() error {
+	oidc := c.Server.Auth.OIDC
+	if !oidc.Enabled {
+		return nil
+	}
+
+	if oidc.IssuerURL == "" {
+		return fmt.Errorf("issuer_url is required")
+	}
+	if oidc.ClientID == "" {
+		return fmt.Errorf("client_id is required")
+	}
+
+	validRole := func(role string) bool {
+		return role == "viewer" || role == "editor" || role == "admin"
+	}
+	if oidc.DefaultRole != "" && !validRole(oidc.DefaultRole) {
+		return fmt.Errorf("default_role must be 'viewer', 'editor', 'admin' or empty, got '%s'", oidc.DefaultRole)
+	}
+	for _, mapping := range oidc.RoleMappings {
+		if mapping.Group == "" {
+			return fmt.Errorf("role_mappings entries require a group")
+		}
+		if !validRole(mapping.Role) {
+			return fmt.Errorf("role for group '%s' must be 'viewer', 'editor' or 'admin', got '%s'", mapping.Group, mapping.Role)
+		}
+	}
+
+	return nil
+}
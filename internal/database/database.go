@@ -1,8 +1,10 @@
 package database
 
 import (
+	"crypto/subtle"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"sort"
@@ -162,10 +164,11 @@ func (db *DB) getSQLiteInitQueries() []string {
 			password_hash TEXT NOT NULL,
 			first_name TEXT NOT NULL,
 			last_name TEXT NOT NULL,
-			role TEXT DEFAULT 'user',
+			role TEXT DEFAULT 'viewer',
 			email_verified BOOLEAN DEFAULT 0,
 			two_factor_enabled BOOLEAN DEFAULT 0,
 			two_factor_secret TEXT,
+			disabled BOOLEAN DEFAULT 0,
 			last_login_at TIMESTAMP,
 			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
 			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
@@ -275,6 +278,67 @@ func (db *DB) getSQLiteInitQueries() []string {
 			FOREIGN KEY (task_id) REFERENCES monitor_tasks (id) ON DELETE CASCADE,
 			UNIQUE(agent_id, task_id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			name TEXT NOT NULL,
+			token_prefix TEXT NOT NULL,
+			token_hash TEXT UNIQUE NOT NULL,
+			scopes TEXT NOT NULL,
+			expires_at TIMESTAMP,
+			last_used_at TIMESTAMP,
+			last_used_ip TEXT,
+			revoked_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			actor_type TEXT NOT NULL,
+			actor_id TEXT,
+			actor_name TEXT,
+			action TEXT NOT NULL,
+			target_type TEXT,
+			target_id TEXT,
+			source_ip TEXT,
+			request_id TEXT,
+			before_data TEXT,
+			after_data TEXT,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)`,
+		`CREATE TABLE IF NOT EXISTS site_pauses (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			paused_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			resumed_at TIMESTAMP,
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS push_monitors (
+			site_id INTEGER PRIMARY KEY,
+			token_hash TEXT UNIQUE NOT NULL,
+			token_prefix TEXT NOT NULL,
+			started_at TIMESTAMP,
+			last_ping_at TIMESTAMP,
+			missed_at TIMESTAMP,
+			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS content_snapshots (
+			site_id INTEGER PRIMARY KEY,
+			hash TEXT NOT NULL,
+			content TEXT NOT NULL,
+			updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS content_changes (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			site_id INTEGER NOT NULL,
+			previous_hash TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			diff TEXT NOT NULL,
+			detected_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
 		// Indexes for user authentication
 		`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id)`,
@@ -295,6 +359,13 @@ func (db *DB) getSQLiteInitQueries() []string {
 		`CREATE INDEX IF NOT EXISTS idx_monitor_results_checked_at ON monitor_results(checked_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_agent_task_assignments_agent_id ON agent_task_assignments(agent_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_agent_task_assignments_task_id ON agent_task_assignments(task_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_type, actor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_site_pauses_site_id ON site_pauses(site_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_content_changes_site_id ON content_changes(site_id)`,
 	}
 }
 
@@ -308,10 +379,11 @@ func (db *DB) getCockroachInitQueries() []string {
 			password_hash STRING NOT NULL,
 			first_name STRING NOT NULL,
 			last_name STRING NOT NULL,
-			role STRING DEFAULT 'user',
+			role STRING DEFAULT 'viewer',
 			email_verified BOOL DEFAULT false,
 			two_factor_enabled BOOL DEFAULT false,
 			two_factor_secret STRING,
+			disabled BOOL DEFAULT false,
 			last_login_at TIMESTAMPTZ,
 			created_at TIMESTAMPTZ DEFAULT NOW(),
 			updated_at TIMESTAMPTZ DEFAULT NOW()
@@ -421,6 +493,67 @@ func (db *DB) getCockroachInitQueries() []string {
 			FOREIGN KEY (task_id) REFERENCES monitor_tasks (id) ON DELETE CASCADE,
 			UNIQUE(agent_id, task_id)
 		)`,
+		`CREATE TABLE IF NOT EXISTS api_tokens (
+			id SERIAL PRIMARY KEY,
+			user_id INT NOT NULL,
+			name STRING NOT NULL,
+			token_prefix STRING NOT NULL,
+			token_hash STRING UNIQUE NOT NULL,
+			scopes STRING NOT NULL,
+			expires_at TIMESTAMPTZ,
+			last_used_at TIMESTAMPTZ,
+			last_used_ip STRING,
+			revoked_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS audit_events (
+			id SERIAL PRIMARY KEY,
+			actor_type STRING NOT NULL,
+			actor_id STRING,
+			actor_name STRING,
+			action STRING NOT NULL,
+			target_type STRING,
+			target_id STRING,
+			source_ip STRING,
+			request_id STRING,
+			before_data STRING,
+			after_data STRING,
+			created_at TIMESTAMPTZ DEFAULT NOW()
+		)`,
+		`CREATE TABLE IF NOT EXISTS site_pauses (
+			id SERIAL PRIMARY KEY,
+			site_id INT NOT NULL,
+			paused_at TIMESTAMPTZ DEFAULT NOW(),
+			resumed_at TIMESTAMPTZ,
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS push_monitors (
+			site_id INT PRIMARY KEY,
+			token_hash STRING UNIQUE NOT NULL,
+			token_prefix STRING NOT NULL,
+			started_at TIMESTAMPTZ,
+			last_ping_at TIMESTAMPTZ,
+			missed_at TIMESTAMPTZ,
+			created_at TIMESTAMPTZ DEFAULT NOW(),
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS content_snapshots (
+			site_id INT PRIMARY KEY,
+			hash STRING NOT NULL,
+			content STRING NOT NULL,
+			updated_at TIMESTAMPTZ DEFAULT NOW(),
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
+		`CREATE TABLE IF NOT EXISTS content_changes (
+			id SERIAL PRIMARY KEY,
+			site_id INT NOT NULL,
+			previous_hash STRING NOT NULL,
+			hash STRING NOT NULL,
+			diff STRING NOT NULL,
+			detected_at TIMESTAMPTZ DEFAULT NOW(),
+			FOREIGN KEY (site_id) REFERENCES sites (id) ON DELETE CASCADE
+		)`,
 		// Indexes for user authentication
 		`CREATE INDEX IF NOT EXISTS idx_users_email ON users(email)`,
 		`CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id)`,
@@ -441,6 +574,13 @@ func (db *DB) getCockroachInitQueries() []string {
 		`CREATE INDEX IF NOT EXISTS idx_monitor_results_checked_at ON monitor_results(checked_at)`,
 		`CREATE INDEX IF NOT EXISTS idx_agent_task_assignments_agent_id ON agent_task_assignments(agent_id)`,
 		`CREATE INDEX IF NOT EXISTS idx_agent_task_assignments_task_id ON agent_task_assignments(task_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_actor ON audit_events(actor_type, actor_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_site_pauses_site_id ON site_pauses(site_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_content_changes_site_id ON content_changes(site_id)`,
 	}
 }
 
@@ -459,6 +599,28 @@ func (db *DB) migrate() error {
 		}
 	}
 
+	// For both databases, add columns introduced after the initial schema
+	if err := db.addColumnIfMissing("users", "disabled", "BOOLEAN DEFAULT 0", "BOOL DEFAULT false"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "oidc_subject", "TEXT", "STRING"); err != nil {
+		return err
+	}
+	if _, err := db.conn.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_users_oidc_subject ON users(oidc_subject)`); err != nil {
+		return fmt.Errorf("failed to create oidc_subject index: %w", err)
+	}
+	if err := db.addColumnIfMissing("monitor_tasks", "config", "TEXT", "STRING"); err != nil {
+		return err
+	}
+	if err := db.addColumnIfMissing("users", "totp_last_step", "INTEGER", "INT8"); err != nil {
+		return err
+	}
+
+	// Map the legacy "user" role onto the read-only viewer role
+	if err := db.migrateLegacyUserRoles(); err != nil {
+		return fmt.Errorf("failed to migrate legacy user roles: %w", err)
+	}
+
 	// For both databases, create monitoring tasks for existing sites
 	if err := db.createMonitoringTasksForExistingSites(); err != nil {
 		return fmt.Errorf("failed to create monitoring tasks for existing sites: %w", err)
@@ -530,6 +692,48 @@ func (db *DB) addKeyTypeColumn() error {
 	return nil
 }
 
+// addColumnIfMissing adds a column to an existing table if it doesn't exist
+func (db *DB) addColumnIfMissing(table, column, sqliteDef, cockroachDef string) error {
+	switch db.dbType {
+	case SQLite:
+		var count int
+		err := db.conn.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM pragma_table_info('%s') WHERE name='%s'", table, column)).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to check for %s column: %w", column, err)
+		}
+		if count > 0 {
+			return nil
+		}
+		if _, err := db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, sqliteDef)); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", column, err)
+		}
+		fmt.Printf("✅ Added %s column to %s table\n", column, table)
+	case CockroachDB:
+		if _, err := db.conn.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s %s", table, column, cockroachDef)); err != nil {
+			return fmt.Errorf("failed to add %s column: %w", column, err)
+		}
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	return nil
+}
+
+// migrateLegacyUserRoles converts accounts created with the old "user" role to viewers
+func (db *DB) migrateLegacyUserRoles() error {
+	result, err := db.conn.Exec(fmt.Sprintf("UPDATE users SET role = %s WHERE role = %s",
+		db.placeholder(1), db.placeholder(2)), models.RoleViewer, "user")
+	if err != nil {
+		return err
+	}
+
+	if affected, _ := result.RowsAffected(); affected > 0 {
+		fmt.Printf("✅ Migrated %d legacy user accounts to the viewer role\n", affected)
+	}
+
+	return nil
+}
+
 // createMonitoringTasksForExistingSites creates monitoring tasks for existing sites that don't have them
 func (db *DB) createMonitoringTasksForExistingSites() error {
 	// Get all sites that don't have monitoring tasks
@@ -567,7 +771,7 @@ func (db *DB) createMonitoringTasksForExistingSites() error {
 
 	// Create monitoring tasks for these sites
 	for _, site := range sitesToMigrate {
-		if err := db.createMonitoringTaskForSite(site.ID, site.URL, site.ScanInterval); err != nil {
+		if err := db.createMonitoringTaskForSite(site.ID, site.URL, site.ScanInterval, nil); err != nil {
 			return fmt.Errorf("failed to create monitoring task for site %d: %w", site.ID, err)
 		}
 	}
@@ -620,54 +824,134 @@ func (db *DB) boolValue(b bool) interface{} {
 	}
 }
 
-// createMonitoringTaskForSite creates appropriate monitoring tasks for a site based on its URL
-func (db *DB) createMonitoringTaskForSite(siteID int, url, interval string) error {
-	var monitorType string
-	var timeout string = "10s"
-
-	// Determine monitor type based on URL
+// monitorTaskForURL determines the monitor type, task URL and timeout for a site URL
+func monitorTaskForURL(url string) (monitorType, taskURL, timeout string) {
 	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-		monitorType = "http"
-		timeout = "30s"
+		return "http", url, "30s"
 	} else if strings.HasPrefix(url, "ping://") {
-		monitorType = "ping"
-		timeout = "5s"
 		// Remove ping:// prefix for the actual URL
-		url = strings.TrimPrefix(url, "ping://")
+		return "ping", strings.TrimPrefix(url, "ping://"), "5s"
 	} else if strings.HasPrefix(url, "log://") {
-		monitorType = "log"
-		timeout = "60s"
 		// Keep the log:// prefix for the agent to handle
-	} else {
-		// Default to HTTP for unknown protocols
-		monitorType = "http"
-		timeout = "30s"
+		return "log", url, "60s"
+	} else if strings.HasPrefix(url, "dns://") {
+		// Keep the full URL, its query holds the record type and resolver
+		return "dns", url, "10s"
+	} else if strings.HasPrefix(url, "push://") {
+		// Push sites report to the server; the task only holds their settings
+		return "push", url, "30s"
+	} else if models.IsMailURL(url) {
+		// Keep the full URL, its scheme sets the protocol and TLS mode
+		protocol, _, _, _ := models.ParseMailURL(url)
+		return protocol, url, "15s"
+	} else if strings.HasPrefix(url, "ws://") || strings.HasPrefix(url, "wss://") {
+		return "websocket", url, "10s"
+	} else if strings.HasPrefix(url, "transaction://") {
+		// The steps in the task config hold the real URLs
+		return "transaction", url, "60s"
+	} else if strings.HasPrefix(url, "postgres://") || strings.HasPrefix(url, "postgresql://") {
+		// The password is added from the task config by whoever runs the check
+		return "postgres", url, "10s"
+	} else if strings.HasPrefix(url, "sqlite://") {
+		return "sqlite", url, "10s"
+	} else if strings.HasPrefix(url, "grpc://") {
+		// Keep the full URL, its path names the service
+		return "grpc", url, "10s"
+	} else if strings.HasPrefix(url, "tcp://") {
+		// Agents dial the bare host:port
+		return "tcp", strings.TrimSuffix(strings.TrimPrefix(url, "tcp://"), "/"), "10s"
+	}
+
+	// Default to HTTP for unknown protocols
+	return "http", url, "30s"
+}
+
+// createMonitoringTaskForSite creates appropriate monitoring tasks for a site based on its URL
+func (db *DB) createMonitoringTaskForSite(siteID int, url, interval string, config *models.MonitorConfig) error {
+	monitorType, url, timeout := monitorTaskForURL(url)
+	timeout = config.TaskTimeout(timeout)
+
+	configJSON, err := encodeMonitorConfig(config)
+	if err != nil {
+		return err
 	}
 
 	// Create the monitoring task with database-specific placeholders
 	var query string
 	switch db.dbType {
 	case SQLite:
-		query = `INSERT INTO monitor_tasks (site_id, monitor_type, url, interval, timeout, enabled) VALUES (?, ?, ?, ?, ?, ?)`
-		_, err := db.conn.Exec(query, siteID, monitorType, url, interval, timeout, db.boolValue(true))
+		query = `INSERT INTO monitor_tasks (site_id, monitor_type, url, interval, timeout, enabled, config) VALUES (?, ?, ?, ?, ?, ?, ?)`
+		_, err := db.conn.Exec(query, siteID, monitorType, url, interval, timeout, db.boolValue(true), configJSON)
 		return err
 	case CockroachDB:
-		query = `INSERT INTO monitor_tasks (site_id, monitor_type, url, interval, timeout, enabled) VALUES ($1, $2, $3, $4, $5, $6)`
-		_, err := db.conn.Exec(query, siteID, monitorType, url, interval, timeout, db.boolValue(true))
+		query = `INSERT INTO monitor_tasks (site_id, monitor_type, url, interval, timeout, enabled, config) VALUES ($1, $2, $3, $4, $5, $6, $7)`
+		_, err := db.conn.Exec(query, siteID, monitorType, url, interval, timeout, db.boolValue(true), configJSON)
 		return err
 	default:
 		return fmt.Errorf("unsupported database type")
 	}
 }
 
+// encodeMonitorConfig serializes a monitor configuration for the monitor_tasks.config column
+func encodeMonitorConfig(config *models.MonitorConfig) (*string, error) {
+	if config == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode monitor config: %w", err)
+	}
+	encoded := string(data)
+	return &encoded, nil
+}
+
+// decodeMonitorConfig parses the monitor_tasks.config column
+func decodeMonitorConfig(raw sql.NullString) (*models.MonitorConfig, error) {
+	if !raw.Valid || raw.String == "" {
+		return nil, nil
+	}
+	var config models.MonitorConfig
+	if err := json.Unmarshal([]byte(raw.String), &config); err != nil {
+		return nil, fmt.Errorf("failed to decode monitor config: %w", err)
+	}
+	return &config, nil
+}
+
 // Sites
 
+// sitePausedColumn selects whether site s is paused, i.e. its monitoring tasks are disabled
+const sitePausedColumn = `EXISTS (SELECT 1 FROM monitor_tasks mt WHERE mt.site_id = s.id AND NOT mt.enabled)`
+
+// siteConfigColumn selects the monitor configuration stored with site s's monitoring task
+const siteConfigColumn = `(SELECT mt.config FROM monitor_tasks mt WHERE mt.site_id = s.id ORDER BY mt.id LIMIT 1)`
+
+// notDuringPause is a condition excluding rows checked while their site was paused
+func (db *DB) notDuringPause(siteIDColumn, checkedAtColumn string) string {
+	checkedAt := db.timestampValue(checkedAtColumn)
+	return fmt.Sprintf(`NOT EXISTS (
+		SELECT 1 FROM site_pauses sp
+		WHERE sp.site_id = %s AND %s >= %s AND (sp.resumed_at IS NULL OR %s < %s)
+	)`, siteIDColumn, checkedAt, db.timestampValue("sp.paused_at"), checkedAt, db.timestampValue("sp.resumed_at"))
+}
+
+// timestampValue wraps a timestamp column so it compares chronologically.
+// SQLite stores timestamps as text in whatever format the writer used
+// (CURRENT_TIMESTAMP in UTC, Go times with a zone offset), so values are
+// compared as Julian day numbers rather than strings.
+func (db *DB) timestampValue(column string) string {
+	if db.dbType == SQLite {
+		return "julianday(" + column + ")"
+	}
+	return column
+}
+
 // AddSite adds a new site to monitor
 func (db *DB) AddSite(site *models.SiteCreateRequest) (*models.Site, error) {
 	var newSite models.Site
 	newSite.URL = site.URL
 	newSite.Name = site.Name
 	newSite.ScanInterval = site.ScanInterval
+	newSite.Config = site.Config
 
 	var err error
 	switch db.dbType {
@@ -686,7 +970,7 @@ func (db *DB) AddSite(site *models.SiteCreateRequest) (*models.Site, error) {
 	}
 
 	// Create monitoring task for this site
-	if err := db.createMonitoringTaskForSite(newSite.ID, newSite.URL, newSite.ScanInterval); err != nil {
+	if err := db.createMonitoringTaskForSite(newSite.ID, newSite.URL, newSite.ScanInterval, newSite.Config); err != nil {
 		log.Warn().Err(err).Int("site_id", newSite.ID).Msg("Failed to create monitoring task for new site")
 	}
 
@@ -695,7 +979,7 @@ func (db *DB) AddSite(site *models.SiteCreateRequest) (*models.Site, error) {
 
 // GetSites returns all sites
 func (db *DB) GetSites() ([]*models.Site, error) {
-	query := `SELECT id, url, name, scan_interval, created_at FROM sites ORDER BY name`
+	query := `SELECT s.id, s.url, s.name, s.scan_interval, ` + sitePausedColumn + `, ` + siteConfigColumn + `, s.created_at FROM sites s ORDER BY s.name`
 
 	rows, err := db.conn.Query(query)
 	if err != nil {
@@ -706,9 +990,13 @@ func (db *DB) GetSites() ([]*models.Site, error) {
 	var sites []*models.Site
 	for rows.Next() {
 		var site models.Site
-		if err := rows.Scan(&site.ID, &site.URL, &site.Name, &site.ScanInterval, &site.CreatedAt); err != nil {
+		var config sql.NullString
+		if err := rows.Scan(&site.ID, &site.URL, &site.Name, &site.ScanInterval, &site.Paused, &config, &site.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan site: %w", err)
 		}
+		if site.Config, err = decodeMonitorConfig(config); err != nil {
+			return nil, err
+		}
 		sites = append(sites, &site)
 	}
 
@@ -720,25 +1008,150 @@ func (db *DB) GetSite(id int) (*models.Site, error) {
 	var query string
 	switch db.dbType {
 	case SQLite:
-		query = `SELECT id, url, name, scan_interval, created_at FROM sites WHERE id = ?`
+		query = `SELECT s.id, s.url, s.name, s.scan_interval, ` + sitePausedColumn + `, ` + siteConfigColumn + `, s.created_at FROM sites s WHERE s.id = ?`
 	case CockroachDB:
-		query = `SELECT id, url, name, scan_interval, created_at FROM sites WHERE id = $1`
+		query = `SELECT s.id, s.url, s.name, s.scan_interval, ` + sitePausedColumn + `, ` + siteConfigColumn + `, s.created_at FROM sites s WHERE s.id = $1`
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
 
 	var site models.Site
-	err := db.conn.QueryRow(query, id).Scan(&site.ID, &site.URL, &site.Name, &site.ScanInterval, &site.CreatedAt)
+	var config sql.NullString
+	err := db.conn.QueryRow(query, id).Scan(&site.ID, &site.URL, &site.Name, &site.ScanInterval, &site.Paused, &config, &site.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("failed to get site: %w", err)
 	}
+	if site.Config, err = decodeMonitorConfig(config); err != nil {
+		return nil, err
+	}
 
 	return &site, nil
 }
 
+// UpdateSite changes a site's URL, name and scan interval in place, keeping its
+// check history, and rewrites its monitoring task to match. It returns nil if
+// the site does not exist.
+func (db *DB) UpdateSite(id int, site *models.SiteCreateRequest) (*models.Site, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE sites SET url = %s, name = %s, scan_interval = %s WHERE id = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4))
+	result, err := tx.Exec(query, site.URL, site.Name, site.ScanInterval, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update site: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return nil, nil
+	}
+
+	monitorType, taskURL, timeout := monitorTaskForURL(site.URL)
+	timeout = site.Config.TaskTimeout(timeout)
+	configJSON, err := encodeMonitorConfig(site.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	query = fmt.Sprintf(`UPDATE monitor_tasks SET monitor_type = %s, url = %s, interval = %s, timeout = %s, config = %s, updated_at = %s WHERE site_id = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5), db.currentTimestamp(), db.placeholder(6))
+	result, err = tx.Exec(query, monitorType, taskURL, site.ScanInterval, timeout, configJSON, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update monitoring task: %w", err)
+	}
+
+	if rowsAffected, err = result.RowsAffected(); err != nil {
+		return nil, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		// Sites created before monitoring tasks existed may not have one yet
+		query = fmt.Sprintf(`INSERT INTO monitor_tasks (site_id, monitor_type, url, interval, timeout, enabled, config) VALUES (%s, %s, %s, %s, %s, %s, %s)`,
+			db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5), db.placeholder(6), db.placeholder(7))
+		if _, err := tx.Exec(query, id, monitorType, taskURL, site.ScanInterval, timeout, db.boolValue(true), configJSON); err != nil {
+			return nil, fmt.Errorf("failed to create monitoring task: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit site update: %w", err)
+	}
+
+	return db.GetSite(id)
+}
+
+// GetTasksForSite returns the monitoring tasks of a site
+func (db *DB) GetTasksForSite(siteID int) ([]*models.MonitorTask, error) {
+	query := fmt.Sprintf(`SELECT id, site_id, monitor_type, url, interval, timeout, enabled, created_at, updated_at, config FROM monitor_tasks WHERE site_id = %s ORDER BY id`, db.placeholder(1))
+
+	rows, err := db.conn.Query(query, siteID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tasks for site: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []*models.MonitorTask
+	for rows.Next() {
+		task, err := scanMonitorTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
+
+// SetSitePaused enables or disables a site's monitoring tasks and records the
+// pause period so it can be excluded from uptime. It reports whether the state
+// changed; pausing a paused site or resuming an active one is a no-op.
+func (db *DB) SetSitePaused(siteID int, paused bool) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE monitor_tasks SET enabled = %s, updated_at = %s WHERE site_id = %s AND enabled = %s`,
+		db.placeholder(1), db.currentTimestamp(), db.placeholder(2), db.placeholder(3))
+	result, err := tx.Exec(query, db.boolValue(!paused), siteID, db.boolValue(paused))
+	if err != nil {
+		return false, fmt.Errorf("failed to update monitoring tasks: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	if paused {
+		query = fmt.Sprintf(`INSERT INTO site_pauses (site_id, paused_at) VALUES (%s, %s)`, db.placeholder(1), db.currentTimestamp())
+	} else {
+		query = fmt.Sprintf(`UPDATE site_pauses SET resumed_at = %s WHERE site_id = %s AND resumed_at IS NULL`, db.currentTimestamp(), db.placeholder(1))
+	}
+	if _, err := tx.Exec(query, siteID); err != nil {
+		return false, fmt.Errorf("failed to record pause period: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit pause change: %w", err)
+	}
+
+	return true, nil
+}
+
 // DeleteSite deletes a site and all its checks
 func (db *DB) DeleteSite(id int) error {
 	var query string
@@ -796,10 +1209,10 @@ func (db *DB) RecordCheck(check *models.SiteCheck) error {
 func (db *DB) GetSiteStatus() ([]*models.SiteStatus, error) {
 	query := `
 		SELECT 
-			s.id, s.url, s.name, s.scan_interval, s.created_at,
+			s.id, s.url, s.name, s.scan_interval, ` + sitePausedColumn + `, s.created_at,
 			sc.status, sc.response_time, sc.status_code, sc.error_message, sc.checked_at,
-			(SELECT COUNT(*) FROM site_checks WHERE site_id = s.id AND status = 'up') as total_up,
-			(SELECT COUNT(*) FROM site_checks WHERE site_id = s.id AND status = 'down') as total_down
+			(SELECT COUNT(*) FROM site_checks c WHERE c.site_id = s.id AND c.status = 'up' AND ` + db.notDuringPause("c.site_id", "c.checked_at") + `) as total_up,
+			(SELECT COUNT(*) FROM site_checks c WHERE c.site_id = s.id AND c.status = 'down' AND ` + db.notDuringPause("c.site_id", "c.checked_at") + `) as total_down
 		FROM sites s
 		LEFT JOIN site_checks sc ON s.id = sc.site_id
 		WHERE sc.checked_at = (
@@ -821,7 +1234,7 @@ func (db *DB) GetSiteStatus() ([]*models.SiteStatus, error) {
 		var status models.SiteStatus
 
 		err := rows.Scan(
-			&status.ID, &status.URL, &status.Name, &status.ScanInterval, &status.CreatedAt,
+			&status.ID, &status.URL, &status.Name, &status.ScanInterval, &status.Paused, &status.CreatedAt,
 			&status.Status, &status.ResponseTime, &status.StatusCode, &status.ErrorMessage, &status.CheckedAt,
 			&status.TotalUp, &status.TotalDown,
 		)
@@ -832,9 +1245,52 @@ func (db *DB) GetSiteStatus() ([]*models.SiteStatus, error) {
 		statuses = append(statuses, &status)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get site status: %w", err)
+	}
+
+	pausedSince, err := db.openSitePauses()
+	if err != nil {
+		return nil, err
+	}
+
+	// A paused site has no current status, whatever its last check said
+	for _, status := range statuses {
+		if status.Paused {
+			paused := "paused"
+			status.Status = &paused
+			if since, ok := pausedSince[status.ID]; ok {
+				status.PausedAt = &since
+			}
+		}
+	}
+
 	return statuses, nil
 }
 
+// openSitePauses returns when each currently paused site was paused
+func (db *DB) openSitePauses() (map[int]time.Time, error) {
+	rows, err := db.conn.Query(`SELECT site_id, paused_at FROM site_pauses WHERE resumed_at IS NULL`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get site pauses: %w", err)
+	}
+	defer rows.Close()
+
+	pausedSince := make(map[int]time.Time)
+	for rows.Next() {
+		var siteID int
+		var pausedAt time.Time
+		if err := rows.Scan(&siteID, &pausedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan site pause: %w", err)
+		}
+		if existing, ok := pausedSince[siteID]; !ok || pausedAt.After(existing) {
+			pausedSince[siteID] = pausedAt
+		}
+	}
+
+	return pausedSince, nil
+}
+
 // GetSiteHistory returns check history for a specific site
 func (db *DB) GetSiteHistory(siteID int, limit int) ([]*models.SiteCheck, error) {
 	var query string
@@ -869,68 +1325,347 @@ func (db *DB) GetSiteHistory(siteID int, limit int) ([]*models.SiteCheck, error)
 	return checks, nil
 }
 
-// Agents
+// Push Monitors
 
-// AddAgent adds a new agent
-func (db *DB) AddAgent(agent *models.AgentCreateRequest, apiKeyHash string) (*models.Agent, error) {
-	// Determine key type based on registration type
-	keyType := "permanent" // default
-	if agent.RegistrationType != nil && *agent.RegistrationType == "auto" {
-		keyType = "bootstrap"
+// pushMonitorColumns lists the push_monitors columns read by scanPushMonitor
+const pushMonitorColumns = `site_id, token_prefix, started_at, last_ping_at, missed_at, created_at`
+
+// scanPushMonitor scans a row selected with pushMonitorColumns
+func scanPushMonitor(row interface{ Scan(...interface{}) error }) (*models.PushMonitor, error) {
+	var push models.PushMonitor
+	if err := row.Scan(&push.SiteID, &push.TokenPrefix, &push.StartedAt, &push.LastPingAt, &push.MissedAt, &push.CreatedAt); err != nil {
+		return nil, err
 	}
+	return &push, nil
+}
 
-	var newAgent models.Agent
-	newAgent.Name = agent.Name
-	newAgent.APIKeyHash = apiKeyHash
-	newAgent.Description = agent.Description
-	newAgent.Status = "offline"
+// SetPushToken stores the token of a push site, replacing any previous one
+func (db *DB) SetPushToken(siteID int, prefix, tokenHash string) error {
+	query := fmt.Sprintf(`INSERT INTO push_monitors (site_id, token_prefix, token_hash) VALUES (%s, %s, %s)
+		ON CONFLICT (site_id) DO UPDATE SET token_prefix = excluded.token_prefix, token_hash = excluded.token_hash`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3))
 
-	var err error
-	switch db.dbType {
-	case SQLite:
-		query := `INSERT INTO agents (name, api_key_hash, key_type, description) VALUES (?, ?, ?, ?) RETURNING id, created_at`
-		err = db.conn.QueryRow(query, agent.Name, apiKeyHash, keyType, agent.Description).Scan(&newAgent.ID, &newAgent.CreatedAt)
-	case CockroachDB:
-		query := `INSERT INTO agents (name, api_key_hash, key_type, description) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
-		err = db.conn.QueryRow(query, agent.Name, apiKeyHash, keyType, agent.Description).Scan(&newAgent.ID, &newAgent.CreatedAt)
-	default:
-		return nil, fmt.Errorf("unsupported database type")
+	if _, err := db.conn.Exec(query, siteID, prefix, tokenHash); err != nil {
+		return fmt.Errorf("failed to set push token: %w", err)
 	}
 
+	return nil
+}
+
+// GetPushMonitor returns the push state of a site, or nil if it has none
+func (db *DB) GetPushMonitor(siteID int) (*models.PushMonitor, error) {
+	query := `SELECT ` + pushMonitorColumns + ` FROM push_monitors WHERE site_id = ` + db.placeholder(1)
+
+	push, err := scanPushMonitor(db.conn.QueryRow(query, siteID))
 	if err != nil {
-		return nil, fmt.Errorf("failed to add agent: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get push monitor: %w", err)
 	}
 
-	return &newAgent, nil
+	return push, nil
 }
 
-// GetAgents returns all agents
-func (db *DB) GetAgents() ([]*models.Agent, error) {
-	query := `SELECT id, name, description, last_seen, status, os, platform, architecture, version, remote_ip, created_at, api_key_hash FROM agents ORDER BY name`
+// GetPushMonitorByTokenHash returns the push state owning a token
+func (db *DB) GetPushMonitorByTokenHash(tokenHash string) (*models.PushMonitor, error) {
+	query := `SELECT ` + pushMonitorColumns + ` FROM push_monitors WHERE token_hash = ` + db.placeholder(1)
 
-	rows, err := db.conn.Query(query)
+	push, err := scanPushMonitor(db.conn.QueryRow(query, tokenHash))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get agents: %w", err)
-	}
-	defer rows.Close()
-
-	var agents []*models.Agent
-	for rows.Next() {
-		var agent models.Agent
-		err := rows.Scan(&agent.ID, &agent.Name, &agent.Description, &agent.LastSeen, &agent.Status,
-			&agent.OS, &agent.Platform, &agent.Architecture, &agent.Version, &agent.RemoteIP, &agent.CreatedAt, &agent.APIKeyHash)
-		if err != nil {
-			return nil, fmt.Errorf("failed to scan agent: %w", err)
+		if err == sql.ErrNoRows {
+			return nil, nil
 		}
-		agents = append(agents, &agent)
+		return nil, fmt.Errorf("failed to get push monitor: %w", err)
 	}
 
-	return agents, nil
+	return push, nil
 }
 
-// GetAgentByKeyHash returns an agent by API key hash
-func (db *DB) GetAgentByKeyHash(keyHash string) (*models.Agent, error) {
-	var query string
+// RecordPushStart marks a push site's job as running
+func (db *DB) RecordPushStart(siteID int, at time.Time) error {
+	query := fmt.Sprintf(`UPDATE push_monitors SET started_at = %s, last_ping_at = %s, missed_at = NULL WHERE site_id = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3))
+
+	if _, err := db.conn.Exec(query, at, at, siteID); err != nil {
+		return fmt.Errorf("failed to record push start: %w", err)
+	}
+
+	return nil
+}
+
+// RecordPushResult records the check reported by a push site's job and
+// clears its running and missed state
+func (db *DB) RecordPushResult(check *models.SiteCheck, at time.Time) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE push_monitors SET started_at = NULL, last_ping_at = %s, missed_at = NULL WHERE site_id = %s`,
+		db.placeholder(1), db.placeholder(2))
+	if _, err := tx.Exec(query, at, check.SiteID); err != nil {
+		return fmt.Errorf("failed to update push monitor: %w", err)
+	}
+
+	query = fmt.Sprintf(`INSERT INTO site_checks (site_id, status, response_time, status_code, error_message) VALUES (%s, %s, %s, %s, %s)`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5))
+	if _, err := tx.Exec(query, check.SiteID, check.Status, check.ResponseTime, check.StatusCode, check.ErrorMessage); err != nil {
+		return fmt.Errorf("failed to record check: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit push result: %w", err)
+	}
+
+	return nil
+}
+
+// RecordPushMissed records a down check for an overdue push site, once per
+// missed report. It reports whether the check was recorded.
+func (db *DB) RecordPushMissed(check *models.SiteCheck, at time.Time) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE push_monitors SET missed_at = %s WHERE site_id = %s AND missed_at IS NULL`,
+		db.placeholder(1), db.placeholder(2))
+	result, err := tx.Exec(query, at, check.SiteID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update push monitor: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	query = fmt.Sprintf(`INSERT INTO site_checks (site_id, status, response_time, status_code, error_message) VALUES (%s, %s, %s, %s, %s)`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5))
+	if _, err := tx.Exec(query, check.SiteID, check.Status, check.ResponseTime, check.StatusCode, check.ErrorMessage); err != nil {
+		return false, fmt.Errorf("failed to record check: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit missed push: %w", err)
+	}
+
+	return true, nil
+}
+
+// LastSiteResume returns when a site was last resumed, or nil if it never was
+func (db *DB) LastSiteResume(siteID int) (*time.Time, error) {
+	query := fmt.Sprintf(`SELECT resumed_at FROM site_pauses WHERE site_id = %s AND resumed_at IS NOT NULL ORDER BY resumed_at DESC LIMIT 1`,
+		db.placeholder(1))
+
+	var resumedAt time.Time
+	if err := db.conn.QueryRow(query, siteID).Scan(&resumedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get last resume: %w", err)
+	}
+
+	return &resumedAt, nil
+}
+
+// Content Changes
+
+// GetContentSnapshot returns the last known content of a site under change
+// detection, or nil if none was recorded yet
+func (db *DB) GetContentSnapshot(siteID int) (*models.ContentSnapshot, error) {
+	query := `SELECT hash, content FROM content_snapshots WHERE site_id = ` + db.placeholder(1)
+
+	var snapshot models.ContentSnapshot
+	if err := db.conn.QueryRow(query, siteID).Scan(&snapshot.Hash, &snapshot.Text); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get content snapshot: %w", err)
+	}
+
+	return &snapshot, nil
+}
+
+// SaveContentBaseline stores the first known content of a site. It returns
+// false when the site already has a snapshot.
+func (db *DB) SaveContentBaseline(siteID int, snapshot *models.ContentSnapshot, at time.Time) (bool, error) {
+	query := fmt.Sprintf(`INSERT INTO content_snapshots (site_id, hash, content, updated_at) VALUES (%s, %s, %s, %s)
+		ON CONFLICT (site_id) DO NOTHING`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4))
+
+	result, err := db.conn.Exec(query, siteID, snapshot.Hash, snapshot.Text, at)
+	if err != nil {
+		return false, fmt.Errorf("failed to save content baseline: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// DeleteContentSnapshot forgets a site's last known content so the next check
+// records a new baseline. Recorded changes are kept.
+func (db *DB) DeleteContentSnapshot(siteID int) error {
+	query := `DELETE FROM content_snapshots WHERE site_id = ` + db.placeholder(1)
+	if _, err := db.conn.Exec(query, siteID); err != nil {
+		return fmt.Errorf("failed to delete content snapshot: %w", err)
+	}
+	return nil
+}
+
+// RecordContentChange replaces a site's content snapshot and records the
+// change, keeping only the site's latest keep changes. It returns false
+// without recording anything when the snapshot no longer has
+// change.PreviousHash, i.e. another result recorded the change first.
+func (db *DB) RecordContentChange(change *models.ContentChange, snapshot *models.ContentSnapshot, keep int) (bool, error) {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := fmt.Sprintf(`UPDATE content_snapshots SET hash = %s, content = %s, updated_at = %s WHERE site_id = %s AND hash = %s`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5))
+	result, err := tx.Exec(query, snapshot.Hash, snapshot.Text, change.DetectedAt, change.SiteID, change.PreviousHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to update content snapshot: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return false, nil
+	}
+
+	query = fmt.Sprintf(`INSERT INTO content_changes (site_id, previous_hash, hash, diff, detected_at) VALUES (%s, %s, %s, %s, %s) RETURNING id`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3), db.placeholder(4), db.placeholder(5))
+	if err := tx.QueryRow(query, change.SiteID, change.PreviousHash, change.Hash, change.Diff, change.DetectedAt).Scan(&change.ID); err != nil {
+		return false, fmt.Errorf("failed to record content change: %w", err)
+	}
+
+	query = fmt.Sprintf(`DELETE FROM content_changes WHERE site_id = %s AND id NOT IN (
+		SELECT id FROM content_changes WHERE site_id = %s ORDER BY id DESC LIMIT %s)`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3))
+	if _, err := tx.Exec(query, change.SiteID, change.SiteID, keep); err != nil {
+		return false, fmt.Errorf("failed to prune content changes: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit content change: %w", err)
+	}
+
+	return true, nil
+}
+
+// GetContentChanges returns a site's recorded content changes, newest first
+func (db *DB) GetContentChanges(siteID int, limit int) ([]*models.ContentChange, error) {
+	query := fmt.Sprintf(`SELECT id, site_id, previous_hash, hash, diff, detected_at FROM content_changes
+		WHERE site_id = %s ORDER BY id DESC LIMIT %s`, db.placeholder(1), db.placeholder(2))
+
+	rows, err := db.conn.Query(query, siteID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get content changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*models.ContentChange{}
+	for rows.Next() {
+		var change models.ContentChange
+		if err := rows.Scan(&change.ID, &change.SiteID, &change.PreviousHash, &change.Hash, &change.Diff, &change.DetectedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan content change: %w", err)
+		}
+		changes = append(changes, &change)
+	}
+
+	return changes, rows.Err()
+}
+
+// GetTaskSiteID returns the site a monitoring task belongs to, or 0 if the task does not exist
+func (db *DB) GetTaskSiteID(taskID int) (int, error) {
+	query := `SELECT site_id FROM monitor_tasks WHERE id = ` + db.placeholder(1)
+
+	var siteID int
+	if err := db.conn.QueryRow(query, taskID).Scan(&siteID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get task site: %w", err)
+	}
+
+	return siteID, nil
+}
+
+// Agents
+
+// AddAgent adds a new agent
+func (db *DB) AddAgent(agent *models.AgentCreateRequest, apiKeyHash string) (*models.Agent, error) {
+	// Determine key type based on registration type
+	keyType := "permanent" // default
+	if agent.RegistrationType != nil && *agent.RegistrationType == "auto" {
+		keyType = "bootstrap"
+	}
+
+	var newAgent models.Agent
+	newAgent.Name = agent.Name
+	newAgent.APIKeyHash = apiKeyHash
+	newAgent.Description = agent.Description
+	newAgent.Status = "offline"
+
+	var err error
+	switch db.dbType {
+	case SQLite:
+		query := `INSERT INTO agents (name, api_key_hash, key_type, description) VALUES (?, ?, ?, ?) RETURNING id, created_at`
+		err = db.conn.QueryRow(query, agent.Name, apiKeyHash, keyType, agent.Description).Scan(&newAgent.ID, &newAgent.CreatedAt)
+	case CockroachDB:
+		query := `INSERT INTO agents (name, api_key_hash, key_type, description) VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+		err = db.conn.QueryRow(query, agent.Name, apiKeyHash, keyType, agent.Description).Scan(&newAgent.ID, &newAgent.CreatedAt)
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to add agent: %w", err)
+	}
+
+	return &newAgent, nil
+}
+
+// GetAgents returns all agents
+func (db *DB) GetAgents() ([]*models.Agent, error) {
+	query := `SELECT id, name, description, last_seen, status, os, platform, architecture, version, remote_ip, created_at, api_key_hash FROM agents ORDER BY name`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agents: %w", err)
+	}
+	defer rows.Close()
+
+	var agents []*models.Agent
+	for rows.Next() {
+		var agent models.Agent
+		err := rows.Scan(&agent.ID, &agent.Name, &agent.Description, &agent.LastSeen, &agent.Status,
+			&agent.OS, &agent.Platform, &agent.Architecture, &agent.Version, &agent.RemoteIP, &agent.CreatedAt, &agent.APIKeyHash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan agent: %w", err)
+		}
+		agents = append(agents, &agent)
+	}
+
+	return agents, nil
+}
+
+// GetAgentByKeyHash returns an agent by API key hash
+func (db *DB) GetAgentByKeyHash(keyHash string) (*models.Agent, error) {
+	var query string
 	switch db.dbType {
 	case SQLite:
 		query = `SELECT id, name, description, last_seen, status, os, platform, architecture, version, remote_ip, created_at FROM agents WHERE api_key_hash = ?`
@@ -953,6 +1688,24 @@ func (db *DB) GetAgentByKeyHash(keyHash string) (*models.Agent, error) {
 	return &agent, nil
 }
 
+// GetAgent returns an agent by ID
+func (db *DB) GetAgent(id int) (*models.Agent, error) {
+	query := `SELECT id, name, description, last_seen, status, os, platform, architecture, version, remote_ip, created_at, api_key_hash 
+			  FROM agents WHERE id = ` + db.placeholder(1)
+
+	var agent models.Agent
+	err := db.conn.QueryRow(query, id).Scan(&agent.ID, &agent.Name, &agent.Description, &agent.LastSeen, &agent.Status,
+		&agent.OS, &agent.Platform, &agent.Architecture, &agent.Version, &agent.RemoteIP, &agent.CreatedAt, &agent.APIKeyHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get agent: %w", err)
+	}
+
+	return &agent, nil
+}
+
 // UpdateAgentOSInfo updates agent OS information and status
 func (db *DB) UpdateAgentOSInfo(keyHash string, status string, osInfo map[string]interface{}) error {
 	var query string
@@ -1086,12 +1839,14 @@ func (db *DB) GetMonitorStats() (*models.MonitorStats, error) {
 	query := `
 		SELECT 
 			COUNT(*) as total_sites,
-			COUNT(CASE WHEN latest_status = 'up' THEN 1 END) as sites_up,
-			COUNT(CASE WHEN latest_status = 'down' THEN 1 END) as sites_down,
-			AVG(CASE WHEN latest_status = 'up' THEN latest_response_time END) as avg_response_time
+			COUNT(CASE WHEN latest_status = 'up' AND NOT paused THEN 1 END) as sites_up,
+			COUNT(CASE WHEN latest_status = 'down' AND NOT paused THEN 1 END) as sites_down,
+			COUNT(CASE WHEN paused THEN 1 END) as sites_paused,
+			AVG(CASE WHEN latest_status = 'up' AND NOT paused THEN latest_response_time END) as avg_response_time
 		FROM (
 			SELECT 
 				s.id,
+				` + sitePausedColumn + ` as paused,
 				sc.status as latest_status,
 				sc.response_time as latest_response_time
 			FROM sites s
@@ -1105,7 +1860,7 @@ func (db *DB) GetMonitorStats() (*models.MonitorStats, error) {
 	`
 
 	var stats models.MonitorStats
-	err := db.conn.QueryRow(query).Scan(&stats.TotalSites, &stats.SitesUp, &stats.SitesDown, &stats.AverageResponseTime)
+	err := db.conn.QueryRow(query).Scan(&stats.TotalSites, &stats.SitesUp, &stats.SitesDown, &stats.SitesPaused, &stats.AverageResponseTime)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get monitor stats: %w", err)
 	}
@@ -1115,9 +1870,23 @@ func (db *DB) GetMonitorStats() (*models.MonitorStats, error) {
 
 // Monitoring Tasks
 
+// scanMonitorTask scans a monitor_tasks row selected with the config column last
+func scanMonitorTask(rows *sql.Rows) (*models.MonitorTask, error) {
+	var task models.MonitorTask
+	var config sql.NullString
+	err := rows.Scan(&task.ID, &task.SiteID, &task.MonitorType, &task.URL, &task.Interval, &task.Timeout, &task.Enabled, &task.CreatedAt, &task.UpdatedAt, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan monitoring task: %w", err)
+	}
+	if task.Config, err = decodeMonitorConfig(config); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
 // GetMonitoringTasks returns all monitoring tasks
 func (db *DB) GetMonitoringTasks() ([]*models.MonitorTask, error) {
-	query := `SELECT id, site_id, monitor_type, url, interval, timeout, enabled, created_at, updated_at FROM monitor_tasks ORDER BY id`
+	query := `SELECT id, site_id, monitor_type, url, interval, timeout, enabled, created_at, updated_at, config FROM monitor_tasks ORDER BY id`
 
 	rows, err := db.conn.Query(query)
 	if err != nil {
@@ -1127,12 +1896,11 @@ func (db *DB) GetMonitoringTasks() ([]*models.MonitorTask, error) {
 
 	var tasks []*models.MonitorTask
 	for rows.Next() {
-		var task models.MonitorTask
-		err := rows.Scan(&task.ID, &task.SiteID, &task.MonitorType, &task.URL, &task.Interval, &task.Timeout, &task.Enabled, &task.CreatedAt, &task.UpdatedAt)
+		task, err := scanMonitorTask(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan monitoring task: %w", err)
+			return nil, err
 		}
-		tasks = append(tasks, &task)
+		tasks = append(tasks, task)
 	}
 
 	return tasks, nil
@@ -1140,7 +1908,7 @@ func (db *DB) GetMonitoringTasks() ([]*models.MonitorTask, error) {
 
 // GetEnabledMonitoringTasks returns all enabled monitoring tasks
 func (db *DB) GetEnabledMonitoringTasks() ([]*models.MonitorTask, error) {
-	query := `SELECT id, site_id, monitor_type, url, interval, timeout, enabled, created_at, updated_at FROM monitor_tasks WHERE enabled = 1 ORDER BY id`
+	query := `SELECT id, site_id, monitor_type, url, interval, timeout, enabled, created_at, updated_at, config FROM monitor_tasks WHERE enabled = 1 ORDER BY id`
 
 	rows, err := db.conn.Query(query)
 	if err != nil {
@@ -1150,12 +1918,11 @@ func (db *DB) GetEnabledMonitoringTasks() ([]*models.MonitorTask, error) {
 
 	var tasks []*models.MonitorTask
 	for rows.Next() {
-		var task models.MonitorTask
-		err := rows.Scan(&task.ID, &task.SiteID, &task.MonitorType, &task.URL, &task.Interval, &task.Timeout, &task.Enabled, &task.CreatedAt, &task.UpdatedAt)
+		task, err := scanMonitorTask(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan monitoring task: %w", err)
+			return nil, err
 		}
-		tasks = append(tasks, &task)
+		tasks = append(tasks, task)
 	}
 
 	return tasks, nil
@@ -1165,9 +1932,9 @@ func (db *DB) GetEnabledMonitoringTasks() ([]*models.MonitorTask, error) {
 func (db *DB) GetTasksForAgent(agentID int) ([]*models.MonitorTask, error) {
 	// For now, assign all enabled tasks to all agents (can be refined later)
 	query := `
-		SELECT mt.id, mt.site_id, mt.monitor_type, mt.url, mt.interval, mt.timeout, mt.enabled, mt.created_at, mt.updated_at 
+		SELECT mt.id, mt.site_id, mt.monitor_type, mt.url, mt.interval, mt.timeout, mt.enabled, mt.created_at, mt.updated_at, mt.config
 		FROM monitor_tasks mt 
-		WHERE mt.enabled = 1 
+		WHERE mt.enabled = 1 AND mt.monitor_type <> 'push'
 		ORDER BY mt.id
 	`
 
@@ -1179,12 +1946,11 @@ func (db *DB) GetTasksForAgent(agentID int) ([]*models.MonitorTask, error) {
 
 	var tasks []*models.MonitorTask
 	for rows.Next() {
-		var task models.MonitorTask
-		err := rows.Scan(&task.ID, &task.SiteID, &task.MonitorType, &task.URL, &task.Interval, &task.Timeout, &task.Enabled, &task.CreatedAt, &task.UpdatedAt)
+		task, err := scanMonitorTask(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan monitoring task: %w", err)
+			return nil, err
 		}
-		tasks = append(tasks, &task)
+		tasks = append(tasks, task)
 	}
 
 	return tasks, nil
@@ -1346,8 +2112,9 @@ func (db *DB) GetAnalyticsData(siteIDs []int, startTime time.Time, intervalMinut
 			JOIN sites s ON mt.site_id = s.id
 			WHERE mt.site_id IN (%s)
 			AND mr.checked_at >= ?
+			AND %s
 			ORDER BY mr.checked_at DESC
-		`, intervalMinutes, intervalMinutes, strings.Join(placeholders, ","))
+		`, intervalMinutes, intervalMinutes, strings.Join(placeholders, ","), db.notDuringPause("mt.site_id", "mr.checked_at"))
 		args = append(args, startTime)
 	} else {
 		query = fmt.Sprintf(`
@@ -1369,8 +2136,9 @@ func (db *DB) GetAnalyticsData(siteIDs []int, startTime time.Time, intervalMinut
 			JOIN monitor_tasks mt ON mr.task_id = mt.id
 			JOIN sites s ON mt.site_id = s.id
 			WHERE mr.checked_at >= ?
+			AND %s
 			ORDER BY mr.checked_at DESC
-		`, intervalMinutes, intervalMinutes)
+		`, intervalMinutes, intervalMinutes, db.notDuringPause("mt.site_id", "mr.checked_at"))
 		args = append(args, startTime)
 	}
 
@@ -1649,13 +2417,17 @@ func (db *DB) GetAgentByKeyHashWithType(keyHash string) (*models.Agent, string,
 // User authentication methods
 
 // CreateUser creates a new user account
-func (db *DB) CreateUser(req *models.UserRegistrationRequest, passwordHash string) (*models.User, error) {
+func (db *DB) CreateUser(req *models.UserRegistrationRequest, passwordHash, role string) (*models.User, error) {
+	if role == "" {
+		role = models.RoleViewer // Default role
+	}
+
 	var newUser models.User
 	newUser.Email = req.Email
 	newUser.PasswordHash = passwordHash
 	newUser.FirstName = req.FirstName
 	newUser.LastName = req.LastName
-	newUser.Role = "user" // Default role
+	newUser.Role = role
 	newUser.EmailVerified = false
 	newUser.TwoFactorEnabled = false
 
@@ -1664,12 +2436,12 @@ func (db *DB) CreateUser(req *models.UserRegistrationRequest, passwordHash strin
 	case SQLite:
 		query := `INSERT INTO users (email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled) 
 				  VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id, created_at, updated_at`
-		err = db.conn.QueryRow(query, req.Email, passwordHash, req.FirstName, req.LastName, "user",
+		err = db.conn.QueryRow(query, req.Email, passwordHash, req.FirstName, req.LastName, role,
 			db.boolValue(false), db.boolValue(false)).Scan(&newUser.ID, &newUser.CreatedAt, &newUser.UpdatedAt)
 	case CockroachDB:
 		query := `INSERT INTO users (email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled) 
 				  VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at, updated_at`
-		err = db.conn.QueryRow(query, req.Email, passwordHash, req.FirstName, req.LastName, "user",
+		err = db.conn.QueryRow(query, req.Email, passwordHash, req.FirstName, req.LastName, role,
 			db.boolValue(false), db.boolValue(false)).Scan(&newUser.ID, &newUser.CreatedAt, &newUser.UpdatedAt)
 	default:
 		return nil, fmt.Errorf("unsupported database type")
@@ -1682,16 +2454,55 @@ func (db *DB) CreateUser(req *models.UserRegistrationRequest, passwordHash strin
 	return &newUser, nil
 }
 
+// CreateFirstUser creates the first user account as an admin. The check for
+// existing users and the insert are one statement, so of concurrent first
+// registrations only one succeeds; the others get nil.
+func (db *DB) CreateFirstUser(req *models.UserRegistrationRequest, passwordHash string) (*models.User, error) {
+	newUser := models.User{
+		Email:        req.Email,
+		PasswordHash: passwordHash,
+		FirstName:    req.FirstName,
+		LastName:     req.LastName,
+		Role:         models.RoleAdmin,
+	}
+
+	// The placeholders are not column values, so CockroachDB needs their types spelled out
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `INSERT INTO users (email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled)
+			SELECT ?, ?, ?, ?, ?, ?, ? WHERE NOT EXISTS (SELECT 1 FROM users)
+			RETURNING id, created_at, updated_at`
+	case CockroachDB:
+		query = `INSERT INTO users (email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled)
+			SELECT $1::STRING, $2::STRING, $3::STRING, $4::STRING, $5::STRING, $6::BOOL, $7::BOOL WHERE NOT EXISTS (SELECT 1 FROM users)
+			RETURNING id, created_at, updated_at`
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+
+	err := db.conn.QueryRow(query, req.Email, passwordHash, req.FirstName, req.LastName, models.RoleAdmin,
+		db.boolValue(false), db.boolValue(false)).Scan(&newUser.ID, &newUser.CreatedAt, &newUser.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to create first user: %w", err)
+	}
+
+	return &newUser, nil
+}
+
 // GetUserByEmail returns a user by email address
 func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 	var query string
 	switch db.dbType {
 	case SQLite:
 		query = `SELECT id, email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled, 
-				 two_factor_secret, last_login_at, created_at, updated_at FROM users WHERE email = ?`
+				 two_factor_secret, disabled, last_login_at, created_at, updated_at FROM users WHERE email = ?`
 	case CockroachDB:
 		query = `SELECT id, email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled, 
-				 two_factor_secret, last_login_at, created_at, updated_at FROM users WHERE email = $1`
+				 two_factor_secret, disabled, last_login_at, created_at, updated_at FROM users WHERE email = $1`
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
@@ -1699,7 +2510,7 @@ func (db *DB) GetUserByEmail(email string) (*models.User, error) {
 	var user models.User
 	err := db.conn.QueryRow(query, email).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName,
 		&user.LastName, &user.Role, &user.EmailVerified, &user.TwoFactorEnabled, &user.TwoFactorSecret,
-		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
+		&user.Disabled, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -1716,10 +2527,10 @@ func (db *DB) GetUserByID(id int) (*models.User, error) {
 	switch db.dbType {
 	case SQLite:
 		query = `SELECT id, email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled, 
-				 two_factor_secret, last_login_at, created_at, updated_at FROM users WHERE id = ?`
+				 two_factor_secret, disabled, last_login_at, created_at, updated_at FROM users WHERE id = ?`
 	case CockroachDB:
 		query = `SELECT id, email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled, 
-				 two_factor_secret, last_login_at, created_at, updated_at FROM users WHERE id = $1`
+				 two_factor_secret, disabled, last_login_at, created_at, updated_at FROM users WHERE id = $1`
 	default:
 		return nil, fmt.Errorf("unsupported database type")
 	}
@@ -1727,7 +2538,7 @@ func (db *DB) GetUserByID(id int) (*models.User, error) {
 	var user models.User
 	err := db.conn.QueryRow(query, id).Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName,
 		&user.LastName, &user.Role, &user.EmailVerified, &user.TwoFactorEnabled, &user.TwoFactorSecret,
-		&user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
+		&user.Disabled, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -1738,40 +2549,163 @@ func (db *DB) GetUserByID(id int) (*models.User, error) {
 	return &user, nil
 }
 
-// CreateUserSession creates a new user session
-func (db *DB) CreateUserSession(userID int, sessionID, tokenHash string, expiresAt time.Time, userAgent, ipAddress *string) error {
+// CountUsers returns the number of user accounts
+func (db *DB) CountUsers() (int, error) {
+	var count int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM users`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count users: %w", err)
+	}
+	return count, nil
+}
+
+// CountActiveAdmins returns the number of enabled admin accounts
+func (db *DB) CountActiveAdmins() (int, error) {
+	query := fmt.Sprintf(`SELECT COUNT(*) FROM users WHERE role = %s AND disabled = %s`,
+		db.placeholder(1), db.placeholder(2))
+
+	var count int
+	if err := db.conn.QueryRow(query, models.RoleAdmin, db.boolValue(false)).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count admins: %w", err)
+	}
+	return count, nil
+}
+
+// GetUsers returns all user accounts
+func (db *DB) GetUsers() ([]*models.User, error) {
+	query := `SELECT id, email, password_hash, first_name, last_name, role, email_verified, two_factor_enabled, 
+			  two_factor_secret, disabled, last_login_at, created_at, updated_at FROM users ORDER BY email`
+
+	rows, err := db.conn.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.PasswordHash, &user.FirstName,
+			&user.LastName, &user.Role, &user.EmailVerified, &user.TwoFactorEnabled, &user.TwoFactorSecret,
+			&user.Disabled, &user.LastLoginAt, &user.CreatedAt, &user.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, &user)
+	}
+
+	return users, rows.Err()
+}
+
+// UpdateUserRole changes a user's role
+func (db *DB) UpdateUserRole(userID int, role string) error {
 	var query string
 	switch db.dbType {
 	case SQLite:
-		query = `INSERT INTO user_sessions (id, user_id, token_hash, expires_at, user_agent, ip_address) 
-				 VALUES (?, ?, ?, ?, ?, ?)`
+		query = `UPDATE users SET role = ?, updated_at = ? WHERE id = ?`
 	case CockroachDB:
-		query = `INSERT INTO user_sessions (id, user_id, token_hash, expires_at, user_agent, ip_address) 
-				 VALUES ($1, $2, $3, $4, $5, $6)`
+		query = `UPDATE users SET role = $1, updated_at = $2 WHERE id = $3`
 	default:
 		return fmt.Errorf("unsupported database type")
 	}
 
-	_, err := db.conn.Exec(query, sessionID, userID, tokenHash, expiresAt, userAgent, ipAddress)
+	result, err := db.conn.Exec(query, role, time.Now(), userID)
 	if err != nil {
-		return fmt.Errorf("failed to create user session: %w", err)
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
 	}
 
 	return nil
 }
 
-// GetUserSession returns a user session by token hash
-func (db *DB) GetUserSession(tokenHash string) (*models.UserSession, error) {
+// SetUserDisabled enables or disables a user account
+func (db *DB) SetUserDisabled(userID int, disabled bool) error {
 	var query string
 	switch db.dbType {
 	case SQLite:
-		query = `SELECT id, user_id, token_hash, expires_at, created_at, user_agent, ip_address 
-				 FROM user_sessions WHERE token_hash = ? AND expires_at > ?`
+		query = `UPDATE users SET disabled = ?, updated_at = ? WHERE id = ?`
 	case CockroachDB:
-		query = `SELECT id, user_id, token_hash, expires_at, created_at, user_agent, ip_address 
-				 FROM user_sessions WHERE token_hash = $1 AND expires_at > $2`
+		query = `UPDATE users SET disabled = $1, updated_at = $2 WHERE id = $3`
 	default:
-		return nil, fmt.Errorf("unsupported database type")
+		return fmt.Errorf("unsupported database type")
+	}
+
+	result, err := db.conn.Exec(query, db.boolValue(disabled), time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to update user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("user not found")
+	}
+
+	return nil
+}
+
+// DeleteUserSessions deletes every session belonging to a user
+func (db *DB) DeleteUserSessions(userID int) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `DELETE FROM user_sessions WHERE user_id = ?`
+	case CockroachDB:
+		query = `DELETE FROM user_sessions WHERE user_id = $1`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := db.conn.Exec(query, userID); err != nil {
+		return fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+
+	return nil
+}
+
+// CreateUserSession creates a new user session
+func (db *DB) CreateUserSession(userID int, sessionID, tokenHash string, expiresAt time.Time, userAgent, ipAddress *string) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `INSERT INTO user_sessions (id, user_id, token_hash, expires_at, user_agent, ip_address) 
+				 VALUES (?, ?, ?, ?, ?, ?)`
+	case CockroachDB:
+		query = `INSERT INTO user_sessions (id, user_id, token_hash, expires_at, user_agent, ip_address) 
+				 VALUES ($1, $2, $3, $4, $5, $6)`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	_, err := db.conn.Exec(query, sessionID, userID, tokenHash, expiresAt, userAgent, ipAddress)
+	if err != nil {
+		return fmt.Errorf("failed to create user session: %w", err)
+	}
+
+	return nil
+}
+
+// GetUserSession returns a user session by token hash
+func (db *DB) GetUserSession(tokenHash string) (*models.UserSession, error) {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `SELECT id, user_id, token_hash, expires_at, created_at, user_agent, ip_address 
+				 FROM user_sessions WHERE token_hash = ? AND expires_at > ?`
+	case CockroachDB:
+		query = `SELECT id, user_id, token_hash, expires_at, created_at, user_agent, ip_address 
+				 FROM user_sessions WHERE token_hash = $1 AND expires_at > $2`
+	default:
+		return nil, fmt.Errorf("unsupported database type")
 	}
 
 	var session models.UserSession
@@ -1905,6 +2839,158 @@ func (db *DB) VerifyEmail(token string) error {
 	return tx.Commit()
 }
 
+// CreatePasswordResetToken stores a hashed password reset token for a user
+func (db *DB) CreatePasswordResetToken(userID int, tokenHash string, expiresAt time.Time) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `INSERT INTO password_reset_tokens (user_id, token, expires_at) VALUES (?, ?, ?)`
+	case CockroachDB:
+		query = `INSERT INTO password_reset_tokens (user_id, token, expires_at) VALUES ($1, $2, $3)`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	_, err := db.conn.Exec(query, userID, tokenHash, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create password reset token: %w", err)
+	}
+
+	return nil
+}
+
+// Errors returned by ResetPasswordWithToken for tokens that cannot be redeemed
+var (
+	ErrResetTokenInvalid = errors.New("invalid reset token") // Unknown or already used
+	ErrResetTokenExpired = errors.New("reset token has expired")
+)
+
+// ResetPasswordWithToken redeems a password reset token: it sets the new
+// password, invalidates every outstanding reset token for the user and ends
+// all of the user's sessions. It returns the ID of the affected user.
+func (db *DB) ResetPasswordWithToken(tokenHash, passwordHash string) (int, error) {
+	var tokenID, userID int
+	var expiresAt time.Time
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `SELECT id, user_id, expires_at FROM password_reset_tokens WHERE token = ? AND used = ?`
+	case CockroachDB:
+		query = `SELECT id, user_id, expires_at FROM password_reset_tokens WHERE token = $1 AND used = $2`
+	default:
+		return 0, fmt.Errorf("unsupported database type")
+	}
+
+	err := db.conn.QueryRow(query, tokenHash, db.boolValue(false)).Scan(&tokenID, &userID, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrResetTokenInvalid
+		}
+		return 0, fmt.Errorf("failed to find reset token: %w", err)
+	}
+	if !expiresAt.After(time.Now()) {
+		return 0, ErrResetTokenExpired
+	}
+
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Claim the token; a concurrent redemption will find it already used
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE password_reset_tokens SET used = ? WHERE id = ? AND used = ?`
+	case CockroachDB:
+		query = `UPDATE password_reset_tokens SET used = $1 WHERE id = $2 AND used = $3`
+	}
+
+	result, err := tx.Exec(query, db.boolValue(true), tokenID, db.boolValue(false))
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark reset token as used: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return 0, ErrResetTokenInvalid
+	}
+
+	// Set the new password
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`
+	case CockroachDB:
+		query = `UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3`
+	}
+
+	if _, err := tx.Exec(query, passwordHash, time.Now(), userID); err != nil {
+		return 0, fmt.Errorf("failed to update password: %w", err)
+	}
+
+	// Invalidate any other outstanding reset tokens
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE password_reset_tokens SET used = ? WHERE user_id = ?`
+	case CockroachDB:
+		query = `UPDATE password_reset_tokens SET used = $1 WHERE user_id = $2`
+	}
+
+	if _, err := tx.Exec(query, db.boolValue(true), userID); err != nil {
+		return 0, fmt.Errorf("failed to invalidate reset tokens: %w", err)
+	}
+
+	// End every existing session
+	switch db.dbType {
+	case SQLite:
+		query = `DELETE FROM user_sessions WHERE user_id = ?`
+	case CockroachDB:
+		query = `DELETE FROM user_sessions WHERE user_id = $1`
+	}
+
+	if _, err := tx.Exec(query, userID); err != nil {
+		return 0, fmt.Errorf("failed to delete user sessions: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit password reset: %w", err)
+	}
+
+	return userID, nil
+}
+
+// ChangePassword sets a new password for a user and ends all of their other sessions
+func (db *DB) ChangePassword(userID int, passwordHash, keepSessionID string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var updateQuery, deleteQuery string
+	switch db.dbType {
+	case SQLite:
+		updateQuery = `UPDATE users SET password_hash = ?, updated_at = ? WHERE id = ?`
+		deleteQuery = `DELETE FROM user_sessions WHERE user_id = ? AND id != ?`
+	case CockroachDB:
+		updateQuery = `UPDATE users SET password_hash = $1, updated_at = $2 WHERE id = $3`
+		deleteQuery = `DELETE FROM user_sessions WHERE user_id = $1 AND id != $2`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := tx.Exec(updateQuery, passwordHash, time.Now(), userID); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if _, err := tx.Exec(deleteQuery, userID, keepSessionID); err != nil {
+		return fmt.Errorf("failed to delete other sessions: %w", err)
+	}
+
+	return tx.Commit()
+}
+
 // UpdateLastLogin updates the user's last login timestamp
 func (db *DB) UpdateLastLogin(userID int) error {
 	var query string
@@ -1926,7 +3012,506 @@ func (db *DB) UpdateLastLogin(userID int) error {
 	return nil
 }
 
+// GetUserIDByOIDCSubject returns the ID of the user linked to an OIDC subject, or 0 if none is linked
+func (db *DB) GetUserIDByOIDCSubject(subject string) (int, error) {
+	query := `SELECT id FROM users WHERE oidc_subject = ` + db.placeholder(1)
+
+	var userID int
+	if err := db.conn.QueryRow(query, subject).Scan(&userID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to look up OIDC subject: %w", err)
+	}
+
+	return userID, nil
+}
+
+// LinkUserOIDCSubject links a user account to an OIDC subject (issuer and subject identifier)
+func (db *DB) LinkUserOIDCSubject(userID int, subject string) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE users SET oidc_subject = ?, updated_at = ? WHERE id = ?`
+	case CockroachDB:
+		query = `UPDATE users SET oidc_subject = $1, updated_at = $2 WHERE id = $3`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := db.conn.Exec(query, subject, time.Now(), userID); err != nil {
+		return fmt.Errorf("failed to link OIDC subject: %w", err)
+	}
+
+	return nil
+}
+
+// SetTwoFactorSecret stores a pending (not yet confirmed) TOTP secret for a
+// user. The replay guard starts over, since steps used with an earlier secret
+// say nothing about codes from the new one.
+func (db *DB) SetTwoFactorSecret(userID int, encryptedSecret string) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE users SET two_factor_secret = ?, totp_last_step = NULL, updated_at = ? WHERE id = ?`
+	case CockroachDB:
+		query = `UPDATE users SET two_factor_secret = $1, totp_last_step = NULL, updated_at = $2 WHERE id = $3`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	_, err := db.conn.Exec(query, encryptedSecret, time.Now(), userID)
+	if err != nil {
+		return fmt.Errorf("failed to set two-factor secret: %w", err)
+	}
+
+	return nil
+}
+
+// AcceptTOTPStep records the time step of a valid TOTP code. It returns false
+// when a code from this or a later step was already accepted for the user.
+func (db *DB) AcceptTOTPStep(userID int, step int64) (bool, error) {
+	query := fmt.Sprintf(`UPDATE users SET totp_last_step = %s WHERE id = %s AND (totp_last_step IS NULL OR totp_last_step < %s)`,
+		db.placeholder(1), db.placeholder(2), db.placeholder(3))
+
+	result, err := db.conn.Exec(query, step, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP step: %w", err)
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// EnableTwoFactor turns on 2FA for a user and replaces their backup codes
+func (db *DB) EnableTwoFactor(userID int, backupCodeHashes []string) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var updateQuery, deleteQuery, insertQuery string
+	switch db.dbType {
+	case SQLite:
+		updateQuery = `UPDATE users SET two_factor_enabled = ?, updated_at = ? WHERE id = ?`
+		deleteQuery = `DELETE FROM two_factor_backup_codes WHERE user_id = ?`
+		insertQuery = `INSERT INTO two_factor_backup_codes (user_id, code_hash) VALUES (?, ?)`
+	case CockroachDB:
+		updateQuery = `UPDATE users SET two_factor_enabled = $1, updated_at = $2 WHERE id = $3`
+		deleteQuery = `DELETE FROM two_factor_backup_codes WHERE user_id = $1`
+		insertQuery = `INSERT INTO two_factor_backup_codes (user_id, code_hash) VALUES ($1, $2)`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := tx.Exec(updateQuery, db.boolValue(true), time.Now(), userID); err != nil {
+		return fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	if _, err := tx.Exec(deleteQuery, userID); err != nil {
+		return fmt.Errorf("failed to delete old backup codes: %w", err)
+	}
+	for _, codeHash := range backupCodeHashes {
+		if _, err := tx.Exec(insertQuery, userID, codeHash); err != nil {
+			return fmt.Errorf("failed to store backup code: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DisableTwoFactor turns off 2FA for a user and removes their secret and backup codes
+func (db *DB) DisableTwoFactor(userID int) error {
+	tx, err := db.conn.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var updateQuery, deleteQuery string
+	switch db.dbType {
+	case SQLite:
+		updateQuery = `UPDATE users SET two_factor_enabled = ?, two_factor_secret = NULL, updated_at = ? WHERE id = ?`
+		deleteQuery = `DELETE FROM two_factor_backup_codes WHERE user_id = ?`
+	case CockroachDB:
+		updateQuery = `UPDATE users SET two_factor_enabled = $1, two_factor_secret = NULL, updated_at = $2 WHERE id = $3`
+		deleteQuery = `DELETE FROM two_factor_backup_codes WHERE user_id = $1`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := tx.Exec(updateQuery, db.boolValue(false), time.Now(), userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if _, err := tx.Exec(deleteQuery, userID); err != nil {
+		return fmt.Errorf("failed to delete backup codes: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetUnusedBackupCodes returns the backup codes a user has not consumed yet
+func (db *DB) GetUnusedBackupCodes(userID int) ([]*models.TwoFactorAuth, error) {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `SELECT id, user_id, code_hash, used, created_at, used_at 
+				 FROM two_factor_backup_codes WHERE user_id = ? AND used_at IS NULL`
+	case CockroachDB:
+		query = `SELECT id, user_id, code_hash, used, created_at, used_at 
+				 FROM two_factor_backup_codes WHERE user_id = $1 AND used_at IS NULL`
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query backup codes: %w", err)
+	}
+	defer rows.Close()
+
+	var codes []*models.TwoFactorAuth
+	for rows.Next() {
+		var code models.TwoFactorAuth
+		if err := rows.Scan(&code.ID, &code.UserID, &code.Code, &code.Used, &code.CreatedAt, &code.UsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan backup code: %w", err)
+		}
+		codes = append(codes, &code)
+	}
+
+	return codes, rows.Err()
+}
+
+// ConsumeBackupCode marks a backup code as used. It returns false if the code
+// was already consumed, so each code can only be redeemed once.
+func (db *DB) ConsumeBackupCode(codeID int) (bool, error) {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE two_factor_backup_codes SET used = ?, used_at = ? WHERE id = ? AND used_at IS NULL`
+	case CockroachDB:
+		query = `UPDATE two_factor_backup_codes SET used = $1, used_at = $2 WHERE id = $3 AND used_at IS NULL`
+	default:
+		return false, fmt.Errorf("unsupported database type")
+	}
+
+	result, err := db.conn.Exec(query, db.boolValue(true), time.Now(), codeID)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume backup code: %w", err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check consumed backup code: %w", err)
+	}
+
+	return affected == 1, nil
+}
+
 // ValidateMasterAPIKey validates the master API key (preserves emergency access)
 func (db *DB) ValidateMasterAPIKey(apiKey, masterKey string) bool {
-	return apiKey == masterKey
+	if apiKey == "" || masterKey == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(apiKey), []byte(masterKey)) == 1
+}
+
+// apiTokenColumns lists the api_tokens columns read by scanAPIToken
+const apiTokenColumns = `id, user_id, name, token_prefix, token_hash, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_at`
+
+// scanAPIToken scans a row selected with apiTokenColumns
+func scanAPIToken(row interface{ Scan(...interface{}) error }) (*models.APIToken, error) {
+	var token models.APIToken
+	var scopes string
+	if err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Prefix, &token.TokenHash, &scopes,
+		&token.ExpiresAt, &token.LastUsedAt, &token.LastUsedIP, &token.RevokedAt, &token.CreatedAt); err != nil {
+		return nil, err
+	}
+	token.Scopes = []string{}
+	if scopes != "" {
+		token.Scopes = strings.Split(scopes, ",")
+	}
+	return &token, nil
+}
+
+// CreateAPIToken stores a new personal access token for a user
+func (db *DB) CreateAPIToken(userID int, name, prefix, tokenHash string, scopes []string, expiresAt *time.Time) (*models.APIToken, error) {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at) 
+				 VALUES (?, ?, ?, ?, ?, ?) RETURNING ` + apiTokenColumns
+	case CockroachDB:
+		query = `INSERT INTO api_tokens (user_id, name, token_prefix, token_hash, scopes, expires_at) 
+				 VALUES ($1, $2, $3, $4, $5, $6) RETURNING ` + apiTokenColumns
+	default:
+		return nil, fmt.Errorf("unsupported database type")
+	}
+
+	token, err := scanAPIToken(db.conn.QueryRow(query, userID, name, prefix, tokenHash, strings.Join(scopes, ","), expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetAPITokenByHash returns the personal access token with the given hash
+func (db *DB) GetAPITokenByHash(tokenHash string) (*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = ` + db.placeholder(1)
+
+	token, err := scanAPIToken(db.conn.QueryRow(query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetAPIToken returns a personal access token by ID
+func (db *DB) GetAPIToken(id int) (*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE id = ` + db.placeholder(1)
+
+	token, err := scanAPIToken(db.conn.QueryRow(query, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetAPITokensForUser returns all personal access tokens owned by a user, newest first
+func (db *DB) GetAPITokensForUser(userID int) ([]*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = ` + db.placeholder(1) + ` ORDER BY created_at DESC, id DESC`
+
+	rows, err := db.conn.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RenameAPIToken changes the display name of a personal access token
+func (db *DB) RenameAPIToken(id int, name string) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE api_tokens SET name = ? WHERE id = ?`
+	case CockroachDB:
+		query = `UPDATE api_tokens SET name = $1 WHERE id = $2`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	result, err := db.conn.Exec(query, name, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename API token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("API token not found")
+	}
+
+	return nil
+}
+
+// RevokeAPIToken revokes a personal access token. Revoking an already revoked token is a no-op.
+func (db *DB) RevokeAPIToken(id int) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	case CockroachDB:
+		query = `UPDATE api_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := db.conn.Exec(query, time.Now(), id); err != nil {
+		return fmt.Errorf("failed to revoke API token: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateAPITokenLastUsed records when and from where a personal access token was last used
+func (db *DB) UpdateAPITokenLastUsed(id int, usedAt time.Time, ipAddress string) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `UPDATE api_tokens SET last_used_at = ?, last_used_ip = ? WHERE id = ?`
+	case CockroachDB:
+		query = `UPDATE api_tokens SET last_used_at = $1, last_used_ip = $2 WHERE id = $3`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if _, err := db.conn.Exec(query, usedAt, ipAddress, id); err != nil {
+		return fmt.Errorf("failed to update API token last use: %w", err)
+	}
+
+	return nil
+}
+
+// nullableJSON converts an empty JSON document to a SQL NULL
+func nullableJSON(data json.RawMessage) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// RecordAuditEvent stores an audit event
+func (db *DB) RecordAuditEvent(event *models.AuditEvent) error {
+	var query string
+	switch db.dbType {
+	case SQLite:
+		query = `INSERT INTO audit_events (actor_type, actor_id, actor_name, action, target_type, target_id, 
+				 source_ip, request_id, before_data, after_data, created_at) 
+				 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	case CockroachDB:
+		query = `INSERT INTO audit_events (actor_type, actor_id, actor_name, action, target_type, target_id, 
+				 source_ip, request_id, before_data, after_data, created_at) 
+				 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
+	default:
+		return fmt.Errorf("unsupported database type")
+	}
+
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	_, err := db.conn.Exec(query, event.ActorType, event.ActorID, event.ActorName, event.Action,
+		event.TargetType, event.TargetID, event.SourceIP, event.RequestID,
+		nullableJSON(event.Before), nullableJSON(event.After), event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to record audit event: %w", err)
+	}
+
+	return nil
+}
+
+// GetAuditEvents returns a page of audit events matching the filter, newest
+// first, together with the total number of matching events
+func (db *DB) GetAuditEvents(filter *models.AuditEventFilter) ([]*models.AuditEvent, int, error) {
+	var conditions []string
+	var args []interface{}
+	addCondition := func(clause string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(clause, db.placeholder(len(args))))
+	}
+
+	if filter.ActorType != "" {
+		addCondition("actor_type = %s", filter.ActorType)
+	}
+	if filter.ActorID != "" {
+		addCondition("actor_id = %s", filter.ActorID)
+	}
+	if filter.Action != "" {
+		if strings.HasSuffix(filter.Action, ".") {
+			addCondition("action LIKE %s", filter.Action+"%")
+		} else {
+			addCondition("action = %s", filter.Action)
+		}
+	}
+	if filter.TargetType != "" {
+		addCondition("target_type = %s", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		addCondition("target_id = %s", filter.TargetID)
+	}
+	if filter.Since != nil {
+		addCondition("created_at >= %s", *filter.Since)
+	}
+	if filter.Until != nil {
+		addCondition("created_at < %s", *filter.Until)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	if err := db.conn.QueryRow(`SELECT COUNT(*) FROM audit_events`+where, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	query := fmt.Sprintf(`SELECT id, actor_type, actor_id, actor_name, action, target_type, target_id, 
+			  source_ip, request_id, before_data, after_data, created_at 
+			  FROM audit_events%s ORDER BY created_at DESC, id DESC LIMIT %s OFFSET %s`,
+		where, db.placeholder(len(args)+1), db.placeholder(len(args)+2))
+	args = append(args, filter.Limit, filter.Offset)
+
+	rows, err := db.conn.Query(query, args...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []*models.AuditEvent
+	for rows.Next() {
+		var event models.AuditEvent
+		var actorID, actorName, targetType, targetID, sourceIP, requestID, before, after sql.NullString
+		if err := rows.Scan(&event.ID, &event.ActorType, &actorID, &actorName, &event.Action, &targetType, &targetID,
+			&sourceIP, &requestID, &before, &after, &event.CreatedAt); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		event.ActorID = actorID.String
+		event.ActorName = actorName.String
+		event.TargetType = targetType.String
+		event.TargetID = targetID.String
+		event.SourceIP = sourceIP.String
+		event.RequestID = requestID.String
+		if before.Valid {
+			event.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			event.After = json.RawMessage(after.String)
+		}
+		events = append(events, &event)
+	}
+
+	return events, total, rows.Err()
+}
+
+// DeleteAuditEventsBefore removes audit events older than the cutoff and returns how many were deleted
+func (db *DB) DeleteAuditEventsBefore(cutoff time.Time) (int64, error) {
+	query := `DELETE FROM audit_events WHERE created_at < ` + db.placeholder(1)
+
+	result, err := db.conn.Exec(query, cutoff)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete old audit events: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return rowsAffected, nil
 }
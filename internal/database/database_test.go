@@ -0,0 +1,306 @@
+package database
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/config"
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// newTestDB opens a fresh SQLite database with the full schema
+func newTestDB(t *testing.T) *DB {
+	t.Helper()
+
+	db, err := New(&config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "sreootb.db")})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// addTestSite adds a site to monitor
+func addTestSite(t *testing.T, db *DB, name string) *models.Site {
+	t.Helper()
+
+	site, err := db.AddSite(&models.SiteCreateRequest{URL: "https://" + name + ".example.com", Name: name, ScanInterval: "60s"})
+	if err != nil {
+		t.Fatalf("add site %s: %v", name, err)
+	}
+	return site
+}
+
+// siteStatus returns the status of one site
+func siteStatus(t *testing.T, db *DB, siteID int) *models.SiteStatus {
+	t.Helper()
+
+	statuses, err := db.GetSiteStatus()
+	if err != nil {
+		t.Fatalf("GetSiteStatus: %v", err)
+	}
+	for _, status := range statuses {
+		if status.ID == siteID {
+			return status
+		}
+	}
+	t.Fatalf("site %d has no status", siteID)
+	return nil
+}
+
+func TestSiteStatusExcludesChecksDuringPause(t *testing.T) {
+	db := newTestDB(t)
+	site := addTestSite(t, db, "api")
+	other := addTestSite(t, db, "web")
+
+	// One closed pause from 10:00 to 11:00, and one still open since 12:00
+	pauses := []struct {
+		pausedAt  string
+		resumedAt interface{}
+	}{
+		{"2026-01-01 10:00:00", "2026-01-01 11:00:00"},
+		{"2026-01-01 12:00:00", nil},
+	}
+	for _, p := range pauses {
+		if _, err := db.conn.Exec(`INSERT INTO site_pauses (site_id, paused_at, resumed_at) VALUES (?, ?, ?)`, site.ID, p.pausedAt, p.resumedAt); err != nil {
+			t.Fatalf("insert pause: %v", err)
+		}
+	}
+
+	checks := []struct {
+		checkedAt string
+		status    string
+		counted   bool
+	}{
+		{"2026-01-01 09:59:59", "up", true},
+		{"2026-01-01 10:00:00", "down", false}, // the pause starts inclusive
+		{"2026-01-01 10:30:00", "down", false},
+		{"2026-01-01 11:00:00", "up", true}, // and ends exclusive
+		{"2026-01-01 11:30:00", "down", true},
+		{"2026-01-01 12:30:00", "down", false},
+	}
+	wantUp, wantDown := 0, 0
+	for _, c := range checks {
+		for _, siteID := range []int{site.ID, other.ID} {
+			if _, err := db.conn.Exec(`INSERT INTO site_checks (site_id, status, checked_at) VALUES (?, ?, ?)`, siteID, c.status, c.checkedAt); err != nil {
+				t.Fatalf("insert check: %v", err)
+			}
+		}
+		if c.counted && c.status == "up" {
+			wantUp++
+		} else if c.counted {
+			wantDown++
+		}
+	}
+
+	status := siteStatus(t, db, site.ID)
+	if status.TotalUp != wantUp || status.TotalDown != wantDown {
+		t.Errorf("paused site counts up=%d down=%d, want up=%d down=%d", status.TotalUp, status.TotalDown, wantUp, wantDown)
+	}
+
+	// Another site's pauses do not affect its counts
+	status = siteStatus(t, db, other.ID)
+	if status.TotalUp != 2 || status.TotalDown != 4 {
+		t.Errorf("unpaused site counts up=%d down=%d, want up=2 down=4", status.TotalUp, status.TotalDown)
+	}
+}
+
+func TestSetSitePaused(t *testing.T) {
+	db := newTestDB(t)
+	site := addTestSite(t, db, "api")
+
+	steps := []struct {
+		paused      bool
+		wantChanged bool
+	}{
+		{false, false}, // resuming an active site is a no-op
+		{true, true},
+		{true, false}, // as is pausing a paused one
+		{false, true},
+		{true, true},
+	}
+	for i, step := range steps {
+		changed, err := db.SetSitePaused(site.ID, step.paused)
+		if err != nil {
+			t.Fatalf("step %d: SetSitePaused(%v): %v", i, step.paused, err)
+		}
+		if changed != step.wantChanged {
+			t.Errorf("step %d: SetSitePaused(%v) changed = %v, want %v", i, step.paused, changed, step.wantChanged)
+		}
+	}
+
+	var periods, open int
+	if err := db.conn.QueryRow(`SELECT COUNT(*), COUNT(*) - COUNT(resumed_at) FROM site_pauses WHERE site_id = ?`, site.ID).Scan(&periods, &open); err != nil {
+		t.Fatalf("count pauses: %v", err)
+	}
+	if periods != 2 || open != 1 {
+		t.Errorf("recorded %d pause periods with %d open, want 2 with 1 open", periods, open)
+	}
+
+	status := siteStatus(t, db, site.ID)
+	if !status.Paused || status.Status == nil || *status.Status != "paused" || status.PausedAt == nil {
+		t.Errorf("paused site status = %+v", status)
+	}
+}
+
+// Checks written as Go times with a zone offset are compared with pauses
+// written by CURRENT_TIMESTAMP in UTC by instant, not as strings
+func TestSiteStatusPauseWindowAcrossTimestampFormats(t *testing.T) {
+	db := newTestDB(t)
+	site := addTestSite(t, db, "api")
+
+	if _, err := db.conn.Exec(`INSERT INTO site_pauses (site_id, paused_at, resumed_at) VALUES (?, ?, ?)`,
+		site.ID, "2026-01-01 10:00:00", "2026-01-01 11:00:00"); err != nil {
+		t.Fatalf("insert pause: %v", err)
+	}
+
+	east := time.FixedZone("UTC+2", 2*60*60)
+	west := time.FixedZone("UTC-2", -2*60*60)
+	checks := []struct {
+		checkedAt time.Time
+		status    string
+	}{
+		{time.Date(2026, 1, 1, 12, 30, 0, 0, east), "down"}, // 10:30 UTC, while paused
+		{time.Date(2026, 1, 1, 9, 30, 0, 0, west), "up"},    // 11:30 UTC, after resuming
+		{time.Date(2026, 1, 1, 9, 59, 0, 0, time.UTC), "up"},
+	}
+	for _, c := range checks {
+		if _, err := db.conn.Exec(`INSERT INTO site_checks (site_id, status, checked_at) VALUES (?, ?, ?)`, site.ID, c.status, c.checkedAt); err != nil {
+			t.Fatalf("insert check: %v", err)
+		}
+	}
+
+	status := siteStatus(t, db, site.ID)
+	if status.TotalUp != 2 || status.TotalDown != 0 {
+		t.Errorf("counts up=%d down=%d, want up=2 down=0", status.TotalUp, status.TotalDown)
+	}
+}
+
+// Of concurrent first registrations exactly one creates the admin account
+func TestCreateFirstUserRace(t *testing.T) {
+	db := newTestDB(t)
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	created := make(chan *models.User, attempts)
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			req := &models.UserRegistrationRequest{Email: fmt.Sprintf("admin%d@example.com", i), FirstName: "First", LastName: "Admin"}
+			user, err := db.CreateFirstUser(req, "hash")
+			if err != nil {
+				errs <- err
+				return
+			}
+			if user != nil {
+				created <- user
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(created)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("CreateFirstUser: %v", err)
+	}
+	var users []*models.User
+	for user := range created {
+		users = append(users, user)
+	}
+	if len(users) != 1 {
+		t.Fatalf("%d first users were created, want 1", len(users))
+	}
+	if users[0].Role != models.RoleAdmin {
+		t.Errorf("first user role = %s, want %s", users[0].Role, models.RoleAdmin)
+	}
+	if count, err := db.CountUsers(); err != nil || count != 1 {
+		t.Errorf("CountUsers() = %d, %v, want 1", count, err)
+	}
+
+	// Once an account exists nobody else becomes the first user
+	user, err := db.CreateFirstUser(&models.UserRegistrationRequest{Email: "late@example.com", FirstName: "Late", LastName: "Comer"}, "hash")
+	if err != nil || user != nil {
+		t.Errorf("CreateFirstUser after the first = %v, %v, want nil, nil", user, err)
+	}
+}
+
+// addTestUser creates a user account
+func addTestUser(t *testing.T, db *DB, email string) *models.User {
+	t.Helper()
+
+	user, err := db.CreateUser(&models.UserRegistrationRequest{Email: email, FirstName: "Test", LastName: "User"}, "hash", models.RoleViewer)
+	if err != nil {
+		t.Fatalf("create user %s: %v", email, err)
+	}
+	return user
+}
+
+func TestAcceptTOTPStep(t *testing.T) {
+	db := newTestDB(t)
+	user := addTestUser(t, db, "user@example.com")
+	other := addTestUser(t, db, "other@example.com")
+
+	accept := func(userID int, step int64, want bool) {
+		t.Helper()
+		accepted, err := db.AcceptTOTPStep(userID, step)
+		if err != nil {
+			t.Fatalf("AcceptTOTPStep(%d): %v", step, err)
+		}
+		if accepted != want {
+			t.Errorf("AcceptTOTPStep(%d) = %v, want %v", step, accepted, want)
+		}
+	}
+
+	if err := db.SetTwoFactorSecret(user.ID, "secret-1"); err != nil {
+		t.Fatalf("SetTwoFactorSecret: %v", err)
+	}
+	accept(user.ID, 100, true)
+	accept(user.ID, 100, false) // the same code again
+	accept(user.ID, 99, false)  // an older code still inside the skew window
+	accept(user.ID, 101, true)
+	accept(other.ID, 100, true) // steps are tracked per user
+
+	// A new secret starts a new sequence of steps
+	if err := db.SetTwoFactorSecret(user.ID, "secret-2"); err != nil {
+		t.Fatalf("SetTwoFactorSecret: %v", err)
+	}
+	accept(user.ID, 101, true)
+	accept(user.ID, 101, false)
+}
+
+func TestConsumeBackupCodeOnce(t *testing.T) {
+	db := newTestDB(t)
+	user := addTestUser(t, db, "user@example.com")
+
+	if err := db.EnableTwoFactor(user.ID, []string{"hash-a", "hash-b"}); err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+	codes, err := db.GetUnusedBackupCodes(user.ID)
+	if err != nil || len(codes) != 2 {
+		t.Fatalf("GetUnusedBackupCodes = %d codes, %v, want 2", len(codes), err)
+	}
+
+	if consumed, err := db.ConsumeBackupCode(codes[0].ID); err != nil || !consumed {
+		t.Fatalf("first ConsumeBackupCode = %v, %v, want true", consumed, err)
+	}
+	if consumed, err := db.ConsumeBackupCode(codes[0].ID); err != nil || consumed {
+		t.Errorf("second ConsumeBackupCode = %v, %v, want false", consumed, err)
+	}
+	if remaining, _ := db.GetUnusedBackupCodes(user.ID); len(remaining) != 1 || remaining[0].ID != codes[1].ID {
+		t.Errorf("unused codes after redeeming one = %+v", remaining)
+	}
+
+	// Re-enrolling replaces every code
+	if err := db.EnableTwoFactor(user.ID, []string{"hash-c"}); err != nil {
+		t.Fatalf("EnableTwoFactor: %v", err)
+	}
+	if remaining, _ := db.GetUnusedBackupCodes(user.ID); len(remaining) != 1 || remaining[0].Code != "hash-c" {
+		t.Errorf("unused codes after re-enrolling = %+v", remaining)
+	}
+}
@@ -1,14 +1,34 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"net"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// User roles, from least to most privileged
+const (
+	RoleViewer = "viewer" // Read-only access to sites, agents and analytics
+	RoleEditor = "editor" // Viewer access plus creating and deleting sites
+	RoleAdmin  = "admin"  // Full access including agents, keys and users
+)
+
+// IsValidRole reports whether role is one of the known user roles
+func IsValidRole(role string) bool {
+	switch role {
+	case RoleViewer, RoleEditor, RoleAdmin:
+		return true
+	}
+	return false
+}
+
 // User represents a user account
 type User struct {
 	ID               int        `json:"id" db:"id"`
@@ -16,10 +36,11 @@ type User struct {
 	PasswordHash     string     `json:"-" db:"password_hash"`
 	FirstName        string     `json:"first_name" db:"first_name"`
 	LastName         string     `json:"last_name" db:"last_name"`
-	Role             string     `json:"role" db:"role"` // "admin", "user"
+	Role             string     `json:"role" db:"role"` // "admin", "editor", "viewer"
 	EmailVerified    bool       `json:"email_verified" db:"email_verified"`
 	TwoFactorEnabled bool       `json:"two_factor_enabled" db:"two_factor_enabled"`
 	TwoFactorSecret  *string    `json:"-" db:"two_factor_secret"` // TOTP secret, encrypted
+	Disabled         bool       `json:"disabled" db:"disabled"`   // Disabled accounts cannot log in
 	LastLoginAt      *time.Time `json:"last_login_at" db:"last_login_at"`
 	CreatedAt        time.Time  `json:"created_at" db:"created_at"`
 	UpdatedAt        time.Time  `json:"updated_at" db:"updated_at"`
@@ -58,10 +79,11 @@ type TwoFactorAuth struct {
 
 // UserRegistrationRequest represents a user registration request
 type UserRegistrationRequest struct {
-	Email     string `json:"email" validate:"required,email"`
-	Password  string `json:"password" validate:"required,min=8"`
-	FirstName string `json:"first_name" validate:"required,min=1"`
-	LastName  string `json:"last_name" validate:"required,min=1"`
+	Email      string `json:"email" validate:"required,email"`
+	Password   string `json:"password" validate:"required,min=8"`
+	FirstName  string `json:"first_name" validate:"required,min=1"`
+	LastName   string `json:"last_name" validate:"required,min=1"`
+	SetupToken string `json:"setup_token,omitempty"` // Authorizes creating the first account (server.auth.setup_token)
 }
 
 // UserLoginRequest represents a user login request
@@ -128,6 +150,117 @@ type ResetPasswordRequest struct {
 	NewPassword string `json:"new_password" validate:"required,min=8"`
 }
 
+// UserRoleUpdateRequest represents a request to change a user's role
+type UserRoleUpdateRequest struct {
+	Role string `json:"role" validate:"required"`
+}
+
+// Validate validates a UserRoleUpdateRequest
+func (u *UserRoleUpdateRequest) Validate() error {
+	if !IsValidRole(u.Role) {
+		return fmt.Errorf("role must be one of: %s, %s, %s", RoleViewer, RoleEditor, RoleAdmin)
+	}
+	return nil
+}
+
+// Personal access token scopes
+const (
+	ScopeSitesRead   = "sites:read"   // Read sites, status, history and analytics
+	ScopeSitesWrite  = "sites:write"  // Create, change and delete sites
+	ScopeAgentsAdmin = "agents:admin" // Manage agents and agent keys
+)
+
+// APITokenPrefix marks personal access tokens so they can be told apart from other credentials
+const APITokenPrefix = "sreootb_pat_"
+
+// IsValidScope reports whether scope is a known personal access token scope
+func IsValidScope(scope string) bool {
+	switch scope {
+	case ScopeSitesRead, ScopeSitesWrite, ScopeAgentsAdmin:
+		return true
+	}
+	return false
+}
+
+// APIToken represents a user's personal access token
+type APIToken struct {
+	ID         int        `json:"id" db:"id"`
+	UserID     int        `json:"user_id" db:"user_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"token_prefix"` // Leading characters of the token, for identification
+	TokenHash  string     `json:"-" db:"token_hash"`        // SHA-256 hash of the token
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" db:"expires_at"` // Nil means the token never expires
+	LastUsedAt *time.Time `json:"last_used_at" db:"last_used_at"`
+	LastUsedIP *string    `json:"last_used_ip" db:"last_used_ip"`
+	RevokedAt  *time.Time `json:"revoked_at" db:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+}
+
+// IsActive reports whether the token is neither revoked nor expired
+func (t *APIToken) IsActive() bool {
+	if t.RevokedAt != nil {
+		return false
+	}
+	return t.ExpiresAt == nil || t.ExpiresAt.After(time.Now())
+}
+
+// APITokenCreateRequest represents a request to create a personal access token
+type APITokenCreateRequest struct {
+	Name          string   `json:"name" validate:"required"`
+	Scopes        []string `json:"scopes" validate:"required"`
+	ExpiresInDays *int     `json:"expires_in_days"` // Omit or 0 for a token that never expires
+}
+
+// APITokenCreateResponse returns a new token; the plaintext value is only shown once
+type APITokenCreateResponse struct {
+	Token    string    `json:"token"`
+	APIToken *APIToken `json:"api_token"`
+}
+
+// APITokenUpdateRequest represents a request to rename a personal access token
+type APITokenUpdateRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// Validate validates an APITokenCreateRequest
+func (t *APITokenCreateRequest) Validate() error {
+	if err := validateTokenName(t.Name); err != nil {
+		return err
+	}
+
+	if len(t.Scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range t.Scopes {
+		if !IsValidScope(scope) {
+			return fmt.Errorf("invalid scope %q: must be one of %s, %s, %s", scope, ScopeSitesRead, ScopeSitesWrite, ScopeAgentsAdmin)
+		}
+	}
+
+	if t.ExpiresInDays != nil && (*t.ExpiresInDays < 0 || *t.ExpiresInDays > 3650) {
+		return fmt.Errorf("expires_in_days must be between 0 and 3650")
+	}
+
+	return nil
+}
+
+// Validate validates an APITokenUpdateRequest
+func (t *APITokenUpdateRequest) Validate() error {
+	return validateTokenName(t.Name)
+}
+
+// validateTokenName checks a personal access token name
+func validateTokenName(name string) error {
+	if strings.TrimSpace(name) == "" {
+		return fmt.Errorf("name is required")
+	}
+	if len(name) > 100 {
+		return fmt.Errorf("name must be 100 characters or fewer")
+	}
+	return nil
+}
+
 // Validate validates a UserRegistrationRequest
 func (u *UserRegistrationRequest) Validate() error {
 	if u.Email == "" {
@@ -177,6 +310,32 @@ func (u *UserLoginRequest) Validate() error {
 	return nil
 }
 
+// Validate validates a PasswordChangeRequest
+func (p *PasswordChangeRequest) Validate() error {
+	if p.CurrentPassword == "" {
+		return fmt.Errorf("current password is required")
+	}
+
+	if !isStrongPassword(p.NewPassword) {
+		return fmt.Errorf("new password must be at least 8 characters and contain at least one uppercase letter, one lowercase letter, one number, and one special character")
+	}
+
+	return nil
+}
+
+// Validate validates a ResetPasswordRequest
+func (r *ResetPasswordRequest) Validate() error {
+	if r.Token == "" {
+		return fmt.Errorf("reset token is required")
+	}
+
+	if !isStrongPassword(r.NewPassword) {
+		return fmt.Errorf("new password must be at least 8 characters and contain at least one uppercase letter, one lowercase letter, one number, and one special character")
+	}
+
+	return nil
+}
+
 // isStrongPassword checks if a password meets complexity requirements
 func isStrongPassword(password string) bool {
 	// At least 8 characters
@@ -195,11 +354,74 @@ func isStrongPassword(password string) bool {
 
 // Site represents a website to monitor
 type Site struct {
+	ID           int            `json:"id" db:"id"`
+	URL          string         `json:"url" db:"url"`
+	Name         string         `json:"name" db:"name"`
+	ScanInterval string         `json:"scan_interval" db:"scan_interval"`
+	Paused       bool           `json:"paused" db:"-"` // Monitoring disabled via the pause endpoint
+	Config       *MonitorConfig `json:"config,omitempty" db:"-"`
+	CreatedAt    time.Time      `json:"created_at" db:"created_at"`
+}
+
+// PushTokenPrefix marks push monitor tokens
+const PushTokenPrefix = "sreootb_push_"
+
+// Push monitor signals, sent as ?status= on the push URL
+const (
+	PushSignalUp    = "up"    // The job finished successfully
+	PushSignalDown  = "down"  // The job failed
+	PushSignalFail  = "fail"  // Same as down
+	PushSignalStart = "start" // The job started; its duration is measured until the next up or down
+)
+
+// PushMonitor is the heartbeat state of a push:// site. Jobs report to a
+// secret URL and the site goes down when a report is overdue.
+type PushMonitor struct {
+	SiteID      int        `json:"site_id" db:"site_id"`
+	TokenPrefix string     `json:"token_prefix" db:"token_prefix"`
+	StartedAt   *time.Time `json:"started_at,omitempty" db:"started_at"`     // Start of the running job, if any
+	LastPingAt  *time.Time `json:"last_ping_at,omitempty" db:"last_ping_at"` // Last signal of any kind
+	MissedAt    *time.Time `json:"missed_at,omitempty" db:"missed_at"`       // When the overdue report was recorded as down
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
+
+// MaxContentSnapshotSize bounds the normalized text kept for change detection
+const MaxContentSnapshotSize = 256 << 10
+
+// ContentSnapshot is the normalized body of a page under change detection.
+// Agents send it as the "content" metadata of a result.
+type ContentSnapshot struct {
+	Hash      string `json:"hash"` // Hex SHA-256 of Text
+	Text      string `json:"text"`
+	Truncated bool   `json:"truncated,omitempty"` // Text was cut at MaxContentSnapshotSize
+}
+
+// NewContentSnapshot hashes normalized text, cutting it at MaxContentSnapshotSize
+func NewContentSnapshot(text string) *ContentSnapshot {
+	snapshot := &ContentSnapshot{Text: text}
+	if len(text) > MaxContentSnapshotSize {
+		snapshot.Text = strings.ToValidUTF8(text[:MaxContentSnapshotSize], "")
+		snapshot.Truncated = true
+	}
+	sum := sha256.Sum256([]byte(snapshot.Text))
+	snapshot.Hash = hex.EncodeToString(sum[:])
+	return snapshot
+}
+
+// Valid reports whether the snapshot's hash matches its text
+func (c *ContentSnapshot) Valid() bool {
+	return len(c.Text) <= MaxContentSnapshotSize && NewContentSnapshot(c.Text).Hash == c.Hash
+}
+
+// ContentChange records a change of a page's normalized content. Changes
+// are events in a site's history, not failures.
+type ContentChange struct {
 	ID           int       `json:"id" db:"id"`
-	URL          string    `json:"url" db:"url"`
-	Name         string    `json:"name" db:"name"`
-	ScanInterval string    `json:"scan_interval" db:"scan_interval"`
-	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	SiteID       int       `json:"site_id" db:"site_id"`
+	PreviousHash string    `json:"previous_hash" db:"previous_hash"`
+	Hash         string    `json:"hash" db:"hash"`
+	Diff         string    `json:"diff" db:"diff"` // Unified diff of the normalized text
+	DetectedAt   time.Time `json:"detected_at" db:"detected_at"`
 }
 
 // SiteCheck represents a monitoring check result
@@ -221,8 +443,9 @@ type SiteStatus struct {
 	StatusCode   *int       `json:"status_code"`
 	ErrorMessage *string    `json:"error_message"`
 	CheckedAt    *time.Time `json:"checked_at"`
-	TotalUp      int        `json:"total_up"`
-	TotalDown    int        `json:"total_down"`
+	PausedAt     *time.Time `json:"paused_at,omitempty"` // Start of the current pause
+	TotalUp      int        `json:"total_up"`            // Excludes checks made while paused
+	TotalDown    int        `json:"total_down"`          // Excludes checks made while paused
 }
 
 // Agent represents a monitoring agent
@@ -265,9 +488,41 @@ func (a *Agent) MarshalJSON() ([]byte, error) {
 
 // SiteCreateRequest represents a request to create a new site
 type SiteCreateRequest struct {
-	URL          string `json:"url" validate:"required"`
-	Name         string `json:"name" validate:"required,min=1"`
-	ScanInterval string `json:"scan_interval" validate:"required"`
+	URL          string         `json:"url" validate:"required"`
+	Name         string         `json:"name" validate:"required,min=1"`
+	ScanInterval string         `json:"scan_interval" validate:"required"`
+	Config       *MonitorConfig `json:"config,omitempty"` // Optional per-site check settings
+}
+
+// SiteUpdateRequest represents a partial update of a site; omitted fields are unchanged
+type SiteUpdateRequest struct {
+	URL          *string        `json:"url"`
+	Name         *string        `json:"name"`
+	ScanInterval *string        `json:"scan_interval"`
+	Config       *MonitorConfig `json:"config"` // Replaces the whole configuration when present
+}
+
+// ApplyTo merges the update into a site, returning the complete site definition to validate and store
+func (s *SiteUpdateRequest) ApplyTo(site *Site) *SiteCreateRequest {
+	merged := &SiteCreateRequest{
+		URL:          site.URL,
+		Name:         site.Name,
+		ScanInterval: site.ScanInterval,
+		Config:       site.Config,
+	}
+	if s.URL != nil {
+		merged.URL = *s.URL
+	}
+	if s.Name != nil {
+		merged.Name = *s.Name
+	}
+	if s.ScanInterval != nil {
+		merged.ScanInterval = *s.ScanInterval
+	}
+	if s.Config != nil {
+		merged.Config = s.Config
+	}
+	return merged
 }
 
 // AgentCreateRequest represents a request to create a new agent
@@ -288,6 +543,7 @@ type MonitorStats struct {
 	TotalSites          int      `json:"total_sites"`
 	SitesUp             int      `json:"sites_up"`
 	SitesDown           int      `json:"sites_down"`
+	SitesPaused         int      `json:"sites_paused"`
 	AverageResponseTime *float64 `json:"average_response_time"`
 	ConnectedAgents     int      `json:"connected_agents"`
 }
@@ -303,10 +559,92 @@ type MonitorTask struct {
 	Enabled     bool      `json:"enabled" db:"enabled"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+	// Per-site check settings; secrets are decrypted before tasks are sent to agents
+	Config *MonitorConfig `json:"config,omitempty" db:"config"`
 	// Configuration for log monitoring (stored as JSON in metadata)
 	LogConfig *LogMonitorConfig `json:"log_config,omitempty" db:"-"`
 }
 
+// HTTPConfig returns the task's HTTP check settings, or nil for defaults
+func (t *MonitorTask) HTTPConfig() *HTTPCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.HTTP
+}
+
+// TCPConfig returns the task's TCP check settings, or nil for defaults
+func (t *MonitorTask) TCPConfig() *TCPCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.TCP
+}
+
+// PingConfig returns the task's ping check settings, or nil for defaults
+func (t *MonitorTask) PingConfig() *PingCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.Ping
+}
+
+// TransactionConfig returns the task's transaction steps, or nil if it has none
+func (t *MonitorTask) TransactionConfig() *TransactionCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.Transaction
+}
+
+// GRPCConfig returns the task's gRPC check settings, or nil for defaults
+func (t *MonitorTask) GRPCConfig() *GRPCCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.GRPC
+}
+
+// DatabaseConfig returns the task's database probe settings, or nil for defaults
+func (t *MonitorTask) DatabaseConfig() *DatabaseCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.Database
+}
+
+// WebSocketConfig returns the task's WebSocket check settings, or nil for defaults
+func (t *MonitorTask) WebSocketConfig() *WebSocketCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.WebSocket
+}
+
+// MailConfig returns the task's SMTP or IMAP check settings, or nil for defaults
+func (t *MonitorTask) MailConfig() *MailCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.Mail
+}
+
+// ContentChangeConfig returns the task's change detection settings, or nil when it is off
+func (t *MonitorTask) ContentChangeConfig() *ContentChangeConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.ContentChange
+}
+
+// TLSConfig returns the task's certificate check settings, or nil for defaults
+func (t *MonitorTask) TLSConfig() *TLSCheckConfig {
+	if t.Config == nil {
+		return nil
+	}
+	return t.Config.TLS
+}
+
 // LogMonitorConfig represents configuration for log file monitoring
 type LogMonitorConfig struct {
 	FilePath   string `json:"file_path"`             // Path to log file
@@ -386,6 +724,104 @@ type AgentKeyUpgradeResponse struct {
 	RestartNeeded bool   `json:"restart_needed"`
 }
 
+// Audit event actor types
+const (
+	ActorUser      = "user"       // A user with a login session
+	ActorToken     = "token"      // A personal access token
+	ActorAgent     = "agent"      // A monitoring agent
+	ActorMasterKey = "master_key" // The admin API key
+	ActorAnonymous = "anonymous"  // An unauthenticated caller, e.g. a failed login
+	ActorSystem    = "system"     // The server itself, e.g. an automatic lockout
+)
+
+// AuditEvent records who changed what, from where, and how
+type AuditEvent struct {
+	ID         int             `json:"id" db:"id"`
+	ActorType  string          `json:"actor_type" db:"actor_type"`
+	ActorID    string          `json:"actor_id" db:"actor_id"`     // User ID, token ID or agent ID
+	ActorName  string          `json:"actor_name" db:"actor_name"` // Email, token name or agent name
+	Action     string          `json:"action" db:"action"`         // e.g. "site.create", "auth.login"
+	TargetType string          `json:"target_type" db:"target_type"`
+	TargetID   string          `json:"target_id" db:"target_id"`
+	SourceIP   string          `json:"source_ip" db:"source_ip"`
+	RequestID  string          `json:"request_id" db:"request_id"`
+	Before     json.RawMessage `json:"before,omitempty" db:"before_data"` // Target state before the change
+	After      json.RawMessage `json:"after,omitempty" db:"after_data"`   // Target state after the change
+	CreatedAt  time.Time       `json:"created_at" db:"created_at"`
+}
+
+// AuditChange is a single field that differs between an event's before and after states
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes returns the top-level fields whose values differ between Before and After
+func (e *AuditEvent) Changes() map[string]AuditChange {
+	var before, after map[string]interface{}
+	if len(e.Before) > 0 {
+		json.Unmarshal(e.Before, &before)
+	}
+	if len(e.After) > 0 {
+		json.Unmarshal(e.After, &after)
+	}
+
+	changes := make(map[string]AuditChange)
+	for key, oldValue := range before {
+		newValue, ok := after[key]
+		if !ok || !jsonValuesEqual(oldValue, newValue) {
+			changes[key] = AuditChange{Before: oldValue, After: newValue}
+		}
+	}
+	for key, newValue := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = AuditChange{Before: nil, After: newValue}
+		}
+	}
+
+	return changes
+}
+
+// MarshalJSON includes the computed field diff alongside the stored states
+func (e *AuditEvent) MarshalJSON() ([]byte, error) {
+	type Alias AuditEvent
+	return json.Marshal(&struct {
+		*Alias
+		Changes map[string]AuditChange `json:"changes"`
+	}{
+		Alias:   (*Alias)(e),
+		Changes: e.Changes(),
+	})
+}
+
+// jsonValuesEqual compares two decoded JSON values
+func jsonValuesEqual(a, b interface{}) bool {
+	aJSON, _ := json.Marshal(a)
+	bJSON, _ := json.Marshal(b)
+	return string(aJSON) == string(bJSON)
+}
+
+// AuditEventFilter selects audit events; zero values match everything
+type AuditEventFilter struct {
+	ActorType  string
+	ActorID    string
+	Action     string // Exact action, or a prefix ending in "." such as "site."
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int
+	Offset     int
+}
+
+// AuditEventPage is a page of audit events
+type AuditEventPage struct {
+	Events []*AuditEvent `json:"events"`
+	Total  int           `json:"total"`
+	Limit  int           `json:"limit"`
+	Offset int           `json:"offset"`
+}
+
 // Validate validates a SiteCreateRequest
 func (s *SiteCreateRequest) Validate() error {
 	if s.URL == "" {
@@ -406,6 +842,16 @@ func (s *SiteCreateRequest) Validate() error {
 		return err
 	}
 
+	if s.Config != nil {
+		if err := s.Config.Validate(s.URL); err != nil {
+			return err
+		}
+	}
+
+	if strings.HasPrefix(s.URL, "transaction://") && (s.Config == nil || s.Config.Transaction == nil) {
+		return fmt.Errorf("transaction sites require a transaction configuration with at least one step")
+	}
+
 	return nil
 }
 
@@ -485,7 +931,7 @@ func validateURL(urlStr string) error {
 		}
 
 		// Basic validation for hostname/IP
-		if !regexp.MustCompile(`^[a-zA-Z0-9.-]+$`).MatchString(host) {
+		if net.ParseIP(host) == nil && !regexp.MustCompile(`^[a-zA-Z0-9.-]+$`).MatchString(host) {
 			return fmt.Errorf("invalid hostname or IP address for ping")
 		}
 		return nil
@@ -506,7 +952,257 @@ func validateURL(urlStr string) error {
 		return nil
 	}
 
-	return fmt.Errorf("URL must start with http://, https://, ping://, or log://")
+	if strings.HasPrefix(urlStr, "tcp://") {
+		return validateHostPort(urlStr, "tcp")
+	}
+
+	if strings.HasPrefix(urlStr, "dns://") {
+		_, err := ParseDNSURL(urlStr)
+		return err
+	}
+
+	if strings.HasPrefix(urlStr, "grpc://") {
+		_, _, err := ParseGRPCURL(urlStr)
+		return err
+	}
+
+	if strings.HasPrefix(urlStr, "ws://") || strings.HasPrefix(urlStr, "wss://") {
+		u, err := url.Parse(urlStr)
+		if err != nil {
+			return fmt.Errorf("invalid WebSocket URL format: %w", err)
+		}
+		if u.Hostname() == "" {
+			return fmt.Errorf("WebSocket URL requires a hostname, e.g. wss://example.com/socket")
+		}
+		return nil
+	}
+
+	if IsMailURL(urlStr) {
+		_, _, _, err := ParseMailURL(urlStr)
+		return err
+	}
+
+	if strings.HasPrefix(urlStr, "postgres://") || strings.HasPrefix(urlStr, "postgresql://") {
+		u, err := url.Parse(urlStr)
+		if err != nil {
+			return fmt.Errorf("invalid postgres URL format: %w", err)
+		}
+		if u.Hostname() == "" {
+			return fmt.Errorf("postgres URL requires a hostname, e.g. postgres://monitor@db.example.com:5432/app")
+		}
+		// Site URLs are shown in the API, so the password goes in the encrypted config
+		if _, hasPassword := u.User.Password(); hasPassword || u.Query().Has("password") {
+			return fmt.Errorf("postgres URL must not contain a password; set config.database.password instead")
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(urlStr, "sqlite://") {
+		if path := urlStr[9:]; !strings.HasPrefix(path, "/") || strings.ContainsAny(path, "?#") {
+			return fmt.Errorf("sqlite URL requires an absolute file path, e.g. sqlite:///var/lib/app/app.db")
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(urlStr, "push://") {
+		// The name only identifies the site; jobs report to a secret token URL
+		if !regexp.MustCompile(`^[a-zA-Z0-9._-]+$`).MatchString(urlStr[7:]) {
+			return fmt.Errorf("push URL requires a name of letters, digits, '.', '_' or '-', e.g. push://nightly-backup")
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(urlStr, "transaction://") {
+		// The steps hold the real URLs
+		if !regexp.MustCompile(`^[a-zA-Z0-9._-]+$`).MatchString(urlStr[14:]) {
+			return fmt.Errorf("transaction URL requires a name of letters, digits, '.', '_' or '-', e.g. transaction://login-flow")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("URL must start with http://, https://, ws://, wss://, ping://, tcp://, dns://, grpc://, smtp://, smtps://, imap://, imaps://, postgres://, sqlite://, push://, transaction://, or log://")
+}
+
+// DNS transports
+const (
+	DNSTransportUDP = "udp" // Default; retried over TCP when the answer is truncated
+	DNSTransportTCP = "tcp"
+	DNSTransportTLS = "tls" // DNS over TLS
+)
+
+// DNSRecordTypes are the record types a dns:// monitor can query
+var DNSRecordTypes = map[string]uint16{
+	"A": 1, "NS": 2, "CNAME": 5, "SOA": 6, "PTR": 12, "MX": 15, "TXT": 16, "AAAA": 28, "SRV": 33,
+}
+
+// DNSRCodes maps DNS response code names to their values
+var DNSRCodes = map[string]int{
+	"NOERROR": 0, "FORMERR": 1, "SERVFAIL": 2, "NXDOMAIN": 3, "NOTIMP": 4, "REFUSED": 5,
+}
+
+// DNSQuery is a parsed dns://name?type=A&server=1.2.3.4&transport=udp URL
+type DNSQuery struct {
+	Name      string // Fully qualified, with a trailing dot
+	Type      string
+	Server    string // host:port, empty for the system resolver
+	Transport string
+}
+
+// ParseDNSURL parses and validates a dns:// monitor URL. The server may carry a
+// port, in which case IPv6 servers must be bracketed, e.g. server=[2001:db8::53]:853.
+func ParseDNSURL(urlStr string) (*DNSQuery, error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNS URL format: %w", err)
+	}
+
+	name := strings.TrimSuffix(u.Host, ".")
+	if name == "" || len(name) > 253 || strings.Contains(name, "..") || !regexp.MustCompile(`^[A-Za-z0-9_*]([A-Za-z0-9_.-]*[A-Za-z0-9_])?$`).MatchString(name) {
+		return nil, fmt.Errorf("DNS URL requires a valid name, e.g. dns://example.com?type=A")
+	}
+	if u.Path != "" && u.Path != "/" {
+		return nil, fmt.Errorf("DNS URL must not have a path")
+	}
+
+	query := &DNSQuery{Name: name + ".", Type: "A", Transport: DNSTransportUDP}
+	params := u.Query()
+	for key := range params {
+		switch key {
+		case "type", "server", "transport":
+		default:
+			return nil, fmt.Errorf("unknown DNS URL parameter %q", key)
+		}
+	}
+
+	if t := strings.ToUpper(params.Get("type")); t != "" {
+		if _, ok := DNSRecordTypes[t]; !ok {
+			return nil, fmt.Errorf("unsupported DNS record type %q", t)
+		}
+		query.Type = t
+	}
+
+	if t := strings.ToLower(params.Get("transport")); t != "" {
+		switch t {
+		case DNSTransportUDP, DNSTransportTCP, DNSTransportTLS:
+			query.Transport = t
+		default:
+			return nil, fmt.Errorf("DNS transport must be udp, tcp or tls")
+		}
+	}
+
+	if server := params.Get("server"); server != "" {
+		port := "53"
+		if query.Transport == DNSTransportTLS {
+			port = "853"
+		}
+		host := server
+		if h, p, err := net.SplitHostPort(server); err == nil {
+			host, port = h, p
+		} else if strings.HasPrefix(server, "[") && strings.HasSuffix(server, "]") {
+			host = strings.Trim(server, "[]")
+		}
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return nil, fmt.Errorf("invalid DNS server port %q", port)
+		}
+		if host == "" || (strings.Contains(host, ":") && net.ParseIP(host) == nil) {
+			return nil, fmt.Errorf("invalid DNS server %q", server)
+		}
+		query.Server = net.JoinHostPort(host, port)
+	}
+
+	return query, nil
+}
+
+// validateHostPort validates a scheme://host:port URL; IPv6 literals must be bracketed
+func validateHostPort(urlStr, scheme string) error {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return fmt.Errorf("invalid %s URL format: %w", scheme, err)
+	}
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%s URL must be %s://host:port", scheme, scheme)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("%s URL requires a hostname or IP address", scheme)
+	}
+	if strings.Contains(u.Hostname(), ":") && !strings.HasPrefix(u.Host, "[") {
+		return fmt.Errorf("IPv6 addresses must be enclosed in brackets, e.g. %s://[::1]:443", scheme)
+	}
+	if strings.Contains(u.Hostname(), "%") {
+		return fmt.Errorf("IPv6 zone identifiers are not supported")
+	}
+	port, err := strconv.Atoi(u.Port())
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("%s URL requires a port between 1 and 65535", scheme)
+	}
+	return nil
+}
+
+// ParseGRPCURL splits a grpc://host:port/service URL into the address to dial
+// and the service whose health is checked; an empty service asks about the
+// server as a whole
+func ParseGRPCURL(urlStr string) (address, service string, err error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid grpc URL format: %w", err)
+	}
+	if u.Scheme != "grpc" {
+		return "", "", fmt.Errorf("grpc URL must start with grpc://")
+	}
+	if err := validateHostPort("grpc://"+u.Host, "grpc"); err != nil {
+		return "", "", err
+	}
+	if u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", fmt.Errorf("grpc URL must be grpc://host:port/service")
+	}
+
+	service = strings.TrimPrefix(u.Path, "/")
+	if !regexp.MustCompile(`^[A-Za-z0-9_.-]*$`).MatchString(service) {
+		return "", "", fmt.Errorf("invalid gRPC service name %q, expected e.g. grpc://host:port/package.Service", service)
+	}
+	return u.Host, service, nil
+}
+
+// mailDefaultPorts maps mail URL schemes to their well-known ports
+var mailDefaultPorts = map[string]string{
+	"smtp":  "25",
+	"smtps": "465",
+	"imap":  "143",
+	"imaps": "993",
+}
+
+// IsMailURL reports whether a URL names an SMTP or IMAP server
+func IsMailURL(urlStr string) bool {
+	scheme, _, ok := strings.Cut(urlStr, "://")
+	_, known := mailDefaultPorts[scheme]
+	return ok && known
+}
+
+// ParseMailURL splits an smtp://, smtps://, imap:// or imaps://host[:port] URL
+// into the protocol ("smtp" or "imap"), the address to dial and whether TLS
+// starts with the connection. The port defaults to the scheme's well-known one.
+func ParseMailURL(urlStr string) (protocol, address string, implicitTLS bool, err error) {
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid mail URL format: %w", err)
+	}
+	port, ok := mailDefaultPorts[u.Scheme]
+	if !ok {
+		return "", "", false, fmt.Errorf("mail URL must start with smtp://, smtps://, imap:// or imaps://")
+	}
+
+	if u.User != nil || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" {
+		return "", "", false, fmt.Errorf("%s URL must be %s://host[:port]; set credentials in config.mail", u.Scheme, u.Scheme)
+	}
+	address = u.Host
+	if u.Port() == "" && u.Hostname() != "" {
+		address = net.JoinHostPort(u.Hostname(), port)
+	}
+	if err := validateHostPort(u.Scheme+"://"+address, u.Scheme); err != nil {
+		return "", "", false, err
+	}
+
+	return strings.TrimSuffix(u.Scheme, "s"), address, strings.HasSuffix(u.Scheme, "s"), nil
 }
 
 // validateScanInterval validates scan interval format and range
@@ -0,0 +1,1290 @@
+package models
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedactedSecret replaces secret values in API responses. Sending it back in
+// an update keeps the stored secret.
+const RedactedSecret = "********"
+
+// HTTP redirect policies
+const (
+	RedirectFollow = "follow" // Follow up to MaxRedirects redirects (default)
+	RedirectNone   = "none"   // Judge the first response, even if it is a redirect
+)
+
+// IP version preferences for monitors that connect to a host
+const (
+	IPVersion4 = "ipv4"
+	IPVersion6 = "ipv6"
+)
+
+// HTTP response assertion types
+const (
+	AssertBodyContains    = "body_contains"     // Body contains Value
+	AssertBodyNotContains = "body_not_contains" // Body does not contain Value
+	AssertBodyRegex       = "body_regex"        // Body matches the regular expression Value
+	AssertJSONPathEquals  = "json_path_equals"  // The JSON value at Path equals Value
+	AssertJSONPathMatches = "json_path_matches" // The JSON value at Path matches the regular expression Value
+	AssertHeaderPresent   = "header_present"    // Response has Header
+	AssertHeaderEquals    = "header_equals"     // Response Header equals Value
+	AssertSize            = "size"              // Body size is within MinBytes and MaxBytes
+	AssertLatencyBelow    = "latency_below"     // Response time is below Threshold; failing yields degraded rather than down
+)
+
+// Defaults applied when a check configuration leaves a field empty
+const (
+	DefaultMaxRedirects       = 10
+	DefaultExpiryWarningDays  = 14
+	DefaultExpiryCriticalDays = 3
+	DefaultPingCount          = 3
+	DefaultPingInterval       = 200 * time.Millisecond
+	DefaultPingProbeTimeout   = time.Second
+	DefaultPushGrace          = 5 * time.Minute
+	maxPingCount              = 20
+	maxTransactionSteps       = 20
+	maxMaxRedirects           = 50
+	maxCheckTimeout           = 5 * time.Minute
+	maxExpiryWindowDays       = 365
+)
+
+var (
+	httpMethodRegex   = regexp.MustCompile(`^[A-Z]+$`)
+	headerNameRegex   = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+	variableNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	variableRefRegex  = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+	cssIdentifierRegex = regexp.MustCompile(`^-?[A-Za-z_][A-Za-z0-9_-]*`)
+)
+
+// MonitorConfig holds per-site settings for monitors that need more than a URL.
+// It is stored with the site's monitoring task and sent to agents.
+type MonitorConfig struct {
+	HTTP *HTTPCheckConfig `json:"http,omitempty"`
+	TCP  *TCPCheckConfig  `json:"tcp,omitempty"`
+	DNS  *DNSCheckConfig  `json:"dns,omitempty"`
+	Ping *PingCheckConfig `json:"ping,omitempty"`
+	Push *PushCheckConfig `json:"push,omitempty"`
+	GRPC *GRPCCheckConfig `json:"grpc,omitempty"`
+	Mail *MailCheckConfig `json:"mail,omitempty"`
+	TLS  *TLSCheckConfig  `json:"tls,omitempty"`
+
+	Database    *DatabaseCheckConfig    `json:"database,omitempty"`
+	WebSocket   *WebSocketCheckConfig   `json:"websocket,omitempty"`
+	Transaction *TransactionCheckConfig `json:"transaction,omitempty"`
+
+	ContentChange *ContentChangeConfig `json:"content_change,omitempty"`
+}
+
+// ContentChangeConfig turns on change detection for an http:// or https://
+// site. The body is normalized and hashed on every check; a new hash records
+// a change with a diff, without affecting the site's status. HTML is reduced
+// to its visible text and JSON is re-indented before the ignore rules apply.
+type ContentChangeConfig struct {
+	IgnoreSelectors []string `json:"ignore_selectors,omitempty"` // CSS selectors of HTML elements to leave out, e.g. "#last-updated" or "div.banner > time"
+	IgnorePatterns  []string `json:"ignore_patterns,omitempty"`  // Regular expressions of text to leave out, e.g. timestamps
+}
+
+// TransactionCheckConfig defines the HTTP steps of a transaction:// monitor.
+// Steps run in order and share a cookie jar; the check fails at the first
+// failing step.
+type TransactionCheckConfig struct {
+	Steps   []TransactionStep `json:"steps"`
+	Timeout string            `json:"timeout,omitempty"` // For all steps together
+}
+
+// TransactionStep is one request of a transaction. Its URL, header values,
+// body and assertion values may use variables extracted by earlier steps as
+// {{name}}. The embedded settings work as for http:// sites.
+type TransactionStep struct {
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url"`
+	HTTPCheckConfig
+	Extract []TransactionVariable `json:"extract,omitempty"` // Variables set from the response
+}
+
+// TransactionVariable extracts a value from a step's response body
+type TransactionVariable struct {
+	Name     string `json:"name"`
+	JSONPath string `json:"json_path,omitempty"` // e.g. "$.data.token"
+	Regex    string `json:"regex,omitempty"`     // Yields the first capture group, or the whole match without one
+}
+
+// PushCheckConfig sets how late a push:// site's reports may be. A report is
+// expected every scan interval.
+type PushCheckConfig struct {
+	Grace       string `json:"grace,omitempty"`        // Extra time allowed after the interval; defaults to 5m
+	MaxDuration string `json:"max_duration,omitempty"` // How long a started job may run; defaults to the grace period
+}
+
+// PingCheckConfig sets how many ICMP echo probes a ping:// monitor sends and
+// when packet loss or latency makes the host degraded or down
+type PingCheckConfig struct {
+	Count               int      `json:"count,omitempty"`                 // Probes per check; defaults to 3
+	Interval            string   `json:"interval,omitempty"`              // Between probes; defaults to 200ms
+	ProbeTimeout        string   `json:"probe_timeout,omitempty"`         // Wait for each reply; defaults to 1s
+	DegradedLossPercent *float64 `json:"degraded_loss_percent,omitempty"` // Degraded when loss is above this
+	DownLossPercent     *float64 `json:"down_loss_percent,omitempty"`     // Down when loss reaches this; defaults to 100
+	DegradedRTT         string   `json:"degraded_rtt,omitempty"`          // Degraded when the average RTT is above this, e.g. "150ms"
+	IPVersion           string   `json:"ip_version,omitempty"`            // "ipv4", "ipv6" or empty for either
+	Timeout             string   `json:"timeout,omitempty"`
+}
+
+// DNSCheckConfig sets what a dns:// monitor expects of the answer. Only
+// records of the queried type are compared and counted.
+type DNSCheckConfig struct {
+	ExpectValues []string `json:"expect_values,omitempty"` // Values that must all be answered, e.g. "192.0.2.1" or "10 mail.example.com"
+	ExactValues  bool     `json:"exact_values,omitempty"`  // Fail on answers not listed in ExpectValues
+	MinAnswers   *int     `json:"min_answers,omitempty"`
+	MaxAnswers   *int     `json:"max_answers,omitempty"`
+	MinTTL       *uint32  `json:"min_ttl,omitempty"` // Seconds
+	MaxTTL       *uint32  `json:"max_ttl,omitempty"`
+	RCode        string   `json:"rcode,omitempty"`       // Expected response code; defaults to NOERROR
+	ServerName   string   `json:"server_name,omitempty"` // DoT certificate name; defaults to the server host
+	Timeout      string   `json:"timeout,omitempty"`
+}
+
+// GRPCCheckConfig customizes how a grpc:// monitor reaches the server.
+// Certificates are given inline as PEM, or as files read on the host that
+// runs the check; only admins may set file paths.
+type GRPCCheckConfig struct {
+	TLS            bool   `json:"tls,omitempty"`              // Use TLS instead of plaintext HTTP/2
+	Authority      string `json:"authority,omitempty"`        // :authority sent with the RPC; defaults to host:port
+	ServerName     string `json:"server_name,omitempty"`      // Certificate name; defaults to the authority's host
+	CAPEM          string `json:"ca_pem,omitempty"`           // PEM roots to trust instead of the system pool
+	ClientCertPEM  string `json:"client_cert_pem,omitempty"`  // PEM client certificate for mutual TLS; encrypted at rest and redacted in the API
+	ClientKeyPEM   string `json:"client_key_pem,omitempty"`   // Encrypted at rest and redacted in the API
+	CAFile         string `json:"ca_file,omitempty"`          // Admin only: file alternative to ca_pem
+	ClientCertFile string `json:"client_cert_file,omitempty"` // Admin only: file alternative to client_cert_pem
+	ClientKeyFile  string `json:"client_key_file,omitempty"`
+	Timeout        string `json:"timeout,omitempty"`
+}
+
+// HostFiles lists the file paths the check reads on the host that runs it
+func (g *GRPCCheckConfig) HostFiles() []string {
+	var files []string
+	for _, file := range []string{g.CAFile, g.ClientCertFile, g.ClientKeyFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// MailCheckConfig customizes an SMTP or IMAP monitor. Credentials are only
+// sent over TLS.
+type MailCheckConfig struct {
+	StartTLS             bool     `json:"starttls,omitempty"`              // Upgrade smtp:// or imap:// with STARTTLS
+	ServerName           string   `json:"server_name,omitempty"`           // Certificate name; defaults to the host
+	ExpectBanner         string   `json:"expect_banner,omitempty"`         // Regular expression the greeting must match
+	RequiredCapabilities []string `json:"required_capabilities,omitempty"` // EHLO keywords or IMAP capabilities, e.g. "SIZE" or "IDLE"
+	HelloName            string   `json:"hello_name,omitempty"`            // SMTP EHLO name; defaults to this host's name
+	Username             string   `json:"username,omitempty"`              // Authenticate as this user when set
+	Password             string   `json:"password,omitempty"`              // Encrypted at rest and redacted in the API
+	Timeout              string   `json:"timeout,omitempty"`
+}
+
+// DatabaseCheckConfig sets the probe query of a postgres:// or sqlite://
+// monitor. The query runs in a read-only transaction.
+type DatabaseCheckConfig struct {
+	Password       string  `json:"password,omitempty"`        // PostgreSQL password; encrypted at rest and redacted in the API
+	Query          string  `json:"query,omitempty"`           // Defaults to SELECT 1
+	ExpectRows     *int    `json:"expect_rows,omitempty"`     // Exact number of rows returned
+	ExpectValue    *string `json:"expect_value,omitempty"`    // First column of the first row, compared as text
+	IntegrityCheck bool    `json:"integrity_check,omitempty"` // SQLite only: also run PRAGMA quick_check
+	Timeout        string  `json:"timeout,omitempty"`
+}
+
+// WebSocketCheckConfig sets what a ws:// or wss:// monitor sends after the
+// upgrade and which message it waits for. Messages that do not match are
+// skipped until one does or the timeout passes.
+type WebSocketCheckConfig struct {
+	Headers       map[string]string `json:"headers,omitempty"`        // Sent with the upgrade request, e.g. Origin
+	SecretHeaders map[string]string `json:"secret_headers,omitempty"` // e.g. Authorization; encrypted at rest and redacted in the API
+	Subprotocols  []string          `json:"subprotocols,omitempty"`   // Offered in Sec-WebSocket-Protocol
+	Send          string            `json:"send,omitempty"`           // Text message sent after the upgrade
+	ExpectRegex   string            `json:"expect_regex,omitempty"`   // Regular expression a message must match
+	JSONPath      string            `json:"json_path,omitempty"`      // Path that must exist in a JSON message, e.g. "$.type"
+	JSONValue     *string           `json:"json_value,omitempty"`     // Value json_path must have, compared as text
+	Timeout       string            `json:"timeout,omitempty"`
+}
+
+// TCPCheckConfig customizes a tcp:// monitor beyond a plain connect
+type TCPCheckConfig struct {
+	Send        string `json:"send,omitempty"`         // Payload written after connecting
+	Expect      string `json:"expect,omitempty"`       // Text the response or banner must contain
+	ExpectRegex string `json:"expect_regex,omitempty"` // Regular expression the response or banner must match
+	TLS         bool   `json:"tls,omitempty"`          // Wrap the connection in TLS
+	ServerName  string `json:"server_name,omitempty"`  // SNI and verification name; defaults to the host
+	Timeout     string `json:"timeout,omitempty"`      // Per-check timeout, e.g. "5s"
+}
+
+// TLSCheckConfig sets how close to expiry a site's certificates may get.
+// A certificate inside the warning window makes the check degraded, inside
+// the critical window down.
+type TLSCheckConfig struct {
+	ExpiryWarningDays  int `json:"expiry_warning_days,omitempty"`  // Defaults to 14
+	ExpiryCriticalDays int `json:"expiry_critical_days,omitempty"` // Defaults to 3
+}
+
+// HTTPCheckConfig customizes the request an HTTP monitor sends and how its response is judged
+type HTTPCheckConfig struct {
+	Method         string            `json:"method,omitempty"`                // Defaults to GET
+	Headers        map[string]string `json:"headers,omitempty"`               // Sent as-is and shown in the API
+	SecretHeaders  map[string]string `json:"secret_headers,omitempty"`        // e.g. Authorization; encrypted at rest and redacted in the API
+	Body           string            `json:"body,omitempty"`                  // Request body
+	AcceptedStatus []string          `json:"accepted_status_codes,omitempty"` // "200", "2xx" or "200-299"; defaults to 200-399
+	RedirectPolicy string            `json:"redirect_policy,omitempty"`       // "follow" (default) or "none"
+	MaxRedirects   int               `json:"max_redirects,omitempty"`         // Redirects followed before failing; 0 means 10
+	Timeout        string            `json:"timeout,omitempty"`               // Per-check timeout, e.g. "10s"
+	IPVersion      string            `json:"ip_version,omitempty"`            // "ipv4", "ipv6" or empty for either
+	Assertions     []HTTPAssertion   `json:"assertions,omitempty"`            // Evaluated by agents on every response
+}
+
+// HTTPAssertion is a check on the content of an HTTP response
+type HTTPAssertion struct {
+	Type      string `json:"type"`
+	Path      string `json:"path,omitempty"`      // JSON path for json_path_* assertions, e.g. "$.status" or "items[0].id"
+	Header    string `json:"header,omitempty"`    // Header name for header_* assertions
+	Value     string `json:"value,omitempty"`     // Keyword, regular expression or expected value
+	MinBytes  *int64 `json:"min_bytes,omitempty"` // Size bounds for size assertions
+	MaxBytes  *int64 `json:"max_bytes,omitempty"`
+	Threshold string `json:"threshold,omitempty"` // Latency threshold for latency_below, e.g. "800ms"
+}
+
+// Validate validates a MonitorConfig for a site URL
+func (c *MonitorConfig) Validate(siteURL string) error {
+	if c.HTTP != nil {
+		if !strings.HasPrefix(siteURL, "http://") && !strings.HasPrefix(siteURL, "https://") {
+			return fmt.Errorf("http configuration only applies to http:// and https:// sites")
+		}
+		if err := c.HTTP.Validate(); err != nil {
+			return fmt.Errorf("http: %w", err)
+		}
+	}
+	if c.TCP != nil {
+		if !strings.HasPrefix(siteURL, "tcp://") {
+			return fmt.Errorf("tcp configuration only applies to tcp:// sites")
+		}
+		if err := c.TCP.Validate(); err != nil {
+			return fmt.Errorf("tcp: %w", err)
+		}
+	}
+	if c.Ping != nil {
+		if !strings.HasPrefix(siteURL, "ping://") {
+			return fmt.Errorf("ping configuration only applies to ping:// sites")
+		}
+		if err := c.Ping.Validate(); err != nil {
+			return fmt.Errorf("ping: %w", err)
+		}
+	}
+	if c.GRPC != nil {
+		if !strings.HasPrefix(siteURL, "grpc://") {
+			return fmt.Errorf("grpc configuration only applies to grpc:// sites")
+		}
+		if err := c.GRPC.Validate(); err != nil {
+			return fmt.Errorf("grpc: %w", err)
+		}
+	}
+	if c.Mail != nil {
+		if !IsMailURL(siteURL) {
+			return fmt.Errorf("mail configuration only applies to smtp://, smtps://, imap:// and imaps:// sites")
+		}
+		_, _, implicitTLS, _ := ParseMailURL(siteURL)
+		if err := c.Mail.Validate(implicitTLS); err != nil {
+			return fmt.Errorf("mail: %w", err)
+		}
+	}
+	if c.Database != nil {
+		isPostgres := strings.HasPrefix(siteURL, "postgres://") || strings.HasPrefix(siteURL, "postgresql://")
+		isSQLite := strings.HasPrefix(siteURL, "sqlite://")
+		if !isPostgres && !isSQLite {
+			return fmt.Errorf("database configuration only applies to postgres:// and sqlite:// sites")
+		}
+		if isSQLite && c.Database.Password != "" {
+			return fmt.Errorf("database: password only applies to postgres:// sites")
+		}
+		if isPostgres && c.Database.IntegrityCheck {
+			return fmt.Errorf("database: integrity_check only applies to sqlite:// sites")
+		}
+		if err := c.Database.Validate(); err != nil {
+			return fmt.Errorf("database: %w", err)
+		}
+	}
+	if c.WebSocket != nil {
+		if !strings.HasPrefix(siteURL, "ws://") && !strings.HasPrefix(siteURL, "wss://") {
+			return fmt.Errorf("websocket configuration only applies to ws:// and wss:// sites")
+		}
+		if err := c.WebSocket.Validate(); err != nil {
+			return fmt.Errorf("websocket: %w", err)
+		}
+	}
+	if c.Push != nil {
+		if !strings.HasPrefix(siteURL, "push://") {
+			return fmt.Errorf("push configuration only applies to push:// sites")
+		}
+		if err := c.Push.Validate(); err != nil {
+			return fmt.Errorf("push: %w", err)
+		}
+	}
+	if c.Transaction != nil {
+		if !strings.HasPrefix(siteURL, "transaction://") {
+			return fmt.Errorf("transaction configuration only applies to transaction:// sites")
+		}
+		if err := c.Transaction.Validate(); err != nil {
+			return fmt.Errorf("transaction: %w", err)
+		}
+	}
+	if c.DNS != nil {
+		if !strings.HasPrefix(siteURL, "dns://") {
+			return fmt.Errorf("dns configuration only applies to dns:// sites")
+		}
+		if err := c.DNS.Validate(); err != nil {
+			return fmt.Errorf("dns: %w", err)
+		}
+	}
+	if c.ContentChange != nil {
+		if !strings.HasPrefix(siteURL, "http://") && !strings.HasPrefix(siteURL, "https://") {
+			return fmt.Errorf("content_change configuration only applies to http:// and https:// sites")
+		}
+		if err := c.ContentChange.Validate(); err != nil {
+			return fmt.Errorf("content_change: %w", err)
+		}
+	}
+	if c.TLS != nil {
+		mailTLS := strings.HasPrefix(siteURL, "smtps://") || strings.HasPrefix(siteURL, "imaps://") || (c.Mail != nil && c.Mail.StartTLS)
+		if !strings.HasPrefix(siteURL, "https://") && !strings.HasPrefix(siteURL, "wss://") && !mailTLS && !(c.TCP != nil && c.TCP.TLS) && !(c.GRPC != nil && c.GRPC.TLS) {
+			return fmt.Errorf("tls configuration only applies to https://, wss:// and mail sites and tcp:// or grpc:// sites using TLS")
+		}
+		if err := c.TLS.Validate(); err != nil {
+			return fmt.Errorf("tls: %w", err)
+		}
+	}
+	return nil
+}
+
+// TaskTimeout returns the timeout to store on the monitoring task, or def when none is configured
+func (c *MonitorConfig) TaskTimeout(def string) string {
+	switch {
+	case c == nil:
+	case c.HTTP != nil && c.HTTP.Timeout != "":
+		return c.HTTP.Timeout
+	case c.TCP != nil && c.TCP.Timeout != "":
+		return c.TCP.Timeout
+	case c.DNS != nil && c.DNS.Timeout != "":
+		return c.DNS.Timeout
+	case c.Ping != nil && c.Ping.Timeout != "":
+		return c.Ping.Timeout
+	case c.GRPC != nil && c.GRPC.Timeout != "":
+		return c.GRPC.Timeout
+	case c.Mail != nil && c.Mail.Timeout != "":
+		return c.Mail.Timeout
+	case c.Database != nil && c.Database.Timeout != "":
+		return c.Database.Timeout
+	case c.WebSocket != nil && c.WebSocket.Timeout != "":
+		return c.WebSocket.Timeout
+	case c.Transaction != nil && c.Transaction.Timeout != "":
+		return c.Transaction.Timeout
+	}
+	return def
+}
+
+// TransformSecrets returns a copy of the configuration with every secret value
+// replaced by fn(name, value). It is used to encrypt, decrypt and redact secrets.
+func (c *MonitorConfig) TransformSecrets(fn func(name, value string) (string, error)) (*MonitorConfig, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	out := *c
+	if c.HTTP != nil && len(c.HTTP.SecretHeaders) > 0 {
+		httpCfg := *c.HTTP
+		headers, err := transformSecretHeaders(c.HTTP.SecretHeaders, "", fn)
+		if err != nil {
+			return nil, err
+		}
+		httpCfg.SecretHeaders = headers
+		out.HTTP = &httpCfg
+	}
+	if c.Database != nil && c.Database.Password != "" {
+		database := *c.Database
+		password, err := fn(DatabasePasswordSecret, c.Database.Password)
+		if err != nil {
+			return nil, fmt.Errorf("database password: %w", err)
+		}
+		database.Password = password
+		out.Database = &database
+	}
+	if c.Mail != nil && c.Mail.Password != "" {
+		mail := *c.Mail
+		password, err := fn(MailPasswordSecret, c.Mail.Password)
+		if err != nil {
+			return nil, fmt.Errorf("mail password: %w", err)
+		}
+		mail.Password = password
+		out.Mail = &mail
+	}
+	if c.GRPC != nil && (c.GRPC.ClientCertPEM != "" || c.GRPC.ClientKeyPEM != "") {
+		grpcCfg := *c.GRPC
+		var err error
+		if grpcCfg.ClientCertPEM != "" {
+			if grpcCfg.ClientCertPEM, err = fn(GRPCClientCertSecret, c.GRPC.ClientCertPEM); err != nil {
+				return nil, fmt.Errorf("grpc client certificate: %w", err)
+			}
+		}
+		if grpcCfg.ClientKeyPEM != "" {
+			if grpcCfg.ClientKeyPEM, err = fn(GRPCClientKeySecret, c.GRPC.ClientKeyPEM); err != nil {
+				return nil, fmt.Errorf("grpc client key: %w", err)
+			}
+		}
+		out.GRPC = &grpcCfg
+	}
+	if c.WebSocket != nil && len(c.WebSocket.SecretHeaders) > 0 {
+		webSocket := *c.WebSocket
+		headers, err := transformSecretHeaders(c.WebSocket.SecretHeaders, "", fn)
+		if err != nil {
+			return nil, err
+		}
+		webSocket.SecretHeaders = headers
+		out.WebSocket = &webSocket
+	}
+	if c.Transaction != nil {
+		transaction := *c.Transaction
+		transaction.Steps = append([]TransactionStep(nil), c.Transaction.Steps...)
+		for i, step := range transaction.Steps {
+			if len(step.SecretHeaders) == 0 {
+				continue
+			}
+			headers, err := transformSecretHeaders(step.SecretHeaders, SecretStepPrefix(i), fn)
+			if err != nil {
+				return nil, err
+			}
+			transaction.Steps[i].SecretHeaders = headers
+		}
+		out.Transaction = &transaction
+	}
+
+	return &out, nil
+}
+
+// SecretValues returns every secret of the configuration under the name
+// TransformSecrets passes for it
+func (c *MonitorConfig) SecretValues() map[string]string {
+	values := make(map[string]string)
+	if c == nil {
+		return values
+	}
+	if c.HTTP != nil {
+		for name, value := range c.HTTP.SecretHeaders {
+			values[name] = value
+		}
+	}
+	if c.Database != nil && c.Database.Password != "" {
+		values[DatabasePasswordSecret] = c.Database.Password
+	}
+	if c.Mail != nil && c.Mail.Password != "" {
+		values[MailPasswordSecret] = c.Mail.Password
+	}
+	if c.GRPC != nil && c.GRPC.ClientCertPEM != "" {
+		values[GRPCClientCertSecret] = c.GRPC.ClientCertPEM
+	}
+	if c.GRPC != nil && c.GRPC.ClientKeyPEM != "" {
+		values[GRPCClientKeySecret] = c.GRPC.ClientKeyPEM
+	}
+	if c.WebSocket != nil {
+		for name, value := range c.WebSocket.SecretHeaders {
+			values[name] = value
+		}
+	}
+	if c.Transaction != nil {
+		for i, step := range c.Transaction.Steps {
+			for name, value := range step.SecretHeaders {
+				values[SecretStepPrefix(i)+name] = value
+			}
+		}
+	}
+	return values
+}
+
+// DatabasePasswordSecret names the database password among a configuration's secrets
+const DatabasePasswordSecret = "database password"
+
+// MailPasswordSecret names the mail password among a configuration's secrets
+const MailPasswordSecret = "mail password"
+
+// GRPCClientCertSecret and GRPCClientKeySecret name the gRPC client
+// certificate and key among a configuration's secrets
+const (
+	GRPCClientCertSecret = "grpc client certificate"
+	GRPCClientKeySecret  = "grpc client key"
+)
+
+// SecretStepPrefix qualifies the secret header names of transaction step i (0-based)
+func SecretStepPrefix(i int) string {
+	return fmt.Sprintf("step %d ", i+1)
+}
+
+// transformSecretHeaders applies fn to a copy of headers, naming each header with prefix
+func transformSecretHeaders(headers map[string]string, prefix string, fn func(name, value string) (string, error)) (map[string]string, error) {
+	out := make(map[string]string, len(headers))
+	for name, value := range headers {
+		transformed, err := fn(prefix+name, value)
+		if err != nil {
+			return nil, fmt.Errorf("secret header %s%s: %w", prefix, name, err)
+		}
+		out[name] = transformed
+	}
+	return out, nil
+}
+
+// Redacted returns a copy of the configuration that is safe to show in the API
+func (c *MonitorConfig) Redacted() *MonitorConfig {
+	redacted, _ := c.TransformSecrets(func(string, string) (string, error) {
+		return RedactedSecret, nil
+	})
+	return redacted
+}
+
+// Validate validates an HTTPCheckConfig
+func (h *HTTPCheckConfig) Validate() error {
+	h.Method = strings.ToUpper(strings.TrimSpace(h.Method))
+	if h.Method != "" && !httpMethodRegex.MatchString(h.Method) {
+		return fmt.Errorf("invalid method %q", h.Method)
+	}
+
+	if err := validateHeaders(h.Headers, h.SecretHeaders); err != nil {
+		return err
+	}
+
+	for _, spec := range h.AcceptedStatus {
+		if _, _, err := parseStatusRange(spec); err != nil {
+			return err
+		}
+	}
+
+	switch h.RedirectPolicy {
+	case "", RedirectFollow, RedirectNone:
+	default:
+		return fmt.Errorf("redirect_policy must be %q or %q", RedirectFollow, RedirectNone)
+	}
+	if h.MaxRedirects < 0 || h.MaxRedirects > maxMaxRedirects {
+		return fmt.Errorf("max_redirects must be between 0 and %d", maxMaxRedirects)
+	}
+
+	if err := validateCheckTimeout(h.Timeout); err != nil {
+		return err
+	}
+
+	switch h.IPVersion {
+	case "", IPVersion4, IPVersion6:
+	default:
+		return fmt.Errorf("ip_version must be %q or %q", IPVersion4, IPVersion6)
+	}
+
+	for i := range h.Assertions {
+		if err := h.Assertions[i].Validate(); err != nil {
+			return fmt.Errorf("assertion %d: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
+
+// validateHeaders checks the names and values of a check's plain and secret headers
+func validateHeaders(headers, secretHeaders map[string]string) error {
+	for _, set := range []map[string]string{headers, secretHeaders} {
+		for name, value := range set {
+			if !headerNameRegex.MatchString(name) {
+				return fmt.Errorf("invalid header name %q", name)
+			}
+			if strings.ContainsAny(value, "\r\n") {
+				return fmt.Errorf("header %s must not contain line breaks", name)
+			}
+		}
+	}
+	for name := range secretHeaders {
+		if _, exists := headers[name]; exists {
+			return fmt.Errorf("header %s is set both as a header and a secret header", name)
+		}
+	}
+	return nil
+}
+
+// Validate validates an HTTPAssertion
+func (a *HTTPAssertion) Validate() error {
+	switch a.Type {
+	case AssertBodyContains, AssertBodyNotContains:
+		if a.Value == "" {
+			return fmt.Errorf("%s requires a value", a.Type)
+		}
+	case AssertBodyRegex:
+		if _, err := regexp.Compile(a.Value); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	case AssertJSONPathEquals, AssertJSONPathMatches:
+		if _, err := ParseJSONPath(a.Path); err != nil {
+			return err
+		}
+		if a.Type == AssertJSONPathMatches {
+			if _, err := regexp.Compile(a.Value); err != nil {
+				return fmt.Errorf("invalid regex: %w", err)
+			}
+		}
+	case AssertHeaderPresent, AssertHeaderEquals:
+		if !headerNameRegex.MatchString(a.Header) {
+			return fmt.Errorf("invalid header name %q", a.Header)
+		}
+	case AssertSize:
+		if a.MinBytes == nil && a.MaxBytes == nil {
+			return fmt.Errorf("size requires min_bytes or max_bytes")
+		}
+		if (a.MinBytes != nil && *a.MinBytes < 0) || (a.MaxBytes != nil && *a.MaxBytes < 0) {
+			return fmt.Errorf("size bounds must not be negative")
+		}
+		if a.MinBytes != nil && a.MaxBytes != nil && *a.MinBytes > *a.MaxBytes {
+			return fmt.Errorf("min_bytes must not exceed max_bytes")
+		}
+	case AssertLatencyBelow:
+		if threshold, err := time.ParseDuration(a.Threshold); err != nil || threshold <= 0 {
+			return fmt.Errorf("latency_below requires a positive threshold (e.g. \"800ms\")")
+		}
+	default:
+		return fmt.Errorf("unknown assertion type %q", a.Type)
+	}
+	return nil
+}
+
+// ParseJSONPath splits a path such as "$.data.items[0].id" into object keys
+// and array indexes; indexes are returned in brackets, e.g. "[0]"
+func ParseJSONPath(path string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	trimmed = strings.TrimPrefix(trimmed, ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("JSON path is required")
+	}
+
+	var segments []string
+	for _, part := range strings.Split(trimmed, ".") {
+		key, rest, hasIndex := strings.Cut(part, "[")
+		if key == "" && !hasIndex {
+			return nil, fmt.Errorf("invalid JSON path %q: empty segment", path)
+		}
+		if key != "" {
+			segments = append(segments, key)
+		}
+		for hasIndex {
+			index, after, ok := strings.Cut(rest, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid JSON path %q: unclosed [", path)
+			}
+			if _, err := strconv.Atoi(index); err != nil {
+				return nil, fmt.Errorf("invalid JSON path %q: index %q is not a number", path, index)
+			}
+			segments = append(segments, "["+index+"]")
+			if after != "" && !strings.HasPrefix(after, "[") {
+				return nil, fmt.Errorf("invalid JSON path %q: unexpected %q", path, after)
+			}
+			rest, hasIndex = strings.CutPrefix(after, "[")
+		}
+	}
+	return segments, nil
+}
+
+// Validate validates a ContentChangeConfig
+func (c *ContentChangeConfig) Validate() error {
+	if len(c.IgnoreSelectors)+len(c.IgnorePatterns) > maxContentIgnoreRules {
+		return fmt.Errorf("at most %d ignore rules are allowed", maxContentIgnoreRules)
+	}
+	for _, selector := range c.IgnoreSelectors {
+		if _, err := ParseCSSSelector(selector); err != nil {
+			return err
+		}
+	}
+	for _, pattern := range c.IgnorePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// maxContentIgnoreRules bounds the selectors and patterns of a ContentChangeConfig
+const maxContentIgnoreRules = 50
+
+// CSSSelector is a parsed selector: compound selectors such as "div.note"
+// joined by descendant (space) or child (">") combinators
+type CSSSelector []CSSCompound
+
+// CSSCompound matches a single element
+type CSSCompound struct {
+	Child      bool           // Must be a child of the element the previous compound matched
+	Tag        string         // Lowercase; empty matches any element
+	ID         string         // #id
+	Classes    []string       // .class, all required
+	Attributes []CSSAttribute // [name] or [name=value]
+}
+
+// CSSAttribute requires an attribute, with an exact value when HasValue is set
+type CSSAttribute struct {
+	Name     string
+	Value    string
+	HasValue bool
+}
+
+// ParseCSSSelector parses the subset of CSS selectors change detection
+// supports: type, #id, .class, [attr] and [attr=value] joined by descendant
+// and child combinators. Attribute values cannot contain spaces, and selector
+// lists are written as separate entries.
+func ParseCSSSelector(selector string) (CSSSelector, error) {
+	if strings.Contains(selector, ",") {
+		return nil, fmt.Errorf("invalid selector %q: list selectors as separate entries", selector)
+	}
+
+	var parsed CSSSelector
+	child := false
+	// Space out child combinators so every compound is a field of its own
+	for _, field := range strings.Fields(strings.ReplaceAll(selector, ">", " > ")) {
+		if field == ">" {
+			if child || len(parsed) == 0 {
+				return nil, fmt.Errorf("invalid selector %q: misplaced >", selector)
+			}
+			child = true
+			continue
+		}
+		compound, err := parseCSSCompound(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector %q: %w", selector, err)
+		}
+		compound.Child = child
+		child = false
+		parsed = append(parsed, compound)
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("selector is empty")
+	}
+	if child {
+		return nil, fmt.Errorf("invalid selector %q: ends with >", selector)
+	}
+	return parsed, nil
+}
+
+// parseCSSCompound parses a compound selector such as "div#main.note[hidden]"
+func parseCSSCompound(text string) (CSSCompound, error) {
+	var compound CSSCompound
+	rest := text
+	if strings.HasPrefix(rest, "*") {
+		rest = rest[1:]
+	} else if tag := cssIdentifierRegex.FindString(rest); tag != "" {
+		compound.Tag = strings.ToLower(tag)
+		rest = rest[len(tag):]
+	}
+
+	for rest != "" {
+		switch rest[0] {
+		case '#', '.':
+			name := cssIdentifierRegex.FindString(rest[1:])
+			if name == "" {
+				return compound, fmt.Errorf("expected a name after %q", rest[:1])
+			}
+			if rest[0] == '#' {
+				compound.ID = name
+			} else {
+				compound.Classes = append(compound.Classes, name)
+			}
+			rest = rest[1+len(name):]
+		case '[':
+			inner, after, ok := strings.Cut(rest[1:], "]")
+			if !ok {
+				return compound, fmt.Errorf("unclosed [")
+			}
+			name, value, hasValue := strings.Cut(inner, "=")
+			if name == "" || cssIdentifierRegex.FindString(name) != name {
+				return compound, fmt.Errorf("invalid attribute name %q", name)
+			}
+			if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+				value = value[1 : len(value)-1]
+			}
+			compound.Attributes = append(compound.Attributes, CSSAttribute{Name: strings.ToLower(name), Value: value, HasValue: hasValue})
+			rest = after
+		default:
+			return compound, fmt.Errorf("unexpected %q", rest[:1])
+		}
+	}
+	return compound, nil
+}
+
+// Validate validates a TCPCheckConfig
+func (t *TCPCheckConfig) Validate() error {
+	if t.ExpectRegex != "" {
+		if _, err := regexp.Compile(t.ExpectRegex); err != nil {
+			return fmt.Errorf("invalid expect_regex: %w", err)
+		}
+	}
+	if t.ServerName != "" && !t.TLS {
+		return fmt.Errorf("server_name requires tls")
+	}
+	return validateCheckTimeout(t.Timeout)
+}
+
+// ExpectsResponse reports whether the check reads a response from the server
+func (t *TCPCheckConfig) ExpectsResponse() bool {
+	return t != nil && (t.Expect != "" || t.ExpectRegex != "")
+}
+
+// Validate validates a TransactionCheckConfig. Steps may only use variables
+// extracted by earlier steps.
+func (t *TransactionCheckConfig) Validate() error {
+	if len(t.Steps) == 0 {
+		return fmt.Errorf("at least one step is required")
+	}
+	if len(t.Steps) > maxTransactionSteps {
+		return fmt.Errorf("at most %d steps are allowed", maxTransactionSteps)
+	}
+
+	defined := make(map[string]bool)
+	for i := range t.Steps {
+		step := &t.Steps[i]
+		if err := step.Validate(defined); err != nil {
+			if step.Name != "" {
+				return fmt.Errorf("step %d (%s): %w", i+1, step.Name, err)
+			}
+			return fmt.Errorf("step %d: %w", i+1, err)
+		}
+		for _, variable := range step.Extract {
+			defined[variable.Name] = true
+		}
+	}
+
+	return validateCheckTimeout(t.Timeout)
+}
+
+// Validate validates a TransactionStep given the variables defined before it
+func (s *TransactionStep) Validate(defined map[string]bool) error {
+	// Variables stand in for any text, so check the URL with placeholders
+	placeholder := variableRefRegex.ReplaceAllString(s.URL, "x")
+	parsed, err := url.Parse(placeholder)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("url must be an absolute http:// or https:// URL")
+	}
+
+	if err := s.HTTPCheckConfig.Validate(); err != nil {
+		return err
+	}
+
+	for _, text := range s.templates() {
+		for _, match := range variableRefRegex.FindAllStringSubmatch(text, -1) {
+			if !defined[match[1]] {
+				return fmt.Errorf("variable %s is not extracted by an earlier step", match[1])
+			}
+		}
+	}
+
+	for _, variable := range s.Extract {
+		if !variableNameRegex.MatchString(variable.Name) {
+			return fmt.Errorf("invalid variable name %q", variable.Name)
+		}
+		switch {
+		case (variable.JSONPath == "") == (variable.Regex == ""):
+			return fmt.Errorf("variable %s needs either json_path or regex", variable.Name)
+		case variable.JSONPath != "":
+			if _, err := ParseJSONPath(variable.JSONPath); err != nil {
+				return fmt.Errorf("variable %s: %w", variable.Name, err)
+			}
+		default:
+			if _, err := regexp.Compile(variable.Regex); err != nil {
+				return fmt.Errorf("variable %s: invalid regex: %w", variable.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Resolve returns the step's URL and request settings with variables replaced
+// by their values. Unknown variables are left as they are.
+func (s *TransactionStep) Resolve(vars map[string]string) (string, *HTTPCheckConfig) {
+	expand := func(text string) string {
+		return variableRefRegex.ReplaceAllStringFunc(text, func(ref string) string {
+			if value, ok := vars[variableRefRegex.FindStringSubmatch(ref)[1]]; ok {
+				return value
+			}
+			return ref
+		})
+	}
+	expandHeaders := func(headers map[string]string) map[string]string {
+		if headers == nil {
+			return nil
+		}
+		out := make(map[string]string, len(headers))
+		for name, value := range headers {
+			out[name] = expand(value)
+		}
+		return out
+	}
+
+	resolved := s.HTTPCheckConfig
+	resolved.Headers = expandHeaders(s.Headers)
+	resolved.SecretHeaders = expandHeaders(s.SecretHeaders)
+	resolved.Body = expand(s.Body)
+	resolved.Assertions = append([]HTTPAssertion(nil), s.Assertions...)
+	for i := range resolved.Assertions {
+		resolved.Assertions[i].Value = expand(resolved.Assertions[i].Value)
+	}
+
+	return expand(s.URL), &resolved
+}
+
+// templates lists the step's fields that may reference variables
+func (s *TransactionStep) templates() []string {
+	texts := []string{s.URL, s.Body}
+	for _, headers := range []map[string]string{s.Headers, s.SecretHeaders} {
+		for _, value := range headers {
+			texts = append(texts, value)
+		}
+	}
+	for _, assertion := range s.Assertions {
+		texts = append(texts, assertion.Value)
+	}
+	return texts
+}
+
+// Validate validates a GRPCCheckConfig
+func (g *GRPCCheckConfig) Validate() error {
+	if strings.ContainsAny(g.Authority, " \t\r\n/") {
+		return fmt.Errorf("authority must be a host or host:port")
+	}
+	if !g.TLS && (g.ServerName != "" || g.CAPEM != "" || g.ClientCertPEM != "" || len(g.HostFiles()) > 0) {
+		return fmt.Errorf("server_name, CA and client certificates require tls")
+	}
+	if g.CAPEM != "" && g.CAFile != "" {
+		return fmt.Errorf("set either ca_pem or ca_file, not both")
+	}
+	if g.CAPEM != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(g.CAPEM)) {
+		return fmt.Errorf("ca_pem contains no PEM certificates")
+	}
+	if (g.ClientCertPEM == "") != (g.ClientKeyPEM == "") {
+		return fmt.Errorf("client_cert_pem and client_key_pem must be set together")
+	}
+	if (g.ClientCertFile == "") != (g.ClientKeyFile == "") {
+		return fmt.Errorf("client_cert_file and client_key_file must be set together")
+	}
+	if g.ClientCertPEM != "" && g.ClientCertFile != "" {
+		return fmt.Errorf("set either client_cert_pem or client_cert_file, not both")
+	}
+	return validateCheckTimeout(g.Timeout)
+}
+
+// Validate validates a MailCheckConfig for a site whose URL does or does not
+// start TLS with the connection
+func (m *MailCheckConfig) Validate(implicitTLS bool) error {
+	if m.StartTLS && implicitTLS {
+		return fmt.Errorf("starttls does not apply to smtps:// and imaps:// sites, which use TLS from the start")
+	}
+	usesTLS := m.StartTLS || implicitTLS
+	if m.ServerName != "" && !usesTLS {
+		return fmt.Errorf("server_name requires starttls or an smtps:// or imaps:// URL")
+	}
+	if m.ExpectBanner != "" {
+		if _, err := regexp.Compile(m.ExpectBanner); err != nil {
+			return fmt.Errorf("invalid expect_banner: %w", err)
+		}
+	}
+	for _, capability := range m.RequiredCapabilities {
+		if capability == "" || strings.ContainsAny(capability, " \t\r\n") {
+			return fmt.Errorf("invalid capability %q", capability)
+		}
+	}
+	if strings.ContainsAny(m.HelloName, " \t\r\n") {
+		return fmt.Errorf("invalid hello_name %q", m.HelloName)
+	}
+	if (m.Username == "") != (m.Password == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	if strings.ContainsAny(m.Username+m.Password, "\r\n") {
+		return fmt.Errorf("username and password must not contain line breaks")
+	}
+	if m.Username != "" && !usesTLS {
+		return fmt.Errorf("authentication requires starttls or an smtps:// or imaps:// URL")
+	}
+	return validateCheckTimeout(m.Timeout)
+}
+
+// Validate validates a DatabaseCheckConfig
+func (d *DatabaseCheckConfig) Validate() error {
+	if d.ExpectRows != nil && *d.ExpectRows < 0 {
+		return fmt.Errorf("expect_rows must not be negative")
+	}
+	if len(d.Query) > 4096 {
+		return fmt.Errorf("query must be at most 4096 characters")
+	}
+	return validateCheckTimeout(d.Timeout)
+}
+
+// ProbeQuery returns the configured query, defaulting to SELECT 1
+func (d *DatabaseCheckConfig) ProbeQuery() string {
+	if d == nil || strings.TrimSpace(d.Query) == "" {
+		return "SELECT 1"
+	}
+	return d.Query
+}
+
+// Validate validates a WebSocketCheckConfig
+func (w *WebSocketCheckConfig) Validate() error {
+	if err := validateHeaders(w.Headers, w.SecretHeaders); err != nil {
+		return err
+	}
+	for _, set := range []map[string]string{w.Headers, w.SecretHeaders} {
+		for name := range set {
+			// The handshake sets these itself
+			switch http.CanonicalHeaderKey(name) {
+			case "Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol":
+				return fmt.Errorf("header %s is set by the WebSocket handshake", name)
+			}
+		}
+	}
+	for _, protocol := range w.Subprotocols {
+		if !headerNameRegex.MatchString(protocol) {
+			return fmt.Errorf("invalid subprotocol %q", protocol)
+		}
+	}
+	if w.ExpectRegex != "" {
+		if _, err := regexp.Compile(w.ExpectRegex); err != nil {
+			return fmt.Errorf("invalid expect_regex: %w", err)
+		}
+	}
+	if w.JSONPath != "" {
+		if _, err := ParseJSONPath(w.JSONPath); err != nil {
+			return err
+		}
+	} else if w.JSONValue != nil {
+		return fmt.Errorf("json_value requires json_path")
+	}
+	return validateCheckTimeout(w.Timeout)
+}
+
+// ExpectsMessage reports whether the check waits for a message after the upgrade
+func (w *WebSocketCheckConfig) ExpectsMessage() bool {
+	return w != nil && (w.Send != "" || w.ExpectRegex != "" || w.JSONPath != "")
+}
+
+// Validate validates a PushCheckConfig
+func (p *PushCheckConfig) Validate() error {
+	for field, value := range map[string]string{"grace": p.Grace, "max_duration": p.MaxDuration} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 || d > 7*24*time.Hour {
+			return fmt.Errorf("%s must be a positive duration up to 168h (e.g. \"10m\")", field)
+		}
+	}
+	return nil
+}
+
+// Windows returns the grace period after each interval and how long a started job may run
+func (p *PushCheckConfig) Windows() (grace, maxDuration time.Duration) {
+	grace = DefaultPushGrace
+	if p != nil {
+		if d, err := time.ParseDuration(p.Grace); err == nil {
+			grace = d
+		}
+	}
+	maxDuration = grace
+	if p != nil {
+		if d, err := time.ParseDuration(p.MaxDuration); err == nil {
+			maxDuration = d
+		}
+	}
+	return grace, maxDuration
+}
+
+// Validate validates a PingCheckConfig
+func (p *PingCheckConfig) Validate() error {
+	if p.Count < 0 || p.Count > maxPingCount {
+		return fmt.Errorf("count must be between 1 and %d", maxPingCount)
+	}
+	for field, value := range map[string]string{"interval": p.Interval, "probe_timeout": p.ProbeTimeout, "degraded_rtt": p.DegradedRTT} {
+		if value == "" {
+			continue
+		}
+		if d, err := time.ParseDuration(value); err != nil || d <= 0 || d > time.Minute {
+			return fmt.Errorf("%s must be a positive duration up to 1m (e.g. \"500ms\")", field)
+		}
+	}
+	for field, value := range map[string]*float64{"degraded_loss_percent": p.DegradedLossPercent, "down_loss_percent": p.DownLossPercent} {
+		if value != nil && (*value < 0 || *value > 100) {
+			return fmt.Errorf("%s must be between 0 and 100", field)
+		}
+	}
+	switch p.IPVersion {
+	case "", IPVersion4, IPVersion6:
+	default:
+		return fmt.Errorf("ip_version must be %q or %q", IPVersion4, IPVersion6)
+	}
+	return validateCheckTimeout(p.Timeout)
+}
+
+// Probes returns the probe count, the interval between probes and how long to wait for each reply
+func (p *PingCheckConfig) Probes() (count int, interval, probeTimeout time.Duration) {
+	count, interval, probeTimeout = DefaultPingCount, DefaultPingInterval, DefaultPingProbeTimeout
+	if p == nil {
+		return
+	}
+	if p.Count > 0 {
+		count = p.Count
+	}
+	if d, err := time.ParseDuration(p.Interval); err == nil {
+		interval = d
+	}
+	if d, err := time.ParseDuration(p.ProbeTimeout); err == nil {
+		probeTimeout = d
+	}
+	return
+}
+
+// Validate validates a DNSCheckConfig
+func (d *DNSCheckConfig) Validate() error {
+	if d.ExactValues && len(d.ExpectValues) == 0 {
+		return fmt.Errorf("exact_values requires expect_values")
+	}
+	if (d.MinAnswers != nil && *d.MinAnswers < 0) || (d.MaxAnswers != nil && *d.MaxAnswers < 0) {
+		return fmt.Errorf("answer counts must not be negative")
+	}
+	if d.MinAnswers != nil && d.MaxAnswers != nil && *d.MinAnswers > *d.MaxAnswers {
+		return fmt.Errorf("min_answers must not exceed max_answers")
+	}
+	if d.MinTTL != nil && d.MaxTTL != nil && *d.MinTTL > *d.MaxTTL {
+		return fmt.Errorf("min_ttl must not exceed max_ttl")
+	}
+	d.RCode = strings.ToUpper(strings.TrimSpace(d.RCode))
+	if d.RCode != "" {
+		if _, ok := DNSRCodes[d.RCode]; !ok {
+			return fmt.Errorf("unknown rcode %q", d.RCode)
+		}
+	}
+	return validateCheckTimeout(d.Timeout)
+}
+
+// ExpectedRCode returns the response code the check expects
+func (d *DNSCheckConfig) ExpectedRCode() string {
+	if d == nil || d.RCode == "" {
+		return "NOERROR"
+	}
+	return d.RCode
+}
+
+// Validate validates a TLSCheckConfig
+func (t *TLSCheckConfig) Validate() error {
+	if t.ExpiryWarningDays < 0 || t.ExpiryWarningDays > maxExpiryWindowDays ||
+		t.ExpiryCriticalDays < 0 || t.ExpiryCriticalDays > maxExpiryWindowDays {
+		return fmt.Errorf("expiry windows must be between 0 and %d days", maxExpiryWindowDays)
+	}
+	warning, critical := t.ExpiryWindows()
+	if critical > warning {
+		return fmt.Errorf("expiry_critical_days must not exceed expiry_warning_days")
+	}
+	return nil
+}
+
+// ExpiryWindows returns the warning and critical expiry windows
+func (t *TLSCheckConfig) ExpiryWindows() (warning, critical time.Duration) {
+	warningDays, criticalDays := DefaultExpiryWarningDays, DefaultExpiryCriticalDays
+	if t != nil && t.ExpiryWarningDays > 0 {
+		warningDays = t.ExpiryWarningDays
+	}
+	if t != nil && t.ExpiryCriticalDays > 0 {
+		criticalDays = t.ExpiryCriticalDays
+	}
+	return time.Duration(warningDays) * 24 * time.Hour, time.Duration(criticalDays) * 24 * time.Hour
+}
+
+// validateCheckTimeout validates an optional per-check timeout
+func validateCheckTimeout(value string) error {
+	if value == "" {
+		return nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 || timeout > maxCheckTimeout {
+		return fmt.Errorf("timeout must be a positive duration no longer than %s (e.g. \"10s\")", maxCheckTimeout)
+	}
+	return nil
+}
+
+// RequestMethod returns the configured method, defaulting to GET
+func (h *HTTPCheckConfig) RequestMethod() string {
+	if h == nil || h.Method == "" {
+		return http.MethodGet
+	}
+	return h.Method
+}
+
+// PreferredIPVersion returns the configured IP version, or "" for either
+func (h *HTTPCheckConfig) PreferredIPVersion() string {
+	if h == nil {
+		return ""
+	}
+	return h.IPVersion
+}
+
+// FollowsRedirects reports whether redirects should be followed, and at most how many
+func (h *HTTPCheckConfig) FollowsRedirects() (bool, int) {
+	if h == nil {
+		return true, DefaultMaxRedirects
+	}
+	if h.RedirectPolicy == RedirectNone {
+		return false, 0
+	}
+	if h.MaxRedirects == 0 {
+		return true, DefaultMaxRedirects
+	}
+	return true, h.MaxRedirects
+}
+
+// AcceptsStatus reports whether a response status code counts as up
+func (h *HTTPCheckConfig) AcceptsStatus(code int) bool {
+	if h == nil || len(h.AcceptedStatus) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, spec := range h.AcceptedStatus {
+		if lo, hi, err := parseStatusRange(spec); err == nil && code >= lo && code <= hi {
+			return true
+		}
+	}
+	return false
+}
+
+// parseStatusRange parses "200", "2xx" or "200-299" into an inclusive range
+func parseStatusRange(spec string) (int, int, error) {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+	invalid := fmt.Errorf("invalid accepted status %q (use e.g. \"200\", \"2xx\" or \"200-299\")", spec)
+
+	if len(spec) == 3 && strings.HasSuffix(spec, "xx") {
+		class, err := strconv.Atoi(spec[:1])
+		if err != nil || class < 1 || class > 5 {
+			return 0, 0, invalid
+		}
+		return class * 100, class*100 + 99, nil
+	}
+
+	loStr, hiStr, isRange := strings.Cut(spec, "-")
+	if !isRange {
+		hiStr = loStr
+	}
+	lo, err := strconv.Atoi(strings.TrimSpace(loStr))
+	if err != nil {
+		return 0, 0, invalid
+	}
+	hi, err := strconv.Atoi(strings.TrimSpace(hiStr))
+	if err != nil || lo < 100 || hi > 599 || lo > hi {
+		return 0, 0, invalid
+	}
+	return lo, hi, nil
+}
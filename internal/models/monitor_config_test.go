@@ -0,0 +1,151 @@
+package models
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []string
+		wantErr string
+	}{
+		{path: "$.status", want: []string{"status"}},
+		{path: "status", want: []string{"status"}},
+		{path: " $.data.items[0].id ", want: []string{"data", "items", "[0]", "id"}},
+		{path: "$[2]", want: []string{"[2]"}},
+		{path: "matrix[1][3]", want: []string{"matrix", "[1]", "[3]"}},
+		{path: "$", wantErr: "required"},
+		{path: "", wantErr: "required"},
+		{path: "$.data..id", wantErr: "empty segment"},
+		{path: "items[0", wantErr: "unclosed ["},
+		{path: "items[first]", wantErr: "is not a number"},
+		{path: "items[0]id", wantErr: "unexpected"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ParseJSONPath(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseJSONPath(%q) error = %v, want %q", tt.path, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseJSONPath(%q): %v", tt.path, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseJSONPath(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTTPAssertionValidate(t *testing.T) {
+	size := func(n int64) *int64 { return &n }
+
+	tests := []struct {
+		name      string
+		assertion HTTPAssertion
+		wantErr   string
+	}{
+		{"keyword", HTTPAssertion{Type: AssertBodyContains, Value: "ok"}, ""},
+		{"keyword missing", HTTPAssertion{Type: AssertBodyNotContains}, "requires a value"},
+		{"invalid regex", HTTPAssertion{Type: AssertBodyRegex, Value: "[a-"}, "invalid regex"},
+		{"json path", HTTPAssertion{Type: AssertJSONPathEquals, Path: "$.a[0]", Value: "x"}, ""},
+		{"json path missing", HTTPAssertion{Type: AssertJSONPathEquals, Value: "x"}, "JSON path is required"},
+		{"json match invalid regex", HTTPAssertion{Type: AssertJSONPathMatches, Path: "a", Value: "("}, "invalid regex"},
+		{"header", HTTPAssertion{Type: AssertHeaderPresent, Header: "X-Cache"}, ""},
+		{"invalid header name", HTTPAssertion{Type: AssertHeaderEquals, Header: "Bad Header"}, "invalid header name"},
+		{"size", HTTPAssertion{Type: AssertSize, MaxBytes: size(1024)}, ""},
+		{"size without bounds", HTTPAssertion{Type: AssertSize}, "requires min_bytes or max_bytes"},
+		{"negative size", HTTPAssertion{Type: AssertSize, MinBytes: size(-1)}, "must not be negative"},
+		{"inverted size bounds", HTTPAssertion{Type: AssertSize, MinBytes: size(10), MaxBytes: size(5)}, "must not exceed"},
+		{"latency", HTTPAssertion{Type: AssertLatencyBelow, Threshold: "800ms"}, ""},
+		{"zero latency", HTTPAssertion{Type: AssertLatencyBelow, Threshold: "0s"}, "positive threshold"},
+		{"unknown type", HTTPAssertion{Type: "status_code"}, "unknown assertion type"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.assertion.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPingCheckConfigProbes(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          *PingCheckConfig
+		count        int
+		interval     time.Duration
+		probeTimeout time.Duration
+	}{
+		{"nil config", nil, DefaultPingCount, DefaultPingInterval, DefaultPingProbeTimeout},
+		{"empty config", &PingCheckConfig{}, DefaultPingCount, DefaultPingInterval, DefaultPingProbeTimeout},
+		{"configured", &PingCheckConfig{Count: 5, Interval: "1s", ProbeTimeout: "500ms"}, 5, time.Second, 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			count, interval, probeTimeout := tt.cfg.Probes()
+			if count != tt.count || interval != tt.interval || probeTimeout != tt.probeTimeout {
+				t.Errorf("Probes() = %d, %s, %s, want %d, %s, %s", count, interval, probeTimeout, tt.count, tt.interval, tt.probeTimeout)
+			}
+		})
+	}
+}
+
+func TestParseCSSSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     CSSSelector
+		wantErr  string
+	}{
+		{selector: "#banner", want: CSSSelector{{ID: "banner"}}},
+		{selector: "DIV.note.top", want: CSSSelector{{Tag: "div", Classes: []string{"note", "top"}}}},
+		{selector: "*[hidden]", want: CSSSelector{{Attributes: []CSSAttribute{{Name: "hidden"}}}}},
+		{selector: `li[data-Region="us"]`, want: CSSSelector{{Tag: "li", Attributes: []CSSAttribute{{Name: "data-region", Value: "us", HasValue: true}}}}},
+		{selector: "main p>span.ts", want: CSSSelector{{Tag: "main"}, {Tag: "p"}, {Child: true, Tag: "span", Classes: []string{"ts"}}}},
+		{selector: "  ", wantErr: "selector is empty"},
+		{selector: "h1, h2", wantErr: "separate entries"},
+		{selector: "> p", wantErr: "misplaced >"},
+		{selector: "div > > p", wantErr: "misplaced >"},
+		{selector: "div >", wantErr: "ends with >"},
+		{selector: "div.", wantErr: `expected a name after "."`},
+		{selector: "a[href", wantErr: "unclosed ["},
+		{selector: "a[=x]", wantErr: "invalid attribute name"},
+		{selector: "p:first-child", wantErr: `unexpected ":"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			got, err := ParseCSSSelector(tt.selector)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseCSSSelector(%q) error = %v, want %q", tt.selector, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseCSSSelector(%q): %v", tt.selector, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseCSSSelector(%q) = %+v, want %+v", tt.selector, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package monitor
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// maxContentChanges is how many content changes are kept per site
+const maxContentChanges = 50
+
+// checkContent normalizes the body of an up HTTP check and records it for
+// change detection. Failures are only logged: a page that cannot be compared
+// is not a failed check.
+func (m *Monitor) checkContent(site *models.Site, resp *http.Response, at time.Time) {
+	body, _, err := utils.ReadAssertionBody(resp.Body)
+	if err != nil {
+		log.Warn().Err(err).Int("site_id", site.ID).Msg("Failed to read body for content change detection")
+		return
+	}
+	snapshot, err := utils.NormalizeContent(body, resp.Header.Get("Content-Type"), site.Config.ContentChange)
+	if err != nil {
+		log.Warn().Err(err).Int("site_id", site.ID).Msg("Failed to normalize content")
+		return
+	}
+	if _, err := m.RecordContentSnapshot(site.ID, snapshot, at); err != nil {
+		log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to record content snapshot")
+	}
+}
+
+// RecordContentSnapshot compares a site's latest content with the last known
+// one. The first snapshot becomes the baseline; a different hash is recorded
+// as a change with a diff of the two. It returns the change, or nil when
+// nothing changed.
+func (m *Monitor) RecordContentSnapshot(siteID int, snapshot *models.ContentSnapshot, at time.Time) (*models.ContentChange, error) {
+	previous, err := m.db.GetContentSnapshot(siteID)
+	if err != nil {
+		return nil, err
+	}
+	if previous == nil {
+		_, err := m.db.SaveContentBaseline(siteID, snapshot, at)
+		return nil, err
+	}
+	if previous.Hash == snapshot.Hash {
+		return nil, nil
+	}
+
+	change := &models.ContentChange{
+		SiteID:       siteID,
+		PreviousHash: previous.Hash,
+		Hash:         snapshot.Hash,
+		Diff:         utils.UnifiedDiff(previous.Text, snapshot.Text),
+		DetectedAt:   at,
+	}
+	// Another result may have recorded the same change first
+	recorded, err := m.db.RecordContentChange(change, snapshot, maxContentChanges)
+	if err != nil || !recorded {
+		return nil, err
+	}
+
+	log.Info().
+		Int("site_id", siteID).
+		Int("change_id", change.ID).
+		Str("previous_hash", previous.Hash).
+		Str("hash", snapshot.Hash).
+		Msg("Site content changed")
+	return change, nil
+}
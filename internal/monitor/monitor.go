@@ -3,9 +3,7 @@ package monitor
 import (
 	"context"
 	"fmt"
-	"net"
 	"net/http"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
@@ -15,17 +13,19 @@ import (
 	"github.com/x86txt/sreootb/internal/config"
 	"github.com/x86txt/sreootb/internal/database"
 	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
 )
 
 // Monitor handles site monitoring
 type Monitor struct {
-	db     *database.DB
-	config *config.Config
-	sites  map[int]*monitoredSite
-	mu     sync.RWMutex
-	ctx    context.Context
-	cancel context.CancelFunc
-	wg     sync.WaitGroup
+	db        *database.DB
+	config    *config.Config
+	secretKey []byte // Decrypts secrets in site check configurations
+	sites     map[int]*monitoredSite
+	mu        sync.RWMutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
 }
 
 type monitoredSite struct {
@@ -35,15 +35,16 @@ type monitoredSite struct {
 }
 
 // New creates a new monitor instance
-func New(db *database.DB, cfg *config.Config) *Monitor {
+func New(db *database.DB, cfg *config.Config, secretKey []byte) *Monitor {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &Monitor{
-		db:     db,
-		config: cfg,
-		sites:  make(map[int]*monitoredSite),
-		ctx:    ctx,
-		cancel: cancel,
+		db:        db,
+		config:    cfg,
+		secretKey: secretKey,
+		sites:     make(map[int]*monitoredSite),
+		ctx:       ctx,
+		cancel:    cancel,
 	}
 }
 
@@ -57,8 +58,11 @@ func (m *Monitor) Start() error {
 		return fmt.Errorf("failed to load sites: %w", err)
 	}
 
-	// Start monitoring each site
+	// Start monitoring each site that is not paused
 	for _, site := range sites {
+		if site.Paused {
+			continue
+		}
 		if err := m.addSiteMonitoring(site); err != nil {
 			log.Error().Err(err).Int("site_id", site.ID).Str("url", site.URL).Msg("Failed to start monitoring site")
 		}
@@ -96,13 +100,13 @@ func (m *Monitor) RefreshMonitoring() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Build map of current site IDs
+	// Build map of current, unpaused site IDs
 	currentSites := make(map[int]bool)
 	for _, site := range sites {
-		currentSites[site.ID] = true
+		currentSites[site.ID] = !site.Paused
 	}
 
-	// Stop monitoring for sites that no longer exist
+	// Stop monitoring for sites that no longer exist or are paused
 	for siteID, monitored := range m.sites {
 		if !currentSites[siteID] {
 			monitored.ticker.Stop()
@@ -111,9 +115,9 @@ func (m *Monitor) RefreshMonitoring() error {
 		}
 	}
 
-	// Start monitoring for new sites
+	// Start monitoring for new or resumed sites
 	for _, site := range sites {
-		if _, exists := m.sites[site.ID]; !exists {
+		if _, exists := m.sites[site.ID]; !exists && !site.Paused {
 			if err := m.addSiteMonitoringLocked(site); err != nil {
 				log.Error().Err(err).Int("site_id", site.ID).Str("url", site.URL).Msg("Failed to start monitoring site")
 			}
@@ -123,17 +127,42 @@ func (m *Monitor) RefreshMonitoring() error {
 	return nil
 }
 
+// RestartSiteMonitoring replaces the ticker of a single site after it has been
+// edited, paused or resumed, so the change applies immediately. Paused sites
+// are only stopped.
+func (m *Monitor) RestartSiteMonitoring(site *models.Site) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if monitored, exists := m.sites[site.ID]; exists {
+		monitored.ticker.Stop()
+		close(monitored.stop)
+		delete(m.sites, site.ID)
+	}
+
+	if site.Paused {
+		log.Debug().Int("site_id", site.ID).Str("url", site.URL).Msg("Paused monitoring site")
+		return nil
+	}
+
+	return m.addSiteMonitoringLocked(site)
+}
+
 // CheckSitesByID manually checks specific sites or all sites if siteIDs is nil
 func (m *Monitor) CheckSitesByID(siteIDs []int) ([]models.SiteCheck, error) {
 	var sitesToCheck []*models.Site
 
 	if siteIDs == nil {
-		// Check all sites
+		// Check all sites that are not paused
 		sites, err := m.db.GetSites()
 		if err != nil {
 			return nil, fmt.Errorf("failed to get sites: %w", err)
 		}
-		sitesToCheck = sites
+		for _, site := range sites {
+			if !site.Paused {
+				sitesToCheck = append(sitesToCheck, site)
+			}
+		}
 	} else {
 		// Check specific sites
 		for _, siteID := range siteIDs {
@@ -149,6 +178,10 @@ func (m *Monitor) CheckSitesByID(siteIDs []int) ([]models.SiteCheck, error) {
 
 	var results []models.SiteCheck
 	for _, site := range sitesToCheck {
+		// Push sites report on their own and cannot be checked on demand
+		if strings.HasPrefix(site.URL, "push://") {
+			continue
+		}
 		check := m.checkSite(site)
 		if err := m.db.RecordCheck(&check); err != nil {
 			log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to record check result")
@@ -179,8 +212,15 @@ func (m *Monitor) addSiteMonitoringLocked(site *models.Site) error {
 		return fmt.Errorf("invalid scan interval for site %d: %w", site.ID, err)
 	}
 
+	// Push sites are watched for overdue reports instead of being checked
+	isPush := strings.HasPrefix(site.URL, "push://")
+	period := interval
+	if isPush {
+		period = pushWatchPeriod(interval)
+	}
+
 	// Create ticker and monitoring goroutine
-	ticker := time.NewTicker(interval)
+	ticker := time.NewTicker(period)
 	stop := make(chan struct{})
 
 	monitored := &monitoredSite{
@@ -196,6 +236,19 @@ func (m *Monitor) addSiteMonitoringLocked(site *models.Site) error {
 	go func() {
 		defer m.wg.Done()
 
+		if isPush {
+			for {
+				select {
+				case <-ticker.C:
+					m.checkPushSite(site, interval)
+				case <-stop:
+					return
+				case <-m.ctx.Done():
+					return
+				}
+			}
+		}
+
 		// Initial check
 		check := m.checkSite(site)
 		if err := m.db.RecordCheck(&check); err != nil {
@@ -232,11 +285,14 @@ func (m *Monitor) checkSite(site *models.Site) models.SiteCheck {
 	if strings.HasPrefix(site.URL, "ping://") {
 		// Ping check
 		host := site.URL[7:] // Remove 'ping://'
-		start := time.Now()
-		success, errorMsg := m.pingHost(host)
-		duration := time.Since(start)
-		responseTime := duration.Seconds()
-		check.ResponseTime = &responseTime
+		var pingConfig *models.PingCheckConfig
+		if site.Config != nil {
+			pingConfig = site.Config.Ping
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 5*time.Second))
+		success, responseTime, errorMsg := m.pingHost(ctx, host, pingConfig)
+		cancel()
+		check.ResponseTime = responseTime
 
 		if success {
 			check.Status = "up"
@@ -244,10 +300,191 @@ func (m *Monitor) checkSite(site *models.Site) models.SiteCheck {
 			check.Status = "down"
 			check.ErrorMessage = &errorMsg
 		}
+	} else if strings.HasPrefix(site.URL, "tcp://") {
+		// TCP check
+		var tcpConfig *models.TCPCheckConfig
+		var tlsConfig *models.TLSCheckConfig
+		if site.Config != nil {
+			tcpConfig, tlsConfig = site.Config.TCP, site.Config.TLS
+		}
+		address := strings.TrimSuffix(strings.TrimPrefix(site.URL, "tcp://"), "/")
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 10*time.Second))
+		start := time.Now()
+		result, err := utils.CheckTCP(ctx, address, tcpConfig, tlsConfig)
+		cancel()
+		responseTime := time.Since(start).Seconds()
+		check.ResponseTime = &responseTime
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case result.TLS != nil && result.TLS.Status == "down":
+			check.Status = "down"
+			errorMsg := "TLS: " + strings.Join(result.TLS.Problems, "; ")
+			check.ErrorMessage = &errorMsg
+		default:
+			check.Status = "up"
+		}
+	} else if strings.HasPrefix(site.URL, "dns://") {
+		// DNS check
+		var dnsConfig *models.DNSCheckConfig
+		if site.Config != nil {
+			dnsConfig = site.Config.DNS
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 10*time.Second))
+		result, err := utils.CheckDNS(ctx, site.URL, dnsConfig)
+		cancel()
+		if result != nil {
+			responseTime := result.QueryMs / 1000
+			check.ResponseTime = &responseTime
+		}
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case len(result.Problems) > 0:
+			check.Status = "down"
+			errorMsg := "DNS: " + strings.Join(result.Problems, "; ")
+			check.ErrorMessage = &errorMsg
+		default:
+			check.Status = "up"
+		}
+	} else if models.IsMailURL(site.URL) {
+		// SMTP or IMAP session
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 15*time.Second))
+		result, err := m.checkMail(ctx, site)
+		cancel()
+		if result != nil {
+			responseTime := result.TotalMs / 1000
+			check.ResponseTime = &responseTime
+		}
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case result.TLS != nil && result.TLS.Status == "down":
+			check.Status = "down"
+			errorMsg := "TLS: " + strings.Join(result.TLS.Problems, "; ")
+			check.ErrorMessage = &errorMsg
+		default:
+			check.Status = "up"
+		}
+	} else if strings.HasPrefix(site.URL, "ws://") || strings.HasPrefix(site.URL, "wss://") {
+		// WebSocket upgrade and optional message exchange
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 10*time.Second))
+		result, err := m.checkWebSocket(ctx, site)
+		cancel()
+		if result != nil {
+			responseTime := result.HandshakeMs / 1000
+			if result.RoundTripMs != nil {
+				responseTime += *result.RoundTripMs / 1000
+			}
+			check.ResponseTime = &responseTime
+			check.StatusCode = result.StatusCode
+		}
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case result.TLS != nil && result.TLS.Status == "down":
+			check.Status = "down"
+			errorMsg := "TLS: " + strings.Join(result.TLS.Problems, "; ")
+			check.ErrorMessage = &errorMsg
+		default:
+			check.Status = "up"
+		}
+	} else if strings.HasPrefix(site.URL, "postgres://") || strings.HasPrefix(site.URL, "postgresql://") || strings.HasPrefix(site.URL, "sqlite://") {
+		// Database probe query
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 10*time.Second))
+		result, err := m.checkDatabase(ctx, site)
+		cancel()
+		if result != nil {
+			responseTime := result.ConnectMs / 1000
+			if result.QueryMs != nil {
+				responseTime += *result.QueryMs / 1000
+			}
+			check.ResponseTime = &responseTime
+		}
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case len(result.Problems) > 0:
+			check.Status = "down"
+			errorMsg := "Database: " + strings.Join(result.Problems, "; ")
+			check.ErrorMessage = &errorMsg
+		default:
+			check.Status = "up"
+		}
+	} else if strings.HasPrefix(site.URL, "grpc://") {
+		// gRPC health check
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 10*time.Second))
+		result, err := m.checkGRPC(ctx, site)
+		cancel()
+		if result != nil {
+			responseTime := result.RPCMs / 1000
+			check.ResponseTime = &responseTime
+		}
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case result.TLS != nil && result.TLS.Status == "down":
+			check.Status = "down"
+			errorMsg := "TLS: " + strings.Join(result.TLS.Problems, "; ")
+			check.ErrorMessage = &errorMsg
+		case result.Status == "down":
+			check.Status = "down"
+			errorMsg := "Health status " + result.ServingStatus
+			check.ErrorMessage = &errorMsg
+		default:
+			check.Status = "up"
+		}
+	} else if strings.HasPrefix(site.URL, "transaction://") {
+		// Multi-step HTTP transaction
+		ctx, cancel := context.WithTimeout(context.Background(), m.checkTimeout(site, 60*time.Second))
+		result, err := m.runTransaction(ctx, site)
+		cancel()
+
+		switch {
+		case err != nil:
+			check.Status = "down"
+			errorMsg := err.Error()
+			check.ErrorMessage = &errorMsg
+		case result.Status == "down":
+			check.Status = "down"
+			check.ErrorMessage = &result.Message
+			// The status code of the failing step; a config without steps fails before any
+			if step := result.FailedStep; step != nil && *step <= len(result.Steps) {
+				check.StatusCode = result.Steps[*step-1].StatusCode
+			}
+		default:
+			check.Status = "up"
+		}
+		if result != nil {
+			responseTime := result.TotalMs / 1000
+			check.ResponseTime = &responseTime
+		}
 	} else {
 		// HTTP check
+		httpConfig, err := m.httpConfig(site)
 		start := time.Now()
-		resp, err := m.httpCheck(site.URL)
+		var resp *http.Response
+		if err == nil {
+			resp, err = m.httpCheck(site.URL, httpConfig)
+		}
 		duration := time.Since(start)
 
 		responseTime := duration.Seconds()
@@ -261,13 +498,16 @@ func (m *Monitor) checkSite(site *models.Site) models.SiteCheck {
 			statusCode := resp.StatusCode
 			check.StatusCode = &statusCode
 
-			if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+			if httpConfig.AcceptsStatus(resp.StatusCode) {
 				check.Status = "up"
 			} else {
 				check.Status = "down"
 				errorMsg := fmt.Sprintf("HTTP %d", resp.StatusCode)
 				check.ErrorMessage = &errorMsg
 			}
+			if check.Status == "up" && site.Config != nil && site.Config.ContentChange != nil {
+				m.checkContent(site, resp, check.CheckedAt)
+			}
 			resp.Body.Close()
 		}
 	}
@@ -283,60 +523,152 @@ func (m *Monitor) checkSite(site *models.Site) models.SiteCheck {
 	return check
 }
 
+// checkTimeout returns a site's configured check timeout, or def when it has none
+func (m *Monitor) checkTimeout(site *models.Site, def time.Duration) time.Duration {
+	if timeout, err := time.ParseDuration(site.Config.TaskTimeout("")); err == nil {
+		return timeout
+	}
+	return def
+}
+
+// httpConfig returns a site's HTTP check settings with secrets decrypted, or nil for defaults
+func (m *Monitor) httpConfig(site *models.Site) (*models.HTTPCheckConfig, error) {
+	if site.Config == nil || site.Config.HTTP == nil {
+		return nil, nil
+	}
+
+	config, err := site.Config.TransformSecrets(func(_, value string) (string, error) {
+		return utils.DecryptSecret(value, m.secretKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt check configuration: %w", err)
+	}
+	return config.HTTP, nil
+}
+
+// runTransaction runs a site's transaction steps with secrets decrypted
+func (m *Monitor) runTransaction(ctx context.Context, site *models.Site) (*utils.TransactionResult, error) {
+	config, err := site.Config.TransformSecrets(func(_, value string) (string, error) {
+		return utils.DecryptSecret(value, m.secretKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt check configuration: %w", err)
+	}
+
+	var transaction *models.TransactionCheckConfig
+	if config != nil {
+		transaction = config.Transaction
+	}
+	return utils.RunTransaction(ctx, transaction, "SREootb-Monitor/2.0"), nil
+}
+
+// checkMail runs a site's SMTP or IMAP check with its password decrypted
+func (m *Monitor) checkMail(ctx context.Context, site *models.Site) (*utils.MailCheckResult, error) {
+	config, err := site.Config.TransformSecrets(func(_, value string) (string, error) {
+		return utils.DecryptSecret(value, m.secretKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt check configuration: %w", err)
+	}
+
+	var mailConfig *models.MailCheckConfig
+	var tlsConfig *models.TLSCheckConfig
+	if config != nil {
+		mailConfig, tlsConfig = config.Mail, config.TLS
+	}
+	return utils.CheckMail(ctx, site.URL, mailConfig, tlsConfig)
+}
+
+// checkGRPC runs a site's gRPC health check with its client certificate decrypted
+func (m *Monitor) checkGRPC(ctx context.Context, site *models.Site) (*utils.GRPCCheckResult, error) {
+	config, err := site.Config.TransformSecrets(func(_, value string) (string, error) {
+		return utils.DecryptSecret(value, m.secretKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt check configuration: %w", err)
+	}
+
+	var grpcConfig *models.GRPCCheckConfig
+	var tlsConfig *models.TLSCheckConfig
+	if config != nil {
+		grpcConfig, tlsConfig = config.GRPC, config.TLS
+	}
+	return utils.CheckGRPC(ctx, site.URL, grpcConfig, tlsConfig)
+}
+
+// checkWebSocket runs a site's WebSocket check with its secret headers decrypted
+func (m *Monitor) checkWebSocket(ctx context.Context, site *models.Site) (*utils.WebSocketCheckResult, error) {
+	config, err := site.Config.TransformSecrets(func(_, value string) (string, error) {
+		return utils.DecryptSecret(value, m.secretKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt check configuration: %w", err)
+	}
+
+	var webSocketConfig *models.WebSocketCheckConfig
+	var tlsConfig *models.TLSCheckConfig
+	if config != nil {
+		webSocketConfig, tlsConfig = config.WebSocket, config.TLS
+	}
+	return utils.CheckWebSocket(ctx, site.URL, webSocketConfig, tlsConfig, "SREootb-Monitor/2.0")
+}
+
+// checkDatabase runs a site's database probe with its password decrypted
+func (m *Monitor) checkDatabase(ctx context.Context, site *models.Site) (*utils.DatabaseCheckResult, error) {
+	// Re-checked here in case the allowlist changed since the site was saved
+	if path, ok := strings.CutPrefix(site.URL, "sqlite://"); ok && !m.config.Server.SQLiteMonitorAllowed(path) {
+		return nil, fmt.Errorf("sqlite file is not listed in server.sqlite_monitors")
+	}
+
+	config, err := site.Config.TransformSecrets(func(_, value string) (string, error) {
+		return utils.DecryptSecret(value, m.secretKey)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt check configuration: %w", err)
+	}
+
+	var databaseConfig *models.DatabaseCheckConfig
+	if config != nil {
+		databaseConfig = config.Database
+	}
+	return utils.CheckDatabase(ctx, site.URL, databaseConfig)
+}
+
 // httpCheck performs an HTTP check
-func (m *Monitor) httpCheck(url string) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-		Transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout: 10 * time.Second,
-			}).DialContext,
-			TLSHandshakeTimeout: 10 * time.Second,
-		},
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
+func (m *Monitor) httpCheck(url string, httpConfig *models.HTTPCheckConfig) (*http.Response, error) {
+	timeout := 30 * time.Second
+	if httpConfig != nil && httpConfig.Timeout != "" {
+		if configured, err := time.ParseDuration(httpConfig.Timeout); err == nil {
+			timeout = configured
+		}
+	}
+
+	client := utils.NewHTTPCheckClient(httpConfig, nil, timeout)
+
+	req, err := utils.NewHTTPCheckRequest(context.Background(), httpConfig, url, "SREootb-Monitor/2.0")
 	if err != nil {
 		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "SREootb-Monitor/2.0")
-
 	return client.Do(req)
 }
 
-// pingHost performs a ping check with detailed error reporting
-func (m *Monitor) pingHost(host string) (bool, string) {
-	// Use system ping command for better reliability
-	cmd := exec.Command("ping", "-c", "1", "-W", "5", host)
-	output, err := cmd.CombinedOutput()
-
-	if err == nil {
-		return true, ""
-	}
-
-	// Categorize different types of ping errors based on output
-	outputStr := strings.ToLower(string(output))
-
-	if strings.Contains(outputStr, "unknown host") || strings.Contains(outputStr, "name or service not known") {
-		return false, "DNS resolution failed: unknown host"
-	} else if strings.Contains(outputStr, "network is unreachable") {
-		return false, "Network unreachable"
-	} else if strings.Contains(outputStr, "host is down") || strings.Contains(outputStr, "host unreachable") {
-		return false, "Host unreachable"
-	} else if strings.Contains(outputStr, "timeout") || strings.Contains(outputStr, "time out") {
-		return false, "Ping timeout"
-	} else if strings.Contains(outputStr, "permission denied") {
-		return false, "Permission denied (ping may require privileges)"
-	} else if strings.Contains(outputStr, "100% packet loss") {
-		return false, "100% packet loss"
-	} else {
-		// Generic error with some context from the output if available
-		if len(outputStr) > 0 && len(outputStr) < 200 {
-			return false, fmt.Sprintf("Ping failed: %s", strings.TrimSpace(outputStr))
-		}
-		return false, "Ping failed: unknown error"
+// pingHost pings a host, returning whether it is up, the average RTT in
+// seconds and why it is down. Degraded hosts count as up.
+func (m *Monitor) pingHost(ctx context.Context, host string, pingConfig *models.PingCheckConfig) (bool, *float64, string) {
+	result, err := utils.Ping(ctx, host, pingConfig)
+	if err != nil {
+		return false, nil, fmt.Sprintf("Ping failed: %v", err)
+	}
+
+	var responseTime *float64
+	if result.AvgMs != nil {
+		seconds := *result.AvgMs / 1000
+		responseTime = &seconds
 	}
+
+	status, problem := utils.PingStatus(result, pingConfig)
+	return status != "down", responseTime, problem
 }
 
 // parseScanInterval parses a scan interval string into a time.Duration
@@ -0,0 +1,86 @@
+package monitor
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// maxPushWatchPeriod bounds how late an overdue push site is noticed
+const maxPushWatchPeriod = 30 * time.Second
+
+// pushWatchPeriod is how often a push site with the given interval is checked for overdue reports
+func pushWatchPeriod(interval time.Duration) time.Duration {
+	if interval < maxPushWatchPeriod {
+		return interval
+	}
+	return maxPushWatchPeriod
+}
+
+// checkPushSite records a down check when a push site's report is overdue:
+// no report within the interval plus grace period, or a started job still
+// running after its maximum duration. Each overdue report is recorded once.
+func (m *Monitor) checkPushSite(site *models.Site, interval time.Duration) {
+	push, err := m.db.GetPushMonitor(site.ID)
+	if err != nil {
+		log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to get push monitor")
+		return
+	}
+	if push == nil || push.MissedAt != nil {
+		return
+	}
+
+	var pushConfig *models.PushCheckConfig
+	if site.Config != nil {
+		pushConfig = site.Config.Push
+	}
+	grace, maxDuration := pushConfig.Windows()
+
+	now := time.Now().UTC()
+	var deadline time.Time
+	var message string
+	if push.StartedAt != nil {
+		deadline = push.StartedAt.Add(maxDuration)
+		message = fmt.Sprintf("Job started at %s did not finish within %s", push.StartedAt.Format(time.RFC3339), maxDuration)
+	} else {
+		// Reports are expected from when the site was created or last resumed
+		since := push.CreatedAt
+		if push.LastPingAt != nil && push.LastPingAt.After(since) {
+			since = *push.LastPingAt
+		}
+		resumedAt, err := m.db.LastSiteResume(site.ID)
+		if err != nil {
+			log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to get last resume")
+			return
+		}
+		if resumedAt != nil && resumedAt.After(since) {
+			since = *resumedAt
+		}
+		deadline = since.Add(interval + grace)
+		message = fmt.Sprintf("No push received within %s", interval+grace)
+		if push.LastPingAt != nil {
+			message += fmt.Sprintf(" (last at %s)", push.LastPingAt.Format(time.RFC3339))
+		}
+	}
+	if now.Before(deadline) {
+		return
+	}
+
+	check := models.SiteCheck{
+		SiteID:       site.ID,
+		Status:       "down",
+		ErrorMessage: &message,
+		CheckedAt:    now,
+	}
+	recorded, err := m.db.RecordPushMissed(&check, now)
+	if err != nil {
+		log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to record missed push")
+		return
+	}
+	if recorded {
+		log.Warn().Int("site_id", site.ID).Str("url", site.URL).Msg(message)
+	}
+}
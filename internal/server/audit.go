@@ -0,0 +1,215 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// Audited actions
+const (
+	auditSiteCreate       = "site.create"
+	auditSiteUpdate       = "site.update"
+	auditSiteDelete       = "site.delete"
+	auditSitePause        = "site.pause"
+	auditSiteResume       = "site.resume"
+	auditSitePushToken    = "site.push_token"
+	auditSiteCheck        = "site.manual_check"
+	auditAgentCreate      = "agent.create"
+	auditAgentDelete      = "agent.delete"
+	auditAgentKeyUpgrade  = "agent.key_upgrade"
+	auditLogin            = "auth.login"
+	auditLoginFailed      = "auth.login_failed"
+	auditLoginLockout     = "auth.lockout"
+	auditLogout           = "auth.logout"
+	auditUserCreate       = "user.create"
+	auditUserRole         = "user.role_change"
+	auditUserDisable      = "user.disable"
+	auditUserEnable       = "user.enable"
+	auditUserProvision    = "user.provision"
+	auditPasswordChange   = "user.password_change"
+	auditPasswordReset    = "user.password_reset"
+	auditTwoFactorSetup   = "user.2fa_setup"
+	auditTwoFactorEnable  = "user.2fa_enable"
+	auditTwoFactorDisable = "user.2fa_disable"
+	auditTokenCreate      = "token.create"
+	auditTokenUpdate      = "token.update"
+	auditTokenRevoke      = "token.revoke"
+)
+
+// Maximum page size for /api/audit
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+)
+
+// auditActor identifies who performed an audited action
+type auditActor struct {
+	Type string
+	ID   string
+	Name string
+}
+
+// actorFromRequest derives the audit actor from the authenticated principal
+func actorFromRequest(r *http.Request) auditActor {
+	return actorFromPrincipal(principalFromContext(r.Context()))
+}
+
+// actorFromPrincipal identifies a principal in audit events
+func actorFromPrincipal(principal *authPrincipal) auditActor {
+	if principal == nil {
+		return auditActor{Type: models.ActorAnonymous}
+	}
+
+	switch principal.Kind {
+	case principalMasterKey:
+		return auditActor{Type: models.ActorMasterKey, Name: "admin API key"}
+	case principalToken:
+		return auditActor{
+			Type: models.ActorToken,
+			ID:   strconv.Itoa(principal.Token.ID),
+			Name: principal.Token.Name + " (" + principal.User.Email + ")",
+		}
+	default:
+		return auditActor{Type: models.ActorUser, ID: strconv.Itoa(principal.User.ID), Name: principal.User.Email}
+	}
+}
+
+// userActor identifies a user who is not yet authenticated by a principal, e.g. while logging in
+func userActor(user *models.User) auditActor {
+	return auditActor{Type: models.ActorUser, ID: strconv.Itoa(user.ID), Name: user.Email}
+}
+
+// audit records an action performed by the request's authenticated principal
+func (s *Server) audit(r *http.Request, action, targetType, targetID string, before, after interface{}) {
+	s.auditAs(r, actorFromRequest(r), action, targetType, targetID, before, after)
+}
+
+// auditAs records an action performed by an explicit actor. before and after
+// are marshaled to JSON; pass nil when the target did not exist before or after.
+// Failures are logged and never fail the request.
+func (s *Server) auditAs(r *http.Request, actor auditActor, action, targetType, targetID string, before, after interface{}) {
+	event := &models.AuditEvent{
+		ActorType:  actor.Type,
+		ActorID:    actor.ID,
+		ActorName:  actor.Name,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		SourceIP:   extractRemoteIP(r),
+		RequestID:  middleware.GetReqID(r.Context()),
+	}
+
+	var err error
+	if event.Before, err = marshalAuditState(before); err != nil {
+		log.Warn().Err(err).Str("action", action).Msg("Failed to encode audit state")
+	}
+	if event.After, err = marshalAuditState(after); err != nil {
+		log.Warn().Err(err).Str("action", action).Msg("Failed to encode audit state")
+	}
+
+	if err := s.db.RecordAuditEvent(event); err != nil {
+		log.Error().Err(err).Str("action", action).Msg("Failed to record audit event")
+	}
+}
+
+// marshalAuditState encodes a before/after snapshot, returning nil for a nil snapshot
+func marshalAuditState(state interface{}) (json.RawMessage, error) {
+	if state == nil {
+		return nil, nil
+	}
+	return json.Marshal(state)
+}
+
+// handleGetAuditEvents returns a filtered, paginated list of audit events
+func (s *Server) handleGetAuditEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := &models.AuditEventFilter{
+		ActorType:  query.Get("actor_type"),
+		ActorID:    query.Get("actor_id"),
+		Action:     query.Get("action"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Limit:      defaultAuditPageSize,
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > maxAuditPageSize {
+			http.Error(w, "limit must be between 1 and "+strconv.Itoa(maxAuditPageSize), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			http.Error(w, "offset must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+	for param, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if v := query.Get(param); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, param+" must be an RFC 3339 timestamp", http.StatusBadRequest)
+				return
+			}
+			*dest = &t
+		}
+	}
+
+	events, total, err := s.db.GetAuditEvents(filter)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get audit events")
+		http.Error(w, "Failed to get audit events", http.StatusInternalServerError)
+		return
+	}
+
+	if events == nil {
+		events = []*models.AuditEvent{}
+	}
+
+	s.writeJSON(w, models.AuditEventPage{
+		Events: events,
+		Total:  total,
+		Limit:  filter.Limit,
+		Offset: filter.Offset,
+	})
+}
+
+// startAuditCleanup periodically removes audit events older than the retention period
+func (s *Server) startAuditCleanup() {
+	retention := s.config.Server.Audit.Retention
+	if retention <= 0 {
+		log.Info().Msg("Audit log retention disabled; audit events are kept forever")
+		return
+	}
+
+	interval := s.config.Server.Audit.CleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := s.db.DeleteAuditEventsBefore(time.Now().Add(-retention))
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to clean up old audit events")
+			continue
+		}
+		if deleted > 0 {
+			log.Info().Int64("deleted", deleted).Msg("Removed audit events past retention")
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/config"
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// auditEvents returns the recorded events of one action, newest first
+func auditEvents(t *testing.T, s *Server, action string) []*models.AuditEvent {
+	t.Helper()
+
+	events, _, err := s.db.GetAuditEvents(&models.AuditEventFilter{Action: action, Limit: maxAuditPageSize})
+	if err != nil {
+		t.Fatalf("GetAuditEvents(%s): %v", action, err)
+	}
+	return events
+}
+
+func TestAccountActionsAreAudited(t *testing.T) {
+	s := newTestServer(t, func(cfg *config.Config) { cfg.Server.Auth.AllowRegistration = true })
+	createTestUser(t, s, "admin@example.com", models.RoleAdmin)
+
+	const password = "Str0ng-passw0rd!"
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/register", "", models.UserRegistrationRequest{
+		Email: "user@example.com", Password: password, FirstName: "New", LastName: "User",
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+	var registered models.UserLoginResponse
+	decodeJSON(t, rec, &registered)
+	user, token := registered.User, registered.SessionToken
+
+	_, backupCodes := enrollTwoFactor(t, s, token)
+	rec = s.serve(jsonRequest(t, http.MethodPost, "/api/auth/2fa/disable", token,
+		models.TwoFactorDisableRequest{Password: password, TOTPCode: backupCodes[0]}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("2fa disable: status %d: %s", rec.Code, rec.Body)
+	}
+
+	rec = s.serve(jsonRequest(t, http.MethodPost, "/api/auth/change-password", token,
+		models.PasswordChangeRequest{CurrentPassword: password, NewPassword: "N3w-passw0rd!"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("change password: status %d: %s", rec.Code, rec.Body)
+	}
+
+	if err := s.db.CreatePasswordResetToken(user.ID, utils.HashSessionToken("reset-token"), time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("CreatePasswordResetToken: %v", err)
+	}
+	rec = s.serve(jsonRequest(t, http.MethodPost, "/api/auth/reset-password", "",
+		models.ResetPasswordRequest{Token: "reset-token", NewPassword: "An0ther-passw0rd!"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("reset password: status %d: %s", rec.Code, rec.Body)
+	}
+
+	token = newSession(t, s, user)
+	if rec = s.serve(jsonRequest(t, http.MethodPost, "/api/auth/logout", token, nil)); rec.Code != http.StatusOK {
+		t.Fatalf("logout: status %d: %s", rec.Code, rec.Body)
+	}
+
+	userID := strconv.Itoa(user.ID)
+	for _, action := range []string{
+		auditUserCreate,
+		auditTwoFactorSetup,
+		auditTwoFactorEnable,
+		auditTwoFactorDisable,
+		auditPasswordChange,
+		auditPasswordReset,
+		auditLogout,
+	} {
+		events := auditEvents(t, s, action)
+		if len(events) != 1 {
+			t.Errorf("%s: recorded %d events, want 1", action, len(events))
+			continue
+		}
+		event := events[0]
+		if event.ActorType != models.ActorUser || event.ActorID != userID || event.ActorName != user.Email {
+			t.Errorf("%s: actor = %s %s %q, want user %s %q", action, event.ActorType, event.ActorID, event.ActorName, userID, user.Email)
+		}
+		if event.TargetType != "user" || event.TargetID != userID {
+			t.Errorf("%s: target = %s %s, want user %s", action, event.TargetType, event.TargetID, userID)
+		}
+	}
+
+	// Enabling and disabling 2FA record the flag before and after
+	for action, want := range map[string]bool{auditTwoFactorEnable: true, auditTwoFactorDisable: false} {
+		event := auditEvents(t, s, action)[0]
+		var before, after models.User
+		if err := json.Unmarshal(event.Before, &before); err != nil {
+			t.Fatalf("%s: decode before: %v", action, err)
+		}
+		if err := json.Unmarshal(event.After, &after); err != nil {
+			t.Fatalf("%s: decode after: %v", action, err)
+		}
+		if before.TwoFactorEnabled == want || after.TwoFactorEnabled != want {
+			t.Errorf("%s: two_factor_enabled before=%v after=%v", action, before.TwoFactorEnabled, after.TwoFactorEnabled)
+		}
+	}
+}
+
+func TestAdminCreatedUserIsAuditedAsAdmin(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := createTestUser(t, s, "admin@example.com", models.RoleAdmin)
+
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/register", newSession(t, s, admin), models.UserRegistrationRequest{
+		Email: "user@example.com", Password: "Str0ng-passw0rd!", FirstName: "New", LastName: "User",
+	}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("register: status %d: %s", rec.Code, rec.Body)
+	}
+
+	events := auditEvents(t, s, auditUserCreate)
+	if len(events) != 1 {
+		t.Fatalf("recorded %d user.create events, want 1", len(events))
+	}
+	if events[0].ActorType != models.ActorUser || events[0].ActorID != strconv.Itoa(admin.ID) {
+		t.Errorf("actor = %s %s, want admin %d", events[0].ActorType, events[0].ActorID, admin.ID)
+	}
+}
+
+func TestRotatePushTokenAuditsPrefixes(t *testing.T) {
+	s := newTestServer(t, nil)
+	admin := createTestUser(t, s, "admin@example.com", models.RoleAdmin)
+
+	site, err := s.db.AddSite(&models.SiteCreateRequest{URL: "push://backup", Name: "backup", ScanInterval: "60s"})
+	if err != nil {
+		t.Fatalf("add site: %v", err)
+	}
+	if _, err := s.issuePushToken(httptest.NewRequest(http.MethodPost, "/api/sites", nil), site.ID); err != nil {
+		t.Fatalf("issue push token: %v", err)
+	}
+	original, err := s.db.GetPushMonitor(site.ID)
+	if err != nil {
+		t.Fatalf("GetPushMonitor: %v", err)
+	}
+
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/sites/"+strconv.Itoa(site.ID)+"/push-token", newSession(t, s, admin), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rotate push token: status %d: %s", rec.Code, rec.Body)
+	}
+	var rotated struct {
+		PushURL string `json:"push_url"`
+	}
+	decodeJSON(t, rec, &rotated)
+
+	events := auditEvents(t, s, auditSitePushToken)
+	if len(events) != 1 {
+		t.Fatalf("recorded %d push token events, want 1", len(events))
+	}
+	var before, after models.PushMonitor
+	if err := json.Unmarshal(events[0].Before, &before); err != nil {
+		t.Fatalf("decode before: %v", err)
+	}
+	if err := json.Unmarshal(events[0].After, &after); err != nil {
+		t.Fatalf("decode after: %v", err)
+	}
+	if before.TokenPrefix != original.TokenPrefix {
+		t.Errorf("before prefix = %q, want %q", before.TokenPrefix, original.TokenPrefix)
+	}
+	if after.TokenPrefix == original.TokenPrefix || !strings.Contains(rotated.PushURL, after.TokenPrefix) {
+		t.Errorf("after prefix = %q, want the prefix of %s", after.TokenPrefix, rotated.PushURL)
+	}
+	rawToken := rotated.PushURL[strings.LastIndex(rotated.PushURL, "/")+1:]
+	if strings.Contains(string(events[0].After), strings.TrimPrefix(rawToken, after.TokenPrefix)) {
+		t.Error("audit event contains the secret part of the push token")
+	}
+}
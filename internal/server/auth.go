@@ -0,0 +1,506 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// Principal kinds recognised by the web API
+const (
+	principalMasterKey = "master_key"
+	principalSession   = "session"
+	principalToken     = "api_token"
+)
+
+// authPrincipal describes who is making an authenticated web API request
+type authPrincipal struct {
+	Kind    string              // principalMasterKey, principalSession or principalToken
+	User    *models.User        // Set for session and token principals
+	Session *models.UserSession // Set for session-based principals
+	Token   *models.APIToken    // Set for personal access token principals
+}
+
+type contextKey string
+
+const principalContextKey contextKey = "sreootb.principal"
+
+// principalFromContext returns the authenticated principal for a request, if any
+func principalFromContext(ctx context.Context) *authPrincipal {
+	p, _ := ctx.Value(principalContextKey).(*authPrincipal)
+	return p
+}
+
+// isAdmin reports whether the principal has full administrative access
+func (p *authPrincipal) isAdmin() bool {
+	return p.can(permUsersAdmin)
+}
+
+// bearerToken extracts the token from an "Authorization: Bearer <token>" header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+// webAuthMiddleware requires a valid admin API key, session token or personal access token on web API routes.
+// Rejected credentials count toward the same per-IP lockout as failed logins.
+func (s *Server) webAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented := r.Header.Get("X-API-Key") != "" || bearerToken(r) != ""
+		if presented && s.credentialLockedOut(w, r) {
+			return
+		}
+
+		principal, err := s.authenticateRequest(r)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to authenticate request")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if principal == nil {
+			if presented {
+				s.recordLoginFailure(r, "")
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sreootb"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), principalContextKey, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateRequest resolves the credentials on a request into a principal.
+// It returns nil without an error when the credentials are missing or invalid.
+func (s *Server) authenticateRequest(r *http.Request) (*authPrincipal, error) {
+	if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+		if s.db.ValidateMasterAPIKey(apiKey, s.config.Server.AdminAPIKey) {
+			return &authPrincipal{Kind: principalMasterKey}, nil
+		}
+		if strings.HasPrefix(apiKey, models.APITokenPrefix) {
+			return s.authenticateAPIToken(r, apiKey)
+		}
+		return nil, nil
+	}
+
+	token := bearerToken(r)
+	if token == "" {
+		return nil, nil
+	}
+
+	if strings.HasPrefix(token, models.APITokenPrefix) {
+		return s.authenticateAPIToken(r, token)
+	}
+
+	// The admin key may also be presented as a bearer token
+	if s.db.ValidateMasterAPIKey(token, s.config.Server.AdminAPIKey) {
+		return &authPrincipal{Kind: principalMasterKey}, nil
+	}
+
+	session, err := s.db.GetUserSession(utils.HashSessionToken(token))
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		return nil, nil
+	}
+
+	user, err := s.db.GetUserByID(session.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, nil
+	}
+
+	return &authPrincipal{Kind: principalSession, User: user, Session: session}, nil
+}
+
+// normalizeEmail canonicalises an email address for storage and lookup
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+var (
+	dummyPasswordHash     string
+	dummyPasswordHashOnce sync.Once
+)
+
+// equalizeLoginTiming burns a bcrypt comparison for unknown accounts so that
+// response times do not reveal which email addresses are registered
+func equalizeLoginTiming(password string) {
+	dummyPasswordHashOnce.Do(func() {
+		dummyPasswordHash, _ = utils.HashPassword("sreootb-timing-equalizer")
+	})
+	utils.VerifyPassword(password, dummyPasswordHash)
+}
+
+// createUserSession issues a new session token for a user and stores its hash
+func (s *Server) createUserSession(r *http.Request, userID int, rememberMe bool) (string, error) {
+	token, err := utils.GenerateSessionToken()
+	if err != nil {
+		return "", err
+	}
+	sessionID, err := utils.GenerateSessionID()
+	if err != nil {
+		return "", err
+	}
+
+	duration := s.config.Server.Auth.SessionDuration
+	if rememberMe {
+		duration = s.config.Server.Auth.RememberMeDuration
+	}
+	if duration <= 0 {
+		duration = 24 * time.Hour
+	}
+
+	var userAgent *string
+	if ua := r.Header.Get("User-Agent"); ua != "" {
+		userAgent = &ua
+	}
+	remoteIP := extractRemoteIP(r)
+
+	if err := s.db.CreateUserSession(userID, sessionID, utils.HashSessionToken(token),
+		time.Now().Add(duration), userAgent, &remoteIP); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// handleAuthLogin authenticates a user with email and password, or with the master admin key
+func (s *Server) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		models.UserLoginRequest
+		APIKey       string `json:"api_key"`
+		LegacyAPIKey string `json:"apiKey"` // Sent by older web GUI builds
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Master admin key login (emergency access)
+	apiKey := req.APIKey
+	if apiKey == "" {
+		apiKey = req.LegacyAPIKey
+	}
+	if apiKey != "" {
+		// Failures count per IP only: a lockout of the key itself would let
+		// anyone lock the administrator out
+		if !s.allowLoginAttempt(w, r, "") {
+			return
+		}
+		if !s.db.ValidateMasterAPIKey(apiKey, s.config.Server.AdminAPIKey) {
+			s.recordLoginFailure(r, "")
+			s.auditAs(r, auditActor{Type: models.ActorAnonymous}, auditLoginFailed, "admin_api_key", "", nil,
+				map[string]string{"reason": "invalid API key"})
+			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			return
+		}
+
+		s.auditAs(r, auditActor{Type: models.ActorMasterKey, Name: "admin API key"}, auditLogin, "admin_api_key", "", nil,
+			map[string]string{"method": "api_key"})
+
+		s.writeJSON(w, map[string]interface{}{
+			"success": true,
+			"message": "Authentication successful",
+		})
+		return
+	}
+
+	user := s.checkPassword(w, r, req.Email, req.Password)
+	if user == nil {
+		return
+	}
+
+	// Second factor
+	if user.TwoFactorEnabled {
+		if req.TOTPCode == nil || strings.TrimSpace(*req.TOTPCode) == "" {
+			s.writeJSON(w, models.UserLoginResponse{
+				Success:      false,
+				RequiresTOTP: true,
+				Message:      "Two-factor authentication code required",
+			})
+			return
+		}
+
+		valid, err := s.verifyTOTPCode(user, *req.TOTPCode)
+		if err != nil {
+			log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to verify TOTP code")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !valid {
+			s.recordLoginFailure(r, user.Email)
+			s.auditAs(r, userActor(user), auditLoginFailed, "user", strconv.Itoa(user.ID), nil,
+				map[string]string{"reason": "invalid two-factor code"})
+			http.Error(w, "Invalid two-factor authentication code", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	method := "password"
+	if user.TwoFactorEnabled {
+		method = "password+totp"
+	}
+	s.completeLogin(w, r, user, req.RememberMe, method, "Login successful")
+}
+
+// checkPassword looks up a user and verifies their password. On failure it
+// writes the error response and returns nil.
+func (s *Server) checkPassword(w http.ResponseWriter, r *http.Request, email, password string) *models.User {
+	if email == "" || password == "" {
+		http.Error(w, "Email and password are required", http.StatusBadRequest)
+		return nil
+	}
+
+	if !s.allowLoginAttempt(w, r, email) {
+		return nil
+	}
+
+	user, err := s.db.GetUserByEmail(normalizeEmail(email))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to look up user")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil
+	}
+
+	if user == nil {
+		equalizeLoginTiming(password)
+		s.recordLoginFailure(r, email)
+		s.auditAs(r, auditActor{Type: models.ActorAnonymous}, auditLoginFailed, "user", normalizeEmail(email), nil,
+			map[string]string{"reason": "unknown email"})
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return nil
+	}
+	if !utils.VerifyPassword(password, user.PasswordHash) {
+		s.recordLoginFailure(r, email)
+		s.auditAs(r, userActor(user), auditLoginFailed, "user", strconv.Itoa(user.ID), nil,
+			map[string]string{"reason": "invalid password"})
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return nil
+	}
+	if user.Disabled {
+		s.auditAs(r, userActor(user), auditLoginFailed, "user", strconv.Itoa(user.ID), nil,
+			map[string]string{"reason": "account disabled"})
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return nil
+	}
+
+	return user
+}
+
+// completeLogin issues a session for a fully authenticated user and writes the login response
+func (s *Server) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, rememberMe bool, method, message string) {
+	token, err := s.createUserSession(r, user.ID, rememberMe)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to create user session")
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.UpdateLastLogin(user.ID); err != nil {
+		log.Warn().Err(err).Int("user_id", user.ID).Msg("Failed to update last login")
+	}
+
+	log.Info().Int("user_id", user.ID).Str("email", user.Email).Msg("User logged in")
+	s.recordLoginSuccess(user.Email)
+	s.auditAs(r, userActor(user), auditLogin, "user", strconv.Itoa(user.ID), nil,
+		map[string]string{"method": method})
+
+	s.writeJSON(w, models.UserLoginResponse{
+		Success:      true,
+		SessionToken: token,
+		User:         user,
+		Message:      message,
+	})
+}
+
+// handleAuthRegister creates a new user account and logs it in.
+// The first account becomes an admin; later sign-ups require allow_registration
+// or an authenticated admin.
+func (s *Server) handleAuthRegister(w http.ResponseWriter, r *http.Request) {
+	var req models.UserRegistrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = normalizeEmail(req.Email)
+	req.FirstName = strings.TrimSpace(req.FirstName)
+	req.LastName = strings.TrimSpace(req.LastName)
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userCount, err := s.db.CountUsers()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count users")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	principal, err := s.authenticateRequest(r)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to authenticate request")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	createdByAdmin := principal != nil && principal.isAdmin()
+
+	// The first account becomes admin, so creating it takes the setup token
+	// or the admin API key rather than whoever reaches the server first
+	firstUser := userCount == 0
+	if firstUser {
+		setupToken := s.config.Server.Auth.SetupToken
+		validToken := req.SetupToken != "" && setupToken != "" &&
+			subtle.ConstantTimeCompare([]byte(req.SetupToken), []byte(setupToken)) == 1
+		if !validToken && (principal == nil || principal.Kind != principalMasterKey) {
+			http.Error(w, "A valid setup token is required to create the first account", http.StatusForbidden)
+			return
+		}
+	} else if !s.config.Server.Auth.AllowRegistration && !createdByAdmin {
+		http.Error(w, "Registration is disabled", http.StatusForbidden)
+		return
+	}
+
+	existing, err := s.db.GetUserByEmail(req.Email)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to look up user")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if existing != nil {
+		http.Error(w, "An account with this email already exists", http.StatusConflict)
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash password")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var user *models.User
+	if firstUser {
+		user, err = s.db.CreateFirstUser(&req, passwordHash)
+	} else {
+		user, err = s.db.CreateUser(&req, passwordHash, models.RoleViewer)
+	}
+	if err != nil {
+		log.Error().Err(err).Str("email", req.Email).Msg("Failed to create user")
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return
+	}
+	if user == nil {
+		// Another registration created the first account in the meantime
+		http.Error(w, "The first account already exists; sign in or ask an admin to create yours", http.StatusConflict)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Str("email", user.Email).Str("role", user.Role).Msg("User registered")
+
+	// Self-service sign-ups are attributed to the new account itself
+	actor := userActor(user)
+	if principal != nil {
+		actor = actorFromPrincipal(principal)
+	}
+	s.auditAs(r, actor, auditUserCreate, "user", strconv.Itoa(user.ID), nil, user)
+
+	// Accounts created by an admin on someone else's behalf are not logged in
+	if createdByAdmin {
+		s.writeJSON(w, models.UserLoginResponse{
+			Success: true,
+			User:    user,
+			Message: "User created",
+		})
+		return
+	}
+
+	token, err := s.createUserSession(r, user.ID, false)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to create user session")
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	s.writeJSON(w, models.UserLoginResponse{
+		Success:      true,
+		SessionToken: token,
+		User:         user,
+		Message:      "Registration successful",
+	})
+}
+
+// handleAuthLogout ends the caller's session
+func (s *Server) handleAuthLogout(w http.ResponseWriter, r *http.Request) {
+	principal := principalFromContext(r.Context())
+	if principal != nil && principal.Session != nil {
+		if err := s.db.DeleteUserSession(principal.Session.ID); err != nil {
+			log.Error().Err(err).Msg("Failed to delete user session")
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			return
+		}
+		s.audit(r, auditLogout, "user", strconv.Itoa(principal.User.ID), nil, nil)
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"success": true,
+		"message": "Logged out",
+	})
+}
+
+// handleAuthMe returns the identity behind the current credentials
+func (s *Server) handleAuthMe(w http.ResponseWriter, r *http.Request) {
+	principal := principalFromContext(r.Context())
+
+	response := map[string]interface{}{
+		"auth_type":   principal.Kind,
+		"user":        principal.User,
+		"permissions": principal.permissions(),
+	}
+	if principal.Session != nil {
+		response["session_expires_at"] = principal.Session.ExpiresAt
+	}
+	if principal.Token != nil {
+		response["token"] = principal.Token
+	}
+
+	s.writeJSON(w, response)
+}
+
+// startSessionCleanup periodically removes expired user sessions
+func (s *Server) startSessionCleanup() {
+	interval := s.config.Server.Auth.SessionCleanupInterval
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := s.db.CleanupExpiredSessions(); err != nil {
+			log.Error().Err(err).Msg("Failed to clean up expired sessions")
+		}
+	}
+}
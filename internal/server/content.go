@@ -0,0 +1,127 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// recordResultContent passes the content snapshot an agent attached to an
+// HTTP result to change detection. The full text is not kept with the
+// result; its metadata keeps the hash and whether it was a change.
+func (s *Server) recordResultContent(result *models.MonitorResultRequest) {
+	raw, ok := result.Metadata["content"]
+	if !ok {
+		return
+	}
+
+	var snapshot models.ContentSnapshot
+	encoded, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(encoded, &snapshot)
+	}
+	if err != nil || !snapshot.Valid() {
+		log.Warn().Int("task_id", result.TaskID).Msg("Ignoring invalid content snapshot")
+		delete(result.Metadata, "content")
+		return
+	}
+
+	summary := map[string]interface{}{
+		"hash":    snapshot.Hash,
+		"changed": false,
+	}
+	if snapshot.Truncated {
+		summary["truncated"] = true
+	}
+	result.Metadata["content"] = summary
+
+	siteID, err := s.db.GetTaskSiteID(result.TaskID)
+	if err != nil || siteID == 0 {
+		log.Warn().Err(err).Int("task_id", result.TaskID).Msg("No site for content snapshot")
+		return
+	}
+	change, err := s.monitor.RecordContentSnapshot(siteID, &snapshot, result.CheckedAt)
+	if err != nil {
+		log.Error().Err(err).Int("site_id", siteID).Msg("Failed to record content snapshot")
+		return
+	}
+	if change != nil {
+		summary["changed"] = true
+		summary["change_id"] = change.ID
+	}
+}
+
+// resetContentBaseline forgets the last known content of an edited site whose
+// URL or ignore rules changed, so the next check records a new baseline
+// rather than a change
+func (s *Server) resetContentBaseline(before, after *models.Site) {
+	if before.URL == after.URL && reflect.DeepEqual(siteContentChange(before), siteContentChange(after)) {
+		return
+	}
+	if err := s.db.DeleteContentSnapshot(after.ID); err != nil {
+		log.Error().Err(err).Int("site_id", after.ID).Msg("Failed to reset content baseline")
+	}
+}
+
+// siteContentChange returns a site's content change settings, or nil when disabled
+func siteContentChange(site *models.Site) *models.ContentChangeConfig {
+	if site.Config == nil {
+		return nil
+	}
+	return site.Config.ContentChange
+}
+
+// handleGetContentChanges lists a site's recorded content changes with their
+// diffs, newest first, along with the hash of its current content
+func (s *Server) handleGetContentChanges(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	site, err := s.db.GetSite(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	snapshot, err := s.db.GetContentSnapshot(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	changes, err := s.db.GetContentChanges(id, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var hash *string
+	if snapshot != nil {
+		hash = &snapshot.Hash
+	}
+	s.writeJSON(w, map[string]interface{}{
+		"site_id": id,
+		"enabled": siteContentChange(site) != nil,
+		"hash":    hash,
+		"changes": changes,
+	})
+}
@@ -0,0 +1,547 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+const (
+	oidcStateCookie  = "sreootb_oidc_state"
+	oidcStateTTL     = 10 * time.Minute // Time allowed to complete the login at the provider
+	oidcChallengeTTL = 5 * time.Minute  // Time allowed to enter the second factor afterwards
+)
+
+// oidcLoginState is kept in an encrypted cookie between the login redirect and
+// the callback, so any server in a cluster can complete the flow
+type oidcLoginState struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Redirect     string `json:"redirect"`
+	ExpiresAt    int64  `json:"expires_at"`
+}
+
+// oidcTwoFactorChallenge is handed to the web GUI, encrypted, when a user
+// signed in by the identity provider still has to enter their local second
+// factor. It names the user so the code can be checked without a session.
+type oidcTwoFactorChallenge struct {
+	UserID    int   `json:"user_id"`
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// oidcRedirectURL returns the callback URL registered with the identity
+// provider. New refuses to enable single sign-on when it would be empty.
+func (s *Server) oidcRedirectURL() string {
+	if s.config.Server.Auth.OIDC.RedirectURL != "" {
+		return s.config.Server.Auth.OIDC.RedirectURL
+	}
+	if base := s.publicBaseURL(); base != "" {
+		return base + "/api/auth/oidc/callback"
+	}
+	return ""
+}
+
+// safeRedirectPath only allows local absolute paths, preventing open redirects
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/"
+	}
+	return path
+}
+
+// handleOIDCInfo tells the web GUI whether single sign-on is available
+func (s *Server) handleOIDCInfo(w http.ResponseWriter, r *http.Request) {
+	response := map[string]interface{}{
+		"enabled": s.oidc != nil,
+	}
+	if s.oidc != nil {
+		response["name"] = s.config.Server.Auth.OIDC.Name
+		response["login_url"] = "/api/auth/oidc/login"
+	}
+
+	s.writeJSON(w, response)
+}
+
+// handleOIDCLogin starts an authorization code flow with PKCE by redirecting to the identity provider
+func (s *Server) handleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "Single sign-on is not enabled", http.StatusNotFound)
+		return
+	}
+
+	state, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate OIDC state")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate OIDC nonce")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	verifier, challenge, err := utils.GeneratePKCE()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate PKCE verifier")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := s.oidc.AuthCodeURL(r.Context(), s.oidcRedirectURL(), state, nonce, challenge)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to build OIDC authorization URL")
+		http.Error(w, "Identity provider is unavailable", http.StatusBadGateway)
+		return
+	}
+
+	payload, err := json.Marshal(oidcLoginState{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		Redirect:     safeRedirectPath(r.URL.Query().Get("redirect")),
+		ExpiresAt:    time.Now().Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encode OIDC state")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	sealed, err := utils.EncryptSecret(string(payload), s.secretKey)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encrypt OIDC state")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    url.QueryEscape(sealed),
+		Path:     "/api/auth/oidc",
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   requestIsHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// handleOIDCCallback completes the authorization code flow, provisions or
+// updates the user, and hands a session token to the web GUI
+func (s *Server) handleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		http.Error(w, "Single sign-on is not enabled", http.StatusNotFound)
+		return
+	}
+
+	query := r.URL.Query()
+	if idpErr := query.Get("error"); idpErr != "" {
+		log.Warn().Str("error", idpErr).Str("description", query.Get("error_description")).Msg("Identity provider rejected login")
+		http.Error(w, "Single sign-on failed: "+idpErr, http.StatusUnauthorized)
+		return
+	}
+
+	loginState := s.readOIDCState(r)
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/auth/oidc", MaxAge: -1, HttpOnly: true})
+	if loginState == nil || subtle.ConstantTimeCompare([]byte(loginState.State), []byte(query.Get("state"))) != 1 {
+		http.Error(w, "Single sign-on session is invalid or has expired; please try again", http.StatusBadRequest)
+		return
+	}
+
+	code := query.Get("code")
+	if code == "" {
+		http.Error(w, "Missing authorization code", http.StatusBadRequest)
+		return
+	}
+
+	tokens, err := s.oidc.Exchange(r.Context(), code, s.oidcRedirectURL(), loginState.CodeVerifier)
+	if err != nil {
+		log.Error().Err(err).Msg("OIDC code exchange failed")
+		http.Error(w, "Single sign-on failed", http.StatusBadGateway)
+		return
+	}
+
+	claims, err := s.oidc.VerifyIDToken(r.Context(), tokens.IDToken, loginState.Nonce)
+	if err != nil {
+		log.Warn().Err(err).Msg("Rejected OIDC ID token")
+		http.Error(w, "Single sign-on failed: invalid ID token", http.StatusUnauthorized)
+		return
+	}
+
+	cfg := s.config.Server.Auth.OIDC
+
+	// Some providers only expose email or groups through the userinfo endpoint
+	_, hasGroups := claims[cfg.GroupsClaim]
+	if _, hasEmail := claims["email"]; (!hasGroups || !hasEmail) && tokens.AccessToken != "" {
+		if info, err := s.oidc.UserInfo(r.Context(), tokens.AccessToken); err != nil {
+			log.Debug().Err(err).Msg("OIDC userinfo unavailable")
+		} else if sub, _ := info["sub"].(string); sub == claims["sub"] {
+			for k, v := range info {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	user, ok := s.oidcUser(w, r, claims)
+	if !ok {
+		return
+	}
+
+	// The identity provider's own MFA policy is unknown, so accounts with local
+	// 2FA enabled still need their second factor before they get a session
+	if user.TwoFactorEnabled {
+		challenge, err := s.sealOIDCChallenge(user)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to encrypt OIDC two-factor challenge")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, loginState.Redirect+"#sso_challenge="+url.QueryEscape(challenge), http.StatusFound)
+		return
+	}
+
+	token, err := s.createUserSession(r, user.ID, false)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to create user session")
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.UpdateLastLogin(user.ID); err != nil {
+		log.Warn().Err(err).Int("user_id", user.ID).Msg("Failed to update last login")
+	}
+
+	log.Info().Int("user_id", user.ID).Str("email", user.Email).Msg("User logged in via single sign-on")
+	s.recordLoginSuccess(user.Email)
+	s.auditAs(r, userActor(user), auditLogin, "user", strconv.Itoa(user.ID), nil,
+		map[string]string{"method": "oidc"})
+
+	// The token travels in the URL fragment, which browsers never send to servers
+	http.Redirect(w, r, loginState.Redirect+"#session_token="+url.QueryEscape(token), http.StatusFound)
+}
+
+// sealOIDCChallenge encrypts a two-factor challenge for a user signed in by the identity provider
+func (s *Server) sealOIDCChallenge(user *models.User) (string, error) {
+	payload, err := json.Marshal(oidcTwoFactorChallenge{
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(oidcChallengeTTL).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return utils.EncryptSecret(string(payload), s.secretKey)
+}
+
+// openOIDCChallenge decrypts and validates a two-factor challenge, returning
+// nil if it is invalid or has expired
+func (s *Server) openOIDCChallenge(sealed string) *oidcTwoFactorChallenge {
+	payload, err := utils.DecryptSecret(sealed, s.secretKey)
+	if err != nil {
+		return nil
+	}
+
+	var challenge oidcTwoFactorChallenge
+	if err := json.Unmarshal([]byte(payload), &challenge); err != nil {
+		return nil
+	}
+	if challenge.UserID == 0 || time.Now().Unix() > challenge.ExpiresAt {
+		return nil
+	}
+
+	return &challenge
+}
+
+// handleOIDCTwoFactor completes a single sign-on login for an account with
+// 2FA enabled, taking a TOTP code or a backup code
+func (s *Server) handleOIDCTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Challenge string `json:"challenge"`
+		TOTPCode  string `json:"totp_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	challenge := s.openOIDCChallenge(req.Challenge)
+	if challenge == nil {
+		http.Error(w, "Single sign-on session is invalid or has expired; please try again", http.StatusBadRequest)
+		return
+	}
+
+	user, err := s.db.GetUserByID(challenge.UserID)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", challenge.UserID).Msg("Failed to look up user")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if user == nil || user.Disabled {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+	if !user.TwoFactorEnabled {
+		// 2FA was turned off since the challenge was issued; it must be started again
+		http.Error(w, "Single sign-on session is invalid or has expired; please try again", http.StatusBadRequest)
+		return
+	}
+
+	if !s.allowLoginAttempt(w, r, user.Email) {
+		return
+	}
+
+	valid, err := s.verifyTOTPCode(user, req.TOTPCode)
+	if err == nil && !valid {
+		valid, err = s.redeemBackupCode(user, req.TOTPCode)
+	}
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to verify second factor")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		s.recordLoginFailure(r, user.Email)
+		s.auditAs(r, userActor(user), auditLoginFailed, "user", strconv.Itoa(user.ID), nil,
+			map[string]string{"reason": "invalid two-factor code", "method": "oidc"})
+		http.Error(w, "Invalid two-factor authentication code", http.StatusUnauthorized)
+		return
+	}
+
+	s.completeLogin(w, r, user, false, "oidc+totp", "Login successful")
+}
+
+// readOIDCState decrypts and validates the login state cookie, returning nil if it is missing or invalid
+func (s *Server) readOIDCState(r *http.Request) *oidcLoginState {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return nil
+	}
+	sealed, err := url.QueryUnescape(cookie.Value)
+	if err != nil {
+		return nil
+	}
+	payload, err := utils.DecryptSecret(sealed, s.secretKey)
+	if err != nil {
+		return nil
+	}
+
+	var state oidcLoginState
+	if err := json.Unmarshal([]byte(payload), &state); err != nil {
+		return nil
+	}
+	if time.Now().Unix() > state.ExpiresAt {
+		return nil
+	}
+
+	return &state
+}
+
+// oidcUser finds, links or provisions the account for verified ID token claims
+// and applies group role mappings. On failure it writes the error response.
+func (s *Server) oidcUser(w http.ResponseWriter, r *http.Request, claims map[string]interface{}) (*models.User, bool) {
+	cfg := s.config.Server.Auth.OIDC
+
+	sub, _ := claims["sub"].(string)
+	iss, _ := claims["iss"].(string)
+	email := normalizeEmail(claimString(claims, "email"))
+	if sub == "" || email == "" {
+		http.Error(w, "Identity provider did not supply a subject and email address", http.StatusForbidden)
+		return nil, false
+	}
+	subject := iss + "#" + sub
+
+	role, allowed := s.oidcRole(claimStrings(claims[cfg.GroupsClaim]))
+	if !allowed {
+		log.Warn().Str("email", email).Msg("SSO login denied: no group maps to a role")
+		s.auditAs(r, auditActor{Type: models.ActorAnonymous}, auditLoginFailed, "user", email, nil,
+			map[string]string{"reason": "no matching OIDC group", "method": "oidc"})
+		http.Error(w, "Your account is not permitted to access SREootb", http.StatusForbidden)
+		return nil, false
+	}
+
+	userID, err := s.db.GetUserIDByOIDCSubject(subject)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to look up OIDC subject")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	var user *models.User
+	if userID != 0 {
+		user, err = s.db.GetUserByID(userID)
+	} else {
+		user, err = s.db.GetUserByEmail(email)
+		if err == nil && user != nil {
+			// Only link an existing local account when the provider vouches for the
+			// address; a missing email_verified claim is treated as unverified
+			if !claimBool(claims, "email_verified") {
+				http.Error(w, "Your identity provider has not verified this email address", http.StatusForbidden)
+				return nil, false
+			}
+			if err = s.db.LinkUserOIDCSubject(user.ID, subject); err == nil {
+				log.Info().Int("user_id", user.ID).Msg("Linked existing account to identity provider")
+			}
+		}
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load SSO user")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if user == nil {
+		if !cfg.AutoProvision {
+			http.Error(w, "No SREootb account exists for "+email, http.StatusForbidden)
+			return nil, false
+		}
+		return s.provisionOIDCUser(w, r, claims, email, subject, role)
+	}
+
+	if user.Disabled {
+		s.auditAs(r, userActor(user), auditLoginFailed, "user", strconv.Itoa(user.ID), nil,
+			map[string]string{"reason": "account disabled", "method": "oidc"})
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return nil, false
+	}
+
+	if cfg.SyncRoles && user.Role != role && s.oidcCanChangeRole(user) {
+		if err := s.db.UpdateUserRole(user.ID, role); err != nil {
+			log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to sync role from identity provider")
+		} else {
+			before := *user
+			user.Role = role
+			log.Info().Int("user_id", user.ID).Str("from", before.Role).Str("to", role).Msg("User role synced from identity provider groups")
+			s.auditAs(r, userActor(user), auditUserRole, "user", strconv.Itoa(user.ID), &before, user)
+		}
+	}
+
+	return user, true
+}
+
+// oidcCanChangeRole applies the guardLastAdmin rule to role sync: the last
+// active admin is never demoted by a change in identity provider groups.
+func (s *Server) oidcCanChangeRole(user *models.User) bool {
+	if user.Role != models.RoleAdmin {
+		return true
+	}
+	admins, err := s.db.CountActiveAdmins()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count admins")
+		return false
+	}
+	if admins <= 1 {
+		log.Warn().Int("user_id", user.ID).Msg("Not syncing role from identity provider: user is the last active admin")
+		return false
+	}
+	return true
+}
+
+// provisionOIDCUser creates an account on first single sign-on. The account
+// gets an unusable random password, so it can only log in through the provider
+// until a password reset.
+func (s *Server) provisionOIDCUser(w http.ResponseWriter, r *http.Request, claims map[string]interface{}, email, subject, role string) (*models.User, bool) {
+	firstName := claimString(claims, "given_name")
+	lastName := claimString(claims, "family_name")
+	if firstName == "" {
+		firstName, lastName, _ = strings.Cut(claimString(claims, "name"), " ")
+	}
+
+	randomPassword, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate password for SSO user")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	passwordHash, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash password for SSO user")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	user, err := s.db.CreateUser(&models.UserRegistrationRequest{
+		Email:     email,
+		FirstName: firstName,
+		LastName:  lastName,
+	}, passwordHash, role)
+	if err != nil {
+		log.Error().Err(err).Str("email", email).Msg("Failed to provision SSO user")
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	if err := s.db.LinkUserOIDCSubject(user.ID, subject); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to link SSO user")
+		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	log.Info().Int("user_id", user.ID).Str("email", email).Str("role", role).Msg("Provisioned user from identity provider")
+	s.auditAs(r, userActor(user), auditUserProvision, "user", strconv.Itoa(user.ID), nil, user)
+
+	return user, true
+}
+
+// oidcRole maps identity provider groups to the most privileged configured
+// role. It returns false when no group matches and there is no default role.
+func (s *Server) oidcRole(groups []string) (string, bool) {
+	cfg := s.config.Server.Auth.OIDC
+
+	best := ""
+	for _, mapping := range cfg.RoleMappings {
+		if containsString(groups, mapping.Group) && roleRank(mapping.Role) > roleRank(best) {
+			best = mapping.Role
+		}
+	}
+	if best == "" {
+		best = cfg.DefaultRole
+	}
+
+	return best, best != ""
+}
+
+// claimString returns a string claim, or "" if it is absent or not a string
+func claimString(claims map[string]interface{}, name string) string {
+	v, _ := claims[name].(string)
+	return strings.TrimSpace(v)
+}
+
+// claimBool reads a boolean claim. Some providers encode booleans as strings.
+func claimBool(claims map[string]interface{}, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// claimStrings reads a claim that may be a single string or an array of strings
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
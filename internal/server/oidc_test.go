@@ -0,0 +1,484 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/config"
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+const testOIDCClientID = "sreootb"
+
+// fakeIdentityProvider is an in-process OIDC provider. The token endpoint
+// answers each authorization code with an ID token for the claims registered
+// under that code.
+type fakeIdentityProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]map[string]interface{}
+}
+
+func newFakeIdentityProvider(t *testing.T) *fakeIdentityProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	idp := &fakeIdentityProvider{key: key, codes: make(map[string]map[string]interface{})}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		claims, ok := idp.codes[r.Form.Get("code")]
+		delete(idp.codes, r.Form.Get("code"))
+		idp.mu.Unlock()
+		if !ok || r.Form.Get("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, claims), "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+// sign produces an RS256 ID token
+func (idp *fakeIdentityProvider) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Errorf("marshal claims: %v", err)
+	}
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, idp.key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Errorf("sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// issue registers the claims returned for an authorization code
+func (idp *fakeIdentityProvider) issue(code string, claims map[string]interface{}) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.codes[code] = claims
+}
+
+// claims returns valid ID token claims for a user of the provider
+func (idp *fakeIdentityProvider) claims(sub, email, nonce string) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":            idp.server.URL,
+		"aud":            testOIDCClientID,
+		"sub":            sub,
+		"email":          email,
+		"email_verified": true,
+		"nonce":          nonce,
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+		"iat":            time.Now().Unix(),
+		"groups":         []string{"sre"},
+	}
+}
+
+func newSSOTestServer(t *testing.T, idp *fakeIdentityProvider, configure func(cfg *config.OIDCConfig)) *Server {
+	return newTestServer(t, func(cfg *config.Config) {
+		cfg.Server.Auth.OIDC = config.OIDCConfig{
+			Enabled:       true,
+			IssuerURL:     idp.server.URL,
+			ClientID:      testOIDCClientID,
+			RedirectURL:   "https://sreootb.example.com/api/auth/oidc/callback",
+			GroupsClaim:   "groups",
+			RoleMappings:  []config.OIDCRoleMapping{{Group: "sre", Role: models.RoleEditor}},
+			AutoProvision: true,
+		}
+		if configure != nil {
+			configure(&cfg.Server.Auth.OIDC)
+		}
+	})
+}
+
+// ssoLogin is one started login: the state cookie and the state and nonce
+// the server sent to the provider
+type ssoLogin struct {
+	cookie *http.Cookie
+	state  string
+	nonce  string
+}
+
+func startSSOLogin(t *testing.T, s *Server) *ssoLogin {
+	t.Helper()
+
+	rec := s.serve(httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login?redirect=/sites", nil))
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", rec.Code, rec.Body)
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("login redirect: %v", err)
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Errorf("login redirect lacks a PKCE challenge: %s", location)
+	}
+
+	login := &ssoLogin{state: query.Get("state"), nonce: query.Get("nonce")}
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			login.cookie = cookie
+		}
+	}
+	if login.cookie == nil || login.state == "" || login.nonce == "" {
+		t.Fatalf("login did not set state, nonce and the state cookie")
+	}
+	return login
+}
+
+// callback completes a login at the server's callback endpoint
+func (login *ssoLogin) callback(s *Server, code, state string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(state), nil)
+	if login.cookie != nil {
+		req.AddCookie(login.cookie)
+	}
+	return s.serve(req)
+}
+
+// sessionToken returns the token handed to the web GUI by a successful callback
+func sessionToken(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: status %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	path, fragment, _ := strings.Cut(location, "#")
+	if path != "/sites" || !strings.HasPrefix(fragment, "session_token=") {
+		t.Fatalf("callback redirected to %q", location)
+	}
+	token, err := url.QueryUnescape(strings.TrimPrefix(fragment, "session_token="))
+	if err != nil || token == "" {
+		t.Fatalf("callback returned no session token: %q", location)
+	}
+	return token
+}
+
+func TestOIDCCallbackProvisionsUser(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, nil)
+
+	login := startSSOLogin(t, s)
+	idp.issue("code-1", idp.claims("alice", "alice@example.com", login.nonce))
+	token := sessionToken(t, login.callback(s, "code-1", login.state))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	if rec := s.serve(req); rec.Code != http.StatusOK {
+		t.Fatalf("session from SSO was not accepted: status %d", rec.Code)
+	}
+
+	user, err := s.db.GetUserByEmail("alice@example.com")
+	if err != nil || user == nil {
+		t.Fatalf("user was not provisioned: %v", err)
+	}
+	if user.Role != models.RoleEditor {
+		t.Errorf("role = %s, want %s from the group mapping", user.Role, models.RoleEditor)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidState(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, nil)
+
+	tests := []struct {
+		name   string
+		mutate func(login *ssoLogin) (state string)
+	}{
+		{"state mismatch", func(login *ssoLogin) string { return "forged-state" }},
+		{"missing state cookie", func(login *ssoLogin) string { login.cookie = nil; return login.state }},
+		{"tampered state cookie", func(login *ssoLogin) string {
+			login.cookie.Value = url.QueryEscape("v1:" + base64.StdEncoding.EncodeToString([]byte("not a sealed state")))
+			return login.state
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := startSSOLogin(t, s)
+			idp.issue("code-state", idp.claims("mallory", "mallory@example.com", login.nonce))
+			state := tt.mutate(login)
+
+			if rec := login.callback(s, "code-state", state); rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if user, _ := s.db.GetUserByEmail("mallory@example.com"); user != nil {
+				t.Error("a user was provisioned despite the invalid state")
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, nil)
+
+	// A token minted for another login must not complete this one
+	login := startSSOLogin(t, s)
+	idp.issue("code-replay", idp.claims("bob", "bob@example.com", "nonce-of-another-login"))
+
+	if rec := login.callback(s, "code-replay", login.state); rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if user, _ := s.db.GetUserByEmail("bob@example.com"); user != nil {
+		t.Error("a user was provisioned from a token with the wrong nonce")
+	}
+}
+
+func TestOIDCCallbackLinksOnlyVerifiedEmail(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, nil)
+	admin := createTestUser(t, s, "admin@example.com", models.RoleAdmin)
+	subject := idp.server.URL + "#admin-at-idp"
+
+	tests := []struct {
+		name          string
+		emailVerified interface{} // nil leaves the claim out
+	}{
+		{"claim missing", nil},
+		{"unverified", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login := startSSOLogin(t, s)
+			claims := idp.claims("admin-at-idp", "admin@example.com", login.nonce)
+			delete(claims, "email_verified")
+			if tt.emailVerified != nil {
+				claims["email_verified"] = tt.emailVerified
+			}
+			idp.issue("code-unverified", claims)
+
+			if rec := login.callback(s, "code-unverified", login.state); rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+			if id, _ := s.db.GetUserIDByOIDCSubject(subject); id != 0 {
+				t.Error("the account was linked to an unverified email address")
+			}
+		})
+	}
+
+	login := startSSOLogin(t, s)
+	idp.issue("code-verified", idp.claims("admin-at-idp", "admin@example.com", login.nonce))
+	sessionToken(t, login.callback(s, "code-verified", login.state))
+	if id, _ := s.db.GetUserIDByOIDCSubject(subject); id != admin.ID {
+		t.Errorf("verified email linked subject to user %d, want %d", id, admin.ID)
+	}
+}
+
+func TestOIDCRoleSyncKeepsLastAdmin(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, func(cfg *config.OIDCConfig) {
+		cfg.SyncRoles = true
+		cfg.RoleMappings = nil
+		cfg.DefaultRole = models.RoleViewer
+	})
+	admin := createTestUser(t, s, "admin@example.com", models.RoleAdmin)
+
+	login := startSSOLogin(t, s)
+	idp.issue("code-1", idp.claims("admin-at-idp", "admin@example.com", login.nonce))
+	sessionToken(t, login.callback(s, "code-1", login.state))
+	if user, _ := s.db.GetUserByID(admin.ID); user.Role != models.RoleAdmin {
+		t.Fatalf("the last admin was demoted to %s", user.Role)
+	}
+
+	// With another admin the group mapping applies
+	createTestUser(t, s, "second@example.com", models.RoleAdmin)
+	login = startSSOLogin(t, s)
+	idp.issue("code-2", idp.claims("admin-at-idp", "admin@example.com", login.nonce))
+	sessionToken(t, login.callback(s, "code-2", login.state))
+	if user, _ := s.db.GetUserByID(admin.ID); user.Role != models.RoleViewer {
+		t.Errorf("role = %s, want %s from sync", user.Role, models.RoleViewer)
+	}
+}
+
+// An existing account is only linked when email_verified is affirmatively true
+func TestOIDCEmailVerifiedClaim(t *testing.T) {
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		want   bool
+	}{
+		{"verified", map[string]interface{}{"email_verified": true}, true},
+		{"verified as string", map[string]interface{}{"email_verified": "true"}, true},
+		{"unverified", map[string]interface{}{"email_verified": false}, false},
+		{"unverified as string", map[string]interface{}{"email_verified": "false"}, false},
+		{"claim missing", map[string]interface{}{"email": "admin@example.com"}, false},
+		{"unexpected type", map[string]interface{}{"email_verified": 1.0}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := claimBool(tt.claims, "email_verified"); got != tt.want {
+				t.Errorf("claimBool() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSafeRedirectPath(t *testing.T) {
+	tests := map[string]string{
+		"/sites":              "/sites",
+		"":                    "/",
+		"https://evil.com":    "/",
+		"//evil.com/path":     "/",
+		"/\\evil.com":         "/",
+		"sites":               "/",
+		"/agents?tab=keys#ok": "/agents?tab=keys#ok",
+	}
+	for in, want := range tests {
+		if got := safeRedirectPath(in); got != want {
+			t.Errorf("safeRedirectPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// ssoChallenge returns the two-factor challenge handed to the web GUI by a
+// callback for an account with 2FA enabled
+func ssoChallenge(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	if rec.Code != http.StatusFound {
+		t.Fatalf("callback: status %d: %s", rec.Code, rec.Body)
+	}
+	location := rec.Header().Get("Location")
+	path, fragment, _ := strings.Cut(location, "#")
+	if path != "/sites" || !strings.HasPrefix(fragment, "sso_challenge=") {
+		t.Fatalf("callback redirected to %q, want a two-factor challenge", location)
+	}
+	challenge, err := url.QueryUnescape(strings.TrimPrefix(fragment, "sso_challenge="))
+	if err != nil || challenge == "" {
+		t.Fatalf("callback returned no challenge: %q", location)
+	}
+	return challenge
+}
+
+// Local 2FA still applies to accounts signing in through the identity provider
+func TestOIDCLoginRequiresLocalSecondFactor(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, nil)
+	user := createTestUser(t, s, "alice@example.com", models.RoleViewer)
+	secret, backupCodes := enrollTwoFactor(t, s, newSession(t, s, user))
+
+	signIn := func(code string) string {
+		t.Helper()
+		login := startSSOLogin(t, s)
+		idp.issue(code, idp.claims("alice", user.Email, login.nonce))
+		return ssoChallenge(t, login.callback(s, code, login.state))
+	}
+	answer := func(challenge, code string) *httptest.ResponseRecorder {
+		return s.serve(jsonRequest(t, http.MethodPost, "/api/auth/oidc/2fa", "",
+			map[string]string{"challenge": challenge, "totp_code": code}))
+	}
+
+	challenge := signIn("code-1")
+	if rec := answer(challenge, "000000"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong code: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := answer("forged-challenge", totpCode(t, secret, time.Now())); rec.Code != http.StatusBadRequest {
+		t.Errorf("forged challenge: status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	next := totpCode(t, secret, time.Now().Add(30*time.Second))
+	rec := answer(challenge, next)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid code: status %d: %s", rec.Code, rec.Body)
+	}
+	var response models.UserLoginResponse
+	decodeJSON(t, rec, &response)
+	req := jsonRequest(t, http.MethodGet, "/api/auth/me", response.SessionToken, nil)
+	if rec := s.serve(req); rec.Code != http.StatusOK {
+		t.Errorf("session from SSO with 2FA was not accepted: status %d", rec.Code)
+	}
+
+	// The code cannot be replayed with the same challenge, but a backup code works
+	if rec := answer(challenge, next); rec.Code != http.StatusUnauthorized {
+		t.Errorf("replayed code: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := answer(signIn("code-2"), backupCodes[0]); rec.Code != http.StatusOK {
+		t.Errorf("backup code: status %d: %s", rec.Code, rec.Body)
+	}
+}
+
+// X-Forwarded-Proto only marks the state cookie Secure when a trusted proxy sent it
+func TestOIDCStateCookieSecureBehindTrustedProxy(t *testing.T) {
+	idp := newFakeIdentityProvider(t)
+	s := newSSOTestServer(t, idp, nil)
+	trusted, err := parseTrustedProxies([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("parseTrustedProxies: %v", err)
+	}
+	s.trustedProxies = trusted
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		proto      string
+		wantSecure bool
+	}{
+		{"trusted proxy over https", "10.1.2.3:4000", "https", true},
+		{"trusted proxy over http", "10.1.2.3:4000", "http", false},
+		{"untrusted peer claiming https", "198.51.100.7:4000", "https", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+			rec := s.serve(req)
+
+			for _, cookie := range rec.Result().Cookies() {
+				if cookie.Name == oidcStateCookie {
+					if cookie.Secure != tt.wantSecure {
+						t.Errorf("Secure = %v, want %v", cookie.Secure, tt.wantSecure)
+					}
+					return
+				}
+			}
+			t.Fatalf("no state cookie: status %d", rec.Code)
+		})
+	}
+}
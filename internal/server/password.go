@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/database"
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// passwordResetTTL is how long a password reset link stays valid
+const passwordResetTTL = time.Hour
+
+// publicBaseURL returns the configured externally reachable web GUI URL used
+// in email links, or "" when none is configured. It is never derived from the
+// request: a client controls Host and X-Forwarded-Host, and a link built from
+// them would send a victim's reset token to the client's domain.
+func (s *Server) publicBaseURL() string {
+	return strings.TrimRight(s.config.Server.Email.BaseURL, "/")
+}
+
+// handleForgotPassword emails a password reset link. It responds identically
+// whether or not the address belongs to an account.
+func (s *Server) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ForgotPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success": true,
+		"message": "If an account exists for that email, a password reset link has been sent",
+	}
+
+	email := normalizeEmail(req.Email)
+	if email == "" {
+		http.Error(w, "Email is required", http.StatusBadRequest)
+		return
+	}
+
+	baseURL := s.publicBaseURL()
+	if baseURL == "" {
+		log.Warn().Msg("Password reset requested but server.email.base_url is not configured")
+		http.Error(w, "Password reset is not available; an administrator must configure the public URL", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Limit reset emails per address so the endpoint can't be used to flood an inbox
+	if ok, retryAfter := s.limits.authAccount.allow("reset:" + email); !ok {
+		writeTooManyRequests(w, retryAfter, "Too many password reset requests; try again later")
+		return
+	}
+
+	user, err := s.db.GetUserByEmail(email)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to look up user for password reset")
+		s.writeJSON(w, response)
+		return
+	}
+	if user == nil || user.Disabled {
+		s.writeJSON(w, response)
+		return
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate password reset token")
+		s.writeJSON(w, response)
+		return
+	}
+
+	if err := s.db.CreatePasswordResetToken(user.ID, utils.HashSessionToken(token), time.Now().Add(passwordResetTTL)); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to store password reset token")
+		s.writeJSON(w, response)
+		return
+	}
+
+	resetURL := baseURL + "/reset-password?token=" + url.QueryEscape(token)
+
+	// Deliver in the background so response timing does not reveal registered addresses
+	go func(email, firstName string) {
+		if err := s.email.SendPasswordResetEmail(email, firstName, resetURL); err != nil {
+			log.Error().Err(err).Str("email", email).Msg("Failed to send password reset email")
+		}
+	}(user.Email, user.FirstName)
+
+	log.Info().Int("user_id", user.ID).Msg("Password reset requested")
+
+	s.writeJSON(w, response)
+}
+
+// handleResetPassword sets a new password using a single-use reset token
+func (s *Server) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	var req models.ResetPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	passwordHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash password")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := s.db.ResetPasswordWithToken(utils.HashSessionToken(req.Token), passwordHash)
+	if err != nil {
+		switch {
+		case errors.Is(err, database.ErrResetTokenExpired):
+			http.Error(w, "Reset token has expired; request a new password reset", http.StatusBadRequest)
+			return
+		case errors.Is(err, database.ErrResetTokenInvalid):
+			http.Error(w, "Invalid or already used reset token", http.StatusBadRequest)
+			return
+		}
+		log.Error().Err(err).Msg("Failed to reset password")
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", userID).Msg("Password reset completed; all sessions revoked")
+
+	// The reset token proves control of the account's mailbox, so the user is the actor
+	actor := auditActor{Type: models.ActorUser, ID: strconv.Itoa(userID)}
+	if user, err := s.db.GetUserByID(userID); err == nil && user != nil {
+		actor = userActor(user)
+	}
+	s.auditAs(r, actor, auditPasswordReset, "user", strconv.Itoa(userID), nil, nil)
+
+	s.writeJSON(w, map[string]interface{}{
+		"success": true,
+		"message": "Password has been reset. Please log in with your new password.",
+	})
+}
+
+// handleChangePassword changes the current user's password and signs out their other sessions
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req models.PasswordChangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A stolen session must not be able to guess its way past the re-check
+	if !s.allowLoginAttempt(w, r, user.Email) {
+		return
+	}
+
+	if !utils.VerifyPassword(req.CurrentPassword, user.PasswordHash) {
+		s.recordLoginFailure(r, user.Email)
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+	s.recordLoginSuccess(user.Email)
+
+	passwordHash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to hash password")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	principal := principalFromContext(r.Context())
+	if err := s.db.ChangePassword(user.ID, passwordHash, principal.Session.ID); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to change password")
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Msg("Password changed; other sessions revoked")
+
+	s.audit(r, auditPasswordChange, "user", strconv.Itoa(user.ID), nil, nil)
+
+	s.writeJSON(w, map[string]interface{}{
+		"success": true,
+		"message": "Password changed",
+	})
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+func TestResetPasswordTokens(t *testing.T) {
+	s := newTestServer(t, nil)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+
+	issue := func(token string, expiresAt time.Time) {
+		t.Helper()
+		if err := s.db.CreatePasswordResetToken(user.ID, utils.HashSessionToken(token), expiresAt); err != nil {
+			t.Fatalf("CreatePasswordResetToken: %v", err)
+		}
+	}
+	issue("expired-token", time.Now().Add(-time.Minute))
+	issue("valid-token", time.Now().Add(time.Hour))
+
+	reset := func(token string) (int, string) {
+		rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/reset-password", "",
+			models.ResetPasswordRequest{Token: token, NewPassword: "N3w-passw0rd!"}))
+		return rec.Code, rec.Body.String()
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		wantStatus  int
+		wantMessage string
+	}{
+		{"unknown token", "no-such-token", http.StatusBadRequest, "Invalid or already used reset token"},
+		{"expired token", "expired-token", http.StatusBadRequest, "Reset token has expired"},
+		{"valid token", "valid-token", http.StatusOK, "Password has been reset"},
+		{"used token", "valid-token", http.StatusBadRequest, "Invalid or already used reset token"},
+	}
+	for _, tt := range tests {
+		status, body := reset(tt.token)
+		if status != tt.wantStatus || !strings.Contains(body, tt.wantMessage) {
+			t.Errorf("%s: status %d %q, want %d %q", tt.name, status, strings.TrimSpace(body), tt.wantStatus, tt.wantMessage)
+		}
+	}
+
+	updated, err := s.db.GetUserByID(user.ID)
+	if err != nil || !utils.VerifyPassword("N3w-passw0rd!", updated.PasswordHash) {
+		t.Errorf("password was not reset: %v", err)
+	}
+}
+
+// Guessing the current password through a session counts toward the same
+// lockout as failed logins
+func TestChangePasswordLockout(t *testing.T) {
+	s := newTestServer(t, enableLockouts)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+	token := newSession(t, s, user)
+
+	change := func(current string) int {
+		return s.serve(jsonRequest(t, http.MethodPost, "/api/auth/change-password", token,
+			models.PasswordChangeRequest{CurrentPassword: current, NewPassword: "N3w-passw0rd!"})).Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if status := change("wrong guess"); status != http.StatusUnauthorized {
+			t.Fatalf("guess %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+	if status := change(testPassword); status != http.StatusTooManyRequests {
+		t.Fatalf("change while locked out: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// The lockout covers logins to the account too
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/login", "",
+		models.UserLoginRequest{Email: user.Email, Password: testPassword}))
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("login while locked out: status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	updated, err := s.db.GetUserByID(user.ID)
+	if err != nil || !utils.VerifyPassword(testPassword, updated.PasswordHash) {
+		t.Errorf("password changed despite the lockout: %v", err)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t, enableLockouts)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+	token := newSession(t, s, user)
+	other := newSession(t, s, user)
+
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/change-password", token,
+		models.PasswordChangeRequest{CurrentPassword: testPassword, NewPassword: "N3w-passw0rd!"}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("change password: status %d: %s", rec.Code, rec.Body)
+	}
+
+	// The session that made the change stays signed in; the others do not
+	if status := s.serve(jsonRequest(t, http.MethodGet, "/api/auth/me", token, nil)).Code; status != http.StatusOK {
+		t.Errorf("current session after change: status %d, want %d", status, http.StatusOK)
+	}
+	if status := s.serve(jsonRequest(t, http.MethodGet, "/api/auth/me", other, nil)).Code; status != http.StatusUnauthorized {
+		t.Errorf("other session after change: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// maxPushMessageLength caps the msg stored with a push result
+const maxPushMessageLength = 500
+
+// issuePushToken gives a push site a new secret token, invalidating the
+// previous one, and returns the URL jobs report to
+func (s *Server) issuePushToken(r *http.Request, siteID int) (string, error) {
+	secret, err := utils.GenerateSecureToken(20)
+	if err != nil {
+		return "", err
+	}
+	rawToken := models.PushTokenPrefix + secret
+
+	if err := s.db.SetPushToken(siteID, models.PushTokenPrefix+secret[:8], utils.HashAPIKey(rawToken)); err != nil {
+		return "", err
+	}
+
+	// The configured public URL is preferred; the request only says how this
+	// client reached the server
+	base := s.publicBaseURL()
+	if base == "" {
+		base = s.getServerURL(r)
+	}
+	return base + "/api/push/" + rawToken, nil
+}
+
+// handlePush receives a report from a push site's job. The token in the URL
+// is the only credential. status is "up" (the default), "down" or "fail", or
+// "start" to time the job until its next report. Reports for a paused site
+// are acknowledged without being recorded, so jobs do not fail meanwhile.
+func (s *Server) handlePush(w http.ResponseWriter, r *http.Request) {
+	push, err := s.db.GetPushMonitorByTokenHash(utils.HashAPIKey(chi.URLParam(r, "token")))
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to look up push token")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	var site *models.Site
+	if push != nil {
+		if site, err = s.db.GetSite(push.SiteID); err != nil {
+			log.Error().Err(err).Int("site_id", push.SiteID).Msg("Failed to get push site")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+	if site == nil || !strings.HasPrefix(site.URL, "push://") {
+		http.Error(w, "Unknown push token", http.StatusNotFound)
+		return
+	}
+	if site.Paused {
+		s.writeJSON(w, map[string]interface{}{
+			"ok":     true,
+			"status": "paused",
+		})
+		return
+	}
+
+	signal := strings.ToLower(strings.TrimSpace(r.FormValue("status")))
+	if signal == "" {
+		signal = models.PushSignalUp
+	}
+
+	message := strings.TrimSpace(r.FormValue("msg"))
+	if len(message) > maxPushMessageLength {
+		message = strings.ToValidUTF8(message[:maxPushMessageLength], "")
+	}
+
+	now := time.Now().UTC()
+	check := models.SiteCheck{SiteID: site.ID, CheckedAt: now}
+	switch signal {
+	case models.PushSignalStart:
+		if err := s.db.RecordPushStart(site.ID, now); err != nil {
+			log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to record push start")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		s.writeJSON(w, map[string]interface{}{
+			"ok":     true,
+			"status": signal,
+		})
+		return
+	case models.PushSignalUp:
+		check.Status = "up"
+	case models.PushSignalDown, models.PushSignalFail:
+		check.Status = "down"
+		if message == "" {
+			message = "Job reported failure"
+		}
+	default:
+		http.Error(w, "status must be up, down, fail or start", http.StatusBadRequest)
+		return
+	}
+
+	if message != "" {
+		check.ErrorMessage = &message
+	}
+	// The job's duration is measured from its start signal
+	if push.StartedAt != nil && now.After(*push.StartedAt) {
+		duration := now.Sub(*push.StartedAt).Seconds()
+		check.ResponseTime = &duration
+	}
+
+	if err := s.db.RecordPushResult(&check, now); err != nil {
+		log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to record push result")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Debug().Int("site_id", site.ID).Str("status", check.Status).Msg("Received push report")
+
+	response := map[string]interface{}{
+		"ok":     true,
+		"status": check.Status,
+	}
+	if check.ResponseTime != nil {
+		response["duration"] = *check.ResponseTime
+	}
+	s.writeJSON(w, response)
+}
+
+// handleRotatePushToken replaces the secret token of a push site. Jobs using
+// the old URL are rejected from then on.
+func (s *Server) handleRotatePushToken(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return
+	}
+
+	site, err := s.db.GetSite(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+	if !strings.HasPrefix(site.URL, "push://") {
+		http.Error(w, "Site is not a push monitor", http.StatusBadRequest)
+		return
+	}
+
+	before, err := s.db.GetPushMonitor(site.ID)
+	if err != nil {
+		log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to get push monitor")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	pushURL, err := s.issuePushToken(r, site.ID)
+	if err != nil {
+		log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to issue push token")
+		http.Error(w, "Failed to issue push token", http.StatusInternalServerError)
+		return
+	}
+
+	// Only the token prefixes are recorded, never the secret
+	after, err := s.db.GetPushMonitor(site.ID)
+	if err != nil {
+		log.Warn().Err(err).Int("site_id", site.ID).Msg("Failed to get push monitor")
+	}
+	s.audit(r, auditSitePushToken, "site", idStr, before, after)
+
+	s.writeJSON(w, map[string]interface{}{
+		"id":       site.ID,
+		"message":  "Push token rotated",
+		"push_url": pushURL,
+	})
+}
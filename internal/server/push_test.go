@@ -0,0 +1,112 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/x86txt/sreootb/internal/config"
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// addPushSite creates a push site and returns it with the URL its job reports to
+func addPushSite(t *testing.T, s *Server, name string) (*models.Site, string) {
+	t.Helper()
+
+	site, err := s.db.AddSite(&models.SiteCreateRequest{URL: "push://" + name, Name: name, ScanInterval: "60s"})
+	if err != nil {
+		t.Fatalf("add site %s: %v", name, err)
+	}
+	pushURL, err := s.issuePushToken(httptest.NewRequest(http.MethodPost, "/api/sites", nil), site.ID)
+	if err != nil {
+		t.Fatalf("issue push token: %v", err)
+	}
+	return site, pushURL
+}
+
+func TestPushWhilePausedIsNotRecorded(t *testing.T) {
+	s := newTestServer(t, nil)
+	site, pushURL := addPushSite(t, s, "backup")
+	pushPath := pushURL[strings.Index(pushURL, "/api/push/"):]
+
+	push := func(status string) string {
+		t.Helper()
+		rec := s.serve(httptest.NewRequest(http.MethodPost, pushPath+"?status="+status, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("push %s: status %d: %s", status, rec.Code, rec.Body)
+		}
+		var response struct {
+			Status string `json:"status"`
+		}
+		decodeJSON(t, rec, &response)
+		return response.Status
+	}
+	history := func() []*models.SiteCheck {
+		t.Helper()
+		checks, err := s.db.GetSiteHistory(site.ID, 10)
+		if err != nil {
+			t.Fatalf("GetSiteHistory: %v", err)
+		}
+		return checks
+	}
+
+	if _, err := s.db.SetSitePaused(site.ID, true); err != nil {
+		t.Fatalf("pause site: %v", err)
+	}
+	for _, status := range []string{"start", "down", "up"} {
+		if got := push(status); got != "paused" {
+			t.Errorf("push %s while paused answered %q, want paused", status, got)
+		}
+	}
+	if checks := history(); len(checks) != 0 {
+		t.Errorf("recorded %d checks while paused, want 0", len(checks))
+	}
+	if monitor, _ := s.db.GetPushMonitor(site.ID); monitor.StartedAt != nil || monitor.LastPingAt != nil {
+		t.Errorf("push monitor updated while paused: %+v", monitor)
+	}
+
+	if _, err := s.db.SetSitePaused(site.ID, false); err != nil {
+		t.Fatalf("resume site: %v", err)
+	}
+	if got := push("down"); got != "down" {
+		t.Errorf("push after resuming answered %q, want down", got)
+	}
+	if checks := history(); len(checks) != 1 || checks[0].Status != "down" {
+		t.Errorf("checks after resuming = %+v, want one down check", checks)
+	}
+}
+
+func TestPushURLIgnoresUntrustedForwardedHost(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		want    string
+	}{
+		{"request host", "", "http://example.com/api/push/"},
+		{"configured base URL", "https://monitor.example.com/", "https://monitor.example.com/api/push/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, func(cfg *config.Config) { cfg.Server.Email.BaseURL = tt.baseURL })
+			admin := createTestUser(t, s, "admin@example.com", models.RoleAdmin)
+			site, _ := addPushSite(t, s, "backup")
+
+			req := jsonRequest(t, http.MethodPost, "/api/sites/"+strconv.Itoa(site.ID)+"/push-token", newSession(t, s, admin), nil)
+			req.Header.Set("X-Forwarded-Host", "attacker.example.net")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			rec := s.serve(req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("rotate push token: status %d: %s", rec.Code, rec.Body)
+			}
+			var response struct {
+				PushURL string `json:"push_url"`
+			}
+			decodeJSON(t, rec, &response)
+			if !strings.HasPrefix(response.PushURL, tt.want) {
+				t.Errorf("push URL = %s, want it to start with %s", response.PushURL, tt.want)
+			}
+		})
+	}
+}
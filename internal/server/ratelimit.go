@@ -0,0 +1,381 @@
+package server
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/config"
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// slidingWindowLimiter allows at most limit events per key within any window-long period
+type slidingWindowLimiter struct {
+	limit  int
+	window time.Duration
+
+	mu   sync.Mutex
+	hits map[string][]time.Time // Oldest first; never longer than limit
+}
+
+// newSlidingWindowLimiter creates a limiter, or returns nil (no limit) when limit or window is not positive
+func newSlidingWindowLimiter(limit int, window time.Duration) *slidingWindowLimiter {
+	if limit <= 0 || window <= 0 {
+		return nil
+	}
+	return &slidingWindowLimiter{
+		limit:  limit,
+		window: window,
+		hits:   make(map[string][]time.Time),
+	}
+}
+
+// allow records an event for key if it is within the limit. When it is not,
+// allow returns false and how long until the next event would be allowed.
+func (l *slidingWindowLimiter) allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	hits := pruneBefore(l.hits[key], now.Add(-l.window))
+	if len(hits) >= l.limit {
+		l.hits[key] = hits
+		return false, hits[0].Add(l.window).Sub(now)
+	}
+
+	l.hits[key] = append(hits, now)
+	return true, 0
+}
+
+// prune forgets keys with no events inside the window
+func (l *slidingWindowLimiter) prune() {
+	if l == nil {
+		return
+	}
+
+	cutoff := time.Now().Add(-l.window)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for key, hits := range l.hits {
+		if len(hits) == 0 || hits[len(hits)-1].Before(cutoff) {
+			delete(l.hits, key)
+		}
+	}
+}
+
+// pruneBefore drops timestamps older than cutoff from an oldest-first slice
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// lockoutEntry tracks failures and lockouts for one key
+type lockoutEntry struct {
+	failures    []time.Time
+	lockouts    int // Consecutive lockouts, drives the exponential backoff
+	lockedUntil time.Time
+}
+
+// lockoutTracker temporarily blocks keys after repeated failures. Each
+// lockout that follows another doubles in length, up to maxLockout.
+type lockoutTracker struct {
+	maxFailures int
+	window      time.Duration
+	baseLockout time.Duration
+	maxLockout  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*lockoutEntry
+}
+
+// newLockoutTracker creates a tracker, or returns nil (no lockouts) when maxFailures is not positive
+func newLockoutTracker(maxFailures int, window, baseLockout, maxLockout time.Duration) *lockoutTracker {
+	if maxFailures <= 0 || window <= 0 || baseLockout <= 0 {
+		return nil
+	}
+	if maxLockout < baseLockout {
+		maxLockout = baseLockout
+	}
+	return &lockoutTracker{
+		maxFailures: maxFailures,
+		window:      window,
+		baseLockout: baseLockout,
+		maxLockout:  maxLockout,
+		entries:     make(map[string]*lockoutEntry),
+	}
+}
+
+// lockedFor returns how much longer key is locked out, or zero
+func (t *lockoutTracker) lockedFor(key string) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if remaining := time.Until(entry.lockedUntil); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// recordFailure counts a failure for key and returns the lockout it triggered, or zero
+func (t *lockoutTracker) recordFailure(key string) time.Duration {
+	if t == nil {
+		return 0
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		entry = &lockoutEntry{}
+		t.entries[key] = entry
+	}
+
+	// Forget earlier lockouts once the key has behaved for a full backoff period
+	if entry.lockouts > 0 && now.Sub(entry.lockedUntil) > t.maxLockout {
+		entry.lockouts = 0
+	}
+
+	entry.failures = append(pruneBefore(entry.failures, now.Add(-t.window)), now)
+	if len(entry.failures) < t.maxFailures {
+		return 0
+	}
+
+	entry.failures = nil
+	entry.lockouts++
+	duration := t.maxLockout
+	if shift := entry.lockouts - 1; shift < 32 {
+		if backoff := t.baseLockout * time.Duration(1<<shift); backoff > 0 && backoff < t.maxLockout {
+			duration = backoff
+		}
+	}
+	entry.lockedUntil = now.Add(duration)
+
+	return duration
+}
+
+// reset clears failures and lockout history for key after a success
+func (t *lockoutTracker) reset(key string) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	delete(t.entries, key)
+	t.mu.Unlock()
+}
+
+// prune forgets keys that are not locked and have no recent history
+func (t *lockoutTracker) prune() {
+	if t == nil {
+		return
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for key, entry := range t.entries {
+		entry.failures = pruneBefore(entry.failures, now.Add(-t.window))
+		if len(entry.failures) == 0 && now.Sub(entry.lockedUntil) > t.maxLockout {
+			delete(t.entries, key)
+		}
+	}
+}
+
+// rateLimiters holds the server's request limiters and lockout trackers. A nil
+// limiter or tracker imposes no limit.
+type rateLimiters struct {
+	web           *slidingWindowLimiter // All web GUI requests, per IP
+	agent         *slidingWindowLimiter // All agent port requests, per IP
+	authIP        *slidingWindowLimiter // Auth endpoint requests, per IP
+	authAccount   *slidingWindowLimiter // Login attempts, per account
+	loginLockouts *lockoutTracker       // Failed logins, per IP and per account
+	agentLockouts *lockoutTracker       // Invalid agent keys, per IP
+}
+
+// newRateLimiters builds the limiters described by the configuration
+func newRateLimiters(cfg *config.RateLimitConfig) *rateLimiters {
+	if !cfg.Enabled {
+		return &rateLimiters{}
+	}
+
+	return &rateLimiters{
+		web:           newSlidingWindowLimiter(cfg.WebRequests, cfg.Window),
+		agent:         newSlidingWindowLimiter(cfg.AgentRequests, cfg.Window),
+		authIP:        newSlidingWindowLimiter(cfg.AuthIPRequests, cfg.AuthWindow),
+		authAccount:   newSlidingWindowLimiter(cfg.AuthAccountRequests, cfg.AuthWindow),
+		loginLockouts: newLockoutTracker(cfg.MaxFailures, cfg.FailureWindow, cfg.LockoutDuration, cfg.MaxLockoutDuration),
+		agentLockouts: newLockoutTracker(cfg.MaxFailures, cfg.FailureWindow, cfg.LockoutDuration, cfg.MaxLockoutDuration),
+	}
+}
+
+// prune releases memory held for idle clients
+func (rl *rateLimiters) prune() {
+	rl.web.prune()
+	rl.agent.prune()
+	rl.authIP.prune()
+	rl.authAccount.prune()
+	rl.loginLockouts.prune()
+	rl.agentLockouts.prune()
+}
+
+// startRateLimitCleanup periodically prunes idle rate limit state
+func (s *Server) startRateLimitCleanup() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.limits.prune()
+	}
+}
+
+// writeTooManyRequests responds with 429 and a Retry-After header in whole seconds
+func writeTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, message, http.StatusTooManyRequests)
+}
+
+// rateLimitMiddleware limits requests per client IP using the given limiter
+func (s *Server) rateLimitMiddleware(limiter *slidingWindowLimiter, scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if limiter == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ip := extractRemoteIP(r)
+			if ok, retryAfter := limiter.allow(scope + ":" + ip); !ok {
+				log.Warn().Str("remote_ip", ip).Str("scope", scope).Str("path", r.URL.Path).Msg("Rate limit exceeded")
+				writeTooManyRequests(w, retryAfter, "Too many requests")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loginKeys returns the lockout keys for a login attempt's IP and, when known, account
+func loginKeys(r *http.Request, email string) (ipKey, accountKey string) {
+	ipKey = "ip:" + extractRemoteIP(r)
+	if email = normalizeEmail(email); email != "" {
+		accountKey = "account:" + email
+	}
+	return ipKey, accountKey
+}
+
+// allowLoginAttempt rejects login attempts from locked-out IPs or accounts and
+// enforces the per-account attempt limit. It writes a 429 response and returns
+// false when the attempt must be refused.
+func (s *Server) allowLoginAttempt(w http.ResponseWriter, r *http.Request, email string) bool {
+	ipKey, accountKey := loginKeys(r, email)
+
+	retryAfter := s.limits.loginLockouts.lockedFor(ipKey)
+	if accountKey != "" {
+		if d := s.limits.loginLockouts.lockedFor(accountKey); d > retryAfter {
+			retryAfter = d
+		}
+	}
+	if retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter, "Too many failed login attempts; try again later")
+		return false
+	}
+
+	if accountKey != "" {
+		if ok, retryAfter := s.limits.authAccount.allow(accountKey); !ok {
+			writeTooManyRequests(w, retryAfter, "Too many login attempts for this account; try again later")
+			return false
+		}
+	}
+
+	return true
+}
+
+// recordLoginFailure counts a failed login against the client IP and account,
+// locking them out once they exceed the failure limit
+func (s *Server) recordLoginFailure(r *http.Request, email string) {
+	ipKey, accountKey := loginKeys(r, email)
+
+	for _, key := range []string{ipKey, accountKey} {
+		if key == "" {
+			continue
+		}
+		if lockout := s.limits.loginLockouts.recordFailure(key); lockout > 0 {
+			log.Warn().Str("key", key).Dur("lockout", lockout).Msg("Locked out after repeated failed logins")
+			s.auditAs(r, auditActor{Type: models.ActorSystem}, auditLoginLockout, "lockout", key, nil,
+				map[string]string{"duration": lockout.String()})
+		}
+	}
+}
+
+// credentialLockedOut writes a 429 response and returns true when the client
+// IP is locked out. Header credentials name no account, so unlike
+// allowLoginAttempt only the IP is checked, and it does not count toward the
+// per-account attempt limit, as every request of an API client carries its
+// credential.
+func (s *Server) credentialLockedOut(w http.ResponseWriter, r *http.Request) bool {
+	ipKey, _ := loginKeys(r, "")
+
+	if retryAfter := s.limits.loginLockouts.lockedFor(ipKey); retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter, "Too many failed authentication attempts; try again later")
+		return true
+	}
+	return false
+}
+
+// recordLoginSuccess clears the failure history of an account after a successful login
+func (s *Server) recordLoginSuccess(email string) {
+	if email = normalizeEmail(email); email != "" {
+		s.limits.loginLockouts.reset("account:" + email)
+	}
+}
+
+// truncateKey shortens a credential for logging
+func truncateKey(key string) string {
+	if len(key) <= 8 {
+		return "..."
+	}
+	return key[:8] + "..."
+}
+
+// agentKeyLockedOut writes a 429 response and returns true when the client IP
+// is locked out after repeatedly presenting invalid agent keys
+func (s *Server) agentKeyLockedOut(w http.ResponseWriter, r *http.Request) bool {
+	if retryAfter := s.limits.agentLockouts.lockedFor("agent:" + extractRemoteIP(r)); retryAfter > 0 {
+		writeTooManyRequests(w, retryAfter, "Too many invalid API key attempts; try again later")
+		return true
+	}
+	return false
+}
+
+// recordInvalidAgentKey counts an invalid agent key against the client IP
+func (s *Server) recordInvalidAgentKey(r *http.Request) {
+	ip := extractRemoteIP(r)
+	if lockout := s.limits.agentLockouts.recordFailure("agent:" + ip); lockout > 0 {
+		log.Warn().Str("remote_ip", ip).Dur("lockout", lockout).Msg("Blocking agent connections after repeated invalid API keys")
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+func TestSlidingWindowLimiter(t *testing.T) {
+	limiter := newSlidingWindowLimiter(3, time.Minute)
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := limiter.allow("a"); !ok {
+			t.Fatalf("event %d rejected within the limit", i+1)
+		}
+	}
+	ok, retryAfter := limiter.allow("a")
+	if ok {
+		t.Fatal("event over the limit allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Minute {
+		t.Errorf("retryAfter = %v, want within the window", retryAfter)
+	}
+	if ok, _ := limiter.allow("b"); !ok {
+		t.Error("limit applied across keys")
+	}
+
+	// Once the oldest event leaves the window another one is allowed
+	limiter.mu.Lock()
+	limiter.hits["a"][0] = time.Now().Add(-2 * time.Minute)
+	limiter.mu.Unlock()
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Error("event rejected after the oldest one left the window")
+	}
+	if ok, _ := limiter.allow("a"); ok {
+		t.Error("event over the limit allowed after the window slid")
+	}
+
+	// Idle keys are forgotten
+	limiter.mu.Lock()
+	limiter.hits["b"][0] = time.Now().Add(-2 * time.Minute)
+	limiter.mu.Unlock()
+	limiter.prune()
+	if _, ok := limiter.hits["b"]; ok {
+		t.Error("prune kept an idle key")
+	}
+	if _, ok := limiter.hits["a"]; !ok {
+		t.Error("prune dropped an active key")
+	}
+}
+
+func TestDisabledLimitersAllowEverything(t *testing.T) {
+	if limiter := newSlidingWindowLimiter(0, time.Minute); limiter != nil {
+		t.Fatal("a zero limit built a limiter")
+	}
+	var limiter *slidingWindowLimiter
+	if ok, _ := limiter.allow("a"); !ok {
+		t.Error("nil limiter rejected an event")
+	}
+	limiter.prune()
+
+	if tracker := newLockoutTracker(0, time.Minute, time.Minute, time.Hour); tracker != nil {
+		t.Fatal("zero max failures built a tracker")
+	}
+	var tracker *lockoutTracker
+	if lockout := tracker.recordFailure("a"); lockout != 0 {
+		t.Errorf("nil tracker locked out for %v", lockout)
+	}
+	if locked := tracker.lockedFor("a"); locked != 0 {
+		t.Errorf("nil tracker reports a lockout of %v", locked)
+	}
+	tracker.reset("a")
+	tracker.prune()
+}
+
+func TestLockoutTrackerBackoff(t *testing.T) {
+	tracker := newLockoutTracker(3, time.Minute, time.Minute, 5*time.Minute)
+
+	// expireLockout moves the key's lockout into the past, as if it had run out
+	expireLockout := func(key string) {
+		tracker.mu.Lock()
+		tracker.entries[key].lockedUntil = time.Now().Add(-time.Second)
+		tracker.mu.Unlock()
+	}
+	lockOut := func(key string) time.Duration {
+		t.Helper()
+		for i := 0; i < 2; i++ {
+			if lockout := tracker.recordFailure(key); lockout != 0 {
+				t.Fatalf("failure %d locked out for %v, want no lockout", i+1, lockout)
+			}
+		}
+		return tracker.recordFailure(key)
+	}
+
+	// Each consecutive lockout doubles, up to the maximum
+	for i, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute} {
+		if lockout := lockOut("a"); lockout != want {
+			t.Errorf("lockout %d = %v, want %v", i+1, lockout, want)
+		}
+		if locked := tracker.lockedFor("a"); locked <= 0 || locked > want {
+			t.Errorf("lockout %d: lockedFor = %v, want up to %v", i+1, locked, want)
+		}
+		expireLockout("a")
+	}
+	if locked := tracker.lockedFor("b"); locked != 0 {
+		t.Errorf("another key is locked out for %v", locked)
+	}
+
+	// A success starts over
+	tracker.reset("a")
+	if lockout := lockOut("a"); lockout != time.Minute {
+		t.Errorf("lockout after reset = %v, want %v", lockout, time.Minute)
+	}
+
+	// As does behaving for longer than the maximum lockout
+	tracker.mu.Lock()
+	tracker.entries["a"].lockedUntil = time.Now().Add(-6 * time.Minute)
+	tracker.mu.Unlock()
+	if lockout := lockOut("a"); lockout != time.Minute {
+		t.Errorf("lockout after a quiet period = %v, want %v", lockout, time.Minute)
+	}
+}
+
+func TestLockoutTrackerPrune(t *testing.T) {
+	tracker := newLockoutTracker(3, time.Minute, time.Minute, 5*time.Minute)
+
+	tracker.recordFailure("recent")
+	for i := 0; i < 3; i++ {
+		tracker.recordFailure("locked")
+	}
+	tracker.recordFailure("stale")
+	tracker.mu.Lock()
+	tracker.entries["stale"].failures[0] = time.Now().Add(-2 * time.Minute)
+	tracker.mu.Unlock()
+
+	tracker.prune()
+	for key, want := range map[string]bool{"recent": true, "locked": true, "stale": false} {
+		if _, ok := tracker.entries[key]; ok != want {
+			t.Errorf("after prune %q kept = %v, want %v", key, ok, want)
+		}
+	}
+}
+
+// Wrong admin keys lock out the client that sent them, never the key itself
+func TestAdminKeyLockoutIsPerIP(t *testing.T) {
+	s := newTestServer(t, enableLockouts)
+
+	const attacker, admin = "198.51.100.7:4000", "203.0.113.9:5000"
+	apiKeyRequest := func(remoteAddr, key string) int {
+		req := jsonRequest(t, http.MethodGet, "/api/auth/me", "", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-API-Key", key)
+		return s.serve(req).Code
+	}
+	keyLogin := func(remoteAddr, key string) int {
+		req := jsonRequest(t, http.MethodPost, "/api/auth/login", "", map[string]string{"api_key": key})
+		req.RemoteAddr = remoteAddr
+		return s.serve(req).Code
+	}
+
+	// Mixed header and login attempts share the attacker's IP lockout
+	for i, status := range []int{apiKeyRequest(attacker, "wrong-1"), keyLogin(attacker, "wrong-2"), apiKeyRequest(attacker, "wrong-3")} {
+		if status != http.StatusUnauthorized {
+			t.Fatalf("wrong key %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+	if status := apiKeyRequest(attacker, testAdminAPIKey); status != http.StatusTooManyRequests {
+		t.Errorf("correct key from the locked-out IP: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+	if status := keyLogin(attacker, testAdminAPIKey); status != http.StatusTooManyRequests {
+		t.Errorf("key login from the locked-out IP: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// The administrator elsewhere is unaffected
+	if status := apiKeyRequest(admin, testAdminAPIKey); status != http.StatusOK {
+		t.Errorf("correct key from another IP: status %d, want %d", status, http.StatusOK)
+	}
+	if status := keyLogin(admin, testAdminAPIKey); status != http.StatusOK {
+		t.Errorf("key login from another IP: status %d, want %d", status, http.StatusOK)
+	}
+}
+
+// Failed logins lock out both the client IP and the account
+func TestLoginLockout(t *testing.T) {
+	s := newTestServer(t, enableLockouts)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+
+	login := func(remoteAddr, password string) int {
+		req := jsonRequest(t, http.MethodPost, "/api/auth/login", "", models.UserLoginRequest{Email: user.Email, Password: password})
+		req.RemoteAddr = remoteAddr
+		return s.serve(req).Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if status := login("198.51.100.7:4000", "wrong password"); status != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d: status %d, want %d", i+1, status, http.StatusUnauthorized)
+		}
+	}
+	if status := login("203.0.113.9:5000", testPassword); status != http.StatusTooManyRequests {
+		t.Errorf("locked-out account from another IP: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+
+	// An IP locked out for one account is refused for every account
+	other := createTestUser(t, s, "other@example.com", models.RoleViewer)
+	req := jsonRequest(t, http.MethodPost, "/api/auth/login", "", models.UserLoginRequest{Email: other.Email, Password: testPassword})
+	req.RemoteAddr = "198.51.100.7:4000"
+	if status := s.serve(req).Code; status != http.StatusTooManyRequests {
+		t.Errorf("locked-out IP logging in to another account: status %d, want %d", status, http.StatusTooManyRequests)
+	}
+}
@@ -0,0 +1,264 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// Permissions checked by web API routes
+const (
+	permSitesRead   = "sites:read"   // View sites, status, history, analytics and stats
+	permSitesWrite  = "sites:write"  // Create and delete sites, trigger manual checks
+	permAgentsRead  = "agents:read"  // View registered agents
+	permAgentsAdmin = "agents:admin" // Register/delete agents and manage agent keys
+	permUsersAdmin  = "users:admin"  // Manage user accounts and roles
+	permAuditRead   = "audit:read"   // View the audit log
+)
+
+// rolePermissions maps each user role to the permissions it grants
+var rolePermissions = map[string][]string{
+	models.RoleViewer: {permSitesRead, permAgentsRead},
+	models.RoleEditor: {permSitesRead, permSitesWrite, permAgentsRead},
+	models.RoleAdmin:  {permSitesRead, permSitesWrite, permAgentsRead, permAgentsAdmin, permUsersAdmin, permAuditRead},
+}
+
+// tokenScopePermissions maps each personal access token scope to the permissions it grants
+var tokenScopePermissions = map[string][]string{
+	models.ScopeSitesRead:   {permSitesRead},
+	models.ScopeSitesWrite:  {permSitesRead, permSitesWrite},
+	models.ScopeAgentsAdmin: {permAgentsRead, permAgentsAdmin},
+}
+
+// can reports whether the principal has been granted a permission. Personal
+// access tokens are limited to their scopes and to their owner's role.
+func (p *authPrincipal) can(permission string) bool {
+	return containsString(p.permissions(), permission)
+}
+
+// permissions lists every permission granted to the principal
+func (p *authPrincipal) permissions() []string {
+	if p.Kind == principalMasterKey {
+		return rolePermissions[models.RoleAdmin]
+	}
+	if p.User == nil {
+		return []string{}
+	}
+	if p.Kind != principalToken {
+		return rolePermissions[p.User.Role]
+	}
+
+	granted := []string{}
+	for _, permission := range rolePermissions[p.User.Role] {
+		for _, scope := range p.Token.Scopes {
+			if containsString(tokenScopePermissions[scope], permission) {
+				granted = append(granted, permission)
+				break
+			}
+		}
+	}
+	return granted
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// roleRank orders roles by privilege; unknown roles rank lowest
+func roleRank(role string) int {
+	switch role {
+	case models.RoleViewer:
+		return 1
+	case models.RoleEditor:
+		return 2
+	case models.RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+// requirePermission rejects requests whose principal lacks the given permission.
+// It must run after webAuthMiddleware.
+func (s *Server) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal := principalFromContext(r.Context())
+			if principal == nil {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			if !principal.can(permission) {
+				http.Error(w, "Forbidden: missing permission "+permission, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// handleGetUsers lists all user accounts
+func (s *Server) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.db.GetUsers()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get users")
+		http.Error(w, "Failed to get users", http.StatusInternalServerError)
+		return
+	}
+
+	if users == nil {
+		users = []*models.User{}
+	}
+
+	s.writeJSON(w, users)
+}
+
+// handleUpdateUserRole changes a user's role
+func (s *Server) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	user := s.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	var req models.UserRoleUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Role = strings.ToLower(strings.TrimSpace(req.Role))
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if user.Role == models.RoleAdmin && req.Role != models.RoleAdmin {
+		if !s.guardLastAdmin(w, r, user) {
+			return
+		}
+	}
+
+	if err := s.db.UpdateUserRole(user.ID, req.Role); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to update user role")
+		http.Error(w, "Failed to update user role", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Str("from", user.Role).Str("to", req.Role).Msg("User role changed")
+
+	before := *user
+	user.Role = req.Role
+	s.audit(r, auditUserRole, "user", strconv.Itoa(user.ID), &before, user)
+
+	s.writeJSON(w, user)
+}
+
+// handleDisableUser disables a user account and ends its sessions
+func (s *Server) handleDisableUser(w http.ResponseWriter, r *http.Request) {
+	user := s.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	if user.Role == models.RoleAdmin && !user.Disabled {
+		if !s.guardLastAdmin(w, r, user) {
+			return
+		}
+	}
+
+	if err := s.db.SetUserDisabled(user.ID, true); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to disable user")
+		http.Error(w, "Failed to disable user", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.DeleteUserSessions(user.ID); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to revoke sessions of disabled user")
+	}
+
+	log.Info().Int("user_id", user.ID).Str("email", user.Email).Msg("User disabled")
+
+	before := *user
+	user.Disabled = true
+	s.audit(r, auditUserDisable, "user", strconv.Itoa(user.ID), &before, user)
+
+	s.writeJSON(w, user)
+}
+
+// handleEnableUser re-enables a disabled user account
+func (s *Server) handleEnableUser(w http.ResponseWriter, r *http.Request) {
+	user := s.userFromURL(w, r)
+	if user == nil {
+		return
+	}
+
+	if err := s.db.SetUserDisabled(user.ID, false); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to enable user")
+		http.Error(w, "Failed to enable user", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Str("email", user.Email).Msg("User enabled")
+
+	before := *user
+	user.Disabled = false
+	s.audit(r, auditUserEnable, "user", strconv.Itoa(user.ID), &before, user)
+
+	s.writeJSON(w, user)
+}
+
+// userFromURL loads the user named by the {id} URL parameter, writing an error response if it can't
+func (s *Server) userFromURL(w http.ResponseWriter, r *http.Request) *models.User {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return nil
+	}
+
+	user, err := s.db.GetUserByID(id)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", id).Msg("Failed to get user")
+		http.Error(w, "Failed to get user", http.StatusInternalServerError)
+		return nil
+	}
+	if user == nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil
+	}
+
+	return user
+}
+
+// guardLastAdmin prevents an admin from demoting or disabling themselves, and
+// keeps at least one active admin account. It writes an error response and
+// returns false when the change must be refused.
+func (s *Server) guardLastAdmin(w http.ResponseWriter, r *http.Request, target *models.User) bool {
+	if principal := principalFromContext(r.Context()); principal != nil && principal.User != nil && principal.User.ID == target.ID {
+		http.Error(w, "You cannot remove your own admin access", http.StatusBadRequest)
+		return false
+	}
+
+	admins, err := s.db.CountActiveAdmins()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to count admins")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return false
+	}
+	if admins <= 1 {
+		http.Error(w, "At least one active admin account is required", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+func TestPrincipalPermissions(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *authPrincipal
+		want      []string
+	}{
+		{"master key", &authPrincipal{Kind: principalMasterKey},
+			[]string{permSitesRead, permSitesWrite, permAgentsRead, permAgentsAdmin, permUsersAdmin, permAuditRead}},
+		{"admin session", &authPrincipal{Kind: principalSession, User: &models.User{Role: models.RoleAdmin}},
+			[]string{permSitesRead, permSitesWrite, permAgentsRead, permAgentsAdmin, permUsersAdmin, permAuditRead}},
+		{"editor session", &authPrincipal{Kind: principalSession, User: &models.User{Role: models.RoleEditor}},
+			[]string{permSitesRead, permSitesWrite, permAgentsRead}},
+		{"viewer session", &authPrincipal{Kind: principalSession, User: &models.User{Role: models.RoleViewer}},
+			[]string{permSitesRead, permAgentsRead}},
+		{"unknown role", &authPrincipal{Kind: principalSession, User: &models.User{Role: "user"}}, nil},
+		{"session without a user", &authPrincipal{Kind: principalSession}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.principal.permissions()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("permissions() = %v, want %v", got, tt.want)
+			}
+			for _, permission := range []string{permSitesRead, permSitesWrite, permAgentsRead, permAgentsAdmin, permUsersAdmin, permAuditRead} {
+				if tt.principal.can(permission) != containsString(tt.want, permission) {
+					t.Errorf("can(%s) = %v", permission, !containsString(tt.want, permission))
+				}
+			}
+		})
+	}
+}
+
+func TestRoleRank(t *testing.T) {
+	if !(roleRank(models.RoleViewer) < roleRank(models.RoleEditor) && roleRank(models.RoleEditor) < roleRank(models.RoleAdmin)) {
+		t.Error("roles are not ranked viewer < editor < admin")
+	}
+	if roleRank("superuser") >= roleRank(models.RoleViewer) {
+		t.Error("an unknown role ranks at or above viewer")
+	}
+}
+
+// Every route permission is granted to some role
+func TestRolePermissionsCoverRoutes(t *testing.T) {
+	for _, permission := range []string{permSitesRead, permSitesWrite, permAgentsRead, permAgentsAdmin, permUsersAdmin, permAuditRead} {
+		if !containsString(rolePermissions[models.RoleAdmin], permission) {
+			t.Errorf("admin lacks %s", permission)
+		}
+	}
+	for role, permissions := range rolePermissions {
+		for _, permission := range permissions {
+			if !containsString(rolePermissions[models.RoleAdmin], permission) {
+				t.Errorf("%s grants %s, which admin lacks", role, permission)
+			}
+		}
+	}
+}
+
+func TestRoutePermissionsByRole(t *testing.T) {
+	s := newTestServer(t, nil)
+	tokens := map[string]string{}
+	for _, role := range []string{models.RoleViewer, models.RoleEditor, models.RoleAdmin} {
+		tokens[role] = newSession(t, s, createTestUser(t, s, role+"@example.com", role))
+	}
+
+	routes := []struct {
+		method, path string
+		allowed      []string
+	}{
+		{http.MethodGet, "/api/sites", []string{models.RoleViewer, models.RoleEditor, models.RoleAdmin}},
+		{http.MethodPost, "/api/sites", []string{models.RoleEditor, models.RoleAdmin}},
+		{http.MethodDelete, "/api/sites/999", []string{models.RoleEditor, models.RoleAdmin}},
+		{http.MethodGet, "/api/agents", []string{models.RoleViewer, models.RoleEditor, models.RoleAdmin}},
+		{http.MethodPost, "/api/agents", []string{models.RoleAdmin}},
+		{http.MethodGet, "/api/users", []string{models.RoleAdmin}},
+		{http.MethodGet, "/api/audit", []string{models.RoleAdmin}},
+	}
+
+	for _, route := range routes {
+		for role, token := range tokens {
+			rec := s.serve(jsonRequest(t, route.method, route.path, token, map[string]string{}))
+			if forbidden := rec.Code == http.StatusForbidden; forbidden == containsString(route.allowed, role) {
+				t.Errorf("%s %s as %s: status %d", route.method, route.path, role, rec.Code)
+			}
+		}
+	}
+}
+
+func TestTokenPermissionsNeverExceedRole(t *testing.T) {
+	allScopes := []string{models.ScopeSitesRead, models.ScopeSitesWrite, models.ScopeAgentsAdmin}
+
+	tests := []struct {
+		role   string
+		scopes []string
+		want   []string
+	}{
+		{models.RoleAdmin, allScopes, []string{permSitesRead, permSitesWrite, permAgentsRead, permAgentsAdmin}},
+		{models.RoleAdmin, []string{models.ScopeSitesRead}, []string{permSitesRead}},
+		{models.RoleAdmin, []string{models.ScopeAgentsAdmin}, []string{permAgentsRead, permAgentsAdmin}},
+		{models.RoleEditor, allScopes, []string{permSitesRead, permSitesWrite, permAgentsRead}},
+		{models.RoleEditor, []string{models.ScopeSitesWrite}, []string{permSitesRead, permSitesWrite}},
+		{models.RoleViewer, allScopes, []string{permSitesRead, permAgentsRead}},
+		{models.RoleViewer, []string{models.ScopeSitesWrite}, []string{permSitesRead}},
+		{models.RoleViewer, nil, []string{}},
+		{models.RoleAdmin, []string{"users:admin", "audit:read"}, []string{}}, // no scope grants these
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.role+" "+strings.Join(tt.scopes, ","), func(t *testing.T) {
+			principal := &authPrincipal{
+				Kind:  principalToken,
+				User:  &models.User{Role: tt.role},
+				Token: &models.APIToken{Scopes: tt.scopes},
+			}
+			got := principal.permissions()
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("permissions() = %v, want %v", got, tt.want)
+			}
+			for _, permission := range got {
+				if !containsString(rolePermissions[tt.role], permission) {
+					t.Errorf("token grants %s beyond the %s role", permission, tt.role)
+				}
+			}
+		})
+	}
+}
+
+func TestAPITokenLimitedToOwnerRole(t *testing.T) {
+	s := newTestServer(t, nil)
+	user := createTestUser(t, s, "editor@example.com", models.RoleEditor)
+	session := newSession(t, s, user)
+
+	createToken := func(scopes ...string) *httptest.ResponseRecorder {
+		return s.serve(jsonRequest(t, http.MethodPost, "/api/tokens", session,
+			models.APITokenCreateRequest{Name: "ci", Scopes: scopes}))
+	}
+
+	// Scopes beyond the role are refused when the token is created
+	if rec := createToken(models.ScopeAgentsAdmin); rec.Code != http.StatusForbidden {
+		t.Errorf("agents:admin token for an editor: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+
+	rec := createToken(models.ScopeSitesWrite)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("create token: status %d: %s", rec.Code, rec.Body)
+	}
+	var created models.APITokenCreateResponse
+	decodeJSON(t, rec, &created)
+
+	deleteSite := func() int {
+		req := httptest.NewRequest(http.MethodDelete, "/api/sites/999", nil)
+		req.Header.Set("X-API-Key", created.Token)
+		return s.serve(req).Code
+	}
+	if status := deleteSite(); status != http.StatusNotFound {
+		t.Fatalf("sites:write token as editor: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	// and a later demotion narrows tokens already issued
+	if err := s.db.UpdateUserRole(user.ID, models.RoleViewer); err != nil {
+		t.Fatalf("UpdateUserRole: %v", err)
+	}
+	if status := deleteSite(); status != http.StatusForbidden {
+		t.Errorf("sites:write token after demotion to viewer: status %d, want %d", status, http.StatusForbidden)
+	}
+
+	// Tokens cannot mint further tokens
+	req := jsonRequest(t, http.MethodPost, "/api/tokens", created.Token, models.APITokenCreateRequest{Name: "nested", Scopes: []string{models.ScopeSitesRead}})
+	if status := s.serve(req).Code; status != http.StatusForbidden {
+		t.Errorf("token creating a token: status %d, want %d", status, http.StatusForbidden)
+	}
+}
@@ -60,6 +60,12 @@ type Server struct {
 	staticFS    embed.FS              // Next.js static files
 	appFS       embed.FS              // Next.js application files
 	upgrader    websocket.Upgrader    // WebSocket upgrader
+	secretKey   []byte                // AES-256 key for secrets stored in the database
+	email       *utils.EmailService   // Outgoing email (console or SMTP)
+	limits      *rateLimiters         // Request rate limits and login lockouts
+	oidc        *utils.OIDCProvider   // Single sign-on provider, nil when disabled
+
+	trustedProxies []*net.IPNet // Reverse proxies whose forwarding headers are believed
 
 	// External hostname/IP cache (5-minute TTL)
 	externalHostname   string
@@ -105,6 +111,62 @@ func ensureAgentAPIKey(cfg *config.Config) error {
 	return nil
 }
 
+// ensureEncryptionKey loads the key used to encrypt secrets at rest, generating one if needed
+func ensureEncryptionKey(cfg *config.Config) ([]byte, error) {
+	if cfg.Server.Auth.EncryptionKey != "" {
+		return utils.ParseEncryptionKey(cfg.Server.Auth.EncryptionKey)
+	}
+
+	keyFile := "encryption.key"
+
+	// Try to read existing key from file
+	if data, err := os.ReadFile(keyFile); err == nil {
+		return utils.ParseEncryptionKey(string(data))
+	}
+
+	// Generate and persist a new key
+	hexKey, err := generateSecureAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+
+	if err := os.WriteFile(keyFile, []byte(hexKey), 0600); err != nil {
+		return nil, fmt.Errorf("failed to save encryption key: %w", err)
+	}
+
+	log.Info().Str("file", keyFile).Msg("Generated new encryption key for secrets at rest")
+
+	return utils.ParseEncryptionKey(hexKey)
+}
+
+// ensureSetupToken generates the token that authorizes registering the first
+// account when none is configured and no account exists yet
+func ensureSetupToken(cfg *config.Config, db *database.DB) error {
+	if cfg.Server.Auth.SetupToken != "" {
+		return nil
+	}
+
+	userCount, err := db.CountUsers()
+	if err != nil {
+		return err
+	}
+	if userCount > 0 {
+		return nil
+	}
+
+	token, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		return err
+	}
+	cfg.Server.Auth.SetupToken = token
+
+	log.Warn().
+		Str("setup_token", token).
+		Msg("No accounts exist yet - register the first (admin) account with this setup token")
+
+	return nil
+}
+
 // New creates a new server instance
 func New(cfg *config.Config, staticFS, appFS embed.FS) (*Server, error) {
 	// Ensure agent API key exists
@@ -122,14 +184,46 @@ func New(cfg *config.Config, staticFS, appFS embed.FS) (*Server, error) {
 		Str("admin_api_key", cfg.Server.AdminAPIKey).
 		Msg("Admin API Key - use this key to access the web GUI")
 
+	// Load key used to encrypt secrets such as TOTP seeds
+	secretKey, err := ensureEncryptionKey(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to ensure encryption key: %w", err)
+	}
+
+	trustedProxies, err := parseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
 	// Initialize database
 	db, err := database.New(&cfg.Server.Database)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize database: %w", err)
 	}
 
+	if err := ensureSetupToken(cfg, db); err != nil {
+		return nil, fmt.Errorf("failed to ensure setup token: %w", err)
+	}
+
+	// Initialize outgoing email
+	emailService, err := utils.NewEmailServiceFromConfig(&cfg.Server.Email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize email service: %w", err)
+	}
+
+	// Initialize single sign-on if enabled; discovery happens on first use
+	var oidcProvider *utils.OIDCProvider
+	if oidcCfg := cfg.Server.Auth.OIDC; oidcCfg.Enabled {
+		// The callback URL must not come from request headers a client controls
+		if oidcCfg.RedirectURL == "" && cfg.Server.Email.BaseURL == "" {
+			return nil, fmt.Errorf("OIDC requires server.auth.oidc.redirect_url or server.email.base_url")
+		}
+		oidcProvider = utils.NewOIDCProvider(oidcCfg.IssuerURL, oidcCfg.ClientID, oidcCfg.ClientSecret, oidcCfg.Scopes, nil)
+		log.Info().Str("issuer", oidcCfg.IssuerURL).Msg("OIDC single sign-on enabled")
+	}
+
 	// Initialize monitor
-	mon := monitor.New(db, cfg)
+	mon := monitor.New(db, cfg, secretKey)
 
 	// Initialize auto-TLS if enabled
 	var autoTLSManager *autotls.Manager
@@ -153,6 +247,12 @@ func New(cfg *config.Config, staticFS, appFS embed.FS) (*Server, error) {
 		staticFS:   staticFS,
 		appFS:      appFS,
 		upgrader:   websocket.Upgrader{},
+		secretKey:  secretKey,
+		email:      emailService,
+		limits:     newRateLimiters(&cfg.Server.RateLimit),
+		oidc:       oidcProvider,
+
+		trustedProxies: trustedProxies,
 	}
 
 	// Setup routers
@@ -162,6 +262,15 @@ func New(cfg *config.Config, staticFS, appFS embed.FS) (*Server, error) {
 	// Start external hostname/IP cache refresh in background
 	go srv.startExternalCacheRefresh()
 
+	// Purge expired user sessions in background
+	go srv.startSessionCleanup()
+
+	// Purge audit events past their retention period
+	go srv.startAuditCleanup()
+
+	// Release rate limit state for idle clients
+	go srv.startRateLimitCleanup()
+
 	return srv, nil
 }
 
@@ -398,13 +507,14 @@ func (s *Server) setupWebRouter() {
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
-	r.Use(middleware.RealIP)
+	r.Use(s.realIPMiddleware)
+	r.Use(s.rateLimitMiddleware(s.limits.web, "web"))
 	r.Use(middleware.Timeout(60 * time.Second))
 
 	// CORS for web GUI
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"*"},
 		ExposedHeaders:   []string{"Link"},
 		AllowCredentials: true,
@@ -413,36 +523,96 @@ func (s *Server) setupWebRouter() {
 
 	// Web GUI API routes
 	r.Route("/api", func(r chi.Router) {
-		// Sites management
-		r.Route("/sites", func(r chi.Router) {
-			r.Get("/", s.handleGetSites)
-			r.Post("/", s.handleCreateSite)
-			r.Get("/status", s.handleGetSitesStatus)
-			r.Get("/{id}/history", s.handleGetSiteHistory)
-			r.Delete("/{id}", s.handleDeleteSite)
-			r.Get("/analytics", s.handleGetSitesAnalytics)
-		})
+		// Public endpoints
+		r.Get("/health", s.handleHealth)
 
-		// Agent management
-		r.Route("/agents", func(r chi.Router) {
-			r.Get("/", s.handleGetAgents)
-			r.Post("/", s.handleCreateAgent)
-			r.Delete("/{id}", s.handleDeleteAgent)
-			r.Get("/api-key", s.handleGetAgentAPIKey)
-			r.Post("/upgrade-key", s.handleUpgradeAgentKey)
+		// Push monitor reports, authenticated by the secret token in the URL
+		r.Get("/push/{token}", s.handlePush)
+		r.Post("/push/{token}", s.handlePush)
+		r.Route("/auth", func(r chi.Router) {
+			// Unauthenticated endpoints share a per-IP limit
+			r.Group(func(r chi.Router) {
+				r.Use(s.rateLimitMiddleware(s.limits.authIP, "auth"))
+				r.Post("/login", s.handleAuthLogin)
+				r.Post("/register", s.handleAuthRegister)
+				r.Post("/2fa/backup-code", s.handleTwoFactorBackupLogin)
+				r.Post("/forgot-password", s.handleForgotPassword)
+				r.Post("/reset-password", s.handleResetPassword)
+
+				// Single sign-on via an OpenID Connect provider
+				r.Get("/oidc", s.handleOIDCInfo)
+				r.Get("/oidc/login", s.handleOIDCLogin)
+				r.Get("/oidc/callback", s.handleOIDCCallback)
+				r.Post("/oidc/2fa", s.handleOIDCTwoFactor)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(s.webAuthMiddleware)
+				r.Post("/logout", s.handleAuthLogout)
+				r.Get("/me", s.handleAuthMe)
+				r.Post("/change-password", s.handleChangePassword)
+
+				// Two-factor authentication management
+				r.Post("/2fa/setup", s.handleTwoFactorSetup)
+				r.Post("/2fa/confirm", s.handleTwoFactorConfirm)
+				r.Post("/2fa/disable", s.handleTwoFactorDisable)
+			})
 		})
 
-		// Monitoring
-		r.Post("/check/manual", s.handleManualCheck)
-		r.Get("/stats", s.handleGetStats)
-		r.Get("/config", s.handleGetConfig)
-		r.Get("/cert", s.handleGetCertInfo)
-
-		// Health check
-		r.Get("/health", s.handleHealth)
-
-		// Authentication
-		r.Post("/auth/login", s.handleAuthLogin)
+		// Everything else requires an admin API key or session token
+		r.Group(func(r chi.Router) {
+			r.Use(s.webAuthMiddleware)
+
+			// Sites management
+			r.Route("/sites", func(r chi.Router) {
+				r.With(s.requirePermission(permSitesRead)).Get("/", s.handleGetSites)
+				r.With(s.requirePermission(permSitesWrite)).Post("/", s.handleCreateSite)
+				r.With(s.requirePermission(permSitesRead)).Get("/status", s.handleGetSitesStatus)
+				r.With(s.requirePermission(permSitesRead)).Get("/{id}/history", s.handleGetSiteHistory)
+				r.With(s.requirePermission(permSitesRead)).Get("/{id}/content-changes", s.handleGetContentChanges)
+				r.With(s.requirePermission(permSitesWrite)).Put("/{id}", s.handleUpdateSite)
+				r.With(s.requirePermission(permSitesWrite)).Patch("/{id}", s.handleUpdateSite)
+				r.With(s.requirePermission(permSitesWrite)).Delete("/{id}", s.handleDeleteSite)
+				r.With(s.requirePermission(permSitesWrite)).Post("/{id}/pause", s.handlePauseSite)
+				r.With(s.requirePermission(permSitesWrite)).Post("/{id}/resume", s.handleResumeSite)
+				r.With(s.requirePermission(permSitesWrite)).Post("/{id}/push-token", s.handleRotatePushToken)
+				r.With(s.requirePermission(permSitesRead)).Get("/analytics", s.handleGetSitesAnalytics)
+			})
+
+			// Agent management
+			r.Route("/agents", func(r chi.Router) {
+				r.With(s.requirePermission(permAgentsRead)).Get("/", s.handleGetAgents)
+				r.With(s.requirePermission(permAgentsAdmin)).Post("/", s.handleCreateAgent)
+				r.With(s.requirePermission(permAgentsAdmin)).Delete("/{id}", s.handleDeleteAgent)
+				r.With(s.requirePermission(permAgentsAdmin)).Get("/api-key", s.handleGetAgentAPIKey)
+				r.With(s.requirePermission(permAgentsAdmin)).Post("/upgrade-key", s.handleUpgradeAgentKey)
+			})
+
+			// User management
+			r.Route("/users", func(r chi.Router) {
+				r.Use(s.requirePermission(permUsersAdmin))
+				r.Get("/", s.handleGetUsers)
+				r.Put("/{id}/role", s.handleUpdateUserRole)
+				r.Post("/{id}/disable", s.handleDisableUser)
+				r.Post("/{id}/enable", s.handleEnableUser)
+			})
+
+			r.With(s.requirePermission(permAuditRead)).Get("/audit", s.handleGetAuditEvents)
+
+			r.Route("/tokens", func(r chi.Router) {
+				r.Get("/", s.handleGetAPITokens)
+				r.Post("/", s.handleCreateAPIToken)
+				r.Get("/{id}", s.handleGetAPIToken)
+				r.Patch("/{id}", s.handleUpdateAPIToken)
+				r.Delete("/{id}", s.handleRevokeAPIToken)
+			})
+
+			// Monitoring
+			r.With(s.requirePermission(permSitesWrite)).Post("/check/manual", s.handleManualCheck)
+			r.With(s.requirePermission(permSitesRead)).Get("/stats", s.handleGetStats)
+			r.With(s.requirePermission(permSitesRead)).Get("/config", s.handleGetConfig)
+			r.With(s.requirePermission(permSitesRead)).Get("/cert", s.handleGetCertInfo)
+		})
 	})
 
 	// Serve Next.js static files
@@ -703,11 +873,7 @@ func (s *Server) handleGetSites(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	// Ensure we return an empty array instead of null
-	if sites == nil {
-		sites = []*models.Site{}
-	}
-	s.writeJSON(w, sites)
+	s.writeJSON(w, publicSites(sites))
 }
 
 func (s *Server) handleCreateSite(w http.ResponseWriter, r *http.Request) {
@@ -722,6 +888,22 @@ func (s *Server) handleCreateSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := s.checkSiteTarget(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err := checkConfigPrivileges(r, req.Config, nil); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	sealed, err := s.sealMonitorConfig(req.Config, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.Config = sealed
+
 	site, err := s.db.AddSite(&req)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE constraint failed") {
@@ -732,6 +914,23 @@ func (s *Server) handleCreateSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.audit(r, auditSiteCreate, "site", strconv.Itoa(site.ID), nil, publicSite(site))
+
+	response := map[string]interface{}{
+		"id":      site.ID,
+		"message": "Site added successfully",
+		"site":    publicSite(site),
+	}
+	// The push URL holds a secret, so it is only shown now and when rotated
+	if strings.HasPrefix(site.URL, "push://") {
+		pushURL, err := s.issuePushToken(r, site.ID)
+		if err != nil {
+			log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to issue push token")
+		} else {
+			response["push_url"] = pushURL
+		}
+	}
+
 	// Immediately broadcast new tasks to connected agents
 	go func() {
 		// Get the new monitoring tasks for this site
@@ -760,11 +959,7 @@ func (s *Server) handleCreateSite(w http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
-	s.writeJSON(w, map[string]interface{}{
-		"id":      site.ID,
-		"message": "Site added successfully",
-		"site":    site,
-	})
+	s.writeJSON(w, response)
 }
 
 func (s *Server) handleGetSitesStatus(w http.ResponseWriter, r *http.Request) {
@@ -805,6 +1000,206 @@ func (s *Server) handleGetSiteHistory(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, history)
 }
 
+// handleUpdateSite edits a site in place, keeping its history. PUT replaces
+// every field; PATCH changes only the fields present in the body.
+func (s *Server) handleUpdateSite(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return
+	}
+
+	site, err := s.db.GetSite(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	var req *models.SiteCreateRequest
+	configChanged := true
+	if r.Method == http.MethodPatch {
+		var patch models.SiteUpdateRequest
+		if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req = patch.ApplyTo(site)
+		configChanged = patch.Config != nil
+	} else {
+		req = &models.SiteCreateRequest{}
+		if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.checkSiteTarget(req.URL); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// An unchanged configuration is already sealed
+	if configChanged {
+		if err := checkConfigPrivileges(r, req.Config, site.Config); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if req.Config, err = s.sealMonitorConfig(req.Config, site.Config); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	updated, err := s.db.UpdateSite(id, req)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE constraint failed") || strings.Contains(err.Error(), "duplicate key") {
+			http.Error(w, "Site with this URL already exists", http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if updated == nil {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	s.audit(r, auditSiteUpdate, "site", idStr, publicSite(site), publicSite(updated))
+	s.resetContentBaseline(site, updated)
+
+	response := map[string]interface{}{
+		"id":      updated.ID,
+		"message": "Site updated successfully",
+		"site":    publicSite(updated),
+	}
+	// A site that just became a push monitor needs a token
+	if strings.HasPrefix(updated.URL, "push://") {
+		push, err := s.db.GetPushMonitor(updated.ID)
+		if err != nil {
+			log.Error().Err(err).Int("site_id", updated.ID).Msg("Failed to get push monitor")
+		} else if push == nil {
+			if pushURL, err := s.issuePushToken(r, updated.ID); err != nil {
+				log.Error().Err(err).Int("site_id", updated.ID).Msg("Failed to issue push token")
+			} else {
+				response["push_url"] = pushURL
+			}
+		}
+	}
+
+	// Push the rewritten task to agents and restart server-side polling for this site only
+	go func() {
+		tasks, err := s.db.GetTasksForSite(updated.ID)
+		if err != nil {
+			log.Error().Err(err).Int("site_id", updated.ID).Msg("Failed to get tasks after updating site")
+		}
+		for _, task := range tasks {
+			log.Info().
+				Int("site_id", updated.ID).
+				Int("task_id", task.ID).
+				Str("monitor_type", task.MonitorType).
+				Str("url", task.URL).
+				Msg("📝 Broadcasting updated monitoring task to agents")
+			s.broadcastTaskToAgents(task)
+		}
+
+		if err := s.monitor.RestartSiteMonitoring(updated); err != nil {
+			log.Error().Err(err).Int("site_id", updated.ID).Msg("Failed to restart monitoring after updating site")
+		}
+	}()
+
+	s.writeJSON(w, response)
+}
+
+// handlePauseSite stops monitoring a site without deleting it or its history
+func (s *Server) handlePauseSite(w http.ResponseWriter, r *http.Request) {
+	s.setSitePaused(w, r, true)
+}
+
+// handleResumeSite restarts monitoring of a paused site
+func (s *Server) handleResumeSite(w http.ResponseWriter, r *http.Request) {
+	s.setSitePaused(w, r, false)
+}
+
+// setSitePaused flips a site's monitoring tasks, then tells agents and the
+// server-side monitor to stop or start checking it
+func (s *Server) setSitePaused(w http.ResponseWriter, r *http.Request, paused bool) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid site ID", http.StatusBadRequest)
+		return
+	}
+
+	site, err := s.db.GetSite(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
+	action, message, unchanged := auditSiteResume, "Site resumed", "Site is not paused"
+	if paused {
+		action, message, unchanged = auditSitePause, "Site paused", "Site is already paused"
+	}
+
+	changed, err := s.db.SetSitePaused(id, paused)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !changed {
+		s.writeJSON(w, map[string]interface{}{
+			"id":      site.ID,
+			"message": unchanged,
+			"site":    publicSite(site),
+		})
+		return
+	}
+
+	before := *site
+	site.Paused = paused
+	s.audit(r, action, "site", idStr, publicSite(&before), publicSite(site))
+
+	go func() {
+		tasks, err := s.db.GetTasksForSite(site.ID)
+		if err != nil {
+			log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to get tasks after pausing or resuming site")
+		}
+		for _, task := range tasks {
+			if paused {
+				s.removeTaskFromAgents(task.ID)
+			} else {
+				s.broadcastTaskToAgents(task)
+			}
+		}
+
+		if err := s.monitor.RestartSiteMonitoring(site); err != nil {
+			log.Error().Err(err).Int("site_id", site.ID).Msg("Failed to restart monitoring after resuming site")
+		}
+	}()
+
+	log.Info().Int("site_id", site.ID).Bool("paused", paused).Msg(message)
+
+	s.writeJSON(w, map[string]interface{}{
+		"id":      site.ID,
+		"message": message,
+		"site":    publicSite(site),
+	})
+}
+
 func (s *Server) handleDeleteSite(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(idStr)
@@ -813,6 +1208,16 @@ func (s *Server) handleDeleteSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	site, err := s.db.GetSite(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if site == nil {
+		http.Error(w, "Site not found", http.StatusNotFound)
+		return
+	}
+
 	if err := s.db.DeleteSite(id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Site not found", http.StatusNotFound)
@@ -822,6 +1227,8 @@ func (s *Server) handleDeleteSite(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.audit(r, auditSiteDelete, "site", idStr, publicSite(site), nil)
+
 	// Async refresh monitoring
 	go func() {
 		if err := s.monitor.RefreshMonitoring(); err != nil {
@@ -891,6 +1298,9 @@ func (s *Server) handleCreateAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	agent.APIKeyHash = keyHash
+	s.audit(r, auditAgentCreate, "agent", strconv.Itoa(agent.ID), nil, agent)
+
 	s.writeJSON(w, map[string]interface{}{
 		"id":      agent.ID,
 		"message": "Agent created successfully",
@@ -906,6 +1316,16 @@ func (s *Server) handleDeleteAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	agent, err := s.db.GetAgent(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if agent == nil {
+		http.Error(w, "Agent not found", http.StatusNotFound)
+		return
+	}
+
 	if err := s.db.DeleteAgent(id); err != nil {
 		if strings.Contains(err.Error(), "not found") {
 			http.Error(w, "Agent not found", http.StatusNotFound)
@@ -915,6 +1335,8 @@ func (s *Server) handleDeleteAgent(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	s.audit(r, auditAgentDelete, "agent", idStr, agent, nil)
+
 	s.writeJSON(w, map[string]string{"message": "Agent deleted successfully"})
 }
 
@@ -924,6 +1346,8 @@ func (s *Server) handleManualCheck(w http.ResponseWriter, r *http.Request) {
 		req.SiteIDs = nil
 	}
 
+	s.audit(r, auditSiteCheck, "site", "", nil, req)
+
 	// Async check
 	go func() {
 		results, err := s.monitor.CheckSitesByID(req.SiteIDs)
@@ -1107,35 +1531,6 @@ func (s *Server) handleGetSitesAnalytics(w http.ResponseWriter, r *http.Request)
 	s.writeJSON(w, analyticsData)
 }
 
-// handleAuthLogin handles admin authentication
-func (s *Server) handleAuthLogin(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		APIKey string `json:"apiKey"`
-	}
-
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-		return
-	}
-
-	// Validate admin API key
-	if req.APIKey == "" {
-		http.Error(w, "API key is required", http.StatusBadRequest)
-		return
-	}
-
-	if req.APIKey != s.config.Server.AdminAPIKey {
-		http.Error(w, "Invalid API key", http.StatusUnauthorized)
-		return
-	}
-
-	// Return success response
-	s.writeJSON(w, map[string]interface{}{
-		"success": true,
-		"message": "Authentication successful",
-	})
-}
-
 // Agent WebSocket message handlers
 func (s *Server) handleAgentHeartbeatWS(conn *AgentConn, msg map[string]interface{}) {
 	log.Debug().Str("agent_id", conn.AgentID).Msg("Received WebSocket heartbeat")
@@ -1247,8 +1642,13 @@ func (s *Server) agentAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		if s.agentKeyLockedOut(w, r) {
+			return
+		}
+
 		// Validate against server's agent API key
 		if apiKey != s.config.Server.AgentAPIKey {
+			s.recordInvalidAgentKey(r)
 			http.Error(w, "Invalid API key", http.StatusUnauthorized)
 			return
 		}
@@ -1276,9 +1676,14 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if s.agentKeyLockedOut(w, r) {
+		return
+	}
+
 	// Validate API key
 	if apiKey != s.config.Server.AgentAPIKey {
-		log.Warn().Str("api_key", apiKey[:8]+"...").Str("remote_ip", remoteIP).Msg("WebSocket connection attempt with invalid API key")
+		log.Warn().Str("api_key", truncateKey(apiKey)).Str("remote_ip", remoteIP).Msg("WebSocket connection attempt with invalid API key")
+		s.recordInvalidAgentKey(r)
 		http.Error(w, "Invalid API key", http.StatusUnauthorized)
 		return
 	}
@@ -1540,7 +1945,8 @@ func (s *Server) handleGetAgentAPIKey(w http.ResponseWriter, r *http.Request) {
 
 // getServerURL attempts to determine the server's URL from the request or external services
 func (s *Server) getServerURL(r *http.Request) string {
-	// First, try to get from request headers (for reverse proxy scenarios)
+	// First, try to get from request headers (for reverse proxy scenarios);
+	// realIPMiddleware removes them unless a trusted proxy sent them
 	if host := r.Header.Get("X-Forwarded-Host"); host != "" {
 		scheme := "https"
 		if r.Header.Get("X-Forwarded-Proto") == "http" {
@@ -1689,6 +2095,8 @@ func (s *Server) handleMonitoringResultWS(agentConn *AgentConn, msg map[string]i
 		return
 	}
 
+	s.recordResultContent(&result)
+
 	// Store result in database
 	if err := s.db.RecordMonitorResult(&result, agent.ID); err != nil {
 		log.Error().Err(err).Str("agent_id", agentConn.AgentID).Int("task_id", taskID).Msg("Failed to store monitoring result")
@@ -1736,7 +2144,7 @@ func (s *Server) handleRequestTasksWS(agentConn *AgentConn, msg map[string]inter
 	}
 
 	// Get monitoring tasks for this agent
-	tasks, err := s.db.GetTasksForAgent(agent.ID)
+	tasks, err := s.tasksForAgent(agent.ID)
 	if err != nil {
 		log.Error().Err(err).Str("agent_id", agentConn.AgentID).Msg("Failed to get monitoring tasks for agent")
 		return
@@ -1772,7 +2180,7 @@ func (s *Server) broadcastTaskToAgents(task *models.MonitorTask) {
 			}
 
 			// Get all tasks for this agent to send updated list
-			tasks, err := s.db.GetTasksForAgent(agent.ID)
+			tasks, err := s.tasksForAgent(agent.ID)
 			if err != nil {
 				log.Error().Err(err).Str("agent_id", agentConn.AgentID).Msg("Failed to get tasks for broadcast")
 				continue
@@ -1923,7 +2331,7 @@ func (s *Server) handleGetMonitoringTasks(w http.ResponseWriter, r *http.Request
 	}
 
 	// Get monitoring tasks for this agent
-	tasks, err := s.db.GetTasksForAgent(agent.ID)
+	tasks, err := s.tasksForAgent(agent.ID)
 	if err != nil {
 		log.Error().Err(err).Int("agent_id", agent.ID).Msg("Failed to get monitoring tasks for agent")
 		http.Error(w, "Failed to get monitoring tasks", http.StatusInternalServerError)
@@ -1986,6 +2394,7 @@ func (s *Server) handleSubmitMonitoringResults(w http.ResponseWriter, r *http.Re
 			result.CheckedAt = time.Now()
 		}
 
+		s.recordResultContent(&result)
 		if err := s.db.RecordMonitorResult(&result, agent.ID); err != nil {
 			log.Error().Err(err).Int("agent_id", agent.ID).Int("task_id", result.TaskID).Msg("Failed to store monitoring result")
 			continue
@@ -2155,6 +2564,8 @@ func (s *Server) setupAgentRouter() {
 	// Minimal middleware for agents
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
+	r.Use(s.realIPMiddleware)
+	r.Use(s.rateLimitMiddleware(s.limits.agent, "agent"))
 
 	// Health endpoint for agent connectivity testing (no auth required)
 	r.Get("/api/health", s.handleAgentHealth)
@@ -2169,6 +2580,9 @@ func (s *Server) setupAgentRouter() {
 		// Agent checkin endpoint (HTTP fallback)
 		r.Post("/api/agents/checkin", s.handleAgentCheckin)
 
+		// Bootstrap key upgrade (the web API copy requires admin credentials)
+		r.Post("/api/agents/upgrade-key", s.handleUpgradeAgentKey)
+
 		// Agent API routes (HTTP fallback)
 		r.Route("/api/agent", func(r chi.Router) {
 			r.Post("/register", s.handleAgentRegister)
@@ -2187,34 +2601,102 @@ func (s *Server) setupAgentRouter() {
 	s.agentRouter = r
 }
 
-// extractRemoteIP extracts the real remote IP address from the request
-// Handles X-Forwarded-For, X-Real-IP headers for proxy scenarios
+// extractRemoteIP returns the client IP of a request. Forwarding headers are
+// only honoured by realIPMiddleware for trusted proxies, which rewrites
+// RemoteAddr, so RemoteAddr is all that is read here.
 func extractRemoteIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for proxies)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// X-Forwarded-For can contain multiple IPs, take the first one
-		ips := strings.Split(xff, ",")
-		if len(ips) > 0 {
-			ip := strings.TrimSpace(ips[0])
-			if net.ParseIP(ip) != nil {
-				return ip
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr // Return as-is if we can't split
+	}
+	return host
+}
+
+// forwardingHeaders are the headers a reverse proxy uses to describe the
+// original request
+var forwardingHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-IP"}
+
+// requestIsHTTPS reports whether the client reached the server over HTTPS,
+// directly or through a trusted proxy that terminated TLS
+func requestIsHTTPS(r *http.Request) bool {
+	return r.TLS != nil || strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https")
+}
+
+// parseTrustedProxies parses the trusted_proxies setting; a bare IP trusts that address only
+func parseTrustedProxies(entries []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", entry)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
 			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
 		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", entry, err)
+		}
+		networks = append(networks, network)
 	}
+	return networks, nil
+}
 
-	// Check X-Real-IP header (for proxies)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		if net.ParseIP(xri) != nil {
-			return xri
+// isTrustedProxy reports whether ip belongs to a configured trusted proxy
+func (s *Server) isTrustedProxy(ip net.IP) bool {
+	for _, network := range s.trustedProxies {
+		if network.Contains(ip) {
+			return true
 		}
 	}
+	return false
+}
 
-	// Fall back to RemoteAddr
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err != nil {
-		return r.RemoteAddr // Return as-is if we can't split
-	}
-	return host
+// realIPMiddleware replaces RemoteAddr with the client address reported by a
+// trusted reverse proxy. X-Forwarded-For is read from the right, skipping
+// trusted proxies, because anything left of the last trusted hop was written
+// by the client. Requests from other peers keep their RemoteAddr and lose
+// their forwarding headers, so clients cannot choose the IP that rate limits
+// and lockouts key on, and handlers may believe the headers that remain.
+func (s *Server) realIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer := net.ParseIP(extractRemoteIP(r))
+		if peer == nil || !s.isTrustedProxy(peer) {
+			for _, header := range forwardingHeaders {
+				r.Header.Del(header)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var client net.IP
+		if xff := r.Header.Values("X-Forwarded-For"); len(xff) > 0 {
+			hops := strings.Split(strings.Join(xff, ","), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				ip := net.ParseIP(strings.TrimSpace(hops[i]))
+				if ip == nil {
+					break
+				}
+				client = ip
+				if !s.isTrustedProxy(ip) {
+					break
+				}
+			}
+		} else if ip := net.ParseIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ip != nil {
+			client = ip
+		}
+
+		if client != nil {
+			r.RemoteAddr = net.JoinHostPort(client.String(), "0")
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (s *Server) handleUpgradeAgentKey(w http.ResponseWriter, r *http.Request) {
@@ -2246,6 +2728,13 @@ func (s *Server) handleUpgradeAgentKey(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	agent, err := s.db.GetAgentByKeyHash(currentKeyHash)
+	if err != nil {
+		log.Error().Err(err).Str("key_hash", currentKeyHash).Msg("Failed to look up agent for key upgrade")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
 	// Generate a new permanent API key
 	newAPIKey, err := generateSecureAPIKey()
 	if err != nil {
@@ -2269,6 +2758,22 @@ func (s *Server) handleUpgradeAgentKey(w http.ResponseWriter, r *http.Request) {
 		Str("new_key_hash", newKeyHash[:8]+"...").
 		Msg("Successfully upgraded agent key from bootstrap to permanent")
 
+	// Agents upgrade their own key over the agent port; admins use the web API
+	actor := actorFromRequest(r)
+	if principalFromContext(r.Context()) == nil {
+		actor = auditActor{Type: models.ActorAgent, ID: req.AgentID}
+	}
+	targetID := req.AgentID
+	if agent != nil {
+		targetID = strconv.Itoa(agent.ID)
+		if actor.Type == models.ActorAgent {
+			actor.Name = agent.Name
+		}
+	}
+	s.auditAs(r, actor, auditAgentKeyUpgrade, "agent", targetID,
+		map[string]string{"key_type": "bootstrap", "api_key_hash": currentKeyHash[:8] + "..."},
+		map[string]string{"key_type": "permanent", "api_key_hash": newKeyHash[:8] + "..."})
+
 	// Return the new key
 	response := models.AgentKeyUpgradeResponse{
 		Success:       true,
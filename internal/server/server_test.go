@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/config"
+	"github.com/x86txt/sreootb/internal/database"
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+const (
+	// testAdminAPIKey is the master key of servers built by newTestServer
+	testAdminAPIKey = "test-admin-key-0123456789abcdef0123456789abcdef"
+
+	// testPassword is the password of accounts made by createTestUser
+	testPassword = "correct horse battery staple"
+)
+
+// newTestServer builds a server on a fresh SQLite database without starting
+// listeners or background jobs. configure may adjust the configuration first.
+func newTestServer(t *testing.T, configure func(cfg *config.Config)) *Server {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Server.Database = config.DatabaseConfig{Type: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "sreootb.db")}
+	cfg.Server.AdminAPIKey = testAdminAPIKey
+	if configure != nil {
+		configure(cfg)
+	}
+
+	db, err := database.New(&cfg.Server.Database)
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	secretKey := make([]byte, 32)
+	if _, err := rand.Read(secretKey); err != nil {
+		t.Fatalf("generate secret key: %v", err)
+	}
+
+	s := &Server{
+		config:     cfg,
+		db:         db,
+		agentConns: make(map[string]*AgentConn),
+		secretKey:  secretKey,
+		email:      utils.NewEmailService(false),
+		limits:     newRateLimiters(&cfg.Server.RateLimit),
+	}
+	if oidcCfg := cfg.Server.Auth.OIDC; oidcCfg.Enabled {
+		s.oidc = utils.NewOIDCProvider(oidcCfg.IssuerURL, oidcCfg.ClientID, oidcCfg.ClientSecret, oidcCfg.Scopes, nil)
+	}
+	s.setupWebRouter()
+
+	return s
+}
+
+// enableLockouts turns on login lockouts after three failures, without request rate limits
+func enableLockouts(cfg *config.Config) {
+	cfg.Server.RateLimit = config.RateLimitConfig{
+		Enabled:            true,
+		MaxFailures:        3,
+		FailureWindow:      time.Minute,
+		LockoutDuration:    time.Minute,
+		MaxLockoutDuration: time.Hour,
+	}
+}
+
+// serve runs a request through the web router
+func (s *Server) serve(req *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.webRouter.ServeHTTP(rec, req)
+	return rec
+}
+
+// createTestUser adds an account with the given role
+func createTestUser(t *testing.T, s *Server, email, role string) *models.User {
+	t.Helper()
+
+	hash, err := utils.HashPassword(testPassword)
+	if err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	user, err := s.db.CreateUser(&models.UserRegistrationRequest{Email: email, FirstName: "Test", LastName: "User"}, hash, role)
+	if err != nil {
+		t.Fatalf("create user %s: %v", email, err)
+	}
+	return user
+}
+
+// newSession logs a user in directly and returns the session token
+func newSession(t *testing.T, s *Server, user *models.User) string {
+	t.Helper()
+
+	token, err := s.createUserSession(httptest.NewRequest(http.MethodPost, "/api/auth/login", nil), user.ID, false)
+	if err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+	return token
+}
+
+// jsonRequest builds an API request with a JSON body, authenticated with
+// token as a bearer credential unless it is empty
+func jsonRequest(t *testing.T, method, path, token string, body interface{}) *http.Request {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode request body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+// decodeJSON decodes a response body into v
+func decodeJSON(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+}
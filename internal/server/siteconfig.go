@@ -0,0 +1,128 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// sealMonitorConfig encrypts the secrets of a submitted check configuration
+// for storage. Secrets sent back as models.RedactedSecret keep the value
+// stored in previous, the site's current configuration.
+func (s *Server) sealMonitorConfig(config, previous *models.MonitorConfig) (*models.MonitorConfig, error) {
+	stored := previous.SecretValues()
+
+	return config.TransformSecrets(func(name, value string) (string, error) {
+		if value == models.RedactedSecret {
+			if existing, ok := stored[name]; ok {
+				return existing, nil
+			}
+			return "", fmt.Errorf("has no stored value to keep")
+		}
+		return utils.EncryptSecret(value, s.secretKey)
+	})
+}
+
+// checkConfigPrivileges refuses check settings only admins may change: file
+// paths read on the host that runs the check. Paths already stored in
+// previous, the site's current configuration, may be sent back unchanged.
+func checkConfigPrivileges(r *http.Request, config, previous *models.MonitorConfig) error {
+	if principal := principalFromContext(r.Context()); principal != nil && principal.isAdmin() {
+		return nil
+	}
+	if files := hostFiles(config); len(files) > 0 && !slices.Equal(files, hostFiles(previous)) {
+		return fmt.Errorf("only admins can set ca_file, client_cert_file and client_key_file")
+	}
+	return nil
+}
+
+// checkSiteTarget refuses sqlite:// sites for files not allowed in
+// server.sqlite_monitors
+func (s *Server) checkSiteTarget(siteURL string) error {
+	if path, ok := strings.CutPrefix(siteURL, "sqlite://"); ok && !s.config.Server.SQLiteMonitorAllowed(path) {
+		return fmt.Errorf("sqlite:// sites may only open files listed in server.sqlite_monitors")
+	}
+	return nil
+}
+
+// hostFiles lists the host file paths a check configuration reads
+func hostFiles(config *models.MonitorConfig) []string {
+	if config == nil || config.GRPC == nil {
+		return nil
+	}
+	return config.GRPC.HostFiles()
+}
+
+// publicSite returns a copy of a site with check configuration secrets redacted
+func publicSite(site *models.Site) *models.Site {
+	if site == nil || site.Config == nil {
+		return site
+	}
+	public := *site
+	public.Config = site.Config.Redacted()
+	return &public
+}
+
+// publicSites redacts check configuration secrets of every site
+func publicSites(sites []*models.Site) []*models.Site {
+	public := make([]*models.Site, len(sites))
+	for i, site := range sites {
+		public[i] = publicSite(site)
+	}
+	return public
+}
+
+// tasksForAgent returns an agent's monitoring tasks with secrets decrypted so
+// the agent can use them. Secrets that fail to decrypt are left out.
+func (s *Server) tasksForAgent(agentID int) ([]*models.MonitorTask, error) {
+	tasks, err := s.db.GetTasksForAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, task := range tasks {
+		if task.Config == nil {
+			continue
+		}
+		decrypted, err := task.Config.TransformSecrets(func(name, value string) (string, error) {
+			plaintext, err := utils.DecryptSecret(value, s.secretKey)
+			if err != nil {
+				log.Error().Err(err).Int("task_id", task.ID).Str("header", name).Msg("Failed to decrypt task secret")
+				return "", nil
+			}
+			return plaintext, nil
+		})
+		if err != nil {
+			continue
+		}
+		if decrypted.HTTP != nil {
+			dropEmptyHeaders(decrypted.HTTP.SecretHeaders)
+		}
+		if decrypted.WebSocket != nil {
+			dropEmptyHeaders(decrypted.WebSocket.SecretHeaders)
+		}
+		if decrypted.Transaction != nil {
+			for _, step := range decrypted.Transaction.Steps {
+				dropEmptyHeaders(step.SecretHeaders)
+			}
+		}
+		task.Config = decrypted
+	}
+
+	return tasks, nil
+}
+
+// dropEmptyHeaders removes headers whose secret could not be decrypted
+func dropEmptyHeaders(headers map[string]string) {
+	for name, value := range headers {
+		if value == "" {
+			delete(headers, name)
+		}
+	}
+}
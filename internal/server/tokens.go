@@ -0,0 +1,238 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+// apiTokenLastUsedInterval limits how often token usage is written back to the database
+const apiTokenLastUsedInterval = time.Minute
+
+// authenticateAPIToken resolves a personal access token into a principal.
+// Revoked or expired tokens and tokens of disabled users are rejected.
+func (s *Server) authenticateAPIToken(r *http.Request, rawToken string) (*authPrincipal, error) {
+	token, err := s.db.GetAPITokenByHash(utils.HashAPIKey(rawToken))
+	if err != nil {
+		return nil, err
+	}
+	if token == nil || !token.IsActive() {
+		return nil, nil
+	}
+
+	user, err := s.db.GetUserByID(token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil || user.Disabled {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= apiTokenLastUsedInterval {
+		remoteIP := extractRemoteIP(r)
+		go func(id int) {
+			if err := s.db.UpdateAPITokenLastUsed(id, now, remoteIP); err != nil {
+				log.Warn().Err(err).Int("token_id", id).Msg("Failed to record API token use")
+			}
+		}(token.ID)
+	}
+
+	return &authPrincipal{Kind: principalToken, User: user, Token: token}, nil
+}
+
+// handleGetAPITokens lists the current user's personal access tokens
+func (s *Server) handleGetAPITokens(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	tokens, err := s.db.GetAPITokensForUser(user.ID)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to get API tokens")
+		http.Error(w, "Failed to get API tokens", http.StatusInternalServerError)
+		return
+	}
+
+	if tokens == nil {
+		tokens = []*models.APIToken{}
+	}
+
+	s.writeJSON(w, tokens)
+}
+
+// handleCreateAPIToken issues a new personal access token for the current user.
+// The plaintext token is only returned in this response.
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req models.APITokenCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A token can never grant more than its owner's role allows
+	var scopes []string
+	for _, scope := range req.Scopes {
+		if containsString(scopes, scope) {
+			continue
+		}
+		for _, permission := range tokenScopePermissions[scope] {
+			if !containsString(rolePermissions[user.Role], permission) {
+				http.Error(w, "Your role does not allow the scope "+scope, http.StatusForbidden)
+				return
+			}
+		}
+		scopes = append(scopes, scope)
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays != nil && *req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, *req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	secret, err := utils.GenerateSecureToken(20)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate API token")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	rawToken := models.APITokenPrefix + secret
+	prefix := models.APITokenPrefix + secret[:8]
+
+	token, err := s.db.CreateAPIToken(user.ID, req.Name, prefix, utils.HashAPIKey(rawToken), scopes, expiresAt)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to create API token")
+		http.Error(w, "Failed to create API token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Int("token_id", token.ID).Strs("scopes", scopes).Msg("API token created")
+	s.audit(r, auditTokenCreate, "api_token", strconv.Itoa(token.ID), nil, token)
+
+	s.writeJSON(w, models.APITokenCreateResponse{
+		Token:    rawToken,
+		APIToken: token,
+	})
+}
+
+// handleGetAPIToken returns a single personal access token
+func (s *Server) handleGetAPIToken(w http.ResponseWriter, r *http.Request) {
+	token := s.apiTokenFromURL(w, r)
+	if token == nil {
+		return
+	}
+
+	s.writeJSON(w, token)
+}
+
+// handleUpdateAPIToken renames a personal access token
+func (s *Server) handleUpdateAPIToken(w http.ResponseWriter, r *http.Request) {
+	token := s.apiTokenFromURL(w, r)
+	if token == nil {
+		return
+	}
+
+	var req models.APITokenUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	if err := req.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.db.RenameAPIToken(token.ID, req.Name); err != nil {
+		log.Error().Err(err).Int("token_id", token.ID).Msg("Failed to rename API token")
+		http.Error(w, "Failed to update API token", http.StatusInternalServerError)
+		return
+	}
+
+	before := *token
+	token.Name = req.Name
+	s.audit(r, auditTokenUpdate, "api_token", strconv.Itoa(token.ID), &before, token)
+
+	s.writeJSON(w, token)
+}
+
+// handleRevokeAPIToken revokes a personal access token
+func (s *Server) handleRevokeAPIToken(w http.ResponseWriter, r *http.Request) {
+	token := s.apiTokenFromURL(w, r)
+	if token == nil {
+		return
+	}
+
+	if err := s.db.RevokeAPIToken(token.ID); err != nil {
+		log.Error().Err(err).Int("token_id", token.ID).Msg("Failed to revoke API token")
+		http.Error(w, "Failed to revoke API token", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("token_id", token.ID).Int("user_id", token.UserID).Msg("API token revoked")
+
+	if token.RevokedAt == nil {
+		after := *token
+		now := time.Now()
+		after.RevokedAt = &now
+		s.audit(r, auditTokenRevoke, "api_token", strconv.Itoa(token.ID), token, &after)
+	}
+
+	s.writeJSON(w, map[string]interface{}{
+		"success": true,
+		"message": "API token revoked",
+	})
+}
+
+// apiTokenFromURL loads the token named by the {id} URL parameter. Users may
+// only manage their own tokens from a session; admins may manage any token.
+func (s *Server) apiTokenFromURL(w http.ResponseWriter, r *http.Request) *models.APIToken {
+	principal := principalFromContext(r.Context())
+	if principal == nil || (principal.Kind != principalSession && !principal.isAdmin()) {
+		http.Error(w, "This action requires a user session", http.StatusForbidden)
+		return nil
+	}
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid token ID", http.StatusBadRequest)
+		return nil
+	}
+
+	token, err := s.db.GetAPIToken(id)
+	if err != nil {
+		log.Error().Err(err).Int("token_id", id).Msg("Failed to get API token")
+		http.Error(w, "Failed to get API token", http.StatusInternalServerError)
+		return nil
+	}
+
+	// Hide other users' tokens from non-admins
+	if token == nil || (!principal.isAdmin() && token.UserID != principal.User.ID) {
+		http.Error(w, "API token not found", http.StatusNotFound)
+		return nil
+	}
+
+	return token
+}
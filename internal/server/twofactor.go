@@ -0,0 +1,307 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/models"
+	"github.com/x86txt/sreootb/internal/utils"
+)
+
+const (
+	totpIssuer      = "SREootb"
+	backupCodeCount = 10
+)
+
+// sessionUser returns the user behind a session principal. Master key requests
+// have no user account and personal access tokens must not manage credentials,
+// so account security actions are rejected for them.
+func sessionUser(w http.ResponseWriter, r *http.Request) *models.User {
+	principal := principalFromContext(r.Context())
+	if principal == nil || principal.Kind != principalSession || principal.User == nil {
+		http.Error(w, "This action requires a user session", http.StatusForbidden)
+		return nil
+	}
+	return principal.User
+}
+
+// decryptTOTPSecret returns the plaintext TOTP secret stored for a user
+func (s *Server) decryptTOTPSecret(user *models.User) (string, error) {
+	if user.TwoFactorSecret == nil || *user.TwoFactorSecret == "" {
+		return "", fmt.Errorf("user has no two-factor secret")
+	}
+	return utils.DecryptSecret(*user.TwoFactorSecret, s.secretKey)
+}
+
+// verifyTOTPCode checks a TOTP code against the user's stored secret. Each
+// time step is accepted at most once, so an observed code cannot be replayed.
+func (s *Server) verifyTOTPCode(user *models.User, code string) (bool, error) {
+	secret, err := s.decryptTOTPSecret(user)
+	if err != nil {
+		return false, err
+	}
+	step, ok := utils.MatchTOTPCode(strings.TrimSpace(code), secret, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return s.db.AcceptTOTPStep(user.ID, step)
+}
+
+// redeemBackupCode consumes a matching unused backup code for the user
+func (s *Server) redeemBackupCode(user *models.User, code string) (bool, error) {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	if code == "" {
+		return false, nil
+	}
+
+	codes, err := s.db.GetUnusedBackupCodes(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, stored := range codes {
+		if utils.VerifyBackupCode(code, stored.Code) {
+			return s.db.ConsumeBackupCode(stored.ID)
+		}
+	}
+
+	return false, nil
+}
+
+// handleTwoFactorSetup generates a new TOTP secret for the current user.
+// 2FA is not enforced until the secret is confirmed with a valid code.
+func (s *Server) handleTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate TOTP secret")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	qrCodeURL, err := utils.GenerateTOTPQRCodeURL(secret, user.Email, totpIssuer)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate TOTP QR code URL")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	encrypted, err := utils.EncryptSecret(secret, s.secretKey)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to encrypt TOTP secret")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := s.db.SetTwoFactorSecret(user.ID, encrypted); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to store TOTP secret")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	s.audit(r, auditTwoFactorSetup, "user", strconv.Itoa(user.ID), nil, nil)
+
+	s.writeJSON(w, models.TwoFactorSetupResponse{
+		Success:   true,
+		Secret:    secret,
+		QRCodeURL: qrCodeURL,
+		Message:   "Scan the QR code with your authenticator app, then confirm with a code",
+	})
+}
+
+// handleTwoFactorConfirm enables 2FA once the user proves they can generate codes
+func (s *Server) handleTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req models.TwoFactorSetupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TwoFactorSecret == nil {
+		http.Error(w, "Two-factor setup has not been started", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := s.verifyTOTPCode(user, req.TOTPCode)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to verify TOTP code")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid two-factor authentication code", http.StatusBadRequest)
+		return
+	}
+
+	backupCodes, err := utils.GenerateBackupCodes(backupCodeCount)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to generate backup codes")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	hashes := make([]string, 0, len(backupCodes))
+	for _, code := range backupCodes {
+		hash, err := utils.HashBackupCode(code)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to hash backup code")
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		hashes = append(hashes, hash)
+	}
+
+	if err := s.db.EnableTwoFactor(user.ID, hashes); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to enable two-factor authentication")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Msg("Two-factor authentication enabled")
+
+	before := *user
+	user.TwoFactorEnabled = true
+	s.audit(r, auditTwoFactorEnable, "user", strconv.Itoa(user.ID), &before, user)
+
+	s.writeJSON(w, models.TwoFactorSetupResponse{
+		Success:     true,
+		BackupCodes: backupCodes,
+		Message:     "Two-factor authentication enabled. Store these backup codes somewhere safe; each can be used once.",
+	})
+}
+
+// handleTwoFactorDisable turns off 2FA after re-checking the password and a second factor
+func (s *Server) handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	user := sessionUser(w, r)
+	if user == nil {
+		return
+	}
+
+	var req models.TwoFactorDisableRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusBadRequest)
+		return
+	}
+
+	// A stolen session must not be able to guess its way past the re-check
+	if !s.allowLoginAttempt(w, r, user.Email) {
+		return
+	}
+
+	if !utils.VerifyPassword(req.Password, user.PasswordHash) {
+		s.recordLoginFailure(r, user.Email)
+		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
+	}
+
+	// Accept either a current TOTP code or an unused backup code
+	valid, err := s.verifyTOTPCode(user, req.TOTPCode)
+	if err == nil && !valid {
+		valid, err = s.redeemBackupCode(user, req.TOTPCode)
+	}
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to verify second factor")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		s.recordLoginFailure(r, user.Email)
+		http.Error(w, "Invalid two-factor authentication code", http.StatusUnauthorized)
+		return
+	}
+	s.recordLoginSuccess(user.Email)
+
+	if err := s.db.DisableTwoFactor(user.ID); err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to disable two-factor authentication")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	log.Info().Int("user_id", user.ID).Msg("Two-factor authentication disabled")
+
+	before := *user
+	user.TwoFactorEnabled = false
+	s.audit(r, auditTwoFactorDisable, "user", strconv.Itoa(user.ID), &before, user)
+
+	s.writeJSON(w, map[string]interface{}{
+		"success": true,
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// handleTwoFactorBackupLogin logs in with a password and a single-use backup code
+// for users who have lost access to their authenticator
+func (s *Server) handleTwoFactorBackupLogin(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		BackupCode string `json:"backup_code"`
+		RememberMe bool   `json:"remember_me"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if req.BackupCode == "" {
+		http.Error(w, "Backup code is required", http.StatusBadRequest)
+		return
+	}
+
+	user := s.checkPassword(w, r, req.Email, req.Password)
+	if user == nil {
+		return
+	}
+
+	if !user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is not enabled for this account", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := s.redeemBackupCode(user, req.BackupCode)
+	if err != nil {
+		log.Error().Err(err).Int("user_id", user.ID).Msg("Failed to redeem backup code")
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		s.recordLoginFailure(r, user.Email)
+		s.auditAs(r, userActor(user), auditLoginFailed, "user", strconv.Itoa(user.ID), nil,
+			map[string]string{"reason": "invalid backup code"})
+		http.Error(w, "Invalid or already used backup code", http.StatusUnauthorized)
+		return
+	}
+
+	log.Warn().Int("user_id", user.ID).Msg("User logged in with a 2FA backup code")
+
+	s.completeLogin(w, r, user, req.RememberMe, "backup_code", "Login successful using a backup code")
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// enrollTwoFactor turns on 2FA for a session's user and returns the TOTP
+// secret and backup codes
+func enrollTwoFactor(t *testing.T, s *Server, token string) (string, []string) {
+	t.Helper()
+
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/2fa/setup", token, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("2fa setup: status %d: %s", rec.Code, rec.Body)
+	}
+	var setup models.TwoFactorSetupResponse
+	decodeJSON(t, rec, &setup)
+
+	rec = s.serve(jsonRequest(t, http.MethodPost, "/api/auth/2fa/confirm", token,
+		models.TwoFactorSetupRequest{TOTPCode: totpCode(t, setup.Secret, time.Now())}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("2fa confirm: status %d: %s", rec.Code, rec.Body)
+	}
+	var confirm models.TwoFactorSetupResponse
+	decodeJSON(t, rec, &confirm)
+	if len(confirm.BackupCodes) != backupCodeCount {
+		t.Fatalf("got %d backup codes, want %d", len(confirm.BackupCodes), backupCodeCount)
+	}
+	return setup.Secret, confirm.BackupCodes
+}
+
+// totpCode returns the code of a secret at time at
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	code, err := totp.GenerateCode(secret, at)
+	if err != nil {
+		t.Fatalf("generate TOTP code: %v", err)
+	}
+	return code
+}
+
+func TestTOTPCodeCannotBeReplayed(t *testing.T) {
+	s := newTestServer(t, nil)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+	secret, _ := enrollTwoFactor(t, s, newSession(t, s, user))
+
+	login := func(code string) int {
+		return s.serve(jsonRequest(t, http.MethodPost, "/api/auth/login", "",
+			models.UserLoginRequest{Email: user.Email, Password: testPassword, TOTPCode: &code})).Code
+	}
+
+	// The next step's code is valid within the allowed clock skew
+	next := totpCode(t, secret, time.Now().Add(30*time.Second))
+	if status := login(next); status != http.StatusOK {
+		t.Fatalf("login with a fresh code: status %d, want %d", status, http.StatusOK)
+	}
+	if status := login(next); status != http.StatusUnauthorized {
+		t.Errorf("replayed code: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	// Codes older than the last one accepted are refused too
+	if status := login(totpCode(t, secret, time.Now())); status != http.StatusUnauthorized {
+		t.Errorf("code older than the last accepted one: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
+
+func TestBackupCodesAreSingleUse(t *testing.T) {
+	s := newTestServer(t, nil)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+	_, backupCodes := enrollTwoFactor(t, s, newSession(t, s, user))
+
+	login := func(code string) int {
+		return s.serve(jsonRequest(t, http.MethodPost, "/api/auth/2fa/backup-code", "", map[string]string{
+			"email": user.Email, "password": testPassword, "backup_code": code,
+		})).Code
+	}
+
+	if status := login(backupCodes[0]); status != http.StatusOK {
+		t.Fatalf("first use of a backup code: status %d, want %d", status, http.StatusOK)
+	}
+	if status := login(backupCodes[0]); status != http.StatusUnauthorized {
+		t.Errorf("second use of a backup code: status %d, want %d", status, http.StatusUnauthorized)
+	}
+	if status := login(backupCodes[1]); status != http.StatusOK {
+		t.Errorf("another backup code: status %d, want %d", status, http.StatusOK)
+	}
+
+	remaining, err := s.db.GetUnusedBackupCodes(user.ID)
+	if err != nil || len(remaining) != backupCodeCount-2 {
+		t.Errorf("%d unused backup codes left, %v, want %d", len(remaining), err, backupCodeCount-2)
+	}
+}
+
+// Re-enrolling within the time step of the last accepted code must not be
+// blocked by the replay guard of the old secret
+func TestTwoFactorReEnrollment(t *testing.T) {
+	s := newTestServer(t, nil)
+	user := createTestUser(t, s, "user@example.com", models.RoleViewer)
+	token := newSession(t, s, user)
+	_, backupCodes := enrollTwoFactor(t, s, token)
+
+	rec := s.serve(jsonRequest(t, http.MethodPost, "/api/auth/2fa/disable", token,
+		models.TwoFactorDisableRequest{Password: testPassword, TOTPCode: backupCodes[0]}))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("2fa disable: status %d: %s", rec.Code, rec.Body)
+	}
+
+	enrollTwoFactor(t, s, token)
+}
@@ -3,9 +3,11 @@ package utils
 import (
 	"crypto/rand"
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
 	"encoding/hex"
 	"fmt"
+	"time"
 
 	"github.com/pquerna/otp"
 	"github.com/pquerna/otp/totp"
@@ -42,6 +44,17 @@ func GenerateSessionToken() (string, error) {
 	return GenerateSecureToken(32) // 64 character hex string
 }
 
+// GenerateSessionID generates a random UUID (version 4) for a session record
+func GenerateSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session ID: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40 // Version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
 // HashSessionToken hashes a session token for storage
 func HashSessionToken(token string) string {
 	hash := sha256.Sum256([]byte(token))
@@ -72,9 +85,22 @@ func GenerateTOTPQRCodeURL(secret, email, issuer string) (string, error) {
 	return key.URL(), nil
 }
 
-// ValidateTOTPCode validates a TOTP code against a secret
-func ValidateTOTPCode(code, secret string) bool {
-	return totp.Validate(code, secret)
+// totpPeriod is the length of a TOTP time step in seconds
+const totpPeriod = 30
+
+// MatchTOTPCode checks a TOTP code against a secret, allowing one time step
+// of clock skew either way, and returns the time step the code belongs to so
+// callers can refuse to accept the same step twice
+func MatchTOTPCode(code, secret string, now time.Time) (int64, bool) {
+	opts := totp.ValidateOpts{Period: totpPeriod, Digits: otp.DigitsSix, Algorithm: otp.AlgorithmSHA1}
+	current := now.Unix() / totpPeriod
+	for _, step := range []int64{current - 1, current, current + 1} {
+		expected, err := totp.GenerateCodeCustom(secret, time.Unix(step*totpPeriod, 0), opts)
+		if err == nil && subtle.ConstantTimeCompare([]byte(code), []byte(expected)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
 }
 
 // GenerateBackupCodes generates backup codes for 2FA
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// hiddenHTMLElements hold no visible text and often change on every load
+var hiddenHTMLElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true, "template": true, "svg": true,
+}
+
+// inlineHTMLElements continue the current line of text; other elements start a new one
+var inlineHTMLElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "cite": true, "code": true,
+	"data": true, "dfn": true, "em": true, "font": true, "i": true, "kbd": true, "label": true,
+	"mark": true, "q": true, "s": true, "samp": true, "small": true, "span": true, "strong": true,
+	"sub": true, "sup": true, "time": true, "u": true, "var": true, "wbr": true,
+}
+
+// NormalizeContent reduces a response body to the text change detection
+// compares: the visible text of HTML without the elements cfg ignores, JSON
+// re-indented, anything else as it is. Text matching cfg's ignore patterns is
+// removed, then trailing spaces and blank lines.
+func NormalizeContent(body []byte, contentType string, cfg *models.ContentChangeConfig) (*models.ContentSnapshot, error) {
+	if cfg == nil {
+		cfg = &models.ContentChangeConfig{}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == "" {
+		mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(body))
+	}
+
+	var text string
+	switch {
+	case strings.Contains(mediaType, "html"):
+		var err error
+		if text, err = htmlVisibleText(body, cfg.IgnoreSelectors); err != nil {
+			return nil, err
+		}
+	case strings.Contains(mediaType, "json"):
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			text = indented.String()
+		} else {
+			text = string(body)
+		}
+	default:
+		text = string(body)
+	}
+	text = strings.ToValidUTF8(text, "�")
+
+	for _, pattern := range cfg.IgnorePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern %q: %w", pattern, err)
+		}
+		text = re.ReplaceAllString(text, "")
+	}
+
+	var lines []string
+	for _, line := range strings.Split(strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\r", "\n"), "\n") {
+		if line = strings.TrimRightFunc(line, unicode.IsSpace); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return models.NewContentSnapshot(strings.Join(lines, "\n")), nil
+}
+
+// htmlVisibleText renders an HTML document's text a line per block element,
+// leaving out hidden elements and those matching the selectors
+func htmlVisibleText(body []byte, selectors []string) (string, error) {
+	ignored := make([]models.CSSSelector, 0, len(selectors))
+	for _, selector := range selectors {
+		parsed, err := models.ParseCSSSelector(selector)
+		if err != nil {
+			return "", err
+		}
+		ignored = append(ignored, parsed)
+	}
+
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to parse HTML: %w", err)
+	}
+
+	var lines []string
+	var line strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(line.String()), " "); text != "" {
+			lines = append(lines, text)
+		}
+		line.Reset()
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			line.WriteString(n.Data)
+			return
+		case html.CommentNode:
+			return
+		case html.ElementNode:
+			if hiddenHTMLElements[n.Data] {
+				return
+			}
+			for _, selector := range ignored {
+				if matchesCSSSelector(n, selector) {
+					return
+				}
+			}
+		}
+
+		block := n.Type == html.ElementNode && !inlineHTMLElements[n.Data]
+		if block {
+			flush()
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			flush()
+		}
+	}
+	walk(doc)
+	flush()
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// matchesCSSSelector reports whether an element matches a parsed selector
+func matchesCSSSelector(n *html.Node, selector models.CSSSelector) bool {
+	return matchesCSSSelectorFrom(n, selector, len(selector)-1)
+}
+
+// matchesCSSSelectorFrom matches n against compound i and its ancestors
+// against the compounds before it
+func matchesCSSSelectorFrom(n *html.Node, selector models.CSSSelector, i int) bool {
+	if !matchesCSSCompound(n, selector[i]) {
+		return false
+	}
+	if i == 0 {
+		return true
+	}
+	for parent := n.Parent; parent != nil && parent.Type == html.ElementNode; parent = parent.Parent {
+		if matchesCSSSelectorFrom(parent, selector, i-1) {
+			return true
+		}
+		if selector[i].Child {
+			return false
+		}
+	}
+	return false
+}
+
+// matchesCSSCompound reports whether an element matches a single compound selector
+func matchesCSSCompound(n *html.Node, compound models.CSSCompound) bool {
+	if n.Type != html.ElementNode || (compound.Tag != "" && n.Data != compound.Tag) {
+		return false
+	}
+
+	attributes := make(map[string]string, len(n.Attr))
+	for _, attr := range n.Attr {
+		attributes[attr.Key] = attr.Val
+	}
+
+	if compound.ID != "" && attributes["id"] != compound.ID {
+		return false
+	}
+	classes := strings.Fields(attributes["class"])
+	for _, class := range compound.Classes {
+		found := false
+		for _, c := range classes {
+			if c == class {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, attr := range compound.Attributes {
+		value, ok := attributes[attr.Name]
+		if !ok || (attr.HasValue && value != attr.Value) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+const testContentPage = `<!DOCTYPE html>
+<html>
+<head><title>Status</title><style>p { color: red }</style></head>
+<body>
+  <div id="banner" class="notice top">Maintenance on <time>Friday</time></div>
+  <main>
+    <h1>All   systems
+      operational</h1>
+    <p>API: <strong>up</strong> <span class="ts">checked 12:00:01</span></p>
+    <ul><li data-region="eu">Europe</li><li data-region="us">Americas</li></ul>
+    <script>var rendered = Date.now();</script>
+    <!-- build 1234 -->
+  </main>
+  <footer><p>Last updated 2026-10-16</p></footer>
+</body>
+</html>`
+
+func TestNormalizeContent(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		contentType string
+		cfg         *models.ContentChangeConfig
+		want        string
+	}{
+		{
+			name:        "html visible text",
+			body:        testContentPage,
+			contentType: "text/html; charset=utf-8",
+			want: "Maintenance on Friday\nAll systems operational\nAPI: up checked 12:00:01\n" +
+				"Europe\nAmericas\nLast updated 2026-10-16",
+		},
+		{
+			name:        "ignored selectors",
+			body:        testContentPage,
+			contentType: "text/html",
+			cfg:         &models.ContentChangeConfig{IgnoreSelectors: []string{"#banner", "p > span.ts", "li[data-region=us]", "footer p"}},
+			want:        "All systems operational\nAPI: up\nEurope",
+		},
+		{
+			name:        "selector not matching a descendant of another element",
+			body:        testContentPage,
+			contentType: "text/html",
+			cfg:         &models.ContentChangeConfig{IgnoreSelectors: []string{"main > span", "div.missing"}},
+			want: "Maintenance on Friday\nAll systems operational\nAPI: up checked 12:00:01\n" +
+				"Europe\nAmericas\nLast updated 2026-10-16",
+		},
+		{
+			name:        "ignored patterns",
+			body:        testContentPage,
+			contentType: "text/html",
+			cfg:         &models.ContentChangeConfig{IgnorePatterns: []string{`checked \d{2}:\d{2}:\d{2}`, `(?m)^Last updated .*$`}},
+			want:        "Maintenance on Friday\nAll systems operational\nAPI: up\nEurope\nAmericas",
+		},
+		{
+			name: "html detected without a content type",
+			body: "<html><body><p>Hello</p><p>world</p></body></html>",
+			want: "Hello\nworld",
+		},
+		{
+			name:        "json reindented",
+			body:        `{"status":"ok","items":[1,2]}`,
+			contentType: "application/problem+json",
+			want:        "{\n  \"status\": \"ok\",\n  \"items\": [\n    1,\n    2\n  ]\n}",
+		},
+		{
+			name:        "invalid json kept as is",
+			body:        `{"status": "ok"`,
+			contentType: "application/json",
+			want:        `{"status": "ok"`,
+		},
+		{
+			name:        "plain text trimmed",
+			body:        "first  \r\n\r\n\tsecond\t\rthird\n\n",
+			contentType: "text/plain",
+			want:        "first\n\tsecond\nthird",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot, err := NormalizeContent([]byte(tt.body), tt.contentType, tt.cfg)
+			if err != nil {
+				t.Fatalf("NormalizeContent: %v", err)
+			}
+			if snapshot.Text != tt.want {
+				t.Errorf("text =\n%q\nwant\n%q", snapshot.Text, tt.want)
+			}
+			if snapshot.Hash != models.NewContentSnapshot(tt.want).Hash {
+				t.Errorf("hash %s does not match the normalized text", snapshot.Hash)
+			}
+		})
+	}
+}
+
+// Changes confined to ignored parts of a page keep the same hash
+func TestNormalizeContentIgnoresNoise(t *testing.T) {
+	cfg := &models.ContentChangeConfig{IgnoreSelectors: []string{".ts"}, IgnorePatterns: []string{`\d{4}-\d{2}-\d{2}`}}
+	later := strings.NewReplacer(
+		"checked 12:00:01", "checked 12:05:00",
+		"2026-10-16", "2026-10-17",
+		"Date.now()", "performance.now()",
+		"build 1234", "build 1235",
+	).Replace(testContentPage)
+
+	before, err := NormalizeContent([]byte(testContentPage), "text/html", cfg)
+	if err != nil {
+		t.Fatalf("NormalizeContent: %v", err)
+	}
+	after, err := NormalizeContent([]byte(later), "text/html", cfg)
+	if err != nil {
+		t.Fatalf("NormalizeContent: %v", err)
+	}
+	if before.Hash != after.Hash {
+		t.Errorf("hash changed with only ignored content:\n%s", UnifiedDiff(before.Text, after.Text))
+	}
+
+	edited, err := NormalizeContent([]byte(strings.Replace(later, "<strong>up</strong>", "<strong>down</strong>", 1)), "text/html", cfg)
+	if err != nil {
+		t.Fatalf("NormalizeContent: %v", err)
+	}
+	if edited.Hash == before.Hash {
+		t.Error("hash unchanged after a visible edit")
+	}
+}
+
+func TestNormalizeContentRejectsInvalidRules(t *testing.T) {
+	tests := map[string]*models.ContentChangeConfig{
+		"selector": {IgnoreSelectors: []string{"div >"}},
+		"pattern":  {IgnorePatterns: []string{"("}},
+	}
+	for name, cfg := range tests {
+		if _, err := NormalizeContent([]byte("<p>text</p>"), "text/html", cfg); err == nil {
+			t.Errorf("invalid %s was accepted", name)
+		}
+	}
+}
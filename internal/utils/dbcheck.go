@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// maxDatabaseRowsCounted is the number of rows read before counting stops
+const maxDatabaseRowsCounted = 10000
+
+// DatabaseCheckResult describes a postgres:// or sqlite:// check; times are in
+// milliseconds. It never holds credentials or data read by the probe query:
+// only whether the first value matched expect_value.
+type DatabaseCheckResult struct {
+	Driver       string   `json:"driver"` // "postgres" or "sqlite"
+	Target       string   `json:"target"` // host:port/database or file path
+	ConnectMs    float64  `json:"connect_ms"`
+	QueryMs      *float64 `json:"query_ms,omitempty"`
+	Rows         *int     `json:"rows,omitempty"`          // Capped at 10000
+	ValueMatched *bool    `json:"value_matched,omitempty"` // Set when expect_value is configured
+	FileSize     *int64   `json:"file_size,omitempty"`
+	Integrity    string   `json:"integrity,omitempty"` // PRAGMA quick_check result
+	Problems     []string `json:"problems,omitempty"`  // Failed expectations
+}
+
+// CheckDatabase connects to the database of a postgres:// or sqlite:// URL and
+// runs the probe query of cfg (which may be nil) in a read-only transaction.
+// An error means the database could not be reached or queried; failed
+// expectations are listed in the result's Problems.
+func CheckDatabase(ctx context.Context, rawURL string, cfg *models.DatabaseCheckConfig) (*DatabaseCheckResult, error) {
+	result := &DatabaseCheckResult{}
+
+	var driver, dsn string
+	if path, ok := strings.CutPrefix(rawURL, "sqlite://"); ok {
+		result.Driver, result.Target = "sqlite", path
+		// Kept generic so a result does not reveal which paths exist
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			return result, fmt.Errorf("database file could not be opened")
+		}
+		size := info.Size()
+		result.FileSize = &size
+		// Read-only so a check can never create or change the file
+		driver, dsn = "sqlite3", "file:"+path+"?mode=ro&_query_only=true"
+	} else {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return result, fmt.Errorf("invalid postgres URL: %w", err)
+		}
+		result.Driver, result.Target = "postgres", u.Host+u.Path
+		if cfg != nil && cfg.Password != "" {
+			u.User = url.UserPassword(u.User.Username(), cfg.Password)
+		}
+		u.Scheme = "postgres"
+		driver, dsn = "postgres", u.String()
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return result, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	start := time.Now()
+	conn, err := db.Conn(ctx)
+	if err == nil {
+		err = conn.PingContext(ctx)
+	}
+	result.ConnectMs = milliseconds(time.Since(start))
+	if err != nil {
+		return result, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+
+	tx, err := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return result, fmt.Errorf("failed to start read-only transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	start = time.Now()
+	rows, value, err := runProbeQuery(ctx, tx, cfg.ProbeQuery())
+	queryMs := milliseconds(time.Since(start))
+	result.QueryMs = &queryMs
+	if err != nil {
+		return result, fmt.Errorf("query failed: %w", err)
+	}
+	result.Rows = &rows
+
+	if cfg != nil && cfg.IntegrityCheck {
+		if err := tx.QueryRowContext(ctx, "PRAGMA quick_check").Scan(&result.Integrity); err != nil {
+			return result, fmt.Errorf("integrity check failed: %w", err)
+		}
+		if result.Integrity != "ok" {
+			result.Problems = append(result.Problems, "integrity check: "+result.Integrity)
+		}
+	}
+
+	if cfg != nil && cfg.ExpectRows != nil && rows != *cfg.ExpectRows {
+		result.Problems = append(result.Problems, fmt.Sprintf("query returned %d rows, expected %d", rows, *cfg.ExpectRows))
+	}
+	if cfg != nil && cfg.ExpectValue != nil {
+		matched := value != nil && *value == *cfg.ExpectValue
+		result.ValueMatched = &matched
+		if !matched {
+			result.Problems = append(result.Problems, "query value does not match expect_value")
+		}
+	}
+
+	return result, nil
+}
+
+// runProbeQuery counts the rows of a query and renders the first column of
+// its first row for comparison; the value is never reported
+func runProbeQuery(ctx context.Context, tx *sql.Tx, query string) (int, *string, error) {
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var count int
+	var value *string
+	for rows.Next() && count < maxDatabaseRowsCounted {
+		count++
+		if count > 1 || len(columns) == 0 {
+			continue
+		}
+		cells := make([]interface{}, len(columns))
+		for i := range cells {
+			cells[i] = new(interface{})
+		}
+		if err := rows.Scan(cells...); err != nil {
+			return count, nil, err
+		}
+		text := databaseValueString(*cells[0].(*interface{}))
+		value = &text
+	}
+	return count, value, rows.Err()
+}
+
+// databaseValueString renders a scanned value as text; NULL becomes "NULL"
+func databaseValueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,338 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// DNSAnswer is one record of a DNS answer section
+type DNSAnswer struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	TTL   uint32 `json:"ttl"`
+	Value string `json:"value"`
+}
+
+// DNSCheckResult describes a dns:// check
+type DNSCheckResult struct {
+	Server      string      `json:"server"`
+	Transport   string      `json:"transport"`
+	QueryMs     float64     `json:"query_ms"`
+	RCode       string      `json:"rcode,omitempty"`
+	AnswerCount int         `json:"answer_count"` // Records of the queried type
+	Answers     []DNSAnswer `json:"answers,omitempty"`
+	Truncated   bool        `json:"truncated,omitempty"` // The UDP answer was truncated and retried over TCP
+	Problems    []string    `json:"problems,omitempty"`  // Failed expectations
+}
+
+// CheckDNS resolves the query of a dns:// URL and checks the answer against
+// cfg (which may be nil). An error means no answer was received; failed
+// expectations are listed in the result's Problems.
+func CheckDNS(ctx context.Context, rawURL string, cfg *models.DNSCheckConfig) (*DNSCheckResult, error) {
+	query, err := models.ParseDNSURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	server := query.Server
+	if server == "" {
+		if server, err = systemResolver(); err != nil {
+			return nil, err
+		}
+	}
+	result := &DNSCheckResult{Server: server, Transport: query.Transport}
+
+	request, id, err := buildDNSQuery(query, query.Transport == models.DNSTransportUDP)
+	if err != nil {
+		return result, err
+	}
+
+	serverName := ""
+	if cfg != nil {
+		serverName = cfg.ServerName
+	}
+
+	start := time.Now()
+	response, err := exchangeDNS(ctx, query.Transport, server, serverName, request)
+	if err == nil && query.Transport == models.DNSTransportUDP && len(response) > 2 && response[2]&0x02 != 0 {
+		// Truncated: ask again over TCP for the full answer
+		result.Truncated = true
+		if request, id, err = buildDNSQuery(query, false); err == nil {
+			response, err = exchangeDNS(ctx, models.DNSTransportTCP, server, "", request)
+		}
+	}
+	result.QueryMs = milliseconds(time.Since(start))
+	if err != nil {
+		return result, fmt.Errorf("DNS query to %s failed: %w", server, err)
+	}
+
+	if err := parseDNSResponse(response, id, query, result); err != nil {
+		return result, err
+	}
+
+	result.Problems = dnsProblems(result, query, cfg)
+	return result, nil
+}
+
+func buildDNSQuery(query *models.DNSQuery, withEDNS bool) ([]byte, uint16, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return nil, 0, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	name, err := dnsmessage.NewName(query.Name)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid DNS name: %w", err)
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: id, RecursionDesired: true})
+	builder.EnableCompression()
+	if err := builder.StartQuestions(); err != nil {
+		return nil, 0, err
+	}
+	if err := builder.Question(dnsmessage.Question{
+		Name:  name,
+		Type:  dnsmessage.Type(models.DNSRecordTypes[query.Type]),
+		Class: dnsmessage.ClassINET,
+	}); err != nil {
+		return nil, 0, err
+	}
+
+	if withEDNS {
+		// Advertise a larger UDP buffer so typical answers are not truncated
+		if err := builder.StartAdditionals(); err != nil {
+			return nil, 0, err
+		}
+		var opt dnsmessage.ResourceHeader
+		if err := opt.SetEDNS0(1232, dnsmessage.RCodeSuccess, false); err != nil {
+			return nil, 0, err
+		}
+		if err := builder.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	msg, err := builder.Finish()
+	return msg, id, err
+}
+
+// exchangeDNS sends one query and returns the raw response
+func exchangeDNS(ctx context.Context, transport, server, serverName string, request []byte) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	switch transport {
+	case models.DNSTransportTLS:
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(server)
+		}
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: serverName}}
+		conn, err = dialer.DialContext(ctx, "tcp", server)
+	case models.DNSTransportTCP:
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", server)
+	default:
+		conn, err = (&net.Dialer{}).DialContext(ctx, "udp", server)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if transport == models.DNSTransportUDP {
+		if _, err := conn.Write(request); err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 65535)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	}
+
+	// Stream transports prefix each message with its length
+	framed := make([]byte, 2+len(request))
+	binary.BigEndian.PutUint16(framed, uint16(len(request)))
+	copy(framed[2:], request)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	response := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+func parseDNSResponse(response []byte, id uint16, query *models.DNSQuery, result *DNSCheckResult) error {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(response)
+	if err != nil {
+		return fmt.Errorf("invalid DNS response: %w", err)
+	}
+	if header.ID != id || !header.Response {
+		return fmt.Errorf("DNS response does not match the query")
+	}
+	if err := parser.SkipAllQuestions(); err != nil {
+		return fmt.Errorf("invalid DNS response: %w", err)
+	}
+
+	result.RCode = rcodeName(header.RCode)
+	queryType := dnsmessage.Type(models.DNSRecordTypes[query.Type])
+	for {
+		resource, err := parser.Answer()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("invalid DNS answer: %w", err)
+		}
+		result.Answers = append(result.Answers, DNSAnswer{
+			Name:  strings.ToLower(resource.Header.Name.String()),
+			Type:  strings.TrimPrefix(resource.Header.Type.String(), "Type"),
+			TTL:   resource.Header.TTL,
+			Value: dnsRecordValue(resource.Body),
+		})
+		if resource.Header.Type == queryType {
+			result.AnswerCount++
+		}
+	}
+	return nil
+}
+
+// dnsProblems compares an answer with the configured expectations
+func dnsProblems(result *DNSCheckResult, query *models.DNSQuery, cfg *models.DNSCheckConfig) []string {
+	var problems []string
+	if expected := cfg.ExpectedRCode(); result.RCode != expected {
+		problems = append(problems, fmt.Sprintf("rcode is %s, expected %s", result.RCode, expected))
+	}
+	if cfg == nil {
+		return problems
+	}
+
+	answered := make(map[string]bool)
+	for _, answer := range result.Answers {
+		if answer.Type != query.Type {
+			continue
+		}
+		answered[normalizeDNSValue(answer.Value, query.Type)] = true
+
+		if cfg.MinTTL != nil && answer.TTL < *cfg.MinTTL {
+			problems = append(problems, fmt.Sprintf("%s has TTL %d, below %d", answer.Value, answer.TTL, *cfg.MinTTL))
+		}
+		if cfg.MaxTTL != nil && answer.TTL > *cfg.MaxTTL {
+			problems = append(problems, fmt.Sprintf("%s has TTL %d, above %d", answer.Value, answer.TTL, *cfg.MaxTTL))
+		}
+	}
+
+	expected := make(map[string]bool)
+	for _, value := range cfg.ExpectValues {
+		normalized := normalizeDNSValue(value, query.Type)
+		expected[normalized] = true
+		if !answered[normalized] {
+			problems = append(problems, fmt.Sprintf("missing expected %s record %s", query.Type, value))
+		}
+	}
+	if cfg.ExactValues {
+		for value := range answered {
+			if !expected[value] {
+				problems = append(problems, fmt.Sprintf("unexpected %s record %s", query.Type, value))
+			}
+		}
+	}
+
+	if cfg.MinAnswers != nil && result.AnswerCount < *cfg.MinAnswers {
+		problems = append(problems, fmt.Sprintf("%d %s records, expected at least %d", result.AnswerCount, query.Type, *cfg.MinAnswers))
+	}
+	if cfg.MaxAnswers != nil && result.AnswerCount > *cfg.MaxAnswers {
+		problems = append(problems, fmt.Sprintf("%d %s records, expected at most %d", result.AnswerCount, query.Type, *cfg.MaxAnswers))
+	}
+
+	return problems
+}
+
+// dnsRecordValue renders a record in zone file presentation form, without trailing dots
+func dnsRecordValue(body dnsmessage.ResourceBody) string {
+	name := func(n dnsmessage.Name) string {
+		return strings.TrimSuffix(n.String(), ".")
+	}
+	switch r := body.(type) {
+	case *dnsmessage.AResource:
+		return netip.AddrFrom4(r.A).String()
+	case *dnsmessage.AAAAResource:
+		return netip.AddrFrom16(r.AAAA).String()
+	case *dnsmessage.CNAMEResource:
+		return name(r.CNAME)
+	case *dnsmessage.NSResource:
+		return name(r.NS)
+	case *dnsmessage.PTRResource:
+		return name(r.PTR)
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", r.Pref, name(r.MX))
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", r.Priority, r.Weight, r.Port, name(r.Target))
+	case *dnsmessage.TXTResource:
+		return strings.Join(r.TXT, "")
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s %d %d %d %d %d", name(r.NS), name(r.MBox), r.Serial, r.Refresh, r.Retry, r.Expire, r.MinTTL)
+	}
+	return fmt.Sprintf("%v", body)
+}
+
+// normalizeDNSValue makes expected and answered values comparable
+func normalizeDNSValue(value, recordType string) string {
+	value = strings.TrimSpace(value)
+	switch recordType {
+	case "TXT":
+		return value
+	case "A", "AAAA":
+		if addr, err := netip.ParseAddr(value); err == nil {
+			return addr.String()
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(value, "."))
+}
+
+func rcodeName(code dnsmessage.RCode) string {
+	for name, value := range models.DNSRCodes {
+		if int(code) == value {
+			return name
+		}
+	}
+	return fmt.Sprintf("RCODE%d", code)
+}
+
+// systemResolver returns the first nameserver in /etc/resolv.conf
+func systemResolver() (string, error) {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "nameserver" {
+				return net.JoinHostPort(fields[1], "53"), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no system resolver found; set server= in the DNS URL")
+}
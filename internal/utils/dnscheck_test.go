@@ -0,0 +1,422 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// fakeDNSServer is an in-process authoritative server answering over UDP and
+// TCP on the same port. Names missing from the zone get NXDOMAIN.
+type fakeDNSServer struct {
+	addr string
+	zone map[string][]dnsmessage.Resource // Records by lower-case FQDN
+	udp  net.PacketConn
+	tcp  net.Listener
+
+	truncateUDP map[string]bool // Names whose UDP answers set the TC bit
+
+	mu      sync.Mutex
+	queries []string // Transport of each query received
+}
+
+func newFakeDNSServer(t *testing.T) *fakeDNSServer {
+	t.Helper()
+
+	srv := &fakeDNSServer{
+		zone:        make(map[string][]dnsmessage.Resource),
+		truncateUDP: make(map[string]bool),
+	}
+
+	// Bind UDP first, then TCP on the same port; retry if the port is taken
+	for attempt := 0; ; attempt++ {
+		udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen udp: %v", err)
+		}
+		tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+		if err == nil {
+			srv.udp, srv.tcp, srv.addr = udp, tcp, udp.LocalAddr().String()
+			break
+		}
+		udp.Close()
+		if attempt == 10 {
+			t.Fatalf("listen tcp: %v", err)
+		}
+	}
+	t.Cleanup(func() {
+		srv.udp.Close()
+		srv.tcp.Close()
+	})
+
+	go srv.serveUDP()
+	go srv.serveStream(srv.tcp, models.DNSTransportTCP)
+	return srv
+}
+
+func (s *fakeDNSServer) add(t *testing.T, name string, ttl uint32, body dnsmessage.ResourceBody) {
+	t.Helper()
+
+	n, err := dnsmessage.NewName(name)
+	if err != nil {
+		t.Fatalf("invalid name %q: %v", name, err)
+	}
+	s.zone[strings.ToLower(name)] = append(s.zone[strings.ToLower(name)], dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: n, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   body,
+	})
+}
+
+func (s *fakeDNSServer) record(transport string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queries = append(s.queries, transport)
+}
+
+func (s *fakeDNSServer) transports() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+func (s *fakeDNSServer) serveUDP() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := s.udp.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		s.record(models.DNSTransportUDP)
+		if response := s.answer(buf[:n], true); response != nil {
+			s.udp.WriteTo(response, addr)
+		}
+	}
+}
+
+// serveStream answers length-prefixed queries on a TCP or TLS listener
+func (s *fakeDNSServer) serveStream(listener net.Listener, transport string) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			var length [2]byte
+			if _, err := io.ReadFull(conn, length[:]); err != nil {
+				return
+			}
+			request := make([]byte, binary.BigEndian.Uint16(length[:]))
+			if _, err := io.ReadFull(conn, request); err != nil {
+				return
+			}
+			s.record(transport)
+
+			response := s.answer(request, false)
+			framed := make([]byte, 2+len(response))
+			binary.BigEndian.PutUint16(framed, uint16(len(response)))
+			copy(framed[2:], response)
+			conn.Write(framed)
+		}()
+	}
+}
+
+// answer builds the response to a raw query
+func (s *fakeDNSServer) answer(request []byte, overUDP bool) []byte {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(request)
+	if err != nil {
+		return nil
+	}
+	question, err := parser.Question()
+	if err != nil {
+		return nil
+	}
+
+	name := strings.ToLower(question.Name.String())
+	records, known := s.zone[name]
+	respHeader := dnsmessage.Header{ID: header.ID, Response: true, Authoritative: true, RecursionDesired: header.RecursionDesired}
+	if !known {
+		respHeader.RCode = dnsmessage.RCodeNameError
+	}
+	truncate := overUDP && s.truncateUDP[name]
+	respHeader.Truncated = truncate
+
+	builder := dnsmessage.NewBuilder(nil, respHeader)
+	builder.StartQuestions()
+	builder.Question(question)
+	builder.StartAnswers()
+	if !truncate {
+		for _, rr := range records {
+			switch body := rr.Body.(type) {
+			case *dnsmessage.AResource:
+				if question.Type == dnsmessage.TypeA {
+					builder.AResource(rr.Header, *body)
+				}
+			case *dnsmessage.AAAAResource:
+				if question.Type == dnsmessage.TypeAAAA {
+					builder.AAAAResource(rr.Header, *body)
+				}
+			case *dnsmessage.MXResource:
+				if question.Type == dnsmessage.TypeMX {
+					builder.MXResource(rr.Header, *body)
+				}
+			case *dnsmessage.TXTResource:
+				if question.Type == dnsmessage.TypeTXT {
+					builder.TXTResource(rr.Header, *body)
+				}
+			}
+		}
+	}
+	response, err := builder.Finish()
+	if err != nil {
+		return nil
+	}
+	return response
+}
+
+// listenTLS starts serving DNS over TLS with a self-signed certificate and
+// records the SNI name of each handshake
+func (s *fakeDNSServer) listenTLS(t *testing.T) (addr string, serverNames <-chan string) {
+	t.Helper()
+
+	names := make(chan string, 10)
+	config := selfSignedTLSConfig(t)
+	config.GetConfigForClient = func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+		names <- hello.ServerName
+		return nil, nil
+	}
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatalf("listen tls: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go s.serveStream(listener, models.DNSTransportTLS)
+	return listener.Addr().String(), names
+}
+
+func (s *fakeDNSServer) url(name, recordType, transport string) string {
+	return "dns://" + name + "?type=" + recordType + "&transport=" + transport + "&server=" + s.addr
+}
+
+func newTestZone(t *testing.T) *fakeDNSServer {
+	srv := newFakeDNSServer(t)
+	srv.add(t, "example.test.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}})
+	srv.add(t, "example.test.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 2}})
+	srv.add(t, "example.test.", 3600, &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.test.")})
+	srv.add(t, "example.test.", 60, &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}})
+	return srv
+}
+
+func checkDNS(t *testing.T, rawURL string, cfg *models.DNSCheckConfig) *DNSCheckResult {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	result, err := CheckDNS(ctx, rawURL, cfg)
+	if err != nil {
+		t.Fatalf("CheckDNS(%s): %v", rawURL, err)
+	}
+	return result
+}
+
+func intPtr(v int) *int          { return &v }
+func uint32Ptr(v uint32) *uint32 { return &v }
+
+func TestCheckDNSRecordMatching(t *testing.T) {
+	srv := newTestZone(t)
+
+	tests := []struct {
+		name         string
+		recordType   string
+		cfg          *models.DNSCheckConfig
+		wantProblems []string
+	}{
+		{
+			name:       "no expectations",
+			recordType: "A",
+		},
+		{
+			name:       "all expected values answered",
+			recordType: "A",
+			cfg:        &models.DNSCheckConfig{ExpectValues: []string{"192.0.2.2", "192.0.2.1"}, ExactValues: true},
+		},
+		{
+			name:         "expected value missing",
+			recordType:   "A",
+			cfg:          &models.DNSCheckConfig{ExpectValues: []string{"192.0.2.1", "198.51.100.7"}},
+			wantProblems: []string{"missing expected A record 198.51.100.7"},
+		},
+		{
+			name:         "unexpected extra value",
+			recordType:   "A",
+			cfg:          &models.DNSCheckConfig{ExpectValues: []string{"192.0.2.1"}, ExactValues: true},
+			wantProblems: []string{"unexpected A record 192.0.2.2"},
+		},
+		{
+			name:       "MX matched case-insensitively with trailing dot",
+			recordType: "MX",
+			cfg:        &models.DNSCheckConfig{ExpectValues: []string{"10 MAIL.example.test."}},
+		},
+		{
+			name:       "TXT strings are joined",
+			recordType: "TXT",
+			cfg:        &models.DNSCheckConfig{ExpectValues: []string{"v=spf1 -all"}},
+		},
+		{
+			name:         "answer count bounds",
+			recordType:   "A",
+			cfg:          &models.DNSCheckConfig{MinAnswers: intPtr(3), MaxAnswers: intPtr(1)},
+			wantProblems: []string{"2 A records, expected at least 3", "2 A records, expected at most 1"},
+		},
+		{
+			name:         "TTL bounds",
+			recordType:   "TXT",
+			cfg:          &models.DNSCheckConfig{MinTTL: uint32Ptr(120), MaxTTL: uint32Ptr(30)},
+			wantProblems: []string{"v=spf1 -all has TTL 60, below 120", "v=spf1 -all has TTL 60, above 30"},
+		},
+		{
+			name:         "no records of the queried type",
+			recordType:   "AAAA",
+			cfg:          &models.DNSCheckConfig{MinAnswers: intPtr(1)},
+			wantProblems: []string{"0 AAAA records, expected at least 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := checkDNS(t, srv.url("example.test", tt.recordType, models.DNSTransportUDP), tt.cfg)
+			if result.RCode != "NOERROR" {
+				t.Errorf("RCode = %s, want NOERROR", result.RCode)
+			}
+			if strings.Join(result.Problems, "\n") != strings.Join(tt.wantProblems, "\n") {
+				t.Errorf("Problems = %q, want %q", result.Problems, tt.wantProblems)
+			}
+		})
+	}
+}
+
+func TestCheckDNSNXDomain(t *testing.T) {
+	srv := newTestZone(t)
+	rawURL := srv.url("missing.example.test", "A", models.DNSTransportUDP)
+
+	result := checkDNS(t, rawURL, nil)
+	if result.RCode != "NXDOMAIN" {
+		t.Fatalf("RCode = %s, want NXDOMAIN", result.RCode)
+	}
+	if result.AnswerCount != 0 {
+		t.Errorf("AnswerCount = %d, want 0", result.AnswerCount)
+	}
+	if len(result.Problems) != 1 || result.Problems[0] != "rcode is NXDOMAIN, expected NOERROR" {
+		t.Errorf("Problems = %q", result.Problems)
+	}
+
+	// A monitor can assert that a name must not exist
+	result = checkDNS(t, rawURL, &models.DNSCheckConfig{RCode: "NXDOMAIN"})
+	if len(result.Problems) != 0 {
+		t.Errorf("Problems = %q, want none when NXDOMAIN is expected", result.Problems)
+	}
+}
+
+func TestCheckDNSOverTCP(t *testing.T) {
+	srv := newTestZone(t)
+
+	result := checkDNS(t, srv.url("example.test", "A", models.DNSTransportTCP),
+		&models.DNSCheckConfig{ExpectValues: []string{"192.0.2.1", "192.0.2.2"}})
+	if result.AnswerCount != 2 || len(result.Problems) != 0 {
+		t.Errorf("AnswerCount = %d, Problems = %q", result.AnswerCount, result.Problems)
+	}
+	if got := srv.transports(); len(got) != 1 || got[0] != models.DNSTransportTCP {
+		t.Errorf("queries = %v, want one over tcp", got)
+	}
+}
+
+func TestCheckDNSTruncatedRetriesOverTCP(t *testing.T) {
+	srv := newTestZone(t)
+	srv.truncateUDP["example.test."] = true
+
+	result := checkDNS(t, srv.url("example.test", "A", models.DNSTransportUDP), nil)
+	if !result.Truncated {
+		t.Error("expected the result to be marked truncated")
+	}
+	if result.AnswerCount != 2 {
+		t.Errorf("AnswerCount = %d, want the full answer from TCP", result.AnswerCount)
+	}
+	if got := srv.transports(); strings.Join(got, ",") != "udp,tcp" {
+		t.Errorf("queries = %v, want udp then tcp", got)
+	}
+}
+
+func TestCheckDNSNoAnswer(t *testing.T) {
+	// A bound UDP socket that never replies
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen udp: %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := CheckDNS(ctx, "dns://example.test?server="+conn.LocalAddr().String(), nil); err == nil {
+		t.Fatal("expected an error when the server does not answer")
+	}
+}
+
+// The checker trusts only the system roots, so a DNS over TLS server with a
+// self-signed certificate must be rejected before any query is sent; the
+// stream framing after the handshake is shared with TCP.
+func TestCheckDNSOverTLSVerifiesCertificate(t *testing.T) {
+	srv := newTestZone(t)
+	addr, serverNames := srv.listenTLS(t)
+	rawURL := "dns://example.test?type=A&transport=tls&server=" + addr
+
+	tests := []struct {
+		name    string
+		cfg     *models.DNSCheckConfig
+		wantSNI string
+	}{
+		{"server name from address", nil, ""}, // IP addresses are not sent as SNI
+		{"configured server name", &models.DNSCheckConfig{ServerName: "dns.example.test"}, "dns.example.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			result, err := CheckDNS(ctx, rawURL, tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), "certificate") {
+				t.Fatalf("CheckDNS error = %v, want a certificate verification failure", err)
+			}
+			if result == nil || result.Transport != models.DNSTransportTLS {
+				t.Errorf("result = %+v, want the tls transport recorded", result)
+			}
+
+			select {
+			case name := <-serverNames:
+				if name != tt.wantSNI {
+					t.Errorf("SNI = %q, want %q", name, tt.wantSNI)
+				}
+			case <-time.After(time.Second):
+				t.Error("no TLS handshake reached the server")
+			}
+		})
+	}
+
+	if got := srv.transports(); len(got) != 0 {
+		t.Errorf("queries = %v, want none sent over an unverified connection", got)
+	}
+}
@@ -1,44 +1,109 @@
 package utils
 
 import (
+	"bytes"
 	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	texttemplate "text/template"
 
 	"github.com/rs/zerolog/log"
+
+	"github.com/x86txt/sreootb/internal/config"
 )
 
+// EmailMessage is a rendered email ready for delivery
+type EmailMessage struct {
+	To       string
+	Subject  string
+	TextBody string
+	HTMLBody string // Optional; sent as a multipart/alternative part when set
+}
+
+// EmailSender delivers rendered email messages
+type EmailSender interface {
+	Send(msg *EmailMessage) error
+}
+
+// ConsoleSender prints emails to stdout instead of delivering them (development)
+type ConsoleSender struct{}
+
+// Send prints the message to the console
+func (ConsoleSender) Send(msg *EmailMessage) error {
+	log.Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Msg("📧 Email sent (logged to console for development)")
+
+	fmt.Printf("\n=== EMAIL ===\n")
+	fmt.Printf("To: %s\n", msg.To)
+	fmt.Printf("Subject: %s\n", msg.Subject)
+	fmt.Printf("Body:\n%s\n", msg.TextBody)
+	fmt.Printf("=============\n\n")
+
+	return nil
+}
+
 // EmailService handles sending emails
 type EmailService struct {
-	// For now, we'll just log emails to console
-	// Later this can be extended to use SMTP, SendGrid, etc.
-	enabled bool
+	enabled     bool
+	sender      EmailSender
+	templateDir string // Optional directory with template overrides
 }
 
-// NewEmailService creates a new email service
+// NewEmailService creates a new email service that logs emails to the console
 func NewEmailService(enabled bool) *EmailService {
 	return &EmailService{
 		enabled: enabled,
+		sender:  ConsoleSender{},
 	}
 }
 
-// SendVerificationEmail sends an email verification email
-func (e *EmailService) SendVerificationEmail(email, firstName, verificationURL string) error {
-	if !e.enabled {
-		log.Info().
-			Str("email", email).
-			Str("verification_url", verificationURL).
-			Msg("Email service disabled - verification email not sent")
-		return nil
+// NewEmailServiceWithSender creates an email service that delivers through the given sender
+func NewEmailServiceWithSender(sender EmailSender, templateDir string) *EmailService {
+	return &EmailService{
+		enabled:     true,
+		sender:      sender,
+		templateDir: templateDir,
 	}
+}
 
-	// For development, just log the email content
-	// In production, this would send an actual email
-	subject := "Verify your SREootb account"
-	body := fmt.Sprintf(`
-Hi %s,
+// NewEmailServiceFromConfig creates an email service from the server email configuration
+func NewEmailServiceFromConfig(cfg *config.EmailConfig) (*EmailService, error) {
+	if !cfg.Enabled {
+		return NewEmailService(false), nil
+	}
+
+	switch cfg.Provider {
+	case "", "console":
+		return NewEmailServiceWithSender(ConsoleSender{}, cfg.TemplateDir), nil
+	case "smtp":
+		sender, err := NewSMTPSender(&cfg.SMTP, cfg.From)
+		if err != nil {
+			return nil, err
+		}
+		return NewEmailServiceWithSender(sender, cfg.TemplateDir), nil
+	default:
+		return nil, fmt.Errorf("unsupported email provider: %s", cfg.Provider)
+	}
+}
+
+// emailTemplateData is passed to every email template
+type emailTemplateData struct {
+	FirstName string
+	Email     string
+	URL       string
+}
+
+// Default templates; each can be overridden by <template_dir>/<name>.txt and <name>.html
+var defaultTextTemplates = map[string]string{
+	"verification": `
+Hi {{.FirstName}},
 
 Thank you for registering with SREootb! Please verify your email address by clicking the link below:
 
-%s
+{{.URL}}
 
 This link will expire in 24 hours.
 
@@ -46,41 +111,13 @@ If you didn't create an account with SREootb, please ignore this email.
 
 Best regards,
 The SREootb Team
-`, firstName, verificationURL)
-
-	log.Info().
-		Str("to", email).
-		Str("subject", subject).
-		Str("verification_url", verificationURL).
-		Msg("📧 Email verification sent (logged to console for development)")
-
-	// Print the email content to console for development
-	fmt.Printf("\n=== EMAIL VERIFICATION ===\n")
-	fmt.Printf("To: %s\n", email)
-	fmt.Printf("Subject: %s\n", subject)
-	fmt.Printf("Body:\n%s\n", body)
-	fmt.Printf("========================\n\n")
-
-	return nil
-}
-
-// SendPasswordResetEmail sends a password reset email
-func (e *EmailService) SendPasswordResetEmail(email, firstName, resetURL string) error {
-	if !e.enabled {
-		log.Info().
-			Str("email", email).
-			Str("reset_url", resetURL).
-			Msg("Email service disabled - password reset email not sent")
-		return nil
-	}
-
-	subject := "Reset your SREootb password"
-	body := fmt.Sprintf(`
-Hi %s,
+`,
+	"password_reset": `
+Hi {{.FirstName}},
 
 You requested to reset your password for your SREootb account. Click the link below to reset your password:
 
-%s
+{{.URL}}
 
 This link will expire in 1 hour.
 
@@ -88,36 +125,9 @@ If you didn't request a password reset, please ignore this email and your passwo
 
 Best regards,
 The SREootb Team
-`, firstName, resetURL)
-
-	log.Info().
-		Str("to", email).
-		Str("subject", subject).
-		Str("reset_url", resetURL).
-		Msg("📧 Password reset email sent (logged to console for development)")
-
-	// Print the email content to console for development
-	fmt.Printf("\n=== PASSWORD RESET ===\n")
-	fmt.Printf("To: %s\n", email)
-	fmt.Printf("Subject: %s\n", subject)
-	fmt.Printf("Body:\n%s\n", body)
-	fmt.Printf("===================\n\n")
-
-	return nil
-}
-
-// SendWelcomeEmail sends a welcome email after email verification
-func (e *EmailService) SendWelcomeEmail(email, firstName string) error {
-	if !e.enabled {
-		log.Info().
-			Str("email", email).
-			Msg("Email service disabled - welcome email not sent")
-		return nil
-	}
-
-	subject := "Welcome to SREootb!"
-	body := fmt.Sprintf(`
-Hi %s,
+`,
+	"welcome": `
+Hi {{.FirstName}},
 
 Welcome to SREootb! Your email has been verified and your account is now active.
 
@@ -132,19 +142,154 @@ If you have any questions, please don't hesitate to reach out.
 
 Best regards,
 The SREootb Team
-`, firstName)
+`,
+}
 
-	log.Info().
-		Str("to", email).
-		Str("subject", subject).
-		Msg("📧 Welcome email sent (logged to console for development)")
+var defaultHTMLTemplates = map[string]string{
+	"verification": `<p>Hi {{.FirstName}},</p>
+<p>Thank you for registering with SREootb! Please verify your email address by clicking the link below:</p>
+<p><a href="{{.URL}}">Verify my email address</a></p>
+<p>This link will expire in 24 hours.</p>
+<p>If you didn't create an account with SREootb, please ignore this email.</p>
+<p>Best regards,<br>The SREootb Team</p>
+`,
+	"password_reset": `<p>Hi {{.FirstName}},</p>
+<p>You requested to reset your password for your SREootb account. Click the link below to reset your password:</p>
+<p><a href="{{.URL}}">Reset my password</a></p>
+<p>This link will expire in 1 hour.</p>
+<p>If you didn't request a password reset, please ignore this email and your password will remain unchanged.</p>
+<p>Best regards,<br>The SREootb Team</p>
+`,
+	"welcome": `<p>Hi {{.FirstName}},</p>
+<p>Welcome to SREootb! Your email has been verified and your account is now active.</p>
+<p>Getting started:</p>
+<ul>
+<li>Add your first website to monitor</li>
+<li>Set up monitoring agents for distributed checking</li>
+<li>Configure alerts and notifications</li>
+</ul>
+<p>If you have any questions, please don't hesitate to reach out.</p>
+<p>Best regards,<br>The SREootb Team</p>
+`,
+}
+
+// loadTemplate returns the override file contents for a template if present, otherwise the default
+func (e *EmailService) loadTemplate(name, ext, fallback string) (string, error) {
+	if e.templateDir == "" {
+		return fallback, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(e.templateDir, name+ext))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fallback, nil
+		}
+		return "", fmt.Errorf("failed to read email template %s%s: %w", name, ext, err)
+	}
+
+	return string(data), nil
+}
+
+// render builds a message from the named text and HTML templates
+func (e *EmailService) render(name, to, subject string, data emailTemplateData) (*EmailMessage, error) {
+	textSrc, err := e.loadTemplate(name, ".txt", defaultTextTemplates[name])
+	if err != nil {
+		return nil, err
+	}
+	htmlSrc, err := e.loadTemplate(name, ".html", defaultHTMLTemplates[name])
+	if err != nil {
+		return nil, err
+	}
+
+	textTmpl, err := texttemplate.New(name + ".txt").Parse(textSrc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email template %s.txt: %w", name, err)
+	}
+	var textBody bytes.Buffer
+	if err := textTmpl.Execute(&textBody, data); err != nil {
+		return nil, fmt.Errorf("failed to render email template %s.txt: %w", name, err)
+	}
 
-	// Print the email content to console for development
-	fmt.Printf("\n=== WELCOME EMAIL ===\n")
-	fmt.Printf("To: %s\n", email)
-	fmt.Printf("Subject: %s\n", subject)
-	fmt.Printf("Body:\n%s\n", body)
-	fmt.Printf("==================\n\n")
+	msg := &EmailMessage{
+		To:       to,
+		Subject:  subject,
+		TextBody: textBody.String(),
+	}
+
+	if htmlSrc != "" {
+		htmlTmpl, err := htmltemplate.New(name + ".html").Parse(htmlSrc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse email template %s.html: %w", name, err)
+		}
+		var htmlBody bytes.Buffer
+		if err := htmlTmpl.Execute(&htmlBody, data); err != nil {
+			return nil, fmt.Errorf("failed to render email template %s.html: %w", name, err)
+		}
+		msg.HTMLBody = htmlBody.String()
+	}
+
+	return msg, nil
+}
+
+// send renders and delivers a templated email
+func (e *EmailService) send(name, to, subject string, data emailTemplateData) error {
+	msg, err := e.render(name, to, subject, data)
+	if err != nil {
+		return err
+	}
+
+	if err := e.sender.Send(msg); err != nil {
+		return fmt.Errorf("failed to send %s email: %w", name, err)
+	}
 
 	return nil
 }
+
+// SendVerificationEmail sends an email verification email
+func (e *EmailService) SendVerificationEmail(email, firstName, verificationURL string) error {
+	if !e.enabled {
+		log.Info().
+			Str("email", email).
+			Str("verification_url", verificationURL).
+			Msg("Email service disabled - verification email not sent")
+		return nil
+	}
+
+	return e.send("verification", email, "Verify your SREootb account", emailTemplateData{
+		FirstName: firstName,
+		Email:     email,
+		URL:       verificationURL,
+	})
+}
+
+// SendPasswordResetEmail sends a password reset email
+func (e *EmailService) SendPasswordResetEmail(email, firstName, resetURL string) error {
+	if !e.enabled {
+		log.Info().
+			Str("email", email).
+			Str("reset_url", resetURL).
+			Msg("Email service disabled - password reset email not sent")
+		return nil
+	}
+
+	return e.send("password_reset", email, "Reset your SREootb password", emailTemplateData{
+		FirstName: firstName,
+		Email:     email,
+		URL:       resetURL,
+	})
+}
+
+// SendWelcomeEmail sends a welcome email after email verification
+func (e *EmailService) SendWelcomeEmail(email, firstName string) error {
+	if !e.enabled {
+		log.Info().
+			Str("email", email).
+			Msg("Email service disabled - welcome email not sent")
+		return nil
+	}
+
+	return e.send("welcome", email, "Welcome to SREootb!", emailTemplateData{
+		FirstName: firstName,
+		Email:     email,
+	})
+}
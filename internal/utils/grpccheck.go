@@ -0,0 +1,307 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// maxGRPCResponseSize bounds the health response read from a server
+const maxGRPCResponseSize = 64 << 10
+
+// grpcServingStatuses names the values of grpc.health.v1.HealthCheckResponse.ServingStatus
+var grpcServingStatuses = map[uint64]string{
+	0: "UNKNOWN",
+	1: "SERVING",
+	2: "NOT_SERVING",
+	3: "SERVICE_UNKNOWN",
+}
+
+// grpcCodes names gRPC status codes
+var grpcCodes = map[int]string{
+	0: "OK", 1: "CANCELLED", 2: "UNKNOWN", 3: "INVALID_ARGUMENT", 4: "DEADLINE_EXCEEDED",
+	5: "NOT_FOUND", 6: "ALREADY_EXISTS", 7: "PERMISSION_DENIED", 8: "RESOURCE_EXHAUSTED",
+	9: "FAILED_PRECONDITION", 10: "ABORTED", 11: "OUT_OF_RANGE", 12: "UNIMPLEMENTED",
+	13: "INTERNAL", 14: "UNAVAILABLE", 15: "DATA_LOSS", 16: "UNAUTHENTICATED",
+}
+
+// GRPCCheckResult describes a grpc:// health check
+type GRPCCheckResult struct {
+	Address       string         `json:"address"`
+	Service       string         `json:"service,omitempty"` // Empty for the server as a whole
+	Status        string         `json:"status"`            // "up", "degraded" or "down"
+	ServingStatus string         `json:"serving_status,omitempty"`
+	GRPCStatus    *int           `json:"grpc_status,omitempty"`
+	GRPCMessage   string         `json:"grpc_message,omitempty"`
+	RPCMs         float64        `json:"rpc_ms"` // From sending the request to reading the trailers
+	TLS           *TLSInspection `json:"tls,omitempty"`
+}
+
+// CheckGRPC calls grpc.health.v1.Health/Check for the service of a grpc://
+// URL over HTTP/2, plaintext or TLS as configured by cfg (which may be nil).
+// SERVING is up, UNKNOWN degraded and anything else down. An error means the
+// RPC itself failed.
+func CheckGRPC(ctx context.Context, rawURL string, cfg *models.GRPCCheckConfig, tlsCfg *models.TLSCheckConfig) (*GRPCCheckResult, error) {
+	address, service, err := models.ParseGRPCURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &models.GRPCCheckConfig{}
+	}
+	result := &GRPCCheckResult{Address: address, Service: service, Status: "down"}
+
+	transport := &http2.Transport{}
+	scheme := "https"
+	if cfg.TLS {
+		if transport.TLSClientConfig, err = grpcTLSConfig(address, cfg); err != nil {
+			return result, err
+		}
+	} else {
+		// Plaintext HTTP/2 with prior knowledge, as gRPC clients use it
+		scheme = "http"
+		transport.AllowHTTP = true
+		transport.DialTLSContext = func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+	}
+	defer transport.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, scheme+"://"+address+"/grpc.health.v1.Health/Check",
+		bytes.NewReader(grpcFrame(grpcHealthRequest(service))))
+	if err != nil {
+		return result, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set("Grpc-Timeout", grpcTimeout(time.Until(deadline)))
+	}
+	if cfg.Authority != "" {
+		req.Host = cfg.Authority
+	}
+
+	start := time.Now()
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		result.RPCMs = milliseconds(time.Since(start))
+		result.TLS = InspectTLSError(err)
+		return result, fmt.Errorf("RPC failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxGRPCResponseSize))
+	result.RPCMs = milliseconds(time.Since(start))
+	if resp.TLS != nil {
+		result.TLS = InspectTLSState(resp.TLS, tlsCfg, time.Now())
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return result, fmt.Errorf("server answered HTTP %d, not gRPC", resp.StatusCode)
+	}
+
+	// Errors come as trailers, or in the headers of a trailers-only response
+	statusText := resp.Trailer.Get("Grpc-Status")
+	message := resp.Trailer.Get("Grpc-Message")
+	if statusText == "" {
+		statusText, message = resp.Header.Get("Grpc-Status"), resp.Header.Get("Grpc-Message")
+	}
+	if statusText == "" {
+		return result, fmt.Errorf("response has no grpc-status")
+	}
+	code, err := strconv.Atoi(statusText)
+	if err != nil {
+		return result, fmt.Errorf("invalid grpc-status %q", statusText)
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	result.GRPCStatus, result.GRPCMessage = &code, message
+	if code != 0 {
+		return result, grpcError(code, message, service)
+	}
+
+	status, err := parseGRPCHealthResponse(body)
+	if err != nil {
+		return result, err
+	}
+	result.ServingStatus = status
+	switch status {
+	case "SERVING":
+		result.Status = "up"
+	case "UNKNOWN":
+		result.Status = "degraded"
+	}
+	return result, nil
+}
+
+// grpcTLSConfig builds the client TLS settings of cfg
+func grpcTLSConfig(address string, cfg *models.GRPCCheckConfig) (*tls.Config, error) {
+	serverName := cfg.ServerName
+	if serverName == "" {
+		authority := cfg.Authority
+		if authority == "" {
+			authority = address
+		}
+		serverName = authority
+		if host, _, err := net.SplitHostPort(authority); err == nil {
+			serverName = host
+		}
+	}
+	tlsConfig := &tls.Config{ServerName: serverName, NextProtos: []string{"h2"}}
+
+	// File errors are kept generic so a check result does not reveal which
+	// paths exist on the host running the check
+	caPEM := []byte(cfg.CAPEM)
+	if cfg.CAFile != "" {
+		var err error
+		if caPEM, err = os.ReadFile(cfg.CAFile); err != nil {
+			return nil, fmt.Errorf("ca_file could not be loaded")
+		}
+	}
+	if len(caPEM) > 0 {
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("CA certificates could not be loaded")
+		}
+		tlsConfig.RootCAs = roots
+	}
+
+	switch {
+	case cfg.ClientCertPEM != "":
+		cert, err := tls.X509KeyPair([]byte(cfg.ClientCertPEM), []byte(cfg.ClientKeyPEM))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	case cfg.ClientCertFile != "":
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCertFile, cfg.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("client_cert_file and client_key_file could not be loaded")
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// grpcHealthRequest encodes a grpc.health.v1.HealthCheckRequest
+func grpcHealthRequest(service string) []byte {
+	if service == "" {
+		return nil
+	}
+	// Field 1 (service), wire type 2 (length-delimited)
+	message := []byte{0x0a}
+	message = binary.AppendUvarint(message, uint64(len(service)))
+	return append(message, service...)
+}
+
+// grpcFrame prefixes a message with the uncompressed flag and its length
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5, 5+len(message))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// parseGRPCHealthResponse decodes the serving status of a framed
+// grpc.health.v1.HealthCheckResponse
+func parseGRPCHealthResponse(body []byte) (string, error) {
+	if len(body) < 5 {
+		return "", fmt.Errorf("response has no health message")
+	}
+	if body[0] != 0 {
+		return "", fmt.Errorf("compressed responses are not supported")
+	}
+	length := binary.BigEndian.Uint32(body[1:5])
+	if uint64(len(body)-5) < uint64(length) {
+		return "", fmt.Errorf("truncated health message")
+	}
+	message := body[5 : 5+length]
+
+	// An absent status field is the default, UNKNOWN
+	var status uint64
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return "", fmt.Errorf("invalid health message")
+		}
+		message = message[n:]
+
+		field, wireType := key>>3, key&7
+		switch wireType {
+		case 0:
+			value, n := binary.Uvarint(message)
+			if n <= 0 {
+				return "", fmt.Errorf("invalid health message")
+			}
+			message = message[n:]
+			if field == 1 {
+				status = value
+			}
+		case 1, 5:
+			size := 8
+			if wireType == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return "", fmt.Errorf("invalid health message")
+			}
+			message = message[size:]
+		case 2:
+			size, n := binary.Uvarint(message)
+			if n <= 0 || uint64(len(message)-n) < size {
+				return "", fmt.Errorf("invalid health message")
+			}
+			message = message[n+int(size):]
+		default:
+			return "", fmt.Errorf("invalid health message")
+		}
+	}
+
+	if name, ok := grpcServingStatuses[status]; ok {
+		return name, nil
+	}
+	return fmt.Sprintf("STATUS_%d", status), nil
+}
+
+// grpcError describes a failed health RPC
+func grpcError(code int, message, service string) error {
+	name, ok := grpcCodes[code]
+	if !ok {
+		name = fmt.Sprintf("CODE_%d", code)
+	}
+	switch code {
+	case 12:
+		return fmt.Errorf("server does not implement grpc.health.v1.Health (%s)", name)
+	case 5:
+		return fmt.Errorf("health server does not know service %q (%s)", service, name)
+	}
+	if message != "" {
+		return fmt.Errorf("RPC failed: %s: %s", name, message)
+	}
+	return fmt.Errorf("RPC failed: %s", name)
+}
+
+// grpcTimeout encodes a grpc-timeout header value
+func grpcTimeout(d time.Duration) string {
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10) + "m"
+}
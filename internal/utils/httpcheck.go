@@ -0,0 +1,257 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// NewHTTPCheckClient returns a client for one HTTP monitor check, applying the
+// redirect policy and IP version preference of cfg (which may be nil). The
+// client gets its own copy of base so per-check dial settings never leak into
+// shared transports; base may be nil.
+func NewHTTPCheckClient(cfg *models.HTTPCheckConfig, base *http.Transport, timeout time.Duration) *http.Client {
+	var transport *http.Transport
+	if base != nil {
+		transport = base.Clone()
+	} else {
+		transport = &http.Transport{
+			TLSHandshakeTimeout: 10 * time.Second,
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, DialNetwork(network, cfg.PreferredIPVersion()), addr)
+	}
+	transport.DisableKeepAlives = true
+
+	follow, maxRedirects := cfg.FollowsRedirects()
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if !follow {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+// NewHTTPCheckRequest builds the request described by cfg (which may be nil)
+func NewHTTPCheckRequest(ctx context.Context, cfg *models.HTTPCheckConfig, url, userAgent string) (*http.Request, error) {
+	var body io.Reader
+	if cfg != nil && cfg.Body != "" {
+		body = strings.NewReader(cfg.Body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, cfg.RequestMethod(), url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	if cfg != nil {
+		for _, headers := range []map[string]string{cfg.Headers, cfg.SecretHeaders} {
+			for name, value := range headers {
+				if strings.EqualFold(name, "Host") {
+					req.Host = value
+					continue
+				}
+				req.Header.Set(name, value)
+			}
+		}
+	}
+
+	return req, nil
+}
+
+// DialNetwork restricts a "tcp" or "udp" network to IPv4 or IPv6 according to ipVersion
+func DialNetwork(network, ipVersion string) string {
+	switch ipVersion {
+	case models.IPVersion4:
+		return network + "4"
+	case models.IPVersion6:
+		return network + "6"
+	}
+	return network
+}
+
+// MaxAssertionBodySize limits how much of a response body is read to evaluate assertions
+const MaxAssertionBodySize = 10 << 20
+
+// HTTPAssertionResult is the outcome of one HTTP response assertion
+type HTTPAssertionResult struct {
+	Type     string `json:"type"`
+	Target   string `json:"target,omitempty"` // Path or header the assertion looked at
+	Passed   bool   `json:"passed"`
+	Degraded bool   `json:"degraded,omitempty"` // Failing only degrades the check
+	Message  string `json:"message,omitempty"`  // Why the assertion failed
+}
+
+// ReadAssertionBody reads up to MaxAssertionBodySize bytes of a response body.
+// The returned size counts the bytes read, capped one past the limit so
+// oversized bodies still fail size assertions.
+func ReadAssertionBody(body io.Reader) ([]byte, int64, error) {
+	data, err := io.ReadAll(io.LimitReader(body, MaxAssertionBodySize+1))
+	size := int64(len(data))
+	if size > MaxAssertionBodySize {
+		data = data[:MaxAssertionBodySize]
+	}
+	return data, size, err
+}
+
+// EvaluateHTTPAssertions checks a response against every assertion in order.
+// responseTime is the time taken to receive the response headers.
+func EvaluateHTTPAssertions(assertions []models.HTTPAssertion, header http.Header, body []byte, size int64, responseTime time.Duration) []HTTPAssertionResult {
+	results := make([]HTTPAssertionResult, 0, len(assertions))
+	for _, assertion := range assertions {
+		result := HTTPAssertionResult{Type: assertion.Type}
+		var failure string
+
+		switch assertion.Type {
+		case models.AssertBodyContains:
+			if !bytes.Contains(body, []byte(assertion.Value)) {
+				failure = fmt.Sprintf("body does not contain %q", assertion.Value)
+			}
+		case models.AssertBodyNotContains:
+			if bytes.Contains(body, []byte(assertion.Value)) {
+				failure = fmt.Sprintf("body contains %q", assertion.Value)
+			}
+		case models.AssertBodyRegex:
+			re, err := regexp.Compile(assertion.Value)
+			if err != nil {
+				failure = fmt.Sprintf("invalid regex: %v", err)
+			} else if !re.Match(body) {
+				failure = fmt.Sprintf("body does not match /%s/", assertion.Value)
+			}
+		case models.AssertJSONPathEquals, models.AssertJSONPathMatches:
+			result.Target = assertion.Path
+			failure = checkJSONPath(assertion, body)
+		case models.AssertHeaderPresent:
+			result.Target = assertion.Header
+			if len(header.Values(assertion.Header)) == 0 {
+				failure = fmt.Sprintf("header %s is missing", assertion.Header)
+			}
+		case models.AssertHeaderEquals:
+			result.Target = assertion.Header
+			if values := header.Values(assertion.Header); len(values) == 0 {
+				failure = fmt.Sprintf("header %s is missing", assertion.Header)
+			} else if values[0] != assertion.Value {
+				failure = fmt.Sprintf("header %s is %q, expected %q", assertion.Header, values[0], assertion.Value)
+			}
+		case models.AssertSize:
+			if assertion.MinBytes != nil && size < *assertion.MinBytes {
+				failure = fmt.Sprintf("body is %d bytes, expected at least %d", size, *assertion.MinBytes)
+			} else if assertion.MaxBytes != nil && size > *assertion.MaxBytes {
+				failure = fmt.Sprintf("body is over %d bytes", *assertion.MaxBytes)
+			}
+		case models.AssertLatencyBelow:
+			result.Degraded = true
+			threshold, err := time.ParseDuration(assertion.Threshold)
+			if err != nil {
+				failure = fmt.Sprintf("invalid threshold %q", assertion.Threshold)
+			} else if responseTime >= threshold {
+				failure = fmt.Sprintf("response took %s, threshold is %s", responseTime.Round(time.Millisecond), threshold)
+			}
+		default:
+			failure = fmt.Sprintf("unknown assertion type %q", assertion.Type)
+		}
+
+		result.Passed = failure == ""
+		result.Message = failure
+		results = append(results, result)
+	}
+	return results
+}
+
+// checkJSONPath evaluates a json_path_* assertion, returning why it failed or ""
+func checkJSONPath(assertion models.HTTPAssertion, body []byte) string {
+	segments, err := models.ParseJSONPath(assertion.Path)
+	if err != nil {
+		return err.Error()
+	}
+
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return fmt.Sprintf("body is not valid JSON: %v", err)
+	}
+
+	value, ok := lookupJSONPath(document, segments)
+	if !ok {
+		return fmt.Sprintf("%s not found", assertion.Path)
+	}
+	actual := jsonValueString(value)
+
+	if assertion.Type == models.AssertJSONPathMatches {
+		re, err := regexp.Compile(assertion.Value)
+		if err != nil {
+			return fmt.Sprintf("invalid regex: %v", err)
+		}
+		if !re.MatchString(actual) {
+			return fmt.Sprintf("%s is %q, does not match /%s/", assertion.Path, actual, assertion.Value)
+		}
+		return ""
+	}
+
+	if actual != assertion.Value {
+		return fmt.Sprintf("%s is %q, expected %q", assertion.Path, actual, assertion.Value)
+	}
+	return ""
+}
+
+// lookupJSONPath walks a decoded JSON document along segments from models.ParseJSONPath
+func lookupJSONPath(document interface{}, segments []string) (interface{}, bool) {
+	current := document
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, "[") {
+			list, ok := current.([]interface{})
+			if !ok {
+				return nil, false
+			}
+			index, err := strconv.Atoi(strings.Trim(segment, "[]"))
+			if err != nil || index < 0 || index >= len(list) {
+				return nil, false
+			}
+			current = list[index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[segment]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// jsonValueString renders a JSON value for comparison: strings as-is, anything else as JSON
+func jsonValueString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
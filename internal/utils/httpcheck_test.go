@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+func int64Ptr(n int64) *int64 { return &n }
+
+func TestEvaluateHTTPAssertions(t *testing.T) {
+	body := []byte(`{"status":"ok","version":2,"healthy":true,"items":[{"id":"a1"},{"id":"b2"}],"meta":null}`)
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Add("X-Region", "eu-west")
+	header.Add("X-Region", "us-east")
+
+	tests := []struct {
+		name        string
+		assertion   models.HTTPAssertion
+		latency     time.Duration
+		wantPassed  bool
+		wantMessage string
+	}{
+		{"body contains", models.HTTPAssertion{Type: models.AssertBodyContains, Value: `"status":"ok"`}, 0, true, ""},
+		{"body lacks keyword", models.HTTPAssertion{Type: models.AssertBodyContains, Value: "maintenance"}, 0, false, `body does not contain "maintenance"`},
+		{"body not contains", models.HTTPAssertion{Type: models.AssertBodyNotContains, Value: "error"}, 0, true, ""},
+		{"body contains forbidden keyword", models.HTTPAssertion{Type: models.AssertBodyNotContains, Value: "healthy"}, 0, false, `body contains "healthy"`},
+		{"body regex", models.HTTPAssertion{Type: models.AssertBodyRegex, Value: `"version":\d+`}, 0, true, ""},
+		{"body regex mismatch", models.HTTPAssertion{Type: models.AssertBodyRegex, Value: `^<html`}, 0, false, "body does not match /^<html/"},
+		{"invalid regex", models.HTTPAssertion{Type: models.AssertBodyRegex, Value: `(`}, 0, false, "invalid regex"},
+		{"json string", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.status", Value: "ok"}, 0, true, ""},
+		{"json number", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "version", Value: "2"}, 0, true, ""},
+		{"json bool", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.healthy", Value: "true"}, 0, true, ""},
+		{"json null", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.meta", Value: "null"}, 0, true, ""},
+		{"json array index", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.items[1].id", Value: "b2"}, 0, true, ""},
+		{"json value differs", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.status", Value: "degraded"}, 0, false, `$.status is "ok", expected "degraded"`},
+		{"json index out of range", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.items[5].id", Value: "a1"}, 0, false, "$.items[5].id not found"},
+		{"json missing key", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.uptime", Value: "1"}, 0, false, "$.uptime not found"},
+		{"json index into object", models.HTTPAssertion{Type: models.AssertJSONPathEquals, Path: "$.status[0]", Value: "o"}, 0, false, "not found"},
+		{"json matches", models.HTTPAssertion{Type: models.AssertJSONPathMatches, Path: "$.items[0].id", Value: `^[a-z]\d$`}, 0, true, ""},
+		{"json does not match", models.HTTPAssertion{Type: models.AssertJSONPathMatches, Path: "$.status", Value: `^fail`}, 0, false, "does not match /^fail/"},
+		{"header present", models.HTTPAssertion{Type: models.AssertHeaderPresent, Header: "content-type"}, 0, true, ""},
+		{"header missing", models.HTTPAssertion{Type: models.AssertHeaderPresent, Header: "X-Request-ID"}, 0, false, "header X-Request-ID is missing"},
+		{"header equals first value", models.HTTPAssertion{Type: models.AssertHeaderEquals, Header: "X-Region", Value: "eu-west"}, 0, true, ""},
+		{"header differs", models.HTTPAssertion{Type: models.AssertHeaderEquals, Header: "X-Region", Value: "us-east"}, 0, false, `header X-Region is "eu-west", expected "us-east"`},
+		{"size within bounds", models.HTTPAssertion{Type: models.AssertSize, MinBytes: int64Ptr(10), MaxBytes: int64Ptr(1000)}, 0, true, ""},
+		{"size too small", models.HTTPAssertion{Type: models.AssertSize, MinBytes: int64Ptr(1000)}, 0, false, "expected at least 1000"},
+		{"size too large", models.HTTPAssertion{Type: models.AssertSize, MaxBytes: int64Ptr(10)}, 0, false, "body is over 10 bytes"},
+		{"fast enough", models.HTTPAssertion{Type: models.AssertLatencyBelow, Threshold: "800ms"}, 200 * time.Millisecond, true, ""},
+		{"too slow", models.HTTPAssertion{Type: models.AssertLatencyBelow, Threshold: "800ms"}, 800 * time.Millisecond, false, "response took 800ms, threshold is 800ms"},
+		{"unknown type", models.HTTPAssertion{Type: "body_length"}, 0, false, `unknown assertion type "body_length"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results := EvaluateHTTPAssertions([]models.HTTPAssertion{tt.assertion}, header, body, int64(len(body)), tt.latency)
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			result := results[0]
+			if result.Passed != tt.wantPassed {
+				t.Errorf("passed = %v, want %v (message %q)", result.Passed, tt.wantPassed, result.Message)
+			}
+			if !strings.Contains(result.Message, tt.wantMessage) || (tt.wantPassed && result.Message != "") {
+				t.Errorf("message = %q, want it to contain %q", result.Message, tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestEvaluateHTTPAssertionsResults(t *testing.T) {
+	assertions := []models.HTTPAssertion{
+		{Type: models.AssertJSONPathEquals, Path: "$.status", Value: "ok"},
+		{Type: models.AssertHeaderPresent, Header: "ETag"},
+		{Type: models.AssertLatencyBelow, Threshold: "1s"},
+	}
+	results := EvaluateHTTPAssertions(assertions, http.Header{}, []byte(`not json`), 8, 2*time.Second)
+
+	want := []HTTPAssertionResult{
+		{Type: models.AssertJSONPathEquals, Target: "$.status"},
+		{Type: models.AssertHeaderPresent, Target: "ETag"},
+		{Type: models.AssertLatencyBelow, Degraded: true},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, result := range results {
+		if result.Type != want[i].Type || result.Target != want[i].Target || result.Degraded != want[i].Degraded || result.Passed {
+			t.Errorf("result %d = %+v, want a failed %+v", i, result, want[i])
+		}
+	}
+	if !strings.HasPrefix(results[0].Message, "body is not valid JSON") {
+		t.Errorf("message = %q, want a JSON decoding failure", results[0].Message)
+	}
+}
+
+func TestReadAssertionBodyCapsSize(t *testing.T) {
+	data, size, err := ReadAssertionBody(bytes.NewReader(make([]byte, MaxAssertionBodySize+4096)))
+	if err != nil {
+		t.Fatalf("ReadAssertionBody: %v", err)
+	}
+	if len(data) != MaxAssertionBodySize {
+		t.Errorf("read %d bytes, want %d", len(data), MaxAssertionBodySize)
+	}
+	if size != MaxAssertionBodySize+1 {
+		t.Errorf("size = %d, want one past the limit so size assertions fail", size)
+	}
+
+	data, size, _ = ReadAssertionBody(strings.NewReader("small"))
+	if string(data) != "small" || size != 5 {
+		t.Errorf("ReadAssertionBody = %q, %d", data, size)
+	}
+}
@@ -0,0 +1,410 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// Phases of a mail check, in the order they run
+const (
+	MailPhaseConnect      = "connect"
+	MailPhaseTLS          = "tls" // Handshake of smtps:// and imaps://
+	MailPhaseGreeting     = "greeting"
+	MailPhaseCapabilities = "capabilities" // EHLO or CAPABILITY
+	MailPhaseStartTLS     = "starttls"
+	MailPhaseAuth         = "auth"
+)
+
+// MailPhaseResult times one phase of a mail check in milliseconds
+type MailPhaseResult struct {
+	Phase string  `json:"phase"`
+	Ms    float64 `json:"ms"`
+}
+
+// MailCheckResult describes an SMTP or IMAP check
+type MailCheckResult struct {
+	Protocol      string            `json:"protocol"` // "smtp" or "imap"
+	Address       string            `json:"address"`
+	Banner        string            `json:"banner,omitempty"`
+	Capabilities  []string          `json:"capabilities,omitempty"` // As last announced, after STARTTLS if used
+	Authenticated bool              `json:"authenticated"`
+	Phases        []MailPhaseResult `json:"phases"` // Completed phases and the failing one
+	FailedPhase   string            `json:"failed_phase,omitempty"`
+	TotalMs       float64           `json:"total_ms"`
+	TLS           *TLSInspection    `json:"tls,omitempty"`
+}
+
+// mailSession is a connection to a mail server being checked
+type mailSession struct {
+	conn   net.Conn
+	text   *textproto.Conn
+	cfg    *models.MailCheckConfig
+	tlsCfg *models.TLSCheckConfig
+	host   string
+	result *MailCheckResult
+	tag    int // Last IMAP command tag
+}
+
+// CheckMail connects to the server of an smtp://, smtps://, imap:// or
+// imaps:// URL and runs the greeting, capability, STARTTLS and authentication
+// phases that cfg (which may be nil) asks for. The error names the phase that
+// failed, which is also recorded in the result.
+func CheckMail(ctx context.Context, rawURL string, cfg *models.MailCheckConfig, tlsCfg *models.TLSCheckConfig) (*MailCheckResult, error) {
+	protocol, address, implicitTLS, err := models.ParseMailURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		cfg = &models.MailCheckConfig{}
+	}
+	result := &MailCheckResult{Protocol: protocol, Address: address, Phases: []MailPhaseResult{}}
+	host, _, _ := net.SplitHostPort(address)
+	s := &mailSession{cfg: cfg, tlsCfg: tlsCfg, host: host, result: result}
+
+	start := time.Now()
+	defer func() { result.TotalMs = milliseconds(time.Since(start)) }()
+
+	err = s.phase(MailPhaseConnect, func() error {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			conn.SetDeadline(deadline)
+		}
+		s.setConn(conn)
+		return nil
+	})
+	if err != nil {
+		return result, err
+	}
+	defer s.conn.Close()
+
+	if implicitTLS {
+		if err := s.phase(MailPhaseTLS, func() error { return s.handshake(ctx) }); err != nil {
+			return result, err
+		}
+	}
+
+	if protocol == "smtp" {
+		err = s.checkSMTP(ctx)
+	} else {
+		err = s.checkIMAP(ctx)
+	}
+	return result, err
+}
+
+// phase runs fn as the named phase, timing it and recording a failure
+func (s *mailSession) phase(name string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	s.result.Phases = append(s.result.Phases, MailPhaseResult{Phase: name, Ms: milliseconds(time.Since(start))})
+	if err != nil {
+		s.result.FailedPhase = name
+		return fmt.Errorf("%s failed: %w", name, err)
+	}
+	return nil
+}
+
+func (s *mailSession) setConn(conn net.Conn) {
+	s.conn = conn
+	s.text = textproto.NewConn(conn)
+}
+
+// handshake starts TLS on the connection and inspects the server's certificate
+func (s *mailSession) handshake(ctx context.Context) error {
+	serverName := s.cfg.ServerName
+	if serverName == "" {
+		serverName = s.host
+	}
+	tlsConn := tls.Client(s.conn, &tls.Config{ServerName: serverName})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		s.result.TLS = InspectTLSError(err)
+		return err
+	}
+	state := tlsConn.ConnectionState()
+	s.result.TLS = InspectTLSState(&state, s.tlsCfg, time.Now())
+	s.setConn(tlsConn)
+	return nil
+}
+
+// checkBanner matches the greeting against the configured expectation
+func (s *mailSession) checkBanner(banner string) error {
+	s.result.Banner = printableResponse([]byte(banner))
+	if s.cfg.ExpectBanner == "" {
+		return nil
+	}
+	re, err := regexp.Compile(s.cfg.ExpectBanner)
+	if err != nil {
+		return fmt.Errorf("invalid expect_banner: %w", err)
+	}
+	if !re.MatchString(banner) {
+		return fmt.Errorf("banner %q does not match /%s/", s.result.Banner, s.cfg.ExpectBanner)
+	}
+	return nil
+}
+
+// checkCapabilities records what the server announced and looks for the required capabilities
+func (s *mailSession) checkCapabilities(capabilities []string) error {
+	s.result.Capabilities = capabilities
+	var missing []string
+	for _, required := range s.cfg.RequiredCapabilities {
+		if _, ok := mailCapability(capabilities, required); !ok {
+			missing = append(missing, required)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("server does not announce %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// mailCapability finds a capability by its keyword, case-insensitively, and
+// returns its parameters
+func mailCapability(capabilities []string, name string) ([]string, bool) {
+	for _, capability := range capabilities {
+		fields := strings.Fields(capability)
+		if len(fields) > 0 && strings.EqualFold(fields[0], name) {
+			return fields[1:], true
+		}
+	}
+	return nil, false
+}
+
+// checkSMTP runs the SMTP phases and says QUIT
+func (s *mailSession) checkSMTP(ctx context.Context) error {
+	err := s.phase(MailPhaseGreeting, func() error {
+		_, banner, err := s.text.ReadResponse(220)
+		if err != nil {
+			return err
+		}
+		return s.checkBanner(banner)
+	})
+	if err != nil {
+		return err
+	}
+
+	helloName := s.cfg.HelloName
+	if helloName == "" {
+		if helloName, err = os.Hostname(); err != nil || helloName == "" {
+			helloName = "localhost"
+		}
+	}
+	var capabilities []string
+	ehlo := func() error {
+		id, err := s.text.Cmd("EHLO %s", helloName)
+		if err != nil {
+			return err
+		}
+		s.text.StartResponse(id)
+		defer s.text.EndResponse(id)
+		_, message, err := s.text.ReadResponse(250)
+		if err != nil {
+			return err
+		}
+		// The first line greets the client, the others are extensions
+		capabilities = strings.Split(message, "\n")[1:]
+		return nil
+	}
+
+	if s.cfg.StartTLS {
+		if err := s.phase(MailPhaseCapabilities, ehlo); err != nil {
+			return err
+		}
+		err := s.phase(MailPhaseStartTLS, func() error {
+			if _, ok := mailCapability(capabilities, "STARTTLS"); !ok {
+				return fmt.Errorf("server does not announce STARTTLS")
+			}
+			if _, _, err := s.smtpCommand(220, "STARTTLS"); err != nil {
+				return err
+			}
+			return s.handshake(ctx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Capabilities change after STARTTLS, so they are checked on the last EHLO
+	err = s.phase(MailPhaseCapabilities, func() error {
+		if err := ehlo(); err != nil {
+			return err
+		}
+		return s.checkCapabilities(capabilities)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.cfg.Username != "" {
+		if err := s.phase(MailPhaseAuth, func() error { return s.smtpAuth(capabilities) }); err != nil {
+			return err
+		}
+		s.result.Authenticated = true
+	}
+
+	s.smtpCommand(221, "QUIT")
+	return nil
+}
+
+// smtpCommand sends a command and reads its response, expecting code
+func (s *mailSession) smtpCommand(code int, format string, args ...interface{}) (int, string, error) {
+	id, err := s.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	s.text.StartResponse(id)
+	defer s.text.EndResponse(id)
+	return s.text.ReadResponse(code)
+}
+
+// smtpAuth authenticates with AUTH PLAIN, or AUTH LOGIN when that is all the server offers
+func (s *mailSession) smtpAuth(capabilities []string) error {
+	mechanisms, _ := mailCapability(capabilities, "AUTH")
+	encode := base64.StdEncoding.EncodeToString
+	for _, mechanism := range mechanisms {
+		if strings.EqualFold(mechanism, "PLAIN") {
+			_, _, err := s.smtpCommand(235, "AUTH PLAIN %s", encode([]byte("\x00"+s.cfg.Username+"\x00"+s.cfg.Password)))
+			return err
+		}
+	}
+	for _, mechanism := range mechanisms {
+		if strings.EqualFold(mechanism, "LOGIN") {
+			if _, _, err := s.smtpCommand(334, "AUTH LOGIN"); err != nil {
+				return err
+			}
+			if _, _, err := s.smtpCommand(334, "%s", encode([]byte(s.cfg.Username))); err != nil {
+				return err
+			}
+			_, _, err := s.smtpCommand(235, "%s", encode([]byte(s.cfg.Password)))
+			return err
+		}
+	}
+	return fmt.Errorf("server offers neither AUTH PLAIN nor AUTH LOGIN")
+}
+
+// checkIMAP runs the IMAP phases and says LOGOUT
+func (s *mailSession) checkIMAP(ctx context.Context) error {
+	err := s.phase(MailPhaseGreeting, func() error {
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return err
+		}
+		banner, ok := strings.CutPrefix(line, "* OK")
+		if !ok {
+			// A preauthenticated session is fine too
+			banner, ok = strings.CutPrefix(line, "* PREAUTH")
+		}
+		if !ok {
+			return fmt.Errorf("unexpected greeting %q", printableResponse([]byte(line)))
+		}
+		return s.checkBanner(strings.TrimSpace(banner))
+	})
+	if err != nil {
+		return err
+	}
+
+	var capabilities []string
+	capability := func() error {
+		untagged, err := s.imapCommand("CAPABILITY")
+		if err != nil {
+			return err
+		}
+		capabilities = nil
+		for _, line := range untagged {
+			if fields := strings.Fields(line); len(fields) > 0 && strings.EqualFold(fields[0], "CAPABILITY") {
+				capabilities = append(capabilities, fields[1:]...)
+			}
+		}
+		return nil
+	}
+
+	if s.cfg.StartTLS {
+		if err := s.phase(MailPhaseCapabilities, capability); err != nil {
+			return err
+		}
+		err := s.phase(MailPhaseStartTLS, func() error {
+			if _, ok := mailCapability(capabilities, "STARTTLS"); !ok {
+				return fmt.Errorf("server does not announce STARTTLS")
+			}
+			if _, err := s.imapCommand("STARTTLS"); err != nil {
+				return err
+			}
+			return s.handshake(ctx)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.phase(MailPhaseCapabilities, func() error {
+		if err := capability(); err != nil {
+			return err
+		}
+		return s.checkCapabilities(capabilities)
+	})
+	if err != nil {
+		return err
+	}
+
+	if s.cfg.Username != "" {
+		err := s.phase(MailPhaseAuth, func() error {
+			if _, ok := mailCapability(capabilities, "LOGINDISABLED"); ok {
+				return fmt.Errorf("server announces LOGINDISABLED")
+			}
+			_, err := s.imapCommand("LOGIN " + imapQuote(s.cfg.Username) + " " + imapQuote(s.cfg.Password))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		s.result.Authenticated = true
+	}
+
+	s.imapCommand("LOGOUT")
+	return nil
+}
+
+// imapCommand sends a tagged command and returns the untagged responses
+// before its completion, failing unless it completes with OK
+func (s *mailSession) imapCommand(command string) ([]string, error) {
+	s.tag++
+	tag := fmt.Sprintf("a%d", s.tag)
+	if err := s.text.PrintfLine("%s %s", tag, command); err != nil {
+		return nil, err
+	}
+
+	var untagged []string
+	for {
+		line, err := s.text.ReadLine()
+		if err != nil {
+			return untagged, err
+		}
+		if rest, ok := strings.CutPrefix(line, "* "); ok {
+			untagged = append(untagged, rest)
+			continue
+		}
+		if rest, ok := strings.CutPrefix(line, tag+" "); ok {
+			if status, _, _ := strings.Cut(rest, " "); strings.EqualFold(status, "OK") {
+				return untagged, nil
+			}
+			return untagged, fmt.Errorf("server answered %q", printableResponse([]byte(rest)))
+		}
+		return untagged, fmt.Errorf("unexpected response %q", printableResponse([]byte(line)))
+	}
+}
+
+// imapQuote encodes a quoted IMAP string
+func imapQuote(value string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value) + `"`
+}
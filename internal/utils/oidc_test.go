@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeOIDCProvider is an in-process identity provider serving discovery and a
+// JWKS, and signing ID tokens with its RSA key
+type fakeOIDCProvider struct {
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	kid       string
+	jwksHits  atomic.Int32
+	clientID  string
+	issuerURL string
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	fp := &fakeOIDCProvider{key: key, kid: "test-key", clientID: "sreootb"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 fp.issuerURL,
+			"authorization_endpoint": fp.issuerURL + "/authorize",
+			"token_endpoint":         fp.issuerURL + "/token",
+			"jwks_uri":               fp.issuerURL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		fp.jwksHits.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": fp.kid,
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	fp.server = httptest.NewServer(mux)
+	fp.issuerURL = fp.server.URL
+	t.Cleanup(fp.server.Close)
+
+	return fp
+}
+
+// relyingParty returns a provider client configured for the fake issuer
+func (fp *fakeOIDCProvider) relyingParty() *OIDCProvider {
+	return NewOIDCProvider(fp.issuerURL, fp.clientID, "secret", nil, fp.server.Client())
+}
+
+// claims returns a valid claim set that tests modify
+func (fp *fakeOIDCProvider) claims(nonce string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"iss":            fp.issuerURL,
+		"sub":            "user-1",
+		"aud":            fp.clientID,
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"iat":            now.Unix(),
+		"nonce":          nonce,
+		"email":          "user@example.com",
+		"email_verified": true,
+	}
+}
+
+// sign produces an RS256 ID token with the given key ID and signing key
+func (fp *fakeOIDCProvider) sign(t *testing.T, kid string, key *rsa.PrivateKey, claims map[string]interface{}) string {
+	t.Helper()
+
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": kid})
+	if err != nil {
+		t.Fatalf("marshal header: %v", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("marshal claims: %v", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestVerifyIDTokenAcceptsValidToken(t *testing.T) {
+	fp := newFakeOIDCProvider(t)
+	rp := fp.relyingParty()
+
+	token := fp.sign(t, fp.kid, fp.key, fp.claims("nonce-1"))
+	claims, err := rp.VerifyIDToken(context.Background(), token, "nonce-1")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims["sub"] != "user-1" || claims["email"] != "user@example.com" {
+		t.Errorf("unexpected claims: %v", claims)
+	}
+}
+
+func TestVerifyIDTokenRejections(t *testing.T) {
+	fp := newFakeOIDCProvider(t)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		nonce   string
+		token   func(claims map[string]interface{}) string
+		wantErr string
+	}{
+		{
+			name:  "signature from another key",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				return fp.sign(t, fp.kid, otherKey, claims)
+			},
+			wantErr: "signature",
+		},
+		{
+			name:  "tampered claims",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				parts := strings.Split(fp.sign(t, fp.kid, fp.key, claims), ".")
+				claims["sub"] = "admin"
+				payload, _ := json.Marshal(claims)
+				return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+			},
+			wantErr: "signature",
+		},
+		{
+			name:  "wrong issuer",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				claims["iss"] = "https://evil.example.com"
+				return fp.sign(t, fp.kid, fp.key, claims)
+			},
+			wantErr: "issuer",
+		},
+		{
+			name:  "wrong audience",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				claims["aud"] = []string{"another-client"}
+				return fp.sign(t, fp.kid, fp.key, claims)
+			},
+			wantErr: "not issued for this client",
+		},
+		{
+			name:  "expired",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				claims["exp"] = time.Now().Add(-10 * time.Minute).Unix()
+				return fp.sign(t, fp.kid, fp.key, claims)
+			},
+			wantErr: "expired",
+		},
+		{
+			name:  "missing expiry",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				delete(claims, "exp")
+				return fp.sign(t, fp.kid, fp.key, claims)
+			},
+			wantErr: "no expiry",
+		},
+		{
+			name:  "nonce mismatch",
+			nonce: "expected",
+			token: func(claims map[string]interface{}) string {
+				claims["nonce"] = "replayed"
+				return fp.sign(t, fp.kid, fp.key, claims)
+			},
+			wantErr: "nonce",
+		},
+		{
+			name:  "unknown key ID",
+			nonce: "n",
+			token: func(claims map[string]interface{}) string {
+				return fp.sign(t, "rotated-away", fp.key, claims)
+			},
+			wantErr: "no signing key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := fp.relyingParty()
+			token := tt.token(fp.claims("n"))
+			_, err := rp.VerifyIDToken(context.Background(), token, tt.nonce)
+			if err == nil {
+				t.Fatal("expected the token to be rejected")
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %q, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSigningKeyRefreshCooldown(t *testing.T) {
+	fp := newFakeOIDCProvider(t)
+	rp := fp.relyingParty()
+
+	for i := 0; i < 5; i++ {
+		token := fp.sign(t, "unknown", fp.key, fp.claims("n"))
+		if _, err := rp.VerifyIDToken(context.Background(), token, "n"); err == nil {
+			t.Fatal("expected a token with an unknown key ID to be rejected")
+		}
+	}
+	if hits := fp.jwksHits.Load(); hits != 1 {
+		t.Errorf("JWKS fetched %d times for unknown key IDs, want 1", hits)
+	}
+
+	// Keys already cached keep verifying without another fetch
+	token := fp.sign(t, fp.kid, fp.key, fp.claims("n"))
+	if _, err := rp.VerifyIDToken(context.Background(), token, "n"); err != nil {
+		t.Fatalf("VerifyIDToken with cached key: %v", err)
+	}
+	if hits := fp.jwksHits.Load(); hits != 1 {
+		t.Errorf("JWKS fetched %d times, want 1", hits)
+	}
+
+	// Once the cooldown has passed a rotated key is picked up
+	rp.mu.Lock()
+	rp.keysFetched = time.Now().Add(-jwksRefreshInterval)
+	rp.mu.Unlock()
+	fp.kid = "rotated"
+	token = fp.sign(t, "rotated", fp.key, fp.claims("n"))
+	if _, err := rp.VerifyIDToken(context.Background(), token, "n"); err != nil {
+		t.Fatalf("VerifyIDToken after rotation: %v", err)
+	}
+	if hits := fp.jwksHits.Load(); hits != 2 {
+		t.Errorf("JWKS fetched %d times after rotation, want 2", hits)
+	}
+}
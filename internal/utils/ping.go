@@ -0,0 +1,239 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// PingResult summarizes the ICMP echo probes sent to a host; times are in milliseconds
+type PingResult struct {
+	Address     string   `json:"address"`
+	Socket      string   `json:"socket"` // "datagram" (unprivileged) or "raw"
+	Sent        int      `json:"sent"`
+	Received    int      `json:"received"`
+	LossPercent float64  `json:"loss_percent"`
+	MinMs       *float64 `json:"min_ms,omitempty"`
+	AvgMs       *float64 `json:"avg_ms,omitempty"`
+	MaxMs       *float64 `json:"max_ms,omitempty"`
+	JitterMs    *float64 `json:"jitter_ms,omitempty"` // Mean difference between consecutive RTTs
+	Unreachable string   `json:"unreachable,omitempty"`
+}
+
+// Ping sends ICMP echo requests to host as configured by cfg (which may be
+// nil). It prefers unprivileged datagram sockets and falls back to raw
+// sockets. An error means no probe could be sent; lost probes are not errors.
+func Ping(ctx context.Context, host string, cfg *models.PingCheckConfig) (*PingResult, error) {
+	ipVersion := ""
+	if cfg != nil {
+		ipVersion = cfg.IPVersion
+	}
+	ip, err := resolvePingAddress(ctx, host, ipVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, socket, err := listenICMP(ip.To4() == nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	result := &PingResult{Address: ip.String(), Socket: socket}
+
+	var dst net.Addr = &net.IPAddr{IP: ip}
+	if socket == "datagram" {
+		dst = &net.UDPAddr{IP: ip}
+	}
+	var echoType icmp.Type = ipv4.ICMPTypeEcho
+	protocol := 1
+	if ip.To4() == nil {
+		echoType, protocol = ipv6.ICMPTypeEchoRequest, 58
+	}
+
+	// A random token in each payload tells our replies from those to other
+	// checks, since raw sockets see every echo reply the host receives
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return nil, err
+	}
+	id := int(token[0])<<8 | int(token[1])
+
+	count, interval, probeTimeout := cfg.Probes()
+	var rtts []float64
+	for seq := 0; seq < count; seq++ {
+		if seq > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(interval):
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		payload := append(append([]byte{}, token...), byte(seq>>8), byte(seq))
+		request, err := (&icmp.Message{
+			Type: echoType,
+			Body: &icmp.Echo{ID: id, Seq: seq, Data: payload},
+		}).Marshal(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		if _, err := conn.WriteTo(request, dst); err != nil {
+			if result.Sent == 0 {
+				return nil, fmt.Errorf("failed to send ICMP echo: %w", err)
+			}
+			break
+		}
+		result.Sent++
+
+		deadline := start.Add(probeTimeout)
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+			deadline = ctxDeadline
+		}
+		if rtt, ok := awaitEchoReply(conn, protocol, payload, start, deadline, result); ok {
+			rtts = append(rtts, milliseconds(rtt))
+		}
+	}
+
+	result.Received = len(rtts)
+	if result.Sent > 0 {
+		result.LossPercent = math.Round(float64(result.Sent-result.Received)/float64(result.Sent)*10000) / 100
+	}
+	summarizeRTTs(result, rtts)
+	return result, nil
+}
+
+// PingStatus judges a ping result against the thresholds of cfg (which may be nil)
+func PingStatus(result *PingResult, cfg *models.PingCheckConfig) (status, problem string) {
+	downLoss := 100.0
+	if cfg != nil && cfg.DownLossPercent != nil {
+		downLoss = *cfg.DownLossPercent
+	}
+
+	if result.Received == 0 || result.LossPercent >= downLoss {
+		if result.Unreachable != "" {
+			return "down", result.Unreachable
+		}
+		return "down", fmt.Sprintf("%.0f%% packet loss", result.LossPercent)
+	}
+	if cfg == nil {
+		return "up", ""
+	}
+	if cfg.DegradedLossPercent != nil && result.LossPercent > *cfg.DegradedLossPercent {
+		return "degraded", fmt.Sprintf("%.0f%% packet loss", result.LossPercent)
+	}
+	if threshold, err := time.ParseDuration(cfg.DegradedRTT); err == nil && result.AvgMs != nil && *result.AvgMs > milliseconds(threshold) {
+		return "degraded", fmt.Sprintf("average RTT %.1fms is above %s", *result.AvgMs, threshold)
+	}
+	return "up", ""
+}
+
+func resolvePingAddress(ctx context.Context, host, ipVersion string) (net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("DNS resolution failed: %w", err)
+	}
+	// Prefer IPv4 unless a version was asked for, like the ping command
+	var fallback net.IP
+	for _, addr := range addrs {
+		is6 := addr.IP.To4() == nil
+		switch {
+		case ipVersion == models.IPVersion4 && !is6, ipVersion == models.IPVersion6 && is6, ipVersion == "" && !is6:
+			return addr.IP, nil
+		case ipVersion == "" && fallback == nil:
+			fallback = addr.IP
+		}
+	}
+	if fallback != nil {
+		return fallback, nil
+	}
+	return nil, fmt.Errorf("%s has no %s address", host, ipVersion)
+}
+
+// listenICMP opens an unprivileged datagram ICMP socket, or a raw one if those are not permitted
+func listenICMP(v6 bool) (*icmp.PacketConn, string, error) {
+	datagram, raw, address := "udp4", "ip4:icmp", "0.0.0.0"
+	if v6 {
+		datagram, raw, address = "udp6", "ip6:ipv6-icmp", "::"
+	}
+
+	conn, err := icmp.ListenPacket(datagram, address)
+	if err == nil {
+		return conn, "datagram", nil
+	}
+	conn, rawErr := icmp.ListenPacket(raw, address)
+	if rawErr == nil {
+		return conn, "raw", nil
+	}
+	if errors.Is(rawErr, os.ErrPermission) {
+		return nil, "", fmt.Errorf("permission denied opening ICMP socket (allow unprivileged ping via net.ipv4.ping_group_range or grant CAP_NET_RAW): %w", rawErr)
+	}
+	return nil, "", fmt.Errorf("failed to open ICMP socket: %w", rawErr)
+}
+
+// awaitEchoReply reads until the reply carrying payload arrives or the deadline passes
+func awaitEchoReply(conn *icmp.PacketConn, protocol int, payload []byte, sent, deadline time.Time, result *PingResult) (time.Duration, bool) {
+	conn.SetReadDeadline(deadline)
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return 0, false
+		}
+		message, err := icmp.ParseMessage(protocol, buf[:n])
+		if err != nil {
+			continue
+		}
+
+		switch body := message.Body.(type) {
+		case *icmp.Echo:
+			if message.Type == ipv4.ICMPTypeEchoReply || message.Type == ipv6.ICMPTypeEchoReply {
+				if bytes.Equal(body.Data, payload) {
+					return time.Since(sent), true
+				}
+			}
+		case *icmp.DstUnreach:
+			// Only trust unreachables quoting one of our probes
+			if bytes.Contains(body.Data, payload[:len(payload)-2]) {
+				result.Unreachable = fmt.Sprintf("destination unreachable (reported by %s)", peer)
+			}
+		}
+	}
+}
+
+func summarizeRTTs(result *PingResult, rtts []float64) {
+	if len(rtts) == 0 {
+		return
+	}
+	minRTT, maxRTT, sum, jitter := rtts[0], rtts[0], 0.0, 0.0
+	for i, rtt := range rtts {
+		minRTT = math.Min(minRTT, rtt)
+		maxRTT = math.Max(maxRTT, rtt)
+		sum += rtt
+		if i > 0 {
+			jitter += math.Abs(rtt - rtts[i-1])
+		}
+	}
+	avg := sum / float64(len(rtts))
+	result.MinMs, result.AvgMs, result.MaxMs = &minRTT, &avg, &maxRTT
+	if len(rtts) > 1 {
+		jitter /= float64(len(rtts) - 1)
+		result.JitterMs = &jitter
+	}
+}
@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"math"
+	"testing"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+func float64Ptr(v float64) *float64 { return &v }
+
+func TestSummarizeRTTs(t *testing.T) {
+	tests := []struct {
+		name                string
+		rtts                []float64
+		min, avg, max       float64
+		jitter              *float64
+		wantNoLatencyFields bool
+	}{
+		{name: "no replies", rtts: nil, wantNoLatencyFields: true},
+		{name: "one reply has no jitter", rtts: []float64{12.5}, min: 12.5, avg: 12.5, max: 12.5},
+		{name: "steady", rtts: []float64{10, 10, 10}, min: 10, avg: 10, max: 10, jitter: float64Ptr(0)},
+		{name: "varying", rtts: []float64{10, 30, 20, 40}, min: 10, avg: 25, max: 40, jitter: float64Ptr(50.0 / 3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &PingResult{}
+			summarizeRTTs(result, tt.rtts)
+
+			if tt.wantNoLatencyFields {
+				if result.MinMs != nil || result.AvgMs != nil || result.MaxMs != nil || result.JitterMs != nil {
+					t.Errorf("result = %+v, want no latency fields", result)
+				}
+				return
+			}
+			if result.MinMs == nil || *result.MinMs != tt.min || *result.AvgMs != tt.avg || *result.MaxMs != tt.max {
+				t.Fatalf("min/avg/max = %v/%v/%v, want %v/%v/%v", deref(result.MinMs), deref(result.AvgMs), deref(result.MaxMs), tt.min, tt.avg, tt.max)
+			}
+			switch {
+			case tt.jitter == nil && result.JitterMs != nil:
+				t.Errorf("jitter = %v, want none", *result.JitterMs)
+			case tt.jitter != nil && (result.JitterMs == nil || math.Abs(*result.JitterMs-*tt.jitter) > 1e-9):
+				t.Errorf("jitter = %v, want %v", deref(result.JitterMs), *tt.jitter)
+			}
+		})
+	}
+}
+
+func deref(v *float64) interface{} {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
+
+func TestPingStatus(t *testing.T) {
+	result := func(sent, received int, avgMs float64) *PingResult {
+		r := &PingResult{Sent: sent, Received: received, AvgMs: &avgMs}
+		r.LossPercent = float64(sent-received) / float64(sent) * 100
+		return r
+	}
+
+	tests := []struct {
+		name        string
+		result      *PingResult
+		cfg         *models.PingCheckConfig
+		wantStatus  string
+		wantProblem string
+	}{
+		{"all replies", result(3, 3, 10), nil, "up", ""},
+		{"partial loss without thresholds", result(4, 1, 10), nil, "up", ""},
+		{"no replies", result(3, 0, 0), nil, "down", "100% packet loss"},
+		{"unreachable", &PingResult{Sent: 3, LossPercent: 100, Unreachable: "destination unreachable (reported by 192.0.2.1)"}, nil, "down", "destination unreachable (reported by 192.0.2.1)"},
+		{"loss reaches down threshold", result(4, 2, 10), &models.PingCheckConfig{DownLossPercent: float64Ptr(50)}, "down", "50% packet loss"},
+		{"loss below down threshold", result(4, 3, 10), &models.PingCheckConfig{DownLossPercent: float64Ptr(50)}, "up", ""},
+		{"loss above degraded threshold", result(4, 3, 10), &models.PingCheckConfig{DegradedLossPercent: float64Ptr(20)}, "degraded", "25% packet loss"},
+		{"loss at degraded threshold", result(4, 3, 10), &models.PingCheckConfig{DegradedLossPercent: float64Ptr(25)}, "up", ""},
+		{"slow", result(3, 3, 180.04), &models.PingCheckConfig{DegradedRTT: "150ms"}, "degraded", "average RTT 180.0ms is above 150ms"},
+		{"fast enough", result(3, 3, 150), &models.PingCheckConfig{DegradedRTT: "150ms"}, "up", ""},
+		{"down wins over degraded", result(3, 0, 0), &models.PingCheckConfig{DegradedLossPercent: float64Ptr(10), DegradedRTT: "1ms"}, "down", "100% packet loss"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, problem := PingStatus(tt.result, tt.cfg)
+			if status != tt.wantStatus || problem != tt.wantProblem {
+				t.Errorf("PingStatus() = %q, %q, want %q, %q", status, problem, tt.wantStatus, tt.wantProblem)
+			}
+		})
+	}
+}
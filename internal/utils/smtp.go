@@ -0,0 +1,308 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/config"
+)
+
+// SMTPSender delivers email through an SMTP relay
+type SMTPSender struct {
+	cfg  config.SMTPConfig
+	from *mail.Address
+}
+
+// NewSMTPSender creates an SMTP sender from configuration
+func NewSMTPSender(cfg *config.SMTPConfig, from string) (*SMTPSender, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SMTP host is required")
+	}
+
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sender address %q: %w", from, err)
+	}
+
+	sender := &SMTPSender{cfg: *cfg, from: fromAddr}
+	if sender.cfg.Port == 0 {
+		sender.cfg.Port = 587
+	}
+	if sender.cfg.TLSMode == "" {
+		sender.cfg.TLSMode = "starttls"
+	}
+	if sender.cfg.Timeout <= 0 {
+		sender.cfg.Timeout = 30 * time.Second
+	}
+	if sender.cfg.HeloName == "" {
+		sender.cfg.HeloName = "localhost"
+	}
+
+	return sender, nil
+}
+
+// Send delivers a message through the configured relay
+func (s *SMTPSender) Send(msg *EmailMessage) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient address %q: %w", msg.To, err)
+	}
+
+	data, err := s.buildMessage(msg, to)
+	if err != nil {
+		return err
+	}
+
+	client, err := s.connect()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if err := client.Mail(s.from.Address); err != nil {
+		return fmt.Errorf("MAIL FROM rejected: %w", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("RCPT TO rejected: %w", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("DATA rejected: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("message rejected: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// connect dials the relay, negotiates TLS and authenticates
+func (s *SMTPSender) connect() (*smtp.Client, error) {
+	addr := net.JoinHostPort(s.cfg.Host, strconv.Itoa(s.cfg.Port))
+	tlsConfig := &tls.Config{
+		ServerName:         s.cfg.Host,
+		InsecureSkipVerify: s.cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	dialer := &net.Dialer{Timeout: s.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if s.cfg.TLSMode == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server %s: %w", addr, err)
+	}
+	conn.SetDeadline(time.Now().Add(s.cfg.Timeout))
+
+	client, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SMTP handshake failed: %w", err)
+	}
+
+	if err := client.Hello(s.cfg.HeloName); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("EHLO failed: %w", err)
+	}
+
+	if s.cfg.TLSMode == "starttls" {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			client.Close()
+			return nil, fmt.Errorf("SMTP server does not support STARTTLS")
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("STARTTLS failed: %w", err)
+		}
+	}
+
+	if s.cfg.Username != "" {
+		auth, err := s.auth(client)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		if err := client.Auth(auth); err != nil {
+			client.Close()
+			return nil, fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+// auth picks the SMTP authentication mechanism
+func (s *SMTPSender) auth(client *smtp.Client) (smtp.Auth, error) {
+	method := s.cfg.AuthMethod
+	if method == "" {
+		ok, mechanisms := client.Extension("AUTH")
+		if !ok {
+			return nil, fmt.Errorf("SMTP server does not support authentication")
+		}
+		method = "login"
+		for _, m := range strings.Fields(strings.ToUpper(mechanisms)) {
+			if m == "PLAIN" {
+				method = "plain"
+				break
+			}
+		}
+	}
+
+	switch method {
+	case "plain":
+		return smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host), nil
+	case "login":
+		return &loginAuth{username: s.cfg.Username, password: s.cfg.Password, host: s.cfg.Host}, nil
+	default:
+		return nil, fmt.Errorf("unsupported SMTP auth method: %s", method)
+	}
+}
+
+// buildMessage renders RFC 5322 headers and a text or multipart/alternative body
+func (s *SMTPSender) buildMessage(msg *EmailMessage, to *mail.Address) ([]byte, error) {
+	var buf bytes.Buffer
+
+	messageID, err := GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+	domain := s.from.Address[strings.LastIndex(s.from.Address, "@")+1:]
+
+	headers := []string{
+		"From: " + s.from.String(),
+		"To: " + to.String(),
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"Message-ID: <" + messageID + "@" + domain + ">",
+		"MIME-Version: 1.0",
+	}
+	for _, h := range headers {
+		buf.WriteString(h + "\r\n")
+	}
+
+	if msg.HTMLBody == "" {
+		buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, msg.TextBody); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	mw := multipart.NewWriter(&buf)
+	boundary, err := randomBoundary()
+	if err != nil {
+		return nil, err
+	}
+	if err := mw.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	buf.WriteString("Content-Type: multipart/alternative; boundary=" + boundary + "\r\n\r\n")
+
+	for _, part := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain; charset=utf-8", msg.TextBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := writeQuotedPrintable(pw, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// writeQuotedPrintable writes body using quoted-printable transfer encoding
+func writeQuotedPrintable(w io.Writer, body string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := qp.Write([]byte(body)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// randomBoundary generates a MIME multipart boundary
+func randomBoundary() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "sreootb-" + hex.EncodeToString(b), nil
+}
+
+// loginAuth implements the LOGIN SMTP authentication mechanism, which net/smtp lacks
+type loginAuth struct {
+	username string
+	password string
+	host     string
+}
+
+// Start begins LOGIN authentication, refusing to send credentials in the clear to remote hosts
+func (a *loginAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	if !server.TLS && !isLocalSMTPHost(server.Name) {
+		return "", nil, errors.New("unencrypted connection")
+	}
+	if server.Name != a.host {
+		return "", nil, errors.New("wrong host name")
+	}
+	return "LOGIN", nil, nil
+}
+
+// Next answers the server's username and password prompts
+func (a *loginAuth) Next(fromServer []byte, more bool) ([]byte, error) {
+	if !more {
+		return nil, nil
+	}
+
+	prompt := strings.ToLower(strings.TrimSpace(string(fromServer)))
+	switch {
+	case strings.HasPrefix(prompt, "username"):
+		return []byte(a.username), nil
+	case strings.HasPrefix(prompt, "password"):
+		return []byte(a.password), nil
+	default:
+		return nil, fmt.Errorf("unexpected LOGIN prompt: %q", fromServer)
+	}
+}
+
+// isLocalSMTPHost reports whether the relay is on the local machine
+func isLocalSMTPHost(name string) bool {
+	return name == "localhost" || name == "127.0.0.1" || name == "::1"
+}
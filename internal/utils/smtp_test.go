@@ -0,0 +1,368 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/config"
+)
+
+// fakeSMTPServer is an in-process SMTP relay that records what clients send
+type fakeSMTPServer struct {
+	listener   net.Listener
+	tlsConfig  *tls.Config
+	implicit   bool     // TLS from the first byte
+	startTLS   bool     // Advertise STARTTLS
+	mechanisms []string // Advertised AUTH mechanisms
+	username   string
+	password   string
+
+	mu       sync.Mutex
+	sessions []*fakeSMTPSession
+}
+
+// fakeSMTPSession is what one client connection did
+type fakeSMTPSession struct {
+	TLS       bool   // The connection was encrypted when the message was sent
+	Mechanism string // AUTH mechanism that succeeded
+	From      string
+	To        []string
+	Data      string
+}
+
+func newFakeSMTPServer(t *testing.T, implicit, startTLS bool, mechanisms ...string) *fakeSMTPServer {
+	t.Helper()
+
+	srv := &fakeSMTPServer{
+		tlsConfig:  selfSignedTLSConfig(t),
+		implicit:   implicit,
+		startTLS:   startTLS,
+		mechanisms: mechanisms,
+		username:   "mailer",
+		password:   "s3cret",
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if implicit {
+		listener = tls.NewListener(listener, srv.tlsConfig)
+	}
+	srv.listener = listener
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go srv.serve(conn)
+		}
+	}()
+
+	return srv
+}
+
+// config returns sender settings pointing at the fake relay
+func (srv *fakeSMTPServer) config(tlsMode, authMethod string) *config.SMTPConfig {
+	host, port, _ := net.SplitHostPort(srv.listener.Addr().String())
+	portNum, _ := net.LookupPort("tcp", port)
+	return &config.SMTPConfig{
+		Host:               host,
+		Port:               portNum,
+		Username:           srv.username,
+		Password:           srv.password,
+		TLSMode:            tlsMode,
+		AuthMethod:         authMethod,
+		InsecureSkipVerify: true, // The fake relay's certificate is self-signed
+		Timeout:            5 * time.Second,
+	}
+}
+
+// lastSession returns the most recent session that delivered a message
+func (srv *fakeSMTPServer) lastSession() *fakeSMTPSession {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if len(srv.sessions) == 0 {
+		return nil
+	}
+	return srv.sessions[len(srv.sessions)-1]
+}
+
+func (srv *fakeSMTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	session := &fakeSMTPSession{TLS: srv.implicit}
+	tp := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) {
+		tp.PrintfLine(format, args...)
+	}
+
+	reply("220 fake.test ESMTP ready")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			lines := []string{"fake.test greets you"}
+			if srv.startTLS && !session.TLS {
+				lines = append(lines, "STARTTLS")
+			}
+			if len(srv.mechanisms) > 0 {
+				lines = append(lines, "AUTH "+strings.Join(srv.mechanisms, " "))
+			}
+			for i, l := range lines {
+				sep := "-"
+				if i == len(lines)-1 {
+					sep = " "
+				}
+				reply("250%s%s", sep, l)
+			}
+		case "STARTTLS":
+			reply("220 go ahead")
+			tlsConn := tls.Server(conn, srv.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn = tlsConn
+			tp = textproto.NewConn(conn)
+			session.TLS = true
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if srv.authenticate(tp, strings.ToUpper(mechanism), initial) {
+				session.Mechanism = strings.ToUpper(mechanism)
+				reply("235 authenticated")
+			} else {
+				reply("535 authentication failed")
+			}
+		case "MAIL":
+			session.From = strings.TrimSuffix(strings.TrimPrefix(arg, "FROM:<"), ">")
+			reply("250 ok")
+		case "RCPT":
+			session.To = append(session.To, strings.TrimSuffix(strings.TrimPrefix(arg, "TO:<"), ">"))
+			reply("250 ok")
+		case "DATA":
+			reply("354 end with .")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			session.Data = strings.Join(lines, "\n")
+			srv.mu.Lock()
+			srv.sessions = append(srv.sessions, session)
+			srv.mu.Unlock()
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 unknown command")
+		}
+	}
+}
+
+// authenticate runs an AUTH PLAIN or AUTH LOGIN exchange
+func (srv *fakeSMTPServer) authenticate(tp *textproto.Conn, mechanism, initial string) bool {
+	challenge := func(prompt string) (string, bool) {
+		tp.PrintfLine("334 %s", base64.StdEncoding.EncodeToString([]byte(prompt)))
+		line, err := tp.ReadLine()
+		if err != nil {
+			return "", false
+		}
+		decoded, err := base64.StdEncoding.DecodeString(line)
+		return string(decoded), err == nil
+	}
+
+	switch mechanism {
+	case "PLAIN":
+		var response string
+		if initial != "" {
+			decoded, err := base64.StdEncoding.DecodeString(initial)
+			if err != nil {
+				return false
+			}
+			response = string(decoded)
+		} else {
+			var ok bool
+			if response, ok = challenge(""); !ok {
+				return false
+			}
+		}
+		parts := strings.Split(response, "\x00")
+		return len(parts) == 3 && parts[1] == srv.username && parts[2] == srv.password
+	case "LOGIN":
+		username, ok := challenge("Username:")
+		if !ok {
+			return false
+		}
+		password, ok := challenge("Password:")
+		return ok && username == srv.username && password == srv.password
+	}
+	return false
+}
+
+// selfSignedTLSConfig returns a server TLS configuration with a throwaway certificate for 127.0.0.1
+func selfSignedTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake.test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}
+}
+
+func TestSMTPSenderDelivers(t *testing.T) {
+	tests := []struct {
+		name          string
+		implicit      bool
+		startTLS      bool
+		mechanisms    []string
+		tlsMode       string
+		authMethod    string
+		wantTLS       bool
+		wantMechanism string
+	}{
+		{"none with PLAIN", false, false, []string{"PLAIN", "LOGIN"}, "none", "plain", false, "PLAIN"},
+		{"none with LOGIN", false, false, []string{"PLAIN", "LOGIN"}, "none", "login", false, "LOGIN"},
+		{"STARTTLS with PLAIN", false, true, []string{"PLAIN", "LOGIN"}, "starttls", "plain", true, "PLAIN"},
+		{"STARTTLS with LOGIN", false, true, []string{"PLAIN", "LOGIN"}, "starttls", "login", true, "LOGIN"},
+		{"implicit TLS with PLAIN", true, false, []string{"PLAIN", "LOGIN"}, "tls", "plain", true, "PLAIN"},
+		{"implicit TLS with LOGIN", true, false, []string{"PLAIN", "LOGIN"}, "tls", "login", true, "LOGIN"},
+		{"automatic prefers PLAIN", false, true, []string{"LOGIN", "PLAIN"}, "starttls", "", true, "PLAIN"},
+		{"automatic falls back to LOGIN", true, false, []string{"LOGIN"}, "tls", "", true, "LOGIN"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSMTPServer(t, tt.implicit, tt.startTLS, tt.mechanisms...)
+			sender, err := NewSMTPSender(srv.config(tt.tlsMode, tt.authMethod), "SREootb <noreply@example.com>")
+			if err != nil {
+				t.Fatalf("NewSMTPSender: %v", err)
+			}
+
+			err = sender.Send(&EmailMessage{
+				To:       "Jane <jane@example.com>",
+				Subject:  "Password reset",
+				TextBody: "Reset your password",
+				HTMLBody: "<p>Reset your password</p>",
+			})
+			if err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+
+			session := srv.lastSession()
+			if session == nil {
+				t.Fatal("no message delivered")
+			}
+			if session.TLS != tt.wantTLS {
+				t.Errorf("TLS = %v, want %v", session.TLS, tt.wantTLS)
+			}
+			if session.Mechanism != tt.wantMechanism {
+				t.Errorf("mechanism = %q, want %q", session.Mechanism, tt.wantMechanism)
+			}
+			if session.From != "noreply@example.com" {
+				t.Errorf("MAIL FROM = %q", session.From)
+			}
+			if len(session.To) != 1 || session.To[0] != "jane@example.com" {
+				t.Errorf("RCPT TO = %q", session.To)
+			}
+			for _, want := range []string{"Subject: Password reset", "multipart/alternative", "<p>Reset your password</p>"} {
+				if !strings.Contains(session.Data, want) {
+					t.Errorf("message does not contain %q:\n%s", want, session.Data)
+				}
+			}
+		})
+	}
+}
+
+func TestSMTPSenderWithoutAuth(t *testing.T) {
+	srv := newFakeSMTPServer(t, false, false)
+	cfg := srv.config("none", "")
+	cfg.Username, cfg.Password = "", ""
+
+	sender, err := NewSMTPSender(cfg, "noreply@example.com")
+	if err != nil {
+		t.Fatalf("NewSMTPSender: %v", err)
+	}
+	if err := sender.Send(&EmailMessage{To: "jane@example.com", Subject: "Hi", TextBody: "Hello"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	session := srv.lastSession()
+	if session == nil {
+		t.Fatal("no message delivered")
+	}
+	if session.Mechanism != "" {
+		t.Errorf("authenticated with %q, want no authentication", session.Mechanism)
+	}
+	if !strings.Contains(session.Data, "Content-Type: text/plain") {
+		t.Errorf("expected a plain text message:\n%s", session.Data)
+	}
+}
+
+func TestSMTPSenderFailures(t *testing.T) {
+	t.Run("STARTTLS not offered", func(t *testing.T) {
+		srv := newFakeSMTPServer(t, false, false, "PLAIN")
+		sender, _ := NewSMTPSender(srv.config("starttls", ""), "noreply@example.com")
+		err := sender.Send(&EmailMessage{To: "jane@example.com", Subject: "Hi", TextBody: "Hello"})
+		if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+			t.Fatalf("err = %v, want a STARTTLS error", err)
+		}
+	})
+
+	t.Run("wrong password", func(t *testing.T) {
+		srv := newFakeSMTPServer(t, true, false, "PLAIN", "LOGIN")
+		cfg := srv.config("tls", "login")
+		cfg.Password = "wrong"
+		sender, _ := NewSMTPSender(cfg, "noreply@example.com")
+		err := sender.Send(&EmailMessage{To: "jane@example.com", Subject: "Hi", TextBody: "Hello"})
+		if err == nil || !strings.Contains(err.Error(), "authentication failed") {
+			t.Fatalf("err = %v, want an authentication error", err)
+		}
+		if srv.lastSession() != nil {
+			t.Error("message delivered despite failed authentication")
+		}
+	})
+
+	t.Run("no AUTH advertised", func(t *testing.T) {
+		srv := newFakeSMTPServer(t, true, false)
+		sender, _ := NewSMTPSender(srv.config("tls", ""), "noreply@example.com")
+		err := sender.Send(&EmailMessage{To: "jane@example.com", Subject: "Hi", TextBody: "Hello"})
+		if err == nil || !strings.Contains(err.Error(), "does not support authentication") {
+			t.Fatalf("err = %v, want an unsupported authentication error", err)
+		}
+	})
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+const (
+	maxTCPResponseSize  = 64 << 10 // Bytes read while waiting for an expected response
+	maxTCPResponseShown = 256      // Bytes of the response kept in results
+)
+
+// TCPCheckResult describes a tcp:// check; timings are in milliseconds
+type TCPCheckResult struct {
+	RemoteAddr     string         `json:"remote_addr,omitempty"`
+	ConnectMs      float64        `json:"connect_ms"`
+	TLSHandshakeMs *float64       `json:"tls_handshake_ms,omitempty"`
+	ResponseMs     *float64       `json:"response_ms,omitempty"` // Until the expected response arrived
+	Response       string         `json:"response,omitempty"`    // Start of what the server sent
+	TLS            *TLSInspection `json:"tls,omitempty"`
+}
+
+// CheckTCP connects to address ("host:port" or "[ipv6]:port") and runs the
+// optional TLS handshake, send and expect steps of cfg (which may be nil). The
+// error names the step that failed; the result holds whatever was measured.
+func CheckTCP(ctx context.Context, address string, cfg *models.TCPCheckConfig, tlsCfg *models.TLSCheckConfig) (*TCPCheckResult, error) {
+	result := &TCPCheckResult{}
+
+	var expect *regexp.Regexp
+	if cfg != nil && cfg.ExpectRegex != "" {
+		var err error
+		if expect, err = regexp.Compile(cfg.ExpectRegex); err != nil {
+			return result, fmt.Errorf("invalid expect_regex: %w", err)
+		}
+	}
+
+	dialer := &net.Dialer{}
+	start := time.Now()
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	result.ConnectMs = milliseconds(time.Since(start))
+	if err != nil {
+		return result, fmt.Errorf("connect failed: %w", err)
+	}
+	defer conn.Close()
+	result.RemoteAddr = conn.RemoteAddr().String()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if cfg != nil && cfg.TLS {
+		serverName := cfg.ServerName
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(address)
+		}
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: serverName})
+		start = time.Now()
+		err := tlsConn.HandshakeContext(ctx)
+		handshake := milliseconds(time.Since(start))
+		result.TLSHandshakeMs = &handshake
+		if err != nil {
+			result.TLS = InspectTLSError(err)
+			return result, fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		state := tlsConn.ConnectionState()
+		result.TLS = InspectTLSState(&state, tlsCfg, time.Now())
+		conn = tlsConn
+	}
+
+	start = time.Now()
+	if cfg != nil && cfg.Send != "" {
+		if _, err := conn.Write([]byte(cfg.Send)); err != nil {
+			return result, fmt.Errorf("send failed: %w", err)
+		}
+	}
+
+	if !cfg.ExpectsResponse() {
+		return result, nil
+	}
+
+	var received []byte
+	buf := make([]byte, 4096)
+	for {
+		n, readErr := conn.Read(buf)
+		received = append(received, buf[:n]...)
+		result.Response = printableResponse(received)
+
+		matched := (cfg.Expect == "" || bytes.Contains(received, []byte(cfg.Expect))) &&
+			(expect == nil || expect.Match(received))
+		if matched {
+			elapsed := milliseconds(time.Since(start))
+			result.ResponseMs = &elapsed
+			return result, nil
+		}
+
+		if readErr != nil || len(received) >= maxTCPResponseSize {
+			var netErr net.Error
+			switch {
+			case errors.As(readErr, &netErr) && netErr.Timeout():
+				return result, fmt.Errorf("timed out waiting for the expected response")
+			case len(received) == 0:
+				return result, fmt.Errorf("connection closed without a response")
+			}
+			return result, fmt.Errorf("response did not match the expected content")
+		}
+	}
+}
+
+// printableResponse trims a response for display in results
+func printableResponse(data []byte) string {
+	if len(data) > maxTCPResponseShown {
+		data = data[:maxTCPResponseShown]
+	}
+	return strings.ToValidUTF8(string(data), "�")
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Nanoseconds()) / 1e6
+}
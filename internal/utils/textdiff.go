@@ -0,0 +1,219 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	diffContextLines = 3        // Unchanged lines shown around each change
+	maxDiffEdits     = 1000     // Edits searched for before falling back to replacing everything
+	maxDiffSize      = 64 << 10 // Bytes of diff kept
+)
+
+// diffOp is one line of an edit script: ' ' kept, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	text string
+}
+
+// UnifiedDiff compares two texts line by line and returns a unified diff
+// with three lines of context, or "" when they are equal. Very large diffs
+// are cut short.
+func UnifiedDiff(previous, current string) string {
+	if previous == current {
+		return ""
+	}
+	ops := diffLines(splitDiffLines(previous), splitDiffLines(current))
+
+	var out strings.Builder
+	out.WriteString("--- previous\n+++ current\n")
+	writeDiffHunks(&out, ops)
+
+	diff := out.String()
+	if len(diff) > maxDiffSize {
+		diff = strings.ToValidUTF8(diff[:maxDiffSize], "") + "\n... diff truncated\n"
+	}
+	return diff
+}
+
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// diffLines finds a shortest edit script from a to b with Myers' algorithm,
+// after setting aside the lines both start and end with
+func diffLines(a, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	ops = append(ops, myersDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops
+}
+
+// myersDiff returns the edit script from a to b, or one replacing all of a
+// when it would take more than maxDiffEdits edits
+func myersDiff(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	maxD := n + m
+	if maxD > maxDiffEdits {
+		maxD = maxDiffEdits
+	}
+
+	// v[offset+k] is the furthest x reached on diagonal k; trace[d] keeps the
+	// diagonals -d-1..d+1 as they were before step d, for backtracking
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+	for d := 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackMyers(trace, a, b)
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	for _, line := range a {
+		ops = append(ops, diffOp{'-', line})
+	}
+	for _, line := range b {
+		ops = append(ops, diffOp{'+', line})
+	}
+	return ops
+}
+
+// backtrackMyers walks the trace of myersDiff back from the end of both inputs
+func backtrackMyers(trace [][]int, a, b []string) []diffOp {
+	var reversed []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int { return v[k+d+1] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, diffOp{' ', a[x-1]})
+			x--
+			y--
+		}
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, diffOp{'+', b[prevY]})
+			} else {
+				reversed = append(reversed, diffOp{'-', a[prevX]})
+			}
+		}
+		x, y = prevX, prevY
+	}
+
+	ops := make([]diffOp, len(reversed))
+	for i, op := range reversed {
+		ops[len(ops)-1-i] = op
+	}
+	return ops
+}
+
+// writeDiffHunks writes the changes of an edit script as unified diff hunks
+func writeDiffHunks(out *strings.Builder, ops []diffOp) {
+	// Line numbers before each op, 0-based
+	oldLine := make([]int, len(ops)+1)
+	newLine := make([]int, len(ops)+1)
+	for i, op := range ops {
+		oldLine[i+1], newLine[i+1] = oldLine[i], newLine[i]
+		if op.kind != '+' {
+			oldLine[i+1]++
+		}
+		if op.kind != '-' {
+			newLine[i+1]++
+		}
+	}
+
+	shown := 0
+	for i := 0; i < len(ops); {
+		for i < len(ops) && ops[i].kind == ' ' {
+			i++
+		}
+		if i == len(ops) {
+			break
+		}
+
+		// Changes closer than twice the context share a hunk
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContextLines {
+				break
+			}
+			end = next
+		}
+
+		start := max(i-diffContextLines, shown)
+		stop := min(end+diffContextLines, len(ops))
+		fmt.Fprintf(out, "@@ -%s +%s @@\n",
+			hunkRange(oldLine[start], oldLine[stop]-oldLine[start]),
+			hunkRange(newLine[start], newLine[stop]-newLine[start]))
+		for _, op := range ops[start:stop] {
+			out.WriteByte(op.kind)
+			out.WriteString(op.text)
+			out.WriteByte('\n')
+		}
+		shown, i = stop, stop
+	}
+}
+
+// hunkRange formats the start and length of one side of a hunk
+func hunkRange(before, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", before)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", before+1)
+	}
+	return fmt.Sprintf("%d,%d", before+1, count)
+}
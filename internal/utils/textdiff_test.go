@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+// letterLines returns n lines "a", "b", "c" and so on
+func letterLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = string(rune('a' + i))
+	}
+	return lines
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	lines := letterLines(20)
+	changed := func(replacements map[int]string) string {
+		out := append([]string(nil), lines...)
+		for i, line := range replacements {
+			out[i] = line
+		}
+		return strings.Join(out, "\n")
+	}
+	original := strings.Join(lines, "\n")
+
+	tests := []struct {
+		name     string
+		previous string
+		current  string
+		want     string
+	}{
+		{"equal", "same\ntext", "same\ntext", ""},
+		{"changed line", "a\nb\nc", "a\nB\nc", "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"appended line", "a\nb\nc", "a\nb\nc\nd", "@@ -1,3 +1,4 @@\n a\n b\n c\n+d\n"},
+		{"from empty", "", "one\ntwo", "@@ -0,0 +1,2 @@\n+one\n+two\n"},
+		{"to empty", "one\ntwo", "", "@@ -1,2 +0,0 @@\n-one\n-two\n"},
+		{"single line", "old", "new", "@@ -1 +1 @@\n-old\n+new\n"},
+		{
+			"distant changes get separate hunks",
+			original, changed(map[int]string{1: "X", 18: "Y"}),
+			"@@ -1,5 +1,5 @@\n a\n-b\n+X\n c\n d\n e\n" +
+				"@@ -16,5 +16,5 @@\n p\n q\n r\n-s\n+Y\n t\n",
+		},
+		{
+			"close changes share a hunk",
+			original, changed(map[int]string{2: "X", 8: "Y"}),
+			"@@ -1,12 +1,12 @@\n a\n b\n-c\n+X\n d\n e\n f\n g\n h\n-i\n+Y\n j\n k\n l\n",
+		},
+		{
+			"inserted and removed lines",
+			"keep\nremove me\nkeep too", "keep\nkeep too\nadded",
+			"@@ -1,3 +1,3 @@\n keep\n-remove me\n keep too\n+added\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := UnifiedDiff(tt.previous, tt.current)
+			if tt.want != "" {
+				tt.want = "--- previous\n+++ current\n" + tt.want
+			}
+			if got != tt.want {
+				t.Errorf("UnifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnifiedDiffLargeInputs(t *testing.T) {
+	// Past maxDiffEdits every line is replaced rather than searched for a shorter script
+	previous := make([]string, maxDiffEdits)
+	current := make([]string, maxDiffEdits)
+	for i := range previous {
+		previous[i] = "old " + strings.Repeat("o", i%7)
+		current[i] = "new " + strings.Repeat("n", i%7)
+	}
+	diff := UnifiedDiff(strings.Join(previous, "\n"), strings.Join(current, "\n"))
+	if !strings.HasPrefix(diff, "--- previous\n+++ current\n@@ -1,1000 +1,1000 @@\n-old \n") {
+		t.Errorf("diff starts %q", diff[:min(len(diff), 80)])
+	}
+
+	// Very large diffs are cut short
+	huge := strings.Repeat("line of text that keeps going\n", maxDiffSize/10)
+	diff = UnifiedDiff("", huge)
+	if len(diff) > maxDiffSize+len("\n... diff truncated\n") || !strings.HasSuffix(diff, "\n... diff truncated\n") {
+		t.Errorf("diff of %d bytes was not truncated to %d", len(diff), maxDiffSize)
+	}
+}
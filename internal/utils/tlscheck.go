@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// TLSCertificateInfo describes one certificate of a server's chain
+type TLSCertificateInfo struct {
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	SANs      []string  `json:"sans,omitempty"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	KeyType   string    `json:"key_type"`
+	Serial    string    `json:"serial"`
+}
+
+// TLSInspection is the result of checking a server's certificate chain
+type TLSInspection struct {
+	Status           string               `json:"status"` // "up", "degraded" or "down"
+	Problems         []string             `json:"problems,omitempty"`
+	Version          string               `json:"version,omitempty"`
+	CipherSuite      string               `json:"cipher_suite,omitempty"`
+	HostnameVerified bool                 `json:"hostname_verified"`
+	ChainVerified    bool                 `json:"chain_verified"`
+	ChainComplete    bool                 `json:"chain_complete"` // The server sent every intermediate itself
+	OCSPStapled      bool                 `json:"ocsp_stapled"`
+	ExpiresAt        *time.Time           `json:"expires_at,omitempty"` // Earliest expiry in the chain
+	DaysRemaining    *int                 `json:"days_remaining,omitempty"`
+	Chain            []TLSCertificateInfo `json:"chain"` // As sent by the server, leaf first
+}
+
+// InspectTLSState checks the connection state of a verified TLS handshake
+// against the expiry windows of cfg (which may be nil)
+func InspectTLSState(state *tls.ConnectionState, cfg *models.TLSCheckConfig, now time.Time) *TLSInspection {
+	inspection := &TLSInspection{
+		Status:           "up",
+		Version:          tls.VersionName(state.Version),
+		CipherSuite:      tls.CipherSuiteName(state.CipherSuite),
+		HostnameVerified: true,
+		ChainComplete:    true,
+		OCSPStapled:      len(state.OCSPResponse) > 0,
+		Chain:            describeChain(state.PeerCertificates),
+	}
+
+	if len(state.VerifiedChains) == 0 {
+		// Verification was skipped, so nothing is known to be trustworthy
+		inspection.HostnameVerified = false
+		inspection.ChainComplete = false
+		inspection.fail("down", "certificate chain was not verified")
+		return inspection
+	}
+	inspection.ChainVerified = true
+
+	verified := state.VerifiedChains[0]
+	for i, cert := range verified {
+		// The leaf is always sent and the root comes from the trust store
+		if i == 0 || i == len(verified)-1 {
+			continue
+		}
+		if !containsCertificate(state.PeerCertificates, cert) {
+			inspection.ChainComplete = false
+			inspection.fail("degraded", fmt.Sprintf("incomplete chain: server did not send intermediate %q", cert.Subject.CommonName))
+		}
+	}
+
+	expiresAt := verified[0].NotAfter
+	for _, cert := range verified[1:] {
+		if cert.NotAfter.Before(expiresAt) {
+			expiresAt = cert.NotAfter
+		}
+	}
+	remaining := expiresAt.Sub(now)
+	days := int(math.Floor(remaining.Hours() / 24))
+	inspection.ExpiresAt = &expiresAt
+	inspection.DaysRemaining = &days
+
+	warning, critical := cfg.ExpiryWindows()
+	switch {
+	case remaining <= critical:
+		inspection.fail("down", fmt.Sprintf("certificate expires in %d days (critical at %d)", days, int(critical.Hours()/24)))
+	case remaining <= warning:
+		inspection.fail("degraded", fmt.Sprintf("certificate expires in %d days (warning at %d)", days, int(warning.Hours()/24)))
+	}
+
+	return inspection
+}
+
+// InspectTLSError describes a failed certificate verification, or returns nil
+// when err is not one. The unverified chain is still reported.
+func InspectTLSError(err error) *TLSInspection {
+	var verifyErr *tls.CertificateVerificationError
+	if !errors.As(err, &verifyErr) {
+		return nil
+	}
+
+	certs := verifyErr.UnverifiedCertificates
+	inspection := &TLSInspection{
+		Status:           "up",
+		HostnameVerified: true,
+		ChainComplete:    true,
+		Chain:            describeChain(certs),
+	}
+
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(verifyErr.Err, &hostnameErr):
+		inspection.HostnameVerified = false
+		inspection.fail("down", fmt.Sprintf("hostname verification failed: %v", hostnameErr))
+	case errors.As(verifyErr.Err, &authorityErr):
+		if len(certs) > 0 && isSelfSigned(certs[0]) {
+			inspection.fail("down", "self-signed certificate")
+		} else {
+			inspection.ChainComplete = false
+			inspection.fail("down", "incomplete or untrusted chain: no trusted issuer for "+chainTop(certs))
+		}
+	case errors.As(verifyErr.Err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		// Validity is checked before the hostname and the chain
+		inspection.HostnameVerified = false
+		inspection.fail("down", fmt.Sprintf("certificate expired or not yet valid: %v", invalidErr))
+	default:
+		inspection.HostnameVerified = false
+		inspection.fail("down", fmt.Sprintf("certificate verification failed: %v", verifyErr.Err))
+	}
+
+	return inspection
+}
+
+// fail records a problem, keeping the worst status seen
+func (i *TLSInspection) fail(status, problem string) {
+	i.Problems = append(i.Problems, problem)
+	if status == "down" || i.Status == "up" {
+		i.Status = status
+	}
+}
+
+func describeChain(certs []*x509.Certificate) []TLSCertificateInfo {
+	chain := make([]TLSCertificateInfo, 0, len(certs))
+	for _, cert := range certs {
+		sans := append([]string{}, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		chain = append(chain, TLSCertificateInfo{
+			Subject:   cert.Subject.String(),
+			Issuer:    cert.Issuer.String(),
+			SANs:      sans,
+			NotBefore: cert.NotBefore,
+			NotAfter:  cert.NotAfter,
+			KeyType:   certificateKeyType(cert),
+			Serial:    cert.SerialNumber.Text(16),
+		})
+	}
+	return chain
+}
+
+// certificateKeyType names a certificate's public key, e.g. "RSA-2048" or "ECDSA-P-256"
+func certificateKeyType(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + key.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if bytes.Equal(c.Raw, cert.Raw) {
+			return true
+		}
+	}
+	return false
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(cert) == nil
+}
+
+// chainTop quotes the issuer of the last certificate the server sent
+func chainTop(certs []*x509.Certificate) string {
+	if len(certs) == 0 {
+		return "an empty chain"
+	}
+	return fmt.Sprintf("%q", certs[len(certs)-1].Issuer.CommonName)
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/cookiejar"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// TransactionStepResult describes one step of a transaction check; times are in milliseconds
+type TransactionStepResult struct {
+	Step       int                   `json:"step"` // 1-based
+	Name       string                `json:"name,omitempty"`
+	Method     string                `json:"method"`
+	URL        string                `json:"url"` // As configured, before variables are replaced
+	Status     string                `json:"status"`
+	StatusCode *int                  `json:"status_code,omitempty"`
+	ResponseMs float64               `json:"response_ms"`
+	BodySize   int64                 `json:"body_size"`
+	Assertions []HTTPAssertionResult `json:"assertions,omitempty"`
+	Extracted  []string              `json:"extracted,omitempty"` // Names of the variables set; values may be secret
+	Error      string                `json:"error,omitempty"`
+}
+
+// TransactionResult describes a transaction check. Steps after the failing
+// one are not run and not listed.
+type TransactionResult struct {
+	Status     string                  `json:"status"` // "up", "degraded" or "down"
+	TotalMs    float64                 `json:"total_ms"`
+	FailedStep *int                    `json:"failed_step,omitempty"`
+	Steps      []TransactionStepResult `json:"steps"`
+	Message    string                  `json:"message,omitempty"` // Names the failing step
+}
+
+// RunTransaction runs the steps of cfg in order with a shared cookie jar and
+// stops at the first step that is down. Steps whose latency assertions fail
+// make the transaction degraded but do not stop it.
+func RunTransaction(ctx context.Context, cfg *models.TransactionCheckConfig, userAgent string) *TransactionResult {
+	result := &TransactionResult{Status: "up", Steps: []TransactionStepResult{}}
+	if cfg == nil || len(cfg.Steps) == 0 {
+		result.fail(0, "", "no steps configured")
+		return result
+	}
+
+	jar, _ := cookiejar.New(nil)
+	vars := make(map[string]string)
+	var degraded []string
+
+	start := time.Now()
+	for i := range cfg.Steps {
+		step := &cfg.Steps[i]
+		stepResult := runTransactionStep(ctx, step, i, vars, jar, userAgent)
+		result.Steps = append(result.Steps, stepResult)
+
+		if stepResult.Status == "down" {
+			result.fail(i, step.Name, stepResult.Error)
+			break
+		}
+		if stepResult.Status == "degraded" {
+			degraded = append(degraded, stepLabel(i, step.Name)+": "+stepResult.Error)
+		}
+	}
+	result.TotalMs = milliseconds(time.Since(start))
+
+	if result.Status == "up" && len(degraded) > 0 {
+		result.Status = "degraded"
+		result.Message = strings.Join(degraded, "; ")
+	}
+	return result
+}
+
+// fail marks the transaction down at step i (0-based)
+func (r *TransactionResult) fail(i int, name, message string) {
+	step := i + 1
+	r.Status = "down"
+	r.FailedStep = &step
+	r.Message = stepLabel(i, name) + ": " + message
+}
+
+func stepLabel(i int, name string) string {
+	if name != "" {
+		return fmt.Sprintf("Step %d (%s)", i+1, name)
+	}
+	return fmt.Sprintf("Step %d", i+1)
+}
+
+// runTransactionStep sends one step's request, judges the response and
+// extracts its variables into vars
+func runTransactionStep(ctx context.Context, step *models.TransactionStep, i int, vars map[string]string, jar http.CookieJar, userAgent string) TransactionStepResult {
+	url, stepConfig := step.Resolve(vars)
+	stepResult := TransactionStepResult{
+		Step:   i + 1,
+		Name:   step.Name,
+		Method: stepConfig.RequestMethod(),
+		URL:    step.URL,
+		Status: "up",
+	}
+
+	var timeout time.Duration
+	if stepConfig.Timeout != "" {
+		timeout, _ = time.ParseDuration(stepConfig.Timeout)
+	}
+	client := NewHTTPCheckClient(stepConfig, nil, timeout)
+	client.Jar = jar
+
+	req, err := NewHTTPCheckRequest(ctx, stepConfig, url, userAgent)
+	if err != nil {
+		stepResult.Status = "down"
+		stepResult.Error = fmt.Sprintf("failed to create request: %v", err)
+		return stepResult
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	duration := time.Since(start)
+	stepResult.ResponseMs = milliseconds(duration)
+	if err != nil {
+		stepResult.Status = "down"
+		stepResult.Error = fmt.Sprintf("request failed: %v", err)
+		return stepResult
+	}
+	defer resp.Body.Close()
+	stepResult.StatusCode = &resp.StatusCode
+
+	body, size, err := ReadAssertionBody(resp.Body)
+	stepResult.BodySize = size
+	if err != nil {
+		stepResult.Status = "down"
+		stepResult.Error = fmt.Sprintf("failed to read response body: %v", err)
+		return stepResult
+	}
+
+	if !stepConfig.AcceptsStatus(resp.StatusCode) {
+		stepResult.Status = "down"
+		stepResult.Error = fmt.Sprintf("HTTP %d", resp.StatusCode)
+		return stepResult
+	}
+
+	if len(stepConfig.Assertions) > 0 {
+		stepResult.Assertions = EvaluateHTTPAssertions(stepConfig.Assertions, resp.Header, body, size, duration)
+		var messages []string
+		degradedOnly := true
+		for _, assertion := range stepResult.Assertions {
+			if assertion.Passed {
+				continue
+			}
+			messages = append(messages, assertion.Message)
+			if !assertion.Degraded {
+				degradedOnly = false
+			}
+		}
+		if len(messages) > 0 {
+			stepResult.Status = "down"
+			if degradedOnly {
+				stepResult.Status = "degraded"
+			}
+			stepResult.Error = "assertion failed: " + strings.Join(messages, "; ")
+			if !degradedOnly {
+				return stepResult
+			}
+		}
+	}
+
+	for _, variable := range step.Extract {
+		value, err := extractTransactionVariable(variable, body)
+		if err != nil {
+			stepResult.Status = "down"
+			stepResult.Error = fmt.Sprintf("extract %s: %v", variable.Name, err)
+			return stepResult
+		}
+		vars[variable.Name] = value
+		stepResult.Extracted = append(stepResult.Extracted, variable.Name)
+	}
+
+	return stepResult
+}
+
+// extractTransactionVariable reads a variable's value from a response body
+func extractTransactionVariable(variable models.TransactionVariable, body []byte) (string, error) {
+	if variable.JSONPath != "" {
+		segments, err := models.ParseJSONPath(variable.JSONPath)
+		if err != nil {
+			return "", err
+		}
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err != nil {
+			return "", fmt.Errorf("body is not valid JSON: %v", err)
+		}
+		value, ok := lookupJSONPath(document, segments)
+		if !ok {
+			return "", fmt.Errorf("%s not found", variable.JSONPath)
+		}
+		return jsonValueString(value), nil
+	}
+
+	re, err := regexp.Compile(variable.Regex)
+	if err != nil {
+		return "", fmt.Errorf("invalid regex: %v", err)
+	}
+	match := re.FindSubmatch(body)
+	if match == nil {
+		return "", fmt.Errorf("body does not match /%s/", variable.Regex)
+	}
+	if len(match) > 1 {
+		return string(match[1]), nil
+	}
+	return string(match[0]), nil
+}
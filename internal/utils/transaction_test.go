@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// intValue returns *p, or 0 when p is nil
+func intValue(p *int) int {
+	if p == nil {
+		return 0
+	}
+	return *p
+}
+
+// newTransactionTestServer serves a login that sets a session cookie and
+// returns a token, an item endpoint that requires both, and a failing endpoint
+func newTransactionTestServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var itemHits atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: "s1", Path: "/"})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"token":"abc123","user":{"id":42}}`))
+	})
+	mux.HandleFunc("/items/42", func(w http.ResponseWriter, r *http.Request) {
+		itemHits.Add(1)
+		if cookie, err := r.Cookie("session"); err != nil || cookie.Value != "s1" {
+			http.Error(w, "no session", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer abc123" {
+			http.Error(w, "bad token", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("item 42"))
+	})
+	mux.HandleFunc("/fail", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &itemHits
+}
+
+func TestRunTransactionCarriesVariablesAndCookies(t *testing.T) {
+	server, _ := newTransactionTestServer(t)
+
+	cfg := &models.TransactionCheckConfig{Steps: []models.TransactionStep{
+		{
+			Name:            "login",
+			URL:             server.URL + "/login",
+			HTTPCheckConfig: models.HTTPCheckConfig{Method: http.MethodPost},
+			Extract: []models.TransactionVariable{
+				{Name: "token", JSONPath: "$.token"},
+				{Name: "user_id", Regex: `"id":(\d+)`},
+			},
+		},
+		{
+			Name: "item",
+			URL:  server.URL + "/items/{{user_id}}",
+			HTTPCheckConfig: models.HTTPCheckConfig{
+				Headers:    map[string]string{"Authorization": "Bearer {{token}}"},
+				Assertions: []models.HTTPAssertion{{Type: models.AssertBodyContains, Value: "item 42"}},
+			},
+		},
+	}}
+
+	result := RunTransaction(context.Background(), cfg, "sreootb-test")
+	if result.Status != "up" || result.FailedStep != nil {
+		t.Fatalf("transaction = %s at step %v: %s", result.Status, intValue(result.FailedStep), result.Message)
+	}
+	if len(result.Steps) != 2 {
+		t.Fatalf("ran %d steps, want 2", len(result.Steps))
+	}
+	if got := strings.Join(result.Steps[0].Extracted, ","); got != "token,user_id" {
+		t.Errorf("extracted %q, want token,user_id", got)
+	}
+	// Results list the URL as configured, without variable values
+	if result.Steps[1].URL != server.URL+"/items/{{user_id}}" {
+		t.Errorf("step URL = %s", result.Steps[1].URL)
+	}
+}
+
+func TestRunTransactionStopsAtFailingStep(t *testing.T) {
+	server, itemHits := newTransactionTestServer(t)
+
+	tests := []struct {
+		name        string
+		steps       []models.TransactionStep
+		wantSteps   int
+		wantCode    int
+		wantMessage string
+	}{
+		{
+			name: "error status",
+			steps: []models.TransactionStep{
+				{Name: "login", URL: server.URL + "/login", HTTPCheckConfig: models.HTTPCheckConfig{Method: http.MethodPost}},
+				{Name: "broken", URL: server.URL + "/fail"},
+				{Name: "item", URL: server.URL + "/items/42"},
+			},
+			wantSteps:   2,
+			wantCode:    http.StatusInternalServerError,
+			wantMessage: "Step 2 (broken): HTTP 500",
+		},
+		{
+			name: "missing variable",
+			steps: []models.TransactionStep{
+				{
+					URL:             server.URL + "/login",
+					HTTPCheckConfig: models.HTTPCheckConfig{Method: http.MethodPost},
+					Extract:         []models.TransactionVariable{{Name: "token", JSONPath: "$.access_token"}},
+				},
+				{Name: "item", URL: server.URL + "/items/42"},
+			},
+			wantSteps:   1,
+			wantCode:    http.StatusOK,
+			wantMessage: "Step 1: extract token: $.access_token not found",
+		},
+		{
+			name: "no cookie without the login",
+			steps: []models.TransactionStep{
+				{Name: "item", URL: server.URL + "/items/42"},
+			},
+			wantSteps:   1,
+			wantCode:    http.StatusUnauthorized,
+			wantMessage: "Step 1 (item): HTTP 401",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			itemHits.Store(0)
+			result := RunTransaction(context.Background(), &models.TransactionCheckConfig{Steps: tt.steps}, "sreootb-test")
+
+			if result.Status != "down" || result.FailedStep == nil || *result.FailedStep != tt.wantSteps {
+				t.Fatalf("transaction = %s at step %v, want down at step %d", result.Status, intValue(result.FailedStep), tt.wantSteps)
+			}
+			if len(result.Steps) != tt.wantSteps {
+				t.Errorf("ran %d steps, want %d", len(result.Steps), tt.wantSteps)
+			}
+			if code := intValue(result.Steps[len(result.Steps)-1].StatusCode); code != tt.wantCode {
+				t.Errorf("failing step status code = %d, want %d", code, tt.wantCode)
+			}
+			if result.Message != tt.wantMessage {
+				t.Errorf("message = %q, want %q", result.Message, tt.wantMessage)
+			}
+			if tt.wantSteps < len(tt.steps) && itemHits.Load() != 0 {
+				t.Error("steps after the failing one were run")
+			}
+		})
+	}
+}
+
+// A config without steps fails without listing any step
+func TestRunTransactionWithoutSteps(t *testing.T) {
+	for _, cfg := range []*models.TransactionCheckConfig{nil, {}} {
+		result := RunTransaction(context.Background(), cfg, "sreootb-test")
+		if result.Status != "down" || intValue(result.FailedStep) != 1 || len(result.Steps) != 0 {
+			t.Errorf("RunTransaction(%v) = %s at step %v with %d steps", cfg, result.Status, intValue(result.FailedStep), len(result.Steps))
+		}
+	}
+}
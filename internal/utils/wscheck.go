@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/x86txt/sreootb/internal/models"
+)
+
+// maxWebSocketMessageSize bounds each message read while waiting for a match
+const maxWebSocketMessageSize = 1 << 20
+
+// WebSocketCheckResult describes a ws:// or wss:// check; times are in milliseconds
+type WebSocketCheckResult struct {
+	StatusCode  *int           `json:"status_code,omitempty"`   // Of the upgrade response
+	HandshakeMs float64        `json:"handshake_ms"`            // Connect, TLS and upgrade
+	RoundTripMs *float64       `json:"round_trip_ms,omitempty"` // From sending until the expected message arrived
+	Subprotocol string         `json:"subprotocol,omitempty"`
+	Messages    int            `json:"messages"`           // Received while waiting
+	Response    string         `json:"response,omitempty"` // Start of the matching, or else the last, message
+	TLS         *TLSInspection `json:"tls,omitempty"`
+}
+
+// CheckWebSocket opens a WebSocket connection to rawURL and, when cfg (which
+// may be nil) asks for it, sends a message and waits for one that matches.
+// The error names the step that failed; the result holds whatever was
+// measured.
+func CheckWebSocket(ctx context.Context, rawURL string, cfg *models.WebSocketCheckConfig, tlsCfg *models.TLSCheckConfig, userAgent string) (*WebSocketCheckResult, error) {
+	result := &WebSocketCheckResult{}
+	if cfg == nil {
+		cfg = &models.WebSocketCheckConfig{}
+	}
+
+	matches, err := webSocketMatcher(cfg)
+	if err != nil {
+		return result, err
+	}
+
+	header := http.Header{}
+	header.Set("User-Agent", userAgent)
+	for _, headers := range []map[string]string{cfg.Headers, cfg.SecretHeaders} {
+		for name, value := range headers {
+			header.Set(name, value)
+		}
+	}
+
+	dialer := &websocket.Dialer{
+		Proxy:        http.ProxyFromEnvironment,
+		Subprotocols: cfg.Subprotocols,
+	}
+
+	start := time.Now()
+	conn, resp, err := dialer.DialContext(ctx, rawURL, header)
+	result.HandshakeMs = milliseconds(time.Since(start))
+	if resp != nil {
+		result.StatusCode = &resp.StatusCode
+		resp.Body.Close()
+	}
+	if err != nil {
+		if errors.Is(err, websocket.ErrBadHandshake) && resp != nil {
+			return result, fmt.Errorf("upgrade rejected with HTTP %d", resp.StatusCode)
+		}
+		result.TLS = InspectTLSError(err)
+		return result, fmt.Errorf("handshake failed: %w", err)
+	}
+	defer conn.Close()
+	result.Subprotocol = conn.Subprotocol()
+
+	if tlsConn, ok := conn.NetConn().(*tls.Conn); ok {
+		state := tlsConn.ConnectionState()
+		result.TLS = InspectTLSState(&state, tlsCfg, time.Now())
+	}
+
+	if !cfg.ExpectsMessage() {
+		closeWebSocket(conn)
+		return result, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetWriteDeadline(deadline)
+		conn.SetReadDeadline(deadline)
+	}
+	conn.SetReadLimit(maxWebSocketMessageSize)
+
+	start = time.Now()
+	if cfg.Send != "" {
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(cfg.Send)); err != nil {
+			return result, fmt.Errorf("send failed: %w", err)
+		}
+	}
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			var netErr net.Error
+			var closeErr *websocket.CloseError
+			switch {
+			case errors.As(err, &netErr) && netErr.Timeout():
+				return result, fmt.Errorf("timed out waiting for a matching message (%d received)", result.Messages)
+			case errors.As(err, &closeErr):
+				return result, fmt.Errorf("server closed the connection before a matching message: %d %s", closeErr.Code, closeErr.Text)
+			}
+			return result, fmt.Errorf("read failed: %w", err)
+		}
+
+		result.Messages++
+		result.Response = printableResponse(message)
+		if matches(message) {
+			roundTrip := milliseconds(time.Since(start))
+			result.RoundTripMs = &roundTrip
+			closeWebSocket(conn)
+			return result, nil
+		}
+	}
+}
+
+// webSocketMatcher returns whether a message satisfies every expectation of cfg
+func webSocketMatcher(cfg *models.WebSocketCheckConfig) (func([]byte) bool, error) {
+	var expect *regexp.Regexp
+	if cfg.ExpectRegex != "" {
+		var err error
+		if expect, err = regexp.Compile(cfg.ExpectRegex); err != nil {
+			return nil, fmt.Errorf("invalid expect_regex: %w", err)
+		}
+	}
+
+	var segments []string
+	if cfg.JSONPath != "" {
+		var err error
+		if segments, err = models.ParseJSONPath(cfg.JSONPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return func(message []byte) bool {
+		if expect != nil && !expect.Match(message) {
+			return false
+		}
+		if cfg.JSONPath == "" {
+			return true
+		}
+
+		var document interface{}
+		decoder := json.NewDecoder(bytes.NewReader(message))
+		decoder.UseNumber()
+		if err := decoder.Decode(&document); err != nil {
+			return false
+		}
+		value, ok := lookupJSONPath(document, segments)
+		return ok && (cfg.JSONValue == nil || jsonValueString(value) == *cfg.JSONValue)
+	}, nil
+}
+
+// closeWebSocket says goodbye so the server does not log an abnormal closure
+func closeWebSocket(conn *websocket.Conn) {
+	conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+}